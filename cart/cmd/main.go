@@ -4,6 +4,8 @@ import (
 	"e-commerce-backend/cart/dbs"
 	"e-commerce-backend/cart/internal/handlers"
 	"e-commerce-backend/cart/internal/models"
+	"e-commerce-backend/cart/internal/services"
+	"e-commerce-backend/cart/pkg/constants"
 	"e-commerce-backend/shared/utils"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
@@ -19,6 +21,8 @@ func main() {
 	defer dbs.CloseDB()
 
 	InitSchemas()
+	services.StartWishlistWatcher(dbs.DB, constants.WishlistCheckEvery)
+	services.StartAbandonedCartJob(dbs.DB, constants.AbandonedCartCheckEvery)
 
 	r := mux.NewRouter()
 	//r.Use(middlewares.AuthMiddleware)
@@ -29,7 +33,7 @@ func main() {
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"X-Requested-With", "Content-Type", "Authorization"},
+		AllowedHeaders: []string{"X-Requested-With", "Content-Type", "Authorization", utils.CartTokenHeader},
 	})
 
 	handlers.CartHandler(r)
@@ -49,5 +53,11 @@ func main() {
 }
 
 func InitSchemas() {
+	models.InitCartHeaderSchema()
 	models.InitCartSchema()
+	models.InitCartCheckoutSchema()
+	models.InitWishlistSchema()
+	models.InitCartReminderSchema()
+	models.InitCartShareSchema()
+	models.InitQuoteSchema()
 }
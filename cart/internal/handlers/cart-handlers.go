@@ -3,6 +3,7 @@ package handlers
 import (
 	"e-commerce-backend/cart/dbs"
 	"e-commerce-backend/cart/internal/services"
+	"e-commerce-backend/cart/pkg/constants"
 	"e-commerce-backend/shared/middlewares"
 	"net/http"
 
@@ -12,11 +13,44 @@ import (
 func CartHandler(r *mux.Router) {
 	cartService := services.NewService(dbs.DB)
 
-	r.Handle("/user/cart", middlewares.AuthMiddleware(http.HandlerFunc(cartService.GetCartItemByUserID))).Methods("GET")
-	r.Handle("/user/cart/add", middlewares.AuthMiddleware(http.HandlerFunc(cartService.AddToCart))).Methods("POST")
-	r.Handle("/user/cart/{id}/update/qty", middlewares.AuthMiddleware(http.HandlerFunc(cartService.UpdateCartQty))).Methods("POST")
-	r.Handle("/user/cart/{id}/delete", middlewares.AuthMiddleware(http.HandlerFunc(cartService.DeleteCartByCartId))).Methods("DELETE")
+	r.Handle("/user/cart", middlewares.GuestOrAuthMiddleware(http.HandlerFunc(cartService.GetCartItemByUserID))).Methods("GET")
+	r.HandleFunc("/user/cart/guest", cartService.CreateGuestCart).Methods("POST")
+	r.Handle("/user/cart/merge", middlewares.AuthMiddleware(http.HandlerFunc(cartService.MergeGuestCart))).Methods("POST")
+	r.Handle("/user/cart/details", middlewares.AuthMiddleware(http.HandlerFunc(cartService.UpdateCartDetails))).Methods("PUT")
+	r.Handle("/user/cart/validate", middlewares.GuestOrAuthMiddleware(http.HandlerFunc(cartService.ValidateCartLines))).Methods("POST")
+	r.Handle("/user/cart/acknowledge", middlewares.GuestOrAuthMiddleware(http.HandlerFunc(cartService.AcknowledgeCartChanges))).Methods("POST")
+	r.Handle("/user/cart/add", middlewares.GuestOrAuthMiddleware(http.HandlerFunc(cartService.AddToCart))).Methods("POST")
+	r.Handle("/user/cart/{id}/update/qty", middlewares.GuestOrAuthMiddleware(http.HandlerFunc(cartService.UpdateCartQty))).Methods("POST")
+	r.Handle("/user/cart/{id}/delete", middlewares.GuestOrAuthMiddleware(http.HandlerFunc(cartService.DeleteCartByCartId))).Methods("DELETE")
 	r.Handle("/user/cart/{cart_id}/checkout", middlewares.AuthMiddleware(http.HandlerFunc(cartService.Checkout))).Methods("POST")
+	//sharing and quotes, registered before /user/cart/{cart_id} so "quotes" is not taken for an id
+	r.Handle("/user/cart/share", middlewares.AuthMiddleware(http.HandlerFunc(cartService.ShareCart))).Methods("POST")
+	r.HandleFunc("/cart/shared/{token}", cartService.GetSharedCart).Methods("GET")
+	r.Handle("/user/cart/shared/{token}/import", middlewares.GuestOrAuthMiddleware(http.HandlerFunc(cartService.ImportSharedCart))).Methods("POST")
+
+	quoteService := services.NewQuoteServices(dbs.DB)
+	r.Handle("/user/cart/quote", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, constants.QuoteCustomerRole)(http.HandlerFunc(quoteService.RequestQuote)))).Methods("POST")
+	r.Handle("/user/cart/quotes", middlewares.AuthMiddleware(http.HandlerFunc(quoteService.GetQuotes))).Methods("GET")
+	r.Handle("/user/cart/quotes/{id}", middlewares.AuthMiddleware(http.HandlerFunc(quoteService.GetQuote))).Methods("GET")
+	r.Handle("/user/cart/quotes/{id}/accept", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, constants.QuoteCustomerRole)(http.HandlerFunc(quoteService.AcceptQuote)))).Methods("POST")
+	r.Handle("/user/cart/quotes/{id}/reject", middlewares.AuthMiddleware(http.HandlerFunc(quoteService.RejectQuote))).Methods("POST")
+	r.Handle("/admin/quotes", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, constants.QuoteAdminRole)(http.HandlerFunc(quoteService.GetAllQuotes)))).Methods("GET")
+	r.Handle("/admin/quotes/{id}/price", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, constants.QuoteAdminRole)(http.HandlerFunc(quoteService.PriceQuote)))).Methods("PUT")
+
 	r.Handle("/user/cart/{cart_id}", middlewares.AuthMiddleware(http.HandlerFunc(cartService.GetCartByCartId))).Methods("GET")
-	r.Handle("/user/cart/clear", middlewares.AuthMiddleware(http.HandlerFunc(cartService.ClearCart))).Methods("DELETE")
+	r.Handle("/user/cart/clear", middlewares.GuestOrAuthMiddleware(http.HandlerFunc(cartService.ClearCart))).Methods("DELETE")
+
+	//save for later and wishlists
+	wishlistService := services.NewWishlistServices(dbs.DB)
+	r.Handle("/user/cart/{id}/save-for-later", middlewares.AuthMiddleware(http.HandlerFunc(wishlistService.SaveCartLineForLater))).Methods("POST")
+	r.Handle("/user/cart/{id}/move-to-wishlist", middlewares.AuthMiddleware(http.HandlerFunc(wishlistService.MoveCartLineToWishlist))).Methods("POST")
+	r.Handle("/user/wishlists", middlewares.AuthMiddleware(http.HandlerFunc(wishlistService.GetWishlists))).Methods("GET")
+	r.Handle("/user/wishlists", middlewares.AuthMiddleware(http.HandlerFunc(wishlistService.CreateWishlist))).Methods("POST")
+	r.Handle("/user/wishlists/{id}", middlewares.AuthMiddleware(http.HandlerFunc(wishlistService.GetWishlist))).Methods("GET")
+	r.Handle("/user/wishlists/{id}", middlewares.AuthMiddleware(http.HandlerFunc(wishlistService.UpdateWishlist))).Methods("PUT")
+	r.Handle("/user/wishlists/{id}", middlewares.AuthMiddleware(http.HandlerFunc(wishlistService.DeleteWishlist))).Methods("DELETE")
+	r.Handle("/user/wishlists/{id}/items", middlewares.AuthMiddleware(http.HandlerFunc(wishlistService.AddWishlistItem))).Methods("POST")
+	r.Handle("/user/wishlists/{id}/items/{item_id}", middlewares.AuthMiddleware(http.HandlerFunc(wishlistService.RemoveWishlistItem))).Methods("DELETE")
+	r.Handle("/user/wishlists/{id}/items/{item_id}/move-to-cart", middlewares.AuthMiddleware(http.HandlerFunc(wishlistService.MoveWishlistItemToCart))).Methods("POST")
+	r.HandleFunc("/wishlists/shared/{token}", wishlistService.GetSharedWishlist).Methods("GET")
 }
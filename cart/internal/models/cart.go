@@ -12,14 +12,20 @@ import (
 	"gorm.io/gorm"
 )
 
+// Cart is a single line of a CartHeader, one row per product, per variant or per bundle
 type Cart struct {
-	Id          int       `json:"id" gorm:"autoIncrement"`
-	UserId      int       `json:"user_id"`
-	ProductId   int       `json:"product_id"`
-	Quantity    int       `json:"quantity" default:"1"`
-	IsProcessed bool      `json:"is_processed" default:"false"`
-	CreatedAt   time.Time `json:"-" gorm:"type:datetime;default:CURRENT_TIMESTAMP"`
-	UpdatedAt   time.Time `json:"updated_at" gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
+	Id            int       `json:"id" gorm:"autoIncrement"`
+	CartHeaderId  int       `json:"cart_header_id" gorm:"default:0;index"`
+	UserId        int       `json:"user_id"`
+	ProductId     int       `json:"product_id"`
+	BundleId      int       `json:"bundle_id" gorm:"default:0;index"`  // set on bundle lines, ProductId is 0 then
+	VariantId     int       `json:"variant_id" gorm:"default:0;index"` // set on variant lines, ProductId is the product of the variant
+	Quantity      int       `json:"quantity" default:"1"`
+	AddedPrice    float64   `json:"added_price" gorm:"default:0"`    // unit price seen when the line was added or last acknowledged
+	AddedDiscount float64   `json:"added_discount" gorm:"default:0"` // discount percent seen with AddedPrice
+	IsProcessed   bool      `json:"is_processed" default:"false"`
+	CreatedAt     time.Time `json:"-" gorm:"type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
 }
 
 func InitCartSchema() {
@@ -29,19 +35,47 @@ func InitCartSchema() {
 	} else {
 		log.Printf(utils.SchemaMigrationSuccess, "Cart")
 	}
+
+	if err := MigrateCartLines(db); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "Cart lines", err)
+	}
 }
 
 func (c *Cart) NewCart() *Cart {
 	return &Cart{
-		UserId:      c.UserId,
-		ProductId:   c.ProductId,
-		Quantity:    c.Quantity,
-		IsProcessed: false,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		CartHeaderId:  c.CartHeaderId,
+		UserId:        c.UserId,
+		ProductId:     c.ProductId,
+		BundleId:      c.BundleId,
+		VariantId:     c.VariantId,
+		Quantity:      c.Quantity,
+		AddedPrice:    c.AddedPrice,
+		AddedDiscount: c.AddedDiscount,
+		IsProcessed:   false,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
 	}
 }
 
+// CartItemKey what a line holds, lines of one cart never share a key
+type CartItemKey struct {
+	ProductId int
+	VariantId int
+	BundleId  int
+}
+
+func (c *Cart) ItemKey() CartItemKey {
+	return CartItemKey{ProductId: c.ProductId, VariantId: c.VariantId, BundleId: c.BundleId}
+}
+
+func (c *Cart) IsBundle() bool {
+	return c.BundleId > 0
+}
+
+func (c *Cart) IsVariant() bool {
+	return c.VariantId > 0
+}
+
 var cartMutex sync.Mutex
 
 type CartService interface {
@@ -58,7 +92,7 @@ func (c *Cart) AddToCart(db *gorm.DB) (Cart, error) {
 	c.IsProcessed = false
 
 	var cart Cart
-	if err := db.First(&cart, "user_id =? and product_id =?", c.UserId, c.ProductId).Error; err != nil {
+	if err := db.First(&cart, "cart_header_id =? and product_id =? and variant_id =? and bundle_id =? and is_processed = false", c.CartHeaderId, c.ProductId, c.VariantId, c.BundleId).Error; err != nil {
 		if strings.EqualFold(err.Error(), gorm.ErrRecordNotFound.Error()) {
 			if c.Quantity == 0 {
 				c.Quantity = 1
@@ -73,11 +107,17 @@ func (c *Cart) AddToCart(db *gorm.DB) (Cart, error) {
 		return cart, err
 	}
 
-	if (cart.UserId == c.UserId) && (cart.ProductId == c.ProductId) {
+	if (cart.UserId == c.UserId) && (cart.ItemKey() == c.ItemKey()) {
 		cart.Quantity = cart.Quantity + c.Quantity
 		if err := cart.UpdateCart(db); err != nil {
 			return cart, err
 		}
+		//adding more of the product is done at the current price
+		if c.AddedPrice > 0 {
+			if err := cart.UpdateAddedPrice(db, c.AddedPrice, c.AddedDiscount); err != nil {
+				return cart, err
+			}
+		}
 		return cart, nil
 	}
 
@@ -94,6 +134,13 @@ func (c *Cart) UpdateCart(db *gorm.DB) error {
 	return nil
 }
 
+func (c *Cart) UpdateAddedPrice(db *gorm.DB, price, discount float64) error {
+	c.AddedPrice = price
+	c.AddedDiscount = discount
+	updatedFields := map[string]interface{}{"added_price": price, "added_discount": discount}
+	return db.Model(&Cart{}).Where("id = ?", c.Id).Updates(updatedFields).Error
+}
+
 func (c *Cart) GetCartByUserId(db *gorm.DB, userId int) ([]Cart, error) {
 	var cart []Cart
 	if err := db.Where("user_id =? and is_processed = false", userId).Find(&cart).Error; err != nil {
@@ -125,3 +172,33 @@ func (c *Cart) DeleteCartItem(db *gorm.DB) error {
 	}
 	return nil
 }
+
+// RevertQuantity takes back a quantity just added to the line, the line is removed if nothing is left
+func (c *Cart) RevertQuantity(db *gorm.DB, quantity int) error {
+	c.Quantity -= quantity
+	if c.Quantity <= 0 {
+		return c.DeleteCartItem(db)
+	}
+	return c.UpdateCart(db)
+}
+
+func DeleteCartItems(db *gorm.DB, carts []Cart) error {
+	if len(carts) == 0 {
+		return nil
+	}
+	var ids []int
+	for _, c := range carts {
+		ids = append(ids, c.Id)
+	}
+	return db.Where("id IN ? and is_processed = false", ids).Delete(&Cart{}).Error
+}
+
+// GetPurchasedQuantity sums what the user bought of the product since the given time, lines are processed once
+// their checkout is confirmed
+func GetPurchasedQuantity(db *gorm.DB, userId, productId int, since time.Time) (int, error) {
+	var purchased int
+	err := db.Model(&Cart{}).Select("COALESCE(SUM(quantity), 0)").
+		Where("user_id = ? and product_id = ? and bundle_id = 0 and is_processed = true and updated_at >= ?", userId, productId, since).
+		Scan(&purchased).Error
+	return purchased, err
+}
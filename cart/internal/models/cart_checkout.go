@@ -0,0 +1,106 @@
+package models
+
+import (
+	"e-commerce-backend/cart/dbs"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CheckoutStatusPending   = "pending"
+	CheckoutStatusConfirmed = "confirmed"
+	CheckoutStatusFailed    = "failed"
+)
+
+// CartCheckout snapshot of the cart lines handed to the order service, the lines are only marked processed
+// once the order service confirmed the order
+type CartCheckout struct {
+	Id            int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	CartHeaderId  int       `json:"cart_header_id" gorm:"not null;index"`
+	UserId        int       `json:"user_id" gorm:"not null;index"`
+	Lines         string    `json:"-" gorm:"type:text;not null"` // json snapshot of the cart lines
+	OrderId       int       `json:"order_id" gorm:"default:0"`
+	Status        string    `json:"status" gorm:"type:varchar(20);not null"` // "pending", "confirmed", "failed"
+	FailureReason string    `json:"failure_reason,omitempty" gorm:"type:text;default:null"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+type CartCheckoutInterface interface {
+	CreateCheckout(db *gorm.DB, lines []Cart) error
+	GetLineIds() ([]int, error)
+	Confirm(db *gorm.DB, orderId int) error
+	Fail(db *gorm.DB, reason string) error
+}
+
+func InitCartCheckoutSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&CartCheckout{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "CartCheckout", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "CartCheckout")
+	}
+}
+
+func (cc *CartCheckout) CreateCheckout(db *gorm.DB, lines []Cart) error {
+	snapshot, err := json.Marshal(lines)
+	if err != nil {
+		return err
+	}
+	cc.Lines = string(snapshot)
+	cc.Status = CheckoutStatusPending
+	return db.Create(&cc).Error
+}
+
+func (cc *CartCheckout) GetLineIds() ([]int, error) {
+	var lines []Cart
+	if err := json.Unmarshal([]byte(cc.Lines), &lines); err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(lines))
+	for _, line := range lines {
+		ids = append(ids, line.Id)
+	}
+	return ids, nil
+}
+
+// Confirm marks the snapshotted lines processed, the cart itself is checked out when nothing was added to it
+// while the order was placed
+func (cc *CartCheckout) Confirm(db *gorm.DB, orderId int) error {
+	ids, err := cc.GetLineIds()
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Cart{}).Where("id IN ?", ids).Update("is_processed", true).Error; err != nil {
+			return err
+		}
+
+		var remaining int64
+		if err := tx.Model(&Cart{}).Where("cart_header_id = ? and is_processed = false", cc.CartHeaderId).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining == 0 {
+			if err := tx.Model(&CartHeader{}).Where("id = ?", cc.CartHeaderId).Update("status", CartStatusCheckedOut).Error; err != nil {
+				return err
+			}
+		}
+
+		cc.OrderId = orderId
+		cc.Status = CheckoutStatusConfirmed
+		updatedFields := map[string]interface{}{"order_id": orderId, "status": cc.Status}
+		return tx.Model(&CartCheckout{}).Where("id = ?", cc.Id).Updates(updatedFields).Error
+	})
+}
+
+func (cc *CartCheckout) Fail(db *gorm.DB, reason string) error {
+	cc.Status = CheckoutStatusFailed
+	cc.FailureReason = reason
+	updatedFields := map[string]interface{}{"status": cc.Status, "failure_reason": reason}
+	return db.Model(&CartCheckout{}).Where("id = ?", cc.Id).Updates(updatedFields).Error
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"e-commerce-backend/cart/dbs"
+	"e-commerce-backend/cart/pkg/constants"
+	"e-commerce-backend/shared/utils"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CartStatusActive     = "active"
+	CartStatusCheckedOut = "checked_out"
+	CartStatusAbandoned  = "abandoned"
+	CartStatusMerged     = "merged"
+)
+
+// CartHeader is the cart entity of a user, items live in Cart rows (cart lines) pointing to it
+type CartHeader struct {
+	Id             int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserId         int       `json:"user_id" gorm:"not null;index"`
+	GuestId        string    `json:"-" gorm:"type:varchar(64);default:null;index"`                 // set for carts of anonymous shoppers, UserId is 0
+	Status         string    `json:"status" gorm:"type:varchar(20);not null;default:active;index"` // "active", "checked_out", "abandoned", "merged"
+	Currency       string    `json:"currency" gorm:"type:varchar(3);not null"`
+	CouponCode     string    `json:"coupon_code" gorm:"default:null"`
+	Notes          string    `json:"notes" gorm:"type:text;default:null"`
+	AddressId      int       `json:"address_id" gorm:"default:0"`
+	ShippingMethod string    `json:"shipping_method" gorm:"default:null"`
+	NotifyEmail    string    `json:"-" gorm:"default:null"` // email of the owner for abandoned cart reminders
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at" gorm:"type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time `json:"updated_at" gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
+}
+
+type CartHeaderService interface {
+	GetOrCreateActiveCart(db *gorm.DB, userId int) error
+	GetActiveCartByUserId(db *gorm.DB, userId int) error
+	GetOrCreateActiveGuestCart(db *gorm.DB, guestId string) error
+	GetActiveCartByGuestId(db *gorm.DB, guestId string) error
+	UpdateCartDetails(db *gorm.DB) error
+	Touch(db *gorm.DB) error
+	GetLines(db *gorm.DB) ([]Cart, error)
+	SetNotifyEmail(db *gorm.DB, email string) error
+}
+
+func InitCartHeaderSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&CartHeader{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "CartHeader", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "CartHeader")
+	}
+}
+
+func (h *CartHeader) GetCartHeaderById(db *gorm.DB, id int) error {
+	return db.Where("id = ?", id).First(&h).Error
+}
+
+func (h *CartHeader) GetActiveCartByUserId(db *gorm.DB, userId int) error {
+	return db.Where("user_id = ? and status = ?", userId, CartStatusActive).Order("id desc").First(&h).Error
+}
+
+func (h *CartHeader) GetActiveCartByGuestId(db *gorm.DB, guestId string) error {
+	return db.Where("guest_id = ? and user_id = 0 and status = ?", guestId, CartStatusActive).Order("id desc").First(&h).Error
+}
+
+// GetOrCreateActiveCart loads the active cart of the user, a new one is opened when there is none
+func (h *CartHeader) GetOrCreateActiveCart(db *gorm.DB, userId int) error {
+	err := h.GetActiveCartByUserId(db, userId)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return h.createActiveCart(db, userId, "")
+}
+
+func (h *CartHeader) GetOrCreateActiveGuestCart(db *gorm.DB, guestId string) error {
+	err := h.GetActiveCartByGuestId(db, guestId)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return h.createActiveCart(db, 0, guestId)
+}
+
+func (h *CartHeader) createActiveCart(db *gorm.DB, userId int, guestId string) error {
+	*h = CartHeader{
+		UserId:    userId,
+		GuestId:   guestId,
+		Status:    CartStatusActive,
+		Currency:  constants.DefaultCurrency,
+		ExpiresAt: time.Now().AddDate(0, 0, constants.CartExpiryDays),
+	}
+	return db.Create(&h).Error
+}
+
+func (h *CartHeader) UpdateCartDetails(db *gorm.DB) error {
+	h.ExpiresAt = time.Now().AddDate(0, 0, constants.CartExpiryDays)
+	updatedFields := map[string]interface{}{
+		"coupon_code":     h.CouponCode,
+		"notes":           h.Notes,
+		"address_id":      h.AddressId,
+		"shipping_method": h.ShippingMethod,
+		"expires_at":      h.ExpiresAt,
+	}
+	return db.Model(&CartHeader{}).Where("id = ?", h.Id).Updates(updatedFields).Error
+}
+
+// Touch pushes the expiry of the cart forward, called whenever the cart lines change
+func (h *CartHeader) Touch(db *gorm.DB) error {
+	h.ExpiresAt = time.Now().AddDate(0, 0, constants.CartExpiryDays)
+	return db.Model(&CartHeader{}).Where("id = ?", h.Id).Update("expires_at", h.ExpiresAt).Error
+}
+
+// SetNotifyEmail remembers where reminders for the cart go, guests have no email and are never reminded
+func (h *CartHeader) SetNotifyEmail(db *gorm.DB, email string) error {
+	if email == "" || email == h.NotifyEmail {
+		return nil
+	}
+	h.NotifyEmail = email
+	return db.Model(&CartHeader{}).Where("id = ?", h.Id).Update("notify_email", email).Error
+}
+
+func (h *CartHeader) GetLines(db *gorm.DB) ([]Cart, error) {
+	var lines []Cart
+	if err := db.Where("cart_header_id = ? and is_processed = false", h.Id).Order("id").Find(&lines).Error; err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// GetLine returns the line of the cart with the id, lines of other carts are not found
+func (h *CartHeader) GetLine(db *gorm.DB, lineId int) (Cart, error) {
+	var line Cart
+	err := db.Where("id = ? and cart_header_id = ? and is_processed = false", lineId, h.Id).First(&line).Error
+	return line, err
+}
+
+// MergeGuestCart moves the lines of the guest cart into the target cart, quantities holds the merged quantity
+// per product or bundle, lines merged down to zero are dropped
+func MergeGuestCart(db *gorm.DB, guest, target *CartHeader, quantities map[CartItemKey]int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		guestLines, err := guest.GetLines(tx)
+		if err != nil {
+			return err
+		}
+		targetLines, err := target.GetLines(tx)
+		if err != nil {
+			return err
+		}
+		targetByItem := make(map[CartItemKey]Cart, len(targetLines))
+		for _, line := range targetLines {
+			targetByItem[line.ItemKey()] = line
+		}
+
+		for _, line := range guestLines {
+			quantity := quantities[line.ItemKey()]
+			existing, ok := targetByItem[line.ItemKey()]
+			if ok && quantity > 0 {
+				if err := tx.Model(&Cart{}).Where("id = ?", existing.Id).Update("quantity", quantity).Error; err != nil {
+					return err
+				}
+			}
+			if ok || quantity <= 0 {
+				if err := tx.Where("id = ?", line.Id).Delete(&Cart{}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			updatedFields := map[string]interface{}{"cart_header_id": target.Id, "user_id": target.UserId, "quantity": quantity}
+			if err := tx.Model(&Cart{}).Where("id = ?", line.Id).Updates(updatedFields).Error; err != nil {
+				return err
+			}
+		}
+
+		//the account cart keeps its own coupon and notes, the guest ones are only taken over when it has none
+		if target.CouponCode == "" && guest.CouponCode != "" {
+			target.CouponCode = guest.CouponCode
+		}
+		if target.Notes == "" && guest.Notes != "" {
+			target.Notes = guest.Notes
+		}
+		if err := target.UpdateCartDetails(tx); err != nil {
+			return err
+		}
+
+		guest.Status = CartStatusMerged
+		return tx.Model(&CartHeader{}).Where("id = ?", guest.Id).Update("status", guest.Status).Error
+	})
+}
+
+// MigrateCartLines moves cart rows created before cart headers existed under an active header of their user
+func MigrateCartLines(db *gorm.DB) error {
+	var userIds []int
+	if err := db.Model(&Cart{}).Where("cart_header_id = 0 and is_processed = false").Distinct().Pluck("user_id", &userIds).Error; err != nil {
+		return err
+	}
+
+	for _, userId := range userIds {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var header CartHeader
+			if err := header.GetOrCreateActiveCart(tx, userId); err != nil {
+				return err
+			}
+			return tx.Model(&Cart{}).Where("user_id = ? and cart_header_id = 0 and is_processed = false", userId).Update("cart_header_id", header.Id).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"e-commerce-backend/cart/dbs"
+	"e-commerce-backend/shared/utils"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CartReminder history of the abandoned cart reminders, every step of the sequence is sent at most once per cart
+type CartReminder struct {
+	Id            int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	CartHeaderId  int       `json:"cart_header_id" gorm:"not null;uniqueIndex:idx_cart_reminder_step"`
+	Step          int       `json:"step" gorm:"not null;uniqueIndex:idx_cart_reminder_step"`
+	UserId        int       `json:"user_id" gorm:"not null;index"`
+	Email         string    `json:"email" gorm:"not null"`
+	CouponCode    string    `json:"coupon_code,omitempty" gorm:"default:null"`
+	CouponPercent float64   `json:"coupon_percent,omitempty" gorm:"default:0"`
+	CouponOrderId int       `json:"coupon_order_id,omitempty" gorm:"default:0"` // order the coupon was redeemed on, 0 while unused
+	SentAt        time.Time `json:"sent_at" gorm:"autoCreateTime"`
+}
+
+// AbandonedCart active cart of a registered user, LastActivity is the newest change of its lines
+type AbandonedCart struct {
+	CartHeaderId  int
+	UserId        int
+	NotifyEmail   string
+	LastActivity  time.Time
+	RemindersSent int
+}
+
+type CartReminderInterface interface {
+	CreateReminder(db *gorm.DB) error
+}
+
+func InitCartReminderSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&CartReminder{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "CartReminder", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "CartReminder")
+	}
+}
+
+// CreateReminder records a sent reminder, the unique index on cart and step rejects a second send of the same step
+func (cr *CartReminder) CreateReminder(db *gorm.DB) error {
+	return db.Create(&cr).Error
+}
+
+// GetUnusedCoupon finds the coupon of a reminder sent to the user which was not redeemed on an order yet
+func GetUnusedCoupon(db *gorm.DB, userId int, code string) (CartReminder, error) {
+	var reminder CartReminder
+	err := db.Where("user_id = ? and coupon_code = ? and coupon_order_id = 0", userId, code).First(&reminder).Error
+	return reminder, err
+}
+
+// GetAbandonedCarts finds the active carts with an email and at least one line whose lines were all last changed
+// before idleSince, along with how many reminders they already got. Checked out and emptied carts drop out
+func GetAbandonedCarts(db *gorm.DB, idleSince time.Time) ([]AbandonedCart, error) {
+	var carts []AbandonedCart
+	reminders := db.Model(&CartReminder{}).Select("count(*)").Where("cart_reminders.cart_header_id = cart_headers.id")
+	err := db.Model(&CartHeader{}).
+		Select("cart_headers.id as cart_header_id, cart_headers.user_id, cart_headers.notify_email, max(carts.updated_at) as last_activity, (?) as reminders_sent", reminders).
+		Joins("join carts on carts.cart_header_id = cart_headers.id and carts.is_processed = false").
+		Where("cart_headers.status = ? and cart_headers.user_id <> 0 and cart_headers.notify_email is not null and cart_headers.notify_email <> ''", CartStatusActive).
+		Group("cart_headers.id, cart_headers.user_id, cart_headers.notify_email").
+		Having("max(carts.updated_at) < ?", idleSince).
+		Scan(&carts).Error
+	if err != nil {
+		return nil, err
+	}
+	return carts, nil
+}
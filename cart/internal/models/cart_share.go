@@ -0,0 +1,71 @@
+package models
+
+import (
+	"e-commerce-backend/cart/dbs"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CartShare snapshot of a cart which anyone with the token can look at and import into their own cart, later
+// changes of the shared cart don't change the snapshot
+type CartShare struct {
+	Id           int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserId       int       `json:"user_id" gorm:"not null;index"`
+	CartHeaderId int       `json:"cart_header_id" gorm:"not null"`
+	Token        string    `json:"token" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Lines        string    `json:"-" gorm:"type:text;not null"` // json of the shared lines
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// SharedCartLine what a shared cart holds of one product, variant or bundle
+type SharedCartLine struct {
+	ProductId int `json:"product_id"`
+	VariantId int `json:"variant_id,omitempty"`
+	BundleId  int `json:"bundle_id,omitempty"`
+	Quantity  int `json:"quantity"`
+}
+
+type CartShareInterface interface {
+	CreateShare(db *gorm.DB, lines []Cart) error
+	GetShareByToken(db *gorm.DB, token string) error
+	GetLines() ([]SharedCartLine, error)
+}
+
+func InitCartShareSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&CartShare{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "CartShare", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "CartShare")
+	}
+}
+
+func (cs *CartShare) CreateShare(db *gorm.DB, lines []Cart) error {
+	shared := make([]SharedCartLine, 0, len(lines))
+	for _, line := range lines {
+		shared = append(shared, SharedCartLine{ProductId: line.ProductId, VariantId: line.VariantId, BundleId: line.BundleId, Quantity: line.Quantity})
+	}
+	snapshot, err := json.Marshal(shared)
+	if err != nil {
+		return err
+	}
+	cs.Lines = string(snapshot)
+	return db.Create(&cs).Error
+}
+
+func (cs *CartShare) GetShareByToken(db *gorm.DB, token string) error {
+	return db.Where("token = ? and expires_at > ?", token, time.Now()).First(&cs).Error
+}
+
+func (cs *CartShare) GetLines() ([]SharedCartLine, error) {
+	var lines []SharedCartLine
+	if err := json.Unmarshal([]byte(cs.Lines), &lines); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
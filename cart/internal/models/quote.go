@@ -0,0 +1,139 @@
+package models
+
+import (
+	"e-commerce-backend/cart/dbs"
+	"e-commerce-backend/shared/utils"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	QuoteStatusRequested = "requested"
+	QuoteStatusPriced    = "priced"
+	QuoteStatusAccepted  = "accepted"
+	QuoteStatusRejected  = "rejected"
+)
+
+// Quote cart of a business customer waiting for negotiated prices, once priced the customer can accept it
+// before ExpiresAt and the order is placed at the negotiated prices
+type Quote struct {
+	Id            int         `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserId        int         `json:"user_id" gorm:"not null;index"`
+	CartHeaderId  int         `json:"cart_header_id" gorm:"not null"`
+	Status        string      `json:"status" gorm:"type:varchar(20);not null;index"` // "requested", "priced", "accepted", "rejected"
+	CustomerNotes string      `json:"customer_notes,omitempty" gorm:"type:text;default:null"`
+	AdminNotes    string      `json:"admin_notes,omitempty" gorm:"type:text;default:null"`
+	ExpiresAt     *time.Time  `json:"expires_at,omitempty" gorm:"default:null"`
+	OrderId       int         `json:"order_id,omitempty" gorm:"default:0"`
+	Lines         []QuoteLine `json:"lines" gorm:"foreignKey:QuoteId"`
+	CreatedAt     time.Time   `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time   `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// QuoteLine product or variant of a quote, the list price is what it cost when the quote was requested
+type QuoteLine struct {
+	Id              int     `json:"id" gorm:"primaryKey;autoIncrement"`
+	QuoteId         int     `json:"quote_id" gorm:"not null;index"`
+	ProductId       int     `json:"product_id" gorm:"not null"`
+	VariantId       int     `json:"variant_id,omitempty" gorm:"default:0"`
+	Quantity        int     `json:"quantity" gorm:"not null"`
+	ListPrice       float64 `json:"list_price" gorm:"default:0"`
+	ListDiscount    float64 `json:"list_discount" gorm:"default:0"`
+	NegotiatedPrice float64 `json:"negotiated_price" gorm:"default:0"` // unit price set by an admin
+}
+
+type QuoteInterface interface {
+	CreateQuote(db *gorm.DB, lines []Cart) error
+	GetQuoteById(db *gorm.DB, id int) error
+	GetQuoteByIdAndUserId(db *gorm.DB, id, userId int) error
+	SetPrices(db *gorm.DB, prices map[int]float64, expiresAt time.Time, notes string) error
+	Accept(db *gorm.DB, orderId int) error
+	Reject(db *gorm.DB) error
+	IsExpired() bool
+}
+
+func InitQuoteSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&Quote{}, &QuoteLine{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "Quote/QuoteLine", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "Quote/QuoteLine")
+	}
+}
+
+// CreateQuote stores the quote with its lines and takes the quoted lines out of the cart in one transaction
+func (q *Quote) CreateQuote(db *gorm.DB, lines []Cart) error {
+	q.Status = QuoteStatusRequested
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&q).Error; err != nil {
+			return err
+		}
+		return DeleteCartItems(tx, lines)
+	})
+}
+
+func (q *Quote) GetQuoteById(db *gorm.DB, id int) error {
+	return db.Preload("Lines").Where("id = ?", id).First(&q).Error
+}
+
+func (q *Quote) GetQuoteByIdAndUserId(db *gorm.DB, id, userId int) error {
+	return db.Preload("Lines").Where("id = ? and user_id = ?", id, userId).First(&q).Error
+}
+
+func GetQuotesByUserId(db *gorm.DB, userId int) ([]Quote, error) {
+	var quotes []Quote
+	if err := db.Preload("Lines").Where("user_id = ?", userId).Order("id desc").Find(&quotes).Error; err != nil {
+		return nil, err
+	}
+	return quotes, nil
+}
+
+// GetQuotesByStatus quotes of every customer, an empty status returns all of them
+func GetQuotesByStatus(db *gorm.DB, status string) ([]Quote, error) {
+	var quotes []Quote
+	query := db.Preload("Lines").Order("id")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&quotes).Error; err != nil {
+		return nil, err
+	}
+	return quotes, nil
+}
+
+// SetPrices stores the negotiated unit price of every line keyed by line id, a quote can be repriced until
+// it is accepted or rejected
+func (q *Quote) SetPrices(db *gorm.DB, prices map[int]float64, expiresAt time.Time, notes string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := range q.Lines {
+			price := prices[q.Lines[i].Id]
+			if err := tx.Model(&QuoteLine{}).Where("id = ?", q.Lines[i].Id).Update("negotiated_price", price).Error; err != nil {
+				return err
+			}
+			q.Lines[i].NegotiatedPrice = price
+		}
+
+		q.Status = QuoteStatusPriced
+		q.ExpiresAt = &expiresAt
+		q.AdminNotes = notes
+		updatedFields := map[string]interface{}{"status": q.Status, "expires_at": expiresAt, "admin_notes": notes}
+		return tx.Model(&Quote{}).Where("id = ?", q.Id).Updates(updatedFields).Error
+	})
+}
+
+func (q *Quote) Accept(db *gorm.DB, orderId int) error {
+	q.Status = QuoteStatusAccepted
+	q.OrderId = orderId
+	return db.Model(&Quote{}).Where("id = ?", q.Id).Updates(map[string]interface{}{"status": q.Status, "order_id": orderId}).Error
+}
+
+func (q *Quote) Reject(db *gorm.DB) error {
+	q.Status = QuoteStatusRejected
+	return db.Model(&Quote{}).Where("id = ?", q.Id).Update("status", q.Status).Error
+}
+
+func (q *Quote) IsExpired() bool {
+	return q.ExpiresAt != nil && q.ExpiresAt.Before(time.Now())
+}
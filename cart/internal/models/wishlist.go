@@ -0,0 +1,193 @@
+package models
+
+import (
+	"e-commerce-backend/cart/dbs"
+	"e-commerce-backend/cart/pkg/constants"
+	"e-commerce-backend/shared/utils"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	WishlistKindWishlist      = "wishlist"
+	WishlistKindSavedForLater = "saved_for_later"
+)
+
+// Wishlist named list of products of a user, public lists can be read by anyone with the share token
+type Wishlist struct {
+	Id          int            `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserId      int            `json:"user_id" gorm:"not null;index"`
+	Name        string         `json:"name" gorm:"type:varchar(100);not null"`
+	Kind        string         `json:"kind" gorm:"type:varchar(20);not null;default:wishlist"` // "wishlist", "saved_for_later"
+	IsPublic    bool           `json:"is_public" gorm:"default:false"`
+	ShareToken  string         `json:"share_token,omitempty" gorm:"type:varchar(64);default:null;uniqueIndex"`
+	NotifyEmail string         `json:"-" gorm:"default:null"` // where price drop and back in stock alerts go
+	Items       []WishlistItem `json:"items" gorm:"foreignKey:WishlistId"`
+	CreatedAt   time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// WishlistItem product on a wishlist, LastPrice and LastInStock are what the user was last told about. LastInStock
+// is nil until the product could be looked up
+type WishlistItem struct {
+	Id          int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	WishlistId  int       `json:"wishlist_id" gorm:"not null;index"`
+	ProductId   int       `json:"product_id" gorm:"not null;index"`
+	Quantity    int       `json:"quantity" gorm:"default:1"`
+	LastPrice   float64   `json:"last_price" gorm:"default:0"` // price after discount
+	LastInStock *bool     `json:"last_in_stock"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// WatchedWishlistItem wishlist item joined with what the alert check needs from its wishlist
+type WatchedWishlistItem struct {
+	WishlistItem
+	WishlistName string
+	NotifyEmail  string
+}
+
+type WishlistInterface interface {
+	CreateWishlist(db *gorm.DB) error
+	GetWishlistByIdAndUserId(db *gorm.DB, id, userId int) error
+	GetWishlistByShareToken(db *gorm.DB, token string) error
+	GetOrCreateSavedForLater(db *gorm.DB, userId int, email string) error
+	UpdateWishlist(db *gorm.DB) error
+	DeleteWishlist(db *gorm.DB) error
+	AddItem(db *gorm.DB, item *WishlistItem) error
+	GetItem(db *gorm.DB, itemId int) (WishlistItem, error)
+}
+
+func InitWishlistSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&Wishlist{}, &WishlistItem{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "Wishlist/WishlistItem", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "Wishlist/WishlistItem")
+	}
+}
+
+func (wl *Wishlist) CreateWishlist(db *gorm.DB) error {
+	if wl.Kind == "" {
+		wl.Kind = WishlistKindWishlist
+	}
+	return db.Create(&wl).Error
+}
+
+func (wl *Wishlist) GetWishlistByIdAndUserId(db *gorm.DB, id, userId int) error {
+	return db.Preload("Items").Where("id = ? and user_id = ?", id, userId).First(&wl).Error
+}
+
+func (wl *Wishlist) GetWishlistByShareToken(db *gorm.DB, token string) error {
+	return db.Preload("Items").Where("share_token = ? and is_public = ?", token, true).First(&wl).Error
+}
+
+func GetWishlistsByUserId(db *gorm.DB, userId int) ([]Wishlist, error) {
+	var wishlists []Wishlist
+	if err := db.Preload("Items").Where("user_id = ?", userId).Order("id").Find(&wishlists).Error; err != nil {
+		return nil, err
+	}
+	return wishlists, nil
+}
+
+func (wl *Wishlist) GetOrCreateSavedForLater(db *gorm.DB, userId int, email string) error {
+	err := db.Preload("Items").Where("user_id = ? and kind = ?", userId, WishlistKindSavedForLater).First(&wl).Error
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	*wl = Wishlist{
+		UserId:      userId,
+		Name:        constants.SavedForLaterListName,
+		Kind:        WishlistKindSavedForLater,
+		NotifyEmail: email,
+	}
+	return wl.CreateWishlist(db)
+}
+
+func (wl *Wishlist) UpdateWishlist(db *gorm.DB) error {
+	updatedFields := map[string]interface{}{"name": wl.Name, "is_public": wl.IsPublic}
+	if wl.ShareToken != "" {
+		updatedFields["share_token"] = wl.ShareToken
+	}
+	if wl.NotifyEmail != "" {
+		updatedFields["notify_email"] = wl.NotifyEmail
+	}
+	return db.Model(&Wishlist{}).Where("id = ?", wl.Id).Updates(updatedFields).Error
+}
+
+func (wl *Wishlist) DeleteWishlist(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("wishlist_id = ?", wl.Id).Delete(&WishlistItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Wishlist{}, wl.Id).Error
+	})
+}
+
+// AddItem puts the product on the list, a product already on it gets the quantities added up
+func (wl *Wishlist) AddItem(db *gorm.DB, item *WishlistItem) error {
+	item.WishlistId = wl.Id
+	if item.Quantity <= 0 {
+		item.Quantity = 1
+	}
+
+	var existing WishlistItem
+	err := db.Where("wishlist_id = ? and product_id = ?", wl.Id, item.ProductId).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return db.Create(&item).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	existing.Quantity += item.Quantity
+	if err := db.Model(&WishlistItem{}).Where("id = ?", existing.Id).Update("quantity", existing.Quantity).Error; err != nil {
+		return err
+	}
+	*item = existing
+	return nil
+}
+
+func (wl *Wishlist) GetItem(db *gorm.DB, itemId int) (WishlistItem, error) {
+	var item WishlistItem
+	err := db.Where("id = ? and wishlist_id = ?", itemId, wl.Id).First(&item).Error
+	return item, err
+}
+
+func (wi *WishlistItem) DeleteItem(db *gorm.DB) error {
+	return db.Delete(&WishlistItem{}, wi.Id).Error
+}
+
+func (wi *WishlistItem) UpdateLastSeen(db *gorm.DB, price float64, inStock bool) error {
+	wi.LastPrice = price
+	wi.LastInStock = &inStock
+	updatedFields := map[string]interface{}{"last_price": price, "last_in_stock": inStock}
+	return db.Model(&WishlistItem{}).Where("id = ?", wi.Id).Updates(updatedFields).Error
+}
+
+// MoveCartLineToWishlist takes the line out of the cart and puts its product on the wishlist in one transaction
+func MoveCartLineToWishlist(db *gorm.DB, line Cart, wishlist *Wishlist, item *WishlistItem) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := line.DeleteCartItem(tx); err != nil {
+			return err
+		}
+		return wishlist.AddItem(tx, item)
+	})
+}
+
+// GetWatchedWishlistItems items of all wishlists which have an email to alert, saved for later lists are not watched
+func GetWatchedWishlistItems(db *gorm.DB) ([]WatchedWishlistItem, error) {
+	var items []WatchedWishlistItem
+	err := db.Model(&WishlistItem{}).
+		Select("wishlist_items.*, wishlists.name as wishlist_name, wishlists.notify_email").
+		Joins("join wishlists on wishlists.id = wishlist_items.wishlist_id").
+		Where("wishlists.kind = ? and wishlists.notify_email is not null and wishlists.notify_email <> ''", WishlistKindWishlist).
+		Scan(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"e-commerce-backend/cart/internal/models"
+	"e-commerce-backend/cart/pkg/constants"
+	"e-commerce-backend/shared/notifications/emails"
+	"e-commerce-backend/shared/notifications/emails/templates"
+	"e-commerce-backend/shared/utils"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// getAbandonedCartConfig reads the idle hours after which each reminder of the sequence is sent and the coupon
+// percent of the last reminder, 0 means no coupon
+func getAbandonedCartConfig() ([]int, float64) {
+	value := os.Getenv("ABANDONED_CART_REMINDER_HOURS")
+	if value == "" {
+		value = constants.DefaultAbandonedCartReminderHours
+	}
+
+	var schedule []int
+	for _, part := range strings.Split(value, ",") {
+		hours, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || hours <= 0 {
+			continue
+		}
+		//every step waits at least as long as the one before
+		if len(schedule) > 0 && hours < schedule[len(schedule)-1] {
+			continue
+		}
+		schedule = append(schedule, hours)
+	}
+
+	couponPercent, _ := strconv.ParseFloat(os.Getenv("ABANDONED_CART_COUPON_PERCENT"), 64)
+	return schedule, max(min(couponPercent, 100), 0)
+}
+
+// StartAbandonedCartJob periodically sends the next reminder of the sequence to carts which are left untouched
+func StartAbandonedCartJob(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			sent, err := remindAbandonedCarts(db)
+			if err != nil {
+				utils.LogError(utils.AbandonedCartCheckError, map[string]interface{}{"error": err.Error()})
+				continue
+			}
+			if sent > 0 {
+				utils.LogInfo(fmt.Sprintf(utils.AbandonedCartRemindersSent, sent), nil)
+			}
+		}
+	}()
+}
+
+func remindAbandonedCarts(db *gorm.DB) (int, error) {
+	schedule, couponPercent := getAbandonedCartConfig()
+	if len(schedule) == 0 {
+		return 0, nil
+	}
+
+	carts, err := models.GetAbandonedCarts(db, time.Now().Add(-time.Duration(schedule[0])*time.Hour))
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, cart := range carts {
+		step := cart.RemindersSent
+		if step >= len(schedule) || time.Since(cart.LastActivity) < time.Duration(schedule[step])*time.Hour {
+			continue
+		}
+
+		stepCoupon := 0.0
+		if step == len(schedule)-1 {
+			stepCoupon = couponPercent
+		}
+		if err := sendCartReminder(db, cart, step, stepCoupon); err != nil {
+			utils.LogError(fmt.Sprintf(utils.AbandonedCartReminderError, cart.CartHeaderId), map[string]interface{}{"error": err.Error()})
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// sendCartReminder records the reminder before sending it, so a failing send never leads to a second email
+// for the same step
+func sendCartReminder(db *gorm.DB, cart models.AbandonedCart, step int, couponPercent float64) error {
+	var header models.CartHeader
+	if err := header.GetCartHeaderById(db, cart.CartHeaderId); err != nil {
+		return err
+	}
+	lines, err := header.GetLines(db)
+	if err != nil || len(lines) == 0 {
+		return err
+	}
+
+	batch, err := fetchProductBatch(cartProductIds(lines))
+	if err != nil {
+		return err
+	}
+
+	content := emails.AbandonedCartReminder{}
+	var total int64
+	for _, line := range lines {
+		product, ok := batch.Products[line.ProductId]
+		if !ok {
+			continue
+		}
+		name, _ := product["name"].(string)
+		price := effectivePrice(product) * float64(line.Quantity)
+		total += utils.ToCents(price)
+		content.Items = append(content.Items, emails.AbandonedCartItem{ProductName: name, Quantity: line.Quantity, Price: formatPrice(price)})
+	}
+	if len(content.Items) == 0 {
+		return nil
+	}
+	content.Total = formatPrice(float64(total) / 100)
+
+	reminder := models.CartReminder{
+		CartHeaderId: cart.CartHeaderId,
+		Step:         step,
+		UserId:       cart.UserId,
+		Email:        cart.NotifyEmail,
+	}
+	if couponPercent > 0 {
+		reminder.CouponCode = fmt.Sprintf("%s-%s", constants.AbandonedCartCouponPrefix, strings.ToUpper(utils.GenerateRandomToken()[:8]))
+		reminder.CouponPercent = couponPercent
+		content.CouponCode = reminder.CouponCode
+		content.CouponPercent = strconv.FormatFloat(couponPercent, 'f', -1, 64)
+	}
+	if err := reminder.CreateReminder(db); err != nil {
+		return err
+	}
+
+	//the coupon is put on the cart unless the user already entered one, the order service redeems it on checkout
+	if reminder.CouponCode != "" && header.CouponCode == "" {
+		header.CouponCode = reminder.CouponCode
+		if err := header.UpdateCartDetails(db); err != nil {
+			utils.LogError(fmt.Sprintf(utils.CartDetailsUpdateError, header.UserId), map[string]interface{}{"error": err.Error()})
+		} else {
+			content.CouponApplied = true
+		}
+	}
+
+	emails.EmailWorkerWithGoRoutine(cart.NotifyEmail, templates.AbandonedCartSubject, templates.ABANDONED_CART_TEMPLATE, content, nil)
+	return nil
+}
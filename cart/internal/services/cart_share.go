@@ -0,0 +1,126 @@
+package services
+
+import (
+	"e-commerce-backend/cart/internal/models"
+	"e-commerce-backend/cart/pkg/constants"
+	"e-commerce-backend/cart/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// sharedLinesToCart turns the shared lines into unsaved cart lines so they are looked up like any cart
+func sharedLinesToCart(lines []models.SharedCartLine) []models.Cart {
+	carts := make([]models.Cart, 0, len(lines))
+	for _, line := range lines {
+		carts = append(carts, models.Cart{ProductId: line.ProductId, VariantId: line.VariantId, BundleId: line.BundleId, Quantity: line.Quantity})
+	}
+	return carts
+}
+
+// getSharedCart loads the share of the path token, it responds itself when the share can't be used
+func (db *Service) getSharedCart(w http.ResponseWriter, r *http.Request) (models.CartShare, []models.SharedCartLine, bool) {
+	var share models.CartShare
+	if err := share.GetShareByToken(db.DB, mux.Vars(r)["token"]); err != nil {
+		utils.JsonError(w, utils.SharedCartNotFound, http.StatusNotFound, err)
+		return share, nil, false
+	}
+	lines, err := share.GetLines()
+	if err != nil {
+		utils.JsonError(w, utils.CartUnexpectedFetchError, http.StatusInternalServerError, err)
+		return share, nil, false
+	}
+	return share, lines, true
+}
+
+// ShareCart snapshots the lines of the active cart behind a token (POST /user/cart/share)
+func (db *Service) ShareCart(w http.ResponseWriter, r *http.Request) {
+	userId := utils.GetUserIdFromContext(r)
+
+	var header models.CartHeader
+	if err := header.GetActiveCartByUserId(db.DB, userId); err != nil {
+		utils.JsonError(w, utils.CartEmptyError, http.StatusBadRequest, err)
+		return
+	}
+	lines, err := header.GetLines(db.DB)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CartShareError, userId), http.StatusInternalServerError, err)
+		return
+	}
+	if len(lines) == 0 {
+		utils.JsonError(w, utils.CartEmptyError, http.StatusBadRequest, nil)
+		return
+	}
+
+	share := models.CartShare{
+		UserId:       userId,
+		CartHeaderId: header.Id,
+		Token:        utils.GenerateRandomToken(),
+		ExpiresAt:    time.Now().AddDate(0, 0, constants.CartShareExpiryDays),
+	}
+	if err := share.CreateShare(db.DB, lines); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CartShareError, userId), http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(share, w, utils.CartShared, http.StatusCreated)
+}
+
+// GetSharedCart shows the shared lines with current prices (GET /cart/shared/{token}), no login needed
+func (db *Service) GetSharedCart(w http.ResponseWriter, r *http.Request) {
+	share, lines, ok := db.getSharedCart(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := cartItemResponses(sharedLinesToCart(lines))
+	if err != nil {
+		utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+
+	resp := payloads.SharedCartResponse{
+		Token:     share.Token,
+		ExpiresAt: share.ExpiresAt,
+		Items:     items,
+		Totals:    calculateCartTotals(items, 0),
+	}
+	utils.JsonResponse(resp, w, utils.SharedCartFetched, http.StatusOK)
+}
+
+// ImportSharedCart adds the shared lines to the caller's cart (POST /user/cart/shared/{token}/import), every
+// line goes through the same stock and quantity checks as adding it by hand
+func (db *Service) ImportSharedCart(w http.ResponseWriter, r *http.Request) {
+	_, lines, ok := db.getSharedCart(w, r)
+	if !ok {
+		return
+	}
+
+	//avoiding race condition
+	cartMutex.Lock()
+	defer cartMutex.Unlock()
+
+	header, err := activeCartForRequest(db.DB, r, true)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.JsonError(w, utils.GuestCartNotFoundError, http.StatusNotFound, err)
+			return
+		}
+		utils.JsonError(w, utils.CartImportError, http.StatusInternalServerError, err)
+		return
+	}
+	if err := header.SetNotifyEmail(db.DB, utils.GetUserEmailFromContext(r)); err != nil {
+		utils.LogError(utils.CartUnexpectedUpdateError, map[string]interface{}{"error": err.Error()})
+	}
+
+	items := make([]payloads.CartItem, 0, len(lines))
+	for _, line := range lines {
+		items = append(items, payloads.CartItem{ProductID: line.ProductId, VariantID: line.VariantId, BundleID: line.BundleId, Quantity: line.Quantity})
+	}
+	db.addItemsToCart(w, r, header, items)
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"bytes"
+	"e-commerce-backend/cart/internal/models"
+	"e-commerce-backend/cart/pkg/constants"
+	"e-commerce-backend/cart/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// placeOrder calls the checkout of the order service with the cart line ids and the coupon of the cart, the order
+// service redeems the coupon. The status and decoded body of the order service are returned as is
+func placeOrder(r *http.Request, header models.CartHeader, lines []models.Cart, req payloads.CartCheckoutRequest) (int, map[string]interface{}, error) {
+	links := constants.MicroserviceLinks()
+	orderServiceURL := fmt.Sprintf(links["orderCheckoutMSCallLink"], header.UserId)
+
+	carts := make([]map[string]interface{}, 0, len(lines))
+	for _, line := range lines {
+		carts = append(carts, map[string]interface{}{"cart_id": line.Id})
+	}
+	payload := map[string]interface{}{
+		"carts":          carts,
+		"payment_method": req.PaymentMethod,
+		"tenders":        req.Tenders,
+		"coupon_code":    header.CouponCode,
+	}
+	return callOrderService(r, orderServiceURL, payload)
+}
+
+// callOrderService posts the payload with the caller's JWT and the service token, the status and decoded body of
+// the order service are returned as is
+func callOrderService(r *http.Request, link string, payload map[string]interface{}) (int, map[string]interface{}, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to marshal body: %w", err)
+	}
+
+	orderReq, err := http.NewRequest(http.MethodPost, link, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, nil, err
+	}
+	orderReq.Header.Set("Content-Type", "application/json")
+	orderReq.Header.Set("Authorization", r.Header.Get("Authorization"))
+	utils.SetServiceToken(orderReq)
+
+	client := &http.Client{}
+	resp, err := client.Do(orderReq)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body := map[string]interface{}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		return resp.StatusCode, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// Checkout validates the cart, snapshots its lines and hands them to the order service, the lines are marked
+// processed only once the order service confirmed the order
+func (db *Service) Checkout(w http.ResponseWriter, r *http.Request) {
+	token := utils.GetTokenFromRequestHeader(r)
+	if token == "" {
+		utils.JsonError(w, utils.MissingAuthorizationHeader, http.StatusUnauthorized, nil)
+		return
+	}
+	userId := utils.GetUserIdFromContext(r)
+
+	cartId, _ := getCartIdFromParams(r)
+
+	//payment details are optional, the order service falls back to its defaults
+	var req payloads.CartCheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.JsonError(w, utils.InvalidCartRequest, http.StatusBadRequest, err)
+		return
+	}
+
+	//avoiding race condition, no line can change while the order is placed
+	cartMutex.Lock()
+	defer cartMutex.Unlock()
+
+	var header models.CartHeader
+	if err := header.GetActiveCartByUserId(db.DB, userId); err != nil || header.Id != cartId {
+		utils.JsonError(w, fmt.Sprintf(utils.CartIdNotFoundError, cartId), http.StatusNotFound, err)
+		return
+	}
+
+	carts, err := header.GetLines(db.DB)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.UserCartNotFoundError, userId), http.StatusNotFound, err)
+		return
+	}
+	if len(carts) == 0 {
+		utils.JsonError(w, "Cart is empty", http.StatusBadRequest, nil)
+		return
+	}
+
+	//the cart is revalidated right before checkout, changes have to be acknowledged and blocking lines fixed first
+	validation, lineProducts, err := validateCartLines(db.DB, r, carts)
+	if err != nil {
+		utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+
+	//holds of an idle cart lapse, every line is held again at its quantity so the order can commit them
+	if !hasBlockingWarnings(validation) {
+		for _, line := range carts {
+			if err := reserveCartLine(r, line); err != nil {
+				validation.Warnings = append(validation.Warnings, *insufficientStock(line, productInt(lineProducts[line.Id], "available_quantity")))
+			}
+		}
+		validation.Valid = len(validation.Warnings) == 0
+	}
+	if hasBlockingWarnings(validation) {
+		utils.JsonResponse(validation, w, utils.CartBlockedByWarnings, http.StatusConflict)
+		return
+	}
+	if validation.RequiresAcknowledgement {
+		utils.JsonResponse(validation, w, utils.CartChangesNotAcknowledged, http.StatusConflict)
+		return
+	}
+
+	checkout := models.CartCheckout{CartHeaderId: header.Id, UserId: userId}
+	if err := checkout.CreateCheckout(db.DB, carts); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CartCheckoutError, cartId), http.StatusInternalServerError, err)
+		return
+	}
+
+	status, orderResp, err := placeOrder(r, header, carts, req)
+	if err != nil {
+		if failErr := checkout.Fail(db.DB, err.Error()); failErr != nil {
+			utils.LogError(utils.CartUnexpectedUpdateError, map[string]interface{}{"error": failErr.Error()})
+		}
+		utils.JsonError(w, utils.ErrorCallingOrderMicroservice, http.StatusBadGateway, err)
+		return
+	}
+
+	message, _ := orderResp["message"].(string)
+	if status != http.StatusOK {
+		if failErr := checkout.Fail(db.DB, message); failErr != nil {
+			utils.LogError(utils.CartUnexpectedUpdateError, map[string]interface{}{"error": failErr.Error()})
+		}
+		err := fmt.Errorf("%s: %s", fmt.Sprintf(utils.CartOrderRejected, cartId), message)
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+
+	order, _ := orderResp["data"].(map[string]interface{})
+	orderId := 0
+	if id, ok := order["order_id"].(float64); ok {
+		orderId = int(id)
+	}
+
+	//the order exists at this point, a failed confirmation is logged and the order still returned to the client
+	if err := checkout.Confirm(db.DB, orderId); err != nil {
+		utils.LogError(fmt.Sprintf(utils.CartCheckoutConfirmError, orderId, checkout.Id), map[string]interface{}{"error": err.Error()})
+	}
+
+	resp := payloads.CartCheckoutResponse{
+		CheckoutId: checkout.Id,
+		Status:     checkout.Status,
+		OrderId:    orderId,
+		Order:      order,
+	}
+	if message == "" {
+		message = fmt.Sprintf(utils.CartCheckedOutSuccessfully, userId)
+	}
+	utils.JsonResponse(resp, w, message, http.StatusCreated)
+}
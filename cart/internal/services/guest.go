@@ -0,0 +1,238 @@
+package services
+
+import (
+	"e-commerce-backend/cart/internal/models"
+	"e-commerce-backend/cart/pkg/constants"
+	"e-commerce-backend/cart/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+func getGuestIdFromContext(r *http.Request) string {
+	guestId, _ := r.Context().Value(utils.GuestIDKey).(string)
+	return guestId
+}
+
+// activeCartForRequest resolves the active cart of the logged-in user or of the guest cart token
+func activeCartForRequest(db *gorm.DB, r *http.Request, create bool) (models.CartHeader, error) {
+	var header models.CartHeader
+	if userId := utils.GetUserIdFromContext(r); userId != 0 {
+		if create {
+			return header, header.GetOrCreateActiveCart(db, userId)
+		}
+		return header, header.GetActiveCartByUserId(db, userId)
+	}
+
+	guestId := getGuestIdFromContext(r)
+	if guestId == "" {
+		return header, errors.New(utils.UserIdNotFoundInCtx)
+	}
+	if create {
+		return header, header.GetOrCreateActiveGuestCart(db, guestId)
+	}
+	return header, header.GetActiveCartByGuestId(db, guestId)
+}
+
+func getCartMergeStrategy() (string, bool, error) {
+	strategy := strings.ToLower(os.Getenv("CART_MERGE_STRATEGY"))
+	if strategy == "" {
+		strategy = constants.DefaultCartMergeStrategy
+	}
+	if strategy != constants.CartMergeStrategySum && strategy != constants.CartMergeStrategyMax {
+		return "", false, fmt.Errorf(utils.CartMergeStrategyInvalid, strategy)
+	}
+
+	capAtStock := true
+	if value := os.Getenv("CART_MERGE_CAP_AT_STOCK"); value != "" {
+		capAtStock, _ = strconv.ParseBool(value)
+	}
+	return strategy, capAtStock, nil
+}
+
+// mergeQuantities decides the quantity of every guest line once merged into the account cart, bundle lines
+// are not capped as the stock of a bundle is only known by holding it. The cap is the stock still available
+// plus what the guest line and the account line already hold
+func mergeQuantities(guestLines, userLines []models.Cart, strategy string, capAtStock bool) map[models.CartItemKey]int {
+	userQuantities := make(map[models.CartItemKey]int, len(userLines))
+	for _, line := range userLines {
+		userQuantities[line.ItemKey()] = line.Quantity
+	}
+
+	var batch payloads.ProductBatchResponse
+	var variants map[int]map[string]interface{}
+	if capAtStock {
+		var err error
+		if batch, err = fetchProductBatch(cartProductIds(guestLines)); err != nil {
+			utils.LogError(utils.ErrorProductMicroservices, map[string]interface{}{"error": err.Error()})
+		}
+		if variants, err = fetchCartVariants(guestLines); err != nil {
+			utils.LogError(utils.ErrorProductMicroservices, map[string]interface{}{"error": err.Error()})
+		}
+	}
+
+	quantities := make(map[models.CartItemKey]int, len(guestLines))
+	for _, line := range guestLines {
+		quantity := line.Quantity
+		if userQty, ok := userQuantities[line.ItemKey()]; ok {
+			if strategy == constants.CartMergeStrategyMax {
+				quantity = max(quantity, userQty)
+			} else {
+				quantity += userQty
+			}
+		}
+
+		if capAtStock && !line.IsBundle() {
+			product := batch.Products[line.ProductId]
+			if line.IsVariant() {
+				product = variants[line.VariantId]
+			}
+			if available, ok := product["available_quantity"].(float64); ok {
+				quantity = min(quantity, int(available)+line.Quantity+userQuantities[line.ItemKey()])
+			}
+		}
+		quantities[line.ItemKey()] = quantity
+	}
+	return quantities
+}
+
+// holdMergedLines holds every merged line at its merged quantity. A line whose stock can't be held anymore goes
+// back to the quantity it held before the merge, and is dropped when not even that can be held
+func holdMergedLines(db *gorm.DB, r *http.Request, target models.CartHeader, guestLines, userLines []models.Cart) error {
+	held := make(map[int]int, len(guestLines)+len(userLines))
+	for _, line := range guestLines {
+		held[line.Id] = line.Quantity
+	}
+	for _, line := range userLines {
+		held[line.Id] = line.Quantity
+	}
+	merged := make(map[models.CartItemKey]bool, len(guestLines))
+	for _, line := range guestLines {
+		merged[line.ItemKey()] = true
+	}
+
+	lines, err := target.GetLines(db)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if !merged[line.ItemKey()] || reserveCartLine(r, line) == nil {
+			continue
+		}
+		previous := min(held[line.Id], line.Quantity)
+		if previous > 0 && previous < line.Quantity {
+			line.Quantity = previous
+			if reserveCartLine(r, line) == nil {
+				if err := line.UpdateCart(db); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if err := line.DeleteCartItem(db); err != nil {
+			return err
+		}
+		if err := releaseCartLines(r, []models.Cart{line}); err != nil {
+			utils.LogError(utils.ReservationUpdateError, map[string]interface{}{"error": err.Error()})
+		}
+	}
+	return nil
+}
+
+// CreateGuestCart opens a cart for an anonymous shopper, the returned token has to be sent as X-Cart-Token
+func (db *Service) CreateGuestCart(w http.ResponseWriter, r *http.Request) {
+	guestId, cartToken := utils.GenerateCartToken()
+
+	var header models.CartHeader
+	if err := header.GetOrCreateActiveGuestCart(db.DB, guestId); err != nil {
+		utils.JsonError(w, utils.GuestCartCreationError, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := payloads.GuestCartResponse{
+		CartToken: cartToken,
+		Cart:      toCartResponse(header),
+	}
+	utils.JsonResponse(resp, w, utils.GuestCartCreated, http.StatusCreated)
+}
+
+// MergeGuestCart moves the guest cart of the X-Cart-Token header into the cart of the logged-in user,
+// called by the users service on login
+func (db *Service) MergeGuestCart(w http.ResponseWriter, r *http.Request) {
+	userId := utils.GetUserIdFromContext(r)
+
+	guestId, err := utils.VerifyCartToken(r.Header.Get(utils.CartTokenHeader))
+	if err != nil {
+		utils.JsonError(w, utils.InvalidCartToken, http.StatusBadRequest, err)
+		return
+	}
+
+	strategy, capAtStock, err := getCartMergeStrategy()
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusInternalServerError, err)
+		return
+	}
+
+	//avoiding race condition
+	cartMutex.Lock()
+	defer cartMutex.Unlock()
+
+	var guest models.CartHeader
+	if err := guest.GetActiveCartByGuestId(db.DB, guestId); err != nil {
+		utils.JsonError(w, utils.GuestCartNotFoundError, http.StatusNotFound, err)
+		return
+	}
+
+	var target models.CartHeader
+	if err := target.GetOrCreateActiveCart(db.DB, userId); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CartMergeError, userId), http.StatusInternalServerError, err)
+		return
+	}
+
+	guestLines, err := guest.GetLines(db.DB)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CartMergeError, userId), http.StatusInternalServerError, err)
+		return
+	}
+	userLines, err := target.GetLines(db.DB)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CartMergeError, userId), http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := target.SetNotifyEmail(db.DB, utils.GetUserEmailFromContext(r)); err != nil {
+		utils.LogError(utils.CartUnexpectedUpdateError, map[string]interface{}{"error": err.Error()})
+	}
+
+	quantities := mergeQuantities(guestLines, userLines, strategy, capAtStock)
+	if err := models.MergeGuestCart(db.DB, &guest, &target, quantities); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CartMergeError, userId), http.StatusInternalServerError, err)
+		return
+	}
+
+	//guest lines merged into an account line or dropped are gone, a hold which could not be released expires on its own
+	userItems := make(map[models.CartItemKey]bool, len(userLines))
+	for _, line := range userLines {
+		userItems[line.ItemKey()] = true
+	}
+	var removed []models.Cart
+	for _, line := range guestLines {
+		if userItems[line.ItemKey()] || quantities[line.ItemKey()] <= 0 {
+			removed = append(removed, line)
+		}
+	}
+	if err := releaseCartLines(r, removed); err != nil {
+		utils.LogError(utils.ReservationUpdateError, map[string]interface{}{"error": err.Error()})
+	}
+	if err := holdMergedLines(db.DB, r, target, guestLines, userLines); err != nil {
+		utils.LogError(utils.ReservationUpdateError, map[string]interface{}{"error": err.Error()})
+	}
+
+	utils.JsonResponse(toCartResponse(target), w, fmt.Sprintf(utils.CartMergedSuccessfully, userId), http.StatusOK)
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"e-commerce-backend/cart/internal/models"
+	"e-commerce-backend/cart/pkg/constants"
+	"e-commerce-backend/cart/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func productInt(product map[string]interface{}, key string) int {
+	value, _ := product[key].(float64)
+	return int(value)
+}
+
+// checkQuantityRules returns the line error for a quantity the rules of the product don't allow, purchased is
+// what the customer already bought of it inside the purchase window
+func checkQuantityRules(cartId, productId int, product map[string]interface{}, quantity, purchased int) *payloads.CartLineWarning {
+	lineError := &payloads.CartLineWarning{CartId: cartId, ProductId: productId, NewValue: float64(quantity), Blocking: true}
+
+	if minQty := productInt(product, "min_order_quantity"); minQty > 1 && quantity < minQty {
+		lineError.Code = constants.CartErrorBelowMinQuantity
+		lineError.Message = fmt.Sprintf(utils.CartBelowMinQuantity, productId, minQty, quantity)
+		lineError.OldValue = float64(minQty)
+		return lineError
+	}
+	if maxQty := productInt(product, "max_order_quantity"); maxQty > 0 && quantity > maxQty {
+		lineError.Code = constants.CartErrorAboveMaxQuantity
+		lineError.Message = fmt.Sprintf(utils.CartAboveMaxQuantity, maxQty, productId, quantity)
+		lineError.OldValue = float64(maxQty)
+		return lineError
+	}
+	if step := productInt(product, "quantity_step"); step > 1 && quantity%step != 0 {
+		lineError.Code = constants.CartErrorInvalidQuantityStep
+		lineError.Message = fmt.Sprintf(utils.CartInvalidQtyStep, productId, step, quantity)
+		lineError.OldValue = float64(step)
+		return lineError
+	}
+	if limit := productInt(product, "max_per_customer"); limit > 0 && purchased+quantity > limit {
+		lineError.Code = constants.CartErrorCustomerLimitReached
+		lineError.Message = fmt.Sprintf(utils.CartCustomerLimit, limit, productId, purchased, quantity)
+		lineError.OldValue = float64(limit)
+		return lineError
+	}
+	return nil
+}
+
+// purchasedInWindow is what the user bought of the product inside its purchase window, it is only looked up
+// for products with a per customer limit and guests have no history
+func purchasedInWindow(db *gorm.DB, userId, productId int, product map[string]interface{}) (int, error) {
+	if userId == 0 || productInt(product, "max_per_customer") <= 0 {
+		return 0, nil
+	}
+	var since time.Time
+	if days := productInt(product, "purchase_window_days"); days > 0 {
+		since = time.Now().AddDate(0, 0, -days)
+	}
+	return models.GetPurchasedQuantity(db, userId, productId, since)
+}
+
+// checkLineQuantity applies the quantity rules of the product to the line, a bundle line applies the rules of
+// every product in the bundle to what the line buys of it
+func checkLineQuantity(db *gorm.DB, line models.Cart, product map[string]interface{}) (*payloads.CartLineWarning, error) {
+	if line.IsBundle() {
+		return checkBundleQuantity(db, line, product)
+	}
+	purchased, err := purchasedInWindow(db, line.UserId, line.ProductId, product)
+	if err != nil {
+		return nil, err
+	}
+	return checkQuantityRules(line.Id, line.ProductId, product, line.Quantity, purchased), nil
+}
+
+// bundleComponents quantity of every product in one bundle keyed by product id
+func bundleComponents(bundle map[string]interface{}) map[int]int {
+	components := map[int]int{}
+	items, _ := bundle["items"].([]interface{})
+	for _, item := range items {
+		component, _ := item.(map[string]interface{})
+		components[productInt(component, "product_id")] += productInt(component, "quantity")
+	}
+	return components
+}
+
+// checkBundleQuantity checks the component quantity times the bundle quantity against the rules of every product
+// in the bundle, a product which is gone is left to the stock check
+func checkBundleQuantity(db *gorm.DB, line models.Cart, bundle map[string]interface{}) (*payloads.CartLineWarning, error) {
+	components := bundleComponents(bundle)
+	productIds := make([]int, 0, len(components))
+	for productId := range components {
+		productIds = append(productIds, productId)
+	}
+	slices.Sort(productIds)
+
+	batch, err := fetchProductBatch(productIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, productId := range productIds {
+		product, ok := batch.Products[productId]
+		if !ok {
+			continue
+		}
+		purchased, err := purchasedInWindow(db, line.UserId, productId, product)
+		if err != nil {
+			return nil, err
+		}
+		if lineError := checkQuantityRules(line.Id, productId, product, components[productId]*line.Quantity, purchased); lineError != nil {
+			lineError.BundleId = line.BundleId
+			return lineError, nil
+		}
+	}
+	return nil, nil
+}
+
+// fetchBundle looks up the cart view of a bundle, a bundle the product service doesn't know is returned as nil
+func fetchBundle(bundleId int) (map[string]interface{}, error) {
+	links := constants.MicroserviceLinks()
+	resp, err := http.Get(fmt.Sprintf(links["bundleMSCallLink"], bundleId))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(utils.ErrorProductMicroservices+": status code %d", resp.StatusCode)
+	}
+
+	var bundleResp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&bundleResp); err != nil {
+		return nil, err
+	}
+	return bundleResp.Data, nil
+}
+
+// fetchCartBundles looks up the bundles of the bundle lines keyed by bundle id, unknown bundles are left out
+func fetchCartBundles(lines []models.Cart) (map[int]map[string]interface{}, error) {
+	bundles := map[int]map[string]interface{}{}
+	for _, line := range lines {
+		if !line.IsBundle() {
+			continue
+		}
+		if _, fetched := bundles[line.BundleId]; fetched {
+			continue
+		}
+		bundle, err := fetchBundle(line.BundleId)
+		if err != nil {
+			return nil, err
+		}
+		if bundle != nil {
+			bundles[line.BundleId] = bundle
+		}
+	}
+	return bundles, nil
+}
+
+// bundleUnavailable is the line error of a bundle which is unknown or no longer sold
+func bundleUnavailable(cartId, bundleId int, bundle map[string]interface{}) *payloads.CartLineWarning {
+	if active, _ := bundle["is_active"].(bool); bundle != nil && active {
+		return nil
+	}
+	return &payloads.CartLineWarning{
+		CartId:   cartId,
+		BundleId: bundleId,
+		Code:     constants.CartErrorBundleUnavailable,
+		Message:  fmt.Sprintf(utils.CartBundleUnavailable, bundleId),
+		Blocking: true,
+	}
+}
+
+// insufficientStock is the line error of a quantity the stock can't cover
+func insufficientStock(line models.Cart, available int) *payloads.CartLineWarning {
+	lineError := &payloads.CartLineWarning{
+		CartId:    line.Id,
+		ProductId: line.ProductId,
+		VariantId: line.VariantId,
+		BundleId:  line.BundleId,
+		Code:      constants.CartWarningInsufficientStock,
+		OldValue:  float64(line.Quantity),
+		NewValue:  float64(available),
+		Blocking:  true,
+	}
+	if line.IsBundle() {
+		lineError.Message = fmt.Sprintf(utils.CartBundleNotInStock, available, line.BundleId, line.Quantity)
+	} else if line.IsVariant() {
+		lineError.Message = fmt.Sprintf(utils.CartVariantNotInStock, available, line.VariantId, line.Quantity)
+	} else {
+		lineError.Message = fmt.Sprintf(utils.CartInsufficientStock, available, line.ProductId, line.Quantity)
+	}
+	return lineError
+}
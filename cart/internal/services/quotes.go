@@ -0,0 +1,322 @@
+package services
+
+import (
+	"e-commerce-backend/cart/internal/models"
+	"e-commerce-backend/cart/pkg/constants"
+	"e-commerce-backend/cart/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type QuoteServices struct {
+	DB *gorm.DB
+}
+
+func NewQuoteServices(db *gorm.DB) *QuoteServices {
+	return &QuoteServices{db}
+}
+
+type QuoteService interface {
+	RequestQuote(w http.ResponseWriter, r *http.Request)
+	GetQuotes(w http.ResponseWriter, r *http.Request)
+	GetQuote(w http.ResponseWriter, r *http.Request)
+	AcceptQuote(w http.ResponseWriter, r *http.Request)
+	RejectQuote(w http.ResponseWriter, r *http.Request)
+	GetAllQuotes(w http.ResponseWriter, r *http.Request)
+	PriceQuote(w http.ResponseWriter, r *http.Request)
+}
+
+var quoteStatuses = []string{models.QuoteStatusRequested, models.QuoteStatusPriced, models.QuoteStatusAccepted, models.QuoteStatusRejected}
+
+// getUserQuote loads the quote of the path id owned by the caller, it responds itself when the quote can't be used
+func (qs *QuoteServices) getUserQuote(w http.ResponseWriter, r *http.Request) (models.Quote, bool) {
+	var quote models.Quote
+	quoteId, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidCartRequest, http.StatusBadRequest, err)
+		return quote, false
+	}
+	if err := quote.GetQuoteByIdAndUserId(qs.DB, quoteId, utils.GetUserIdFromContext(r)); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.QuoteNotFoundError, quoteId), http.StatusNotFound, err)
+		return quote, false
+	}
+	return quote, true
+}
+
+// releaseQuoteStock gives back the stock held for the quote, a hold which could not be released expires on its own
+func releaseQuoteStock(r *http.Request, quoteId int) {
+	links := constants.MicroserviceLinks()
+	reference := utils.QuoteReservationReference(quoteId)
+	if _, err := callReservationService(r, links["releaseReservationsMSCallLink"], map[string]interface{}{"references": []string{reference}}); err != nil {
+		utils.LogError(fmt.Sprintf(utils.ReservationReleaseError, reference), map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// RequestQuote turns the products of the active cart into a quote request (POST /user/cart/quote), business
+// customers only. The quoted lines leave the cart and their holds are released, bundles stay in the cart
+func (qs *QuoteServices) RequestQuote(w http.ResponseWriter, r *http.Request) {
+	userId := utils.GetUserIdFromContext(r)
+
+	var req payloads.QuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.JsonError(w, utils.InvalidCartRequest, http.StatusBadRequest, err)
+		return
+	}
+
+	//avoiding race condition
+	cartMutex.Lock()
+	defer cartMutex.Unlock()
+
+	var header models.CartHeader
+	if err := header.GetActiveCartByUserId(qs.DB, userId); err != nil {
+		utils.JsonError(w, utils.CartEmptyError, http.StatusBadRequest, err)
+		return
+	}
+	lines, err := header.GetLines(qs.DB)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.QuoteCreationError, userId), http.StatusInternalServerError, err)
+		return
+	}
+
+	var productLines []models.Cart
+	for _, line := range lines {
+		if !line.IsBundle() {
+			productLines = append(productLines, line)
+		}
+	}
+	if len(productLines) == 0 {
+		utils.JsonError(w, utils.QuoteNoProductLines, http.StatusBadRequest, nil)
+		return
+	}
+
+	batch, err := fetchProductBatch(cartProductIds(productLines))
+	if err != nil {
+		utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+	variants, err := fetchCartVariants(productLines)
+	if err != nil {
+		utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+
+	quote := models.Quote{UserId: userId, CartHeaderId: header.Id, CustomerNotes: req.Notes}
+	for _, line := range productLines {
+		product, ok := batch.Products[line.ProductId]
+		if !ok {
+			utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, line.ProductId), http.StatusBadRequest, nil)
+			return
+		}
+		if line.IsVariant() {
+			if product, ok = variants[line.VariantId]; !ok {
+				utils.JsonError(w, fmt.Sprintf(utils.CartVariantUnavailable, line.VariantId), http.StatusBadRequest, nil)
+				return
+			}
+		}
+		price, _ := product["price"].(float64)
+		discount, _ := product["discount"].(float64)
+		quote.Lines = append(quote.Lines, models.QuoteLine{ProductId: line.ProductId, VariantId: line.VariantId, Quantity: line.Quantity, ListPrice: price, ListDiscount: discount})
+	}
+
+	if err := quote.CreateQuote(qs.DB, productLines); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.QuoteCreationError, userId), http.StatusInternalServerError, err)
+		return
+	}
+
+	//the stock is held again once the quote is accepted
+	if err := releaseCartLines(r, productLines); err != nil {
+		utils.LogError(utils.ReservationUpdateError, map[string]interface{}{"error": err.Error()})
+	}
+
+	utils.JsonResponse(quote, w, fmt.Sprintf(utils.QuoteRequested, quote.Id), http.StatusCreated)
+}
+
+func (qs *QuoteServices) GetQuotes(w http.ResponseWriter, r *http.Request) {
+	quotes, err := models.GetQuotesByUserId(qs.DB, utils.GetUserIdFromContext(r))
+	if err != nil {
+		utils.JsonError(w, utils.CartUnexpectedFetchError, http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(quotes, w, fmt.Sprintf(utils.QuotesFetched, len(quotes)), http.StatusOK)
+}
+
+// GetQuote is also how the order service reads the negotiated prices when the quote is accepted
+func (qs *QuoteServices) GetQuote(w http.ResponseWriter, r *http.Request) {
+	quote, ok := qs.getUserQuote(w, r)
+	if !ok {
+		return
+	}
+	utils.JsonResponse(quote, w, fmt.Sprintf(utils.QuoteFetched, quote.Id), http.StatusOK)
+}
+
+// AcceptQuote holds the stock of the quote and has the order service place the order at the negotiated prices
+// (POST /user/cart/quotes/{id}/accept), the holds are released again when the order is not placed
+func (qs *QuoteServices) AcceptQuote(w http.ResponseWriter, r *http.Request) {
+	userId := utils.GetUserIdFromContext(r)
+
+	//payment details are optional, the order service falls back to its defaults
+	var req payloads.CartCheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.JsonError(w, utils.InvalidCartRequest, http.StatusBadRequest, err)
+		return
+	}
+
+	//avoiding race condition, a quote is accepted once
+	cartMutex.Lock()
+	defer cartMutex.Unlock()
+
+	quote, ok := qs.getUserQuote(w, r)
+	if !ok {
+		return
+	}
+	if quote.Status == models.QuoteStatusRequested {
+		utils.JsonError(w, fmt.Sprintf(utils.QuoteNotPriced, quote.Id), http.StatusConflict, nil)
+		return
+	}
+	if quote.Status != models.QuoteStatusPriced {
+		utils.JsonError(w, fmt.Sprintf(utils.QuoteNotOpen, quote.Id, quote.Status), http.StatusConflict, nil)
+		return
+	}
+	if quote.IsExpired() {
+		utils.JsonError(w, fmt.Sprintf(utils.QuoteExpired, quote.Id, quote.ExpiresAt.Format(time.DateOnly)), http.StatusConflict, nil)
+		return
+	}
+
+	links := constants.MicroserviceLinks()
+	reference := utils.QuoteReservationReference(quote.Id)
+	for _, line := range quote.Lines {
+		payload := map[string]interface{}{"reference": reference, "quantity": line.Quantity}
+		link := fmt.Sprintf(links["reserveProductMSCallLink"], line.ProductId)
+		if line.VariantId > 0 {
+			link = fmt.Sprintf(links["reserveVariantMSCallLink"], line.VariantId)
+		}
+		if _, err := callReservationService(r, link, payload); err != nil {
+			releaseQuoteStock(r, quote.Id)
+			utils.JsonError(w, fmt.Sprintf(utils.QuoteStockUnavailable, quote.Id), http.StatusConflict, err)
+			return
+		}
+	}
+
+	payload := map[string]interface{}{
+		"payment_method": req.PaymentMethod,
+		"tenders":        req.Tenders,
+	}
+	status, orderResp, err := callOrderService(r, fmt.Sprintf(links["orderQuoteMSCallLink"], userId, quote.Id), payload)
+	if err != nil {
+		releaseQuoteStock(r, quote.Id)
+		utils.JsonError(w, utils.ErrorCallingOrderMicroservice, http.StatusBadGateway, err)
+		return
+	}
+
+	message, _ := orderResp["message"].(string)
+	if status != http.StatusOK {
+		releaseQuoteStock(r, quote.Id)
+		err := fmt.Errorf("%s: %s", fmt.Sprintf(utils.QuoteOrderRejected, quote.Id), message)
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+
+	order, _ := orderResp["data"].(map[string]interface{})
+	orderId := 0
+	if id, ok := order["order_id"].(float64); ok {
+		orderId = int(id)
+	}
+
+	//the order service accepted the quote already, this only records the order on the quote in hand. The order
+	//exists at this point, a failed update is logged and the order still returned to the client
+	if err := quote.Accept(qs.DB, orderId); err != nil {
+		utils.LogError(fmt.Sprintf(utils.QuoteAcceptConfirmError, orderId, quote.Id), map[string]interface{}{"error": err.Error()})
+	}
+
+	resp := payloads.QuoteAcceptResponse{QuoteId: quote.Id, Status: quote.Status, OrderId: orderId, Order: order}
+	utils.JsonResponse(resp, w, fmt.Sprintf(utils.QuoteAccepted, quote.Id, orderId), http.StatusCreated)
+}
+
+// RejectQuote lets the customer decline an open quote (POST /user/cart/quotes/{id}/reject)
+func (qs *QuoteServices) RejectQuote(w http.ResponseWriter, r *http.Request) {
+	quote, ok := qs.getUserQuote(w, r)
+	if !ok {
+		return
+	}
+	if quote.Status != models.QuoteStatusRequested && quote.Status != models.QuoteStatusPriced {
+		utils.JsonError(w, fmt.Sprintf(utils.QuoteNotOpen, quote.Id, quote.Status), http.StatusConflict, nil)
+		return
+	}
+
+	if err := quote.Reject(qs.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.QuoteUpdateError, quote.Id), http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(quote, w, fmt.Sprintf(utils.QuoteRejected, quote.Id), http.StatusOK)
+}
+
+// GetAllQuotes lists the quotes of every customer (GET /admin/quotes?status=requested), admin only
+func (qs *QuoteServices) GetAllQuotes(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !slices.Contains(quoteStatuses, status) {
+		utils.JsonError(w, fmt.Sprintf(utils.InvalidQuoteStatusFilter, status), http.StatusBadRequest, nil)
+		return
+	}
+
+	quotes, err := models.GetQuotesByStatus(qs.DB, status)
+	if err != nil {
+		utils.JsonError(w, utils.CartUnexpectedFetchError, http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(quotes, w, fmt.Sprintf(utils.QuotesFetched, len(quotes)), http.StatusOK)
+}
+
+// PriceQuote sets the negotiated price of every line and the expiry of the quote (PUT /admin/quotes/{id}/price),
+// admin only. A priced quote can be repriced until the customer accepts or rejects it
+func (qs *QuoteServices) PriceQuote(w http.ResponseWriter, r *http.Request) {
+	quoteId, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidCartRequest, http.StatusBadRequest, err)
+		return
+	}
+
+	var req payloads.QuotePriceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidCartRequest, http.StatusBadRequest, err)
+		return
+	}
+	if !req.ExpiresAt.After(time.Now()) {
+		utils.JsonError(w, utils.QuoteExpiryInPast, http.StatusBadRequest, nil)
+		return
+	}
+
+	var quote models.Quote
+	if err := quote.GetQuoteById(qs.DB, quoteId); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.QuoteNotFoundError, quoteId), http.StatusNotFound, err)
+		return
+	}
+	if quote.Status != models.QuoteStatusRequested && quote.Status != models.QuoteStatusPriced {
+		utils.JsonError(w, fmt.Sprintf(utils.QuoteNotOpen, quote.Id, quote.Status), http.StatusConflict, nil)
+		return
+	}
+
+	prices := make(map[int]float64, len(req.Lines))
+	for _, line := range req.Lines {
+		prices[line.LineId] = line.Price
+	}
+	for _, line := range quote.Lines {
+		if utils.ToCents(prices[line.Id]) <= 0 {
+			utils.JsonError(w, fmt.Sprintf(utils.QuotePriceMissing, quote.Id), http.StatusBadRequest, nil)
+			return
+		}
+	}
+
+	if err := quote.SetPrices(qs.DB, prices, req.ExpiresAt, req.AdminNotes); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.QuoteUpdateError, quote.Id), http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(quote, w, fmt.Sprintf(utils.QuotePriced, quote.Id), http.StatusOK)
+}
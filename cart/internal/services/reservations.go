@@ -0,0 +1,90 @@
+package services
+
+import (
+	"bytes"
+	"e-commerce-backend/cart/internal/models"
+	"e-commerce-backend/cart/pkg/constants"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// callReservationService calls the reservation endpoints of the product service, which only take calls of the services
+func callReservationService(r *http.Request, link string, payload map[string]interface{}) (map[string]interface{}, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal body: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, link, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	utils.SetServiceToken(req)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if msg, ok := body["error"].(string); ok {
+			return body, fmt.Errorf("%s", msg)
+		}
+		return body, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// reserveCartLine holds the full quantity of the cart line, quantity 0 releases the hold. Variant lines hold
+// stock of the variant and bundle lines every product of the bundle under the line reference
+func reserveCartLine(r *http.Request, line models.Cart) error {
+	links := constants.MicroserviceLinks()
+	payload := map[string]interface{}{
+		"reference": utils.CartLineReservationReference(line.Id),
+		"quantity":  line.Quantity,
+	}
+	link := fmt.Sprintf(links["reserveProductMSCallLink"], line.ProductId)
+	if line.IsBundle() {
+		link = fmt.Sprintf(links["reserveBundleMSCallLink"], line.BundleId)
+	} else if line.IsVariant() {
+		link = fmt.Sprintf(links["reserveVariantMSCallLink"], line.VariantId)
+	}
+	_, err := callReservationService(r, link, payload)
+	return err
+}
+
+func cartLineReferences(lines []models.Cart) []string {
+	references := make([]string, 0, len(lines))
+	for _, line := range lines {
+		references = append(references, utils.CartLineReservationReference(line.Id))
+	}
+	return references
+}
+
+func releaseCartLines(r *http.Request, lines []models.Cart) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	links := constants.MicroserviceLinks()
+	_, err := callReservationService(r, links["releaseReservationsMSCallLink"], map[string]interface{}{"references": cartLineReferences(lines)})
+	return err
+}
+
+// extendCartLines keeps the holds of an active cart alive, a failure only means they may expire earlier
+func extendCartLines(r *http.Request, lines []models.Cart) {
+	if len(lines) == 0 {
+		return
+	}
+	links := constants.MicroserviceLinks()
+	if _, err := callReservationService(r, links["extendReservationsMSCallLink"], map[string]interface{}{"references": cartLineReferences(lines)}); err != nil {
+		utils.LogError(utils.ReservationUpdateError, map[string]interface{}{"error": err.Error()})
+	}
+}
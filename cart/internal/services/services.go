@@ -1,7 +1,6 @@
 package services
 
 import (
-	"bytes"
 	"e-commerce-backend/cart/internal/models"
 	"e-commerce-backend/cart/pkg/constants"
 	"e-commerce-backend/cart/pkg/payloads"
@@ -9,7 +8,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -48,6 +46,11 @@ type CartInterface interface {
 	CheckProductStock(productId int, quantity int) (bool, error)
 	GetCartByCartId(w http.ResponseWriter, r *http.Request)
 	ClearCart(w http.ResponseWriter, r *http.Request)
+	UpdateCartDetails(w http.ResponseWriter, r *http.Request)
+	CreateGuestCart(w http.ResponseWriter, r *http.Request)
+	MergeGuestCart(w http.ResponseWriter, r *http.Request)
+	ValidateCartLines(w http.ResponseWriter, r *http.Request)
+	AcknowledgeCartChanges(w http.ResponseWriter, r *http.Request)
 }
 
 func verifyUserUsingIdAndCtxId(r *http.Request) (int, bool) {
@@ -68,82 +71,251 @@ func getCartIdFromParams(r *http.Request) (int, bool) {
 	return cartId, true
 }
 
-func fetchProductUsingMicroservices(productId int) (map[string]interface{}, error) {
-	productServiceURL := fmt.Sprintf(constants.ProductMicroserviceGetProductCall, productId)
-	resp, err := http.Get(productServiceURL)
-	if err != nil {
-		utils.LogError(fmt.Sprintf(constants.FailedToFetchProductDetails, productId), map[string]interface{}{"error": err.Error()})
-		return nil, err
+// fetchProductBatch looks up the products of several cart lines with the batch endpoint of the product service,
+// products which could not be served are returned in Errors keyed by product id
+func fetchProductBatch(productIds []int) (payloads.ProductBatchResponse, error) {
+	links := constants.MicroserviceLinks()
+	batch := payloads.ProductBatchResponse{
+		Products: make(map[int]map[string]interface{}, len(productIds)),
+		Errors:   map[int]string{},
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		utils.LogError(fmt.Sprintf(constants.ProductNotFound, productId), map[string]interface{}{})
-		return nil, err
-	}
+	for start := 0; start < len(productIds); start += constants.ProductBatchSize {
+		end := min(start+constants.ProductBatchSize, len(productIds))
+		ids := make([]string, 0, end-start)
+		for _, id := range productIds[start:end] {
+			ids = append(ids, strconv.Itoa(id))
+		}
 
-	// Decode the product details
-	var product map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&product); err != nil {
-		utils.LogError(fmt.Sprintf(constants.ErrorDecodingProductDetails, productId), map[string]interface{}{"error": err.Error()})
-		return nil, err
-	}
+		productServiceURL := fmt.Sprintf(links["productBatchMSCallLink"], strings.Join(ids, ","))
+		resp, err := http.Get(productServiceURL)
+		if err != nil {
+			return batch, err
+		}
 
-	if product == nil {
-		utils.LogError(fmt.Sprintf(constants.ProductNotFound, productId), map[string]interface{}{"error": err.Error()})
-		return nil, err
-	}
+		var batchResp struct {
+			Data payloads.ProductBatchResponse `json:"data"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&batchResp)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return batch, fmt.Errorf(utils.ErrorProductMicroservices+": status code %d", resp.StatusCode)
+		}
+		if err != nil {
+			return batch, err
+		}
 
-	data, ok := product["data"].(map[string]interface{})
-	if !ok {
-		utils.LogError(constants.ProductDetailsNotEnough, map[string]interface{}{"error": err.Error()})
-		return nil, err
+		for id, product := range batchResp.Data.Products {
+			batch.Products[id] = product
+		}
+		for id, msg := range batchResp.Data.Errors {
+			batch.Errors[id] = msg
+		}
+		batch.Deleted = append(batch.Deleted, batchResp.Data.Deleted...)
 	}
 
-	return data, nil
+	return batch, nil
+}
+
+// cartProductIds product ids of the lines, bundle lines have none and are looked up with fetchCartBundles
+func cartProductIds(lines []models.Cart) []int {
+	ids := make([]int, 0, len(lines))
+	for _, line := range lines {
+		if !line.IsBundle() {
+			ids = append(ids, line.ProductId)
+		}
+	}
+	return ids
 }
 
 func (db *Service) GetCartItemByUserID(w http.ResponseWriter, r *http.Request) {
 	userId := utils.GetUserIdFromContext(r)
 
-	var cart models.Cart
-	cartItems, err := cart.GetCartByUserId(db.DB, userId)
+	header, err := activeCartForRequest(db.DB, r, false)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			//nothing added yet, respond with an empty cart
+			cartResp := payloads.CartResponse{Status: models.CartStatusActive, Currency: constants.DefaultCurrency, Items: []payloads.CartItemResponse{}}
+			cartResp.Totals = calculateCartTotals(cartResp.Items, 0)
+			utils.JsonResponse(cartResp, w, fmt.Sprintf(utils.CartFetchedSuccessfully, userId), http.StatusOK)
+			return
+		}
+		utils.JsonError(w, fmt.Sprintf(utils.UserCartNotFoundError, userId), http.StatusNotFound, err)
+		return
+	}
+
+	cartItems, err := header.GetLines(db.DB)
 	if err != nil {
 		utils.JsonError(w, fmt.Sprintf(utils.UserCartNotFoundError, userId), http.StatusNotFound, err)
 		return
 	}
 
-	var cartResp payloads.CartResponse
+	cartResp := toCartResponse(header)
+	if cartResp.Items, err = cartItemResponses(cartItems); err != nil {
+		utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+	cartResp.Totals = calculateCartTotals(cartResp.Items, cartCouponPercent(db.DB, header))
+
+	utils.JsonResponse(cartResp, w, fmt.Sprintf(utils.CartFetchedSuccessfully, userId), http.StatusOK)
+}
+
+// cartItemResponses prices the lines with the current products, variants and bundles, fetched in one call for
+// all products, a missing product only fails its own line
+func cartItemResponses(cartItems []models.Cart) ([]payloads.CartItemResponse, error) {
+	items := []payloads.CartItemResponse{}
+	batch, err := fetchProductBatch(cartProductIds(cartItems))
+	if err != nil {
+		return nil, err
+	}
+	bundles, err := fetchCartBundles(cartItems)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := fetchCartVariants(cartItems)
+	if err != nil {
+		return nil, err
+	}
 
-	//fetching product details using product id
 	for _, cartItem := range cartItems {
-		product, err := fetchProductUsingMicroservices(cartItem.ProductId)
-		if err != nil {
-			return
+		product, ok := batch.Products[cartItem.ProductId]
+		if cartItem.IsBundle() {
+			product, ok = bundles[cartItem.BundleId]
+		} else if cartItem.IsVariant() && ok {
+			product, ok = variants[cartItem.VariantId]
+		}
+		if !ok {
+			msg, found := batch.Errors[cartItem.ProductId]
+			if cartItem.IsBundle() {
+				msg, found = fmt.Sprintf(utils.CartBundleUnavailable, cartItem.BundleId), true
+			} else if cartItem.IsVariant() && !found {
+				msg, found = fmt.Sprintf(utils.CartVariantUnavailable, cartItem.VariantId), true
+			}
+			if !found {
+				msg = fmt.Sprintf(utils.ProductNotFoundError, cartItem.ProductId)
+			}
+			items = append(items, payloads.CartItemResponse{
+				Id:        cartItem.Id,
+				VariantId: cartItem.VariantId,
+				BundleId:  cartItem.BundleId,
+				Quantity:  cartItem.Quantity,
+				Error:     msg,
+			})
+			continue
 		}
 
 		price := product["price"].(float64) * float64(cartItem.Quantity)
-		cartRespItem := payloads.CartItemResponse{
-			Id:       cartItem.Id,
-			Product:  product,
-			Quantity: cartItem.Quantity,
-			Price:    price,
-		}
+		discountPct, _ := product["discount"].(float64)
+		items = append(items, payloads.CartItemResponse{
+			Id:        cartItem.Id,
+			VariantId: cartItem.VariantId,
+			BundleId:  cartItem.BundleId,
+			Product:   product,
+			Quantity:  cartItem.Quantity,
+			Price:     price,
+			Discount:  price * (discountPct / 100),
+		})
+	}
+	return items, nil
+}
 
-		cartResp.Items = append(cartResp.Items, cartRespItem)
+func toCartResponse(header models.CartHeader) payloads.CartResponse {
+	expiresAt := header.ExpiresAt
+	return payloads.CartResponse{
+		CartId:         header.Id,
+		Status:         header.Status,
+		Currency:       header.Currency,
+		CouponCode:     header.CouponCode,
+		Notes:          header.Notes,
+		AddressId:      header.AddressId,
+		ShippingMethod: header.ShippingMethod,
+		ExpiresAt:      &expiresAt,
+		Items:          []payloads.CartItemResponse{},
 	}
+}
 
-	utils.JsonResponse(cartResp, w, fmt.Sprintf(utils.CartFetchedSuccessfully, userId), http.StatusOK)
+// cartCouponPercent percent off of the coupon on the cart, 0 when there is none or it was redeemed meanwhile
+func cartCouponPercent(db *gorm.DB, header models.CartHeader) float64 {
+	if header.CouponCode == "" {
+		return 0
+	}
+	coupon, err := models.GetUnusedCoupon(db, header.UserId, header.CouponCode)
+	if err != nil {
+		return 0
+	}
+	return coupon.CouponPercent
 }
 
-func (db *Service) AddToCart(w http.ResponseWriter, r *http.Request) {
-	token := utils.GetTokenFromRequestHeader(r)
-	if token == "" {
-		utils.JsonError(w, utils.MissingAuthorizationHeader, http.StatusUnauthorized, nil)
-		return
+// calculateCartTotals applies the same discount and tax rules as the order checkout, the coupon comes off what
+// is left after the product discounts. Shipping is a flat fee waived above the free shipping threshold
+func calculateCartTotals(items []payloads.CartItemResponse, couponPercent float64) *payloads.CartTotals {
+	var subTotal, discount int64
+	for _, item := range items {
+		subTotal += utils.ToCents(item.Price)
+		discount += utils.ToCents(item.Discount)
+	}
+	discount += utils.ToCents(float64(subTotal-discount) * couponPercent / 100 / 100)
+
+	taxable := subTotal - discount
+	tax := utils.ToCents(float64(taxable) * constants.CartTaxPercent / 100 / 100)
+	var shipping int64
+	if len(items) > 0 && taxable < utils.ToCents(constants.FreeShippingThreshold) {
+		shipping = utils.ToCents(constants.FlatShippingFee)
+	}
+
+	return &payloads.CartTotals{
+		SubTotal:         float64(subTotal) / 100,
+		Discount:         float64(discount) / 100,
+		Tax:              float64(tax) / 100,
+		ShippingEstimate: float64(shipping) / 100,
+		Total:            float64(taxable+tax+shipping) / 100,
 	}
+}
+
+// UpdateCartDetails sets the checkout details kept on the cart (coupon, notes, address, shipping method)
+func (db *Service) UpdateCartDetails(w http.ResponseWriter, r *http.Request) {
 	userId := utils.GetUserIdFromContext(r)
 
+	var req payloads.CartDetailsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidCartRequest, http.StatusBadRequest, err)
+		return
+	}
+	//only coupons sent to the user with a cart reminder and not redeemed yet are accepted
+	couponCode := strings.ToUpper(strings.TrimSpace(req.CouponCode))
+	if couponCode != "" {
+		if _, err := models.GetUnusedCoupon(db.DB, userId, couponCode); err != nil {
+			err := fmt.Errorf(utils.CartCouponInvalid, couponCode)
+			utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	var header models.CartHeader
+	if err := header.GetOrCreateActiveCart(db.DB, userId); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CartDetailsUpdateError, userId), http.StatusInternalServerError, err)
+		return
+	}
+
+	header.CouponCode = couponCode
+	header.Notes = req.Notes
+	header.AddressId = req.AddressId
+	header.ShippingMethod = req.ShippingMethod
+	if err := header.UpdateCartDetails(db.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CartDetailsUpdateError, userId), http.StatusInternalServerError, err)
+		return
+	}
+	if err := header.SetNotifyEmail(db.DB, utils.GetUserEmailFromContext(r)); err != nil {
+		utils.LogError(utils.CartUnexpectedUpdateError, map[string]interface{}{"error": err.Error()})
+	}
+	if lines, err := header.GetLines(db.DB); err == nil {
+		extendCartLines(r, lines)
+	}
+
+	utils.JsonResponse(toCartResponse(header), w, fmt.Sprintf(utils.CartDetailsUpdated, userId), http.StatusOK)
+}
+
+func (db *Service) AddToCart(w http.ResponseWriter, r *http.Request) {
 	var req payloads.CartRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
@@ -154,32 +326,138 @@ func (db *Service) AddToCart(w http.ResponseWriter, r *http.Request) {
 	cartMutex.Lock()
 	defer cartMutex.Unlock()
 
+	header, err := activeCartForRequest(db.DB, r, true)
+	if err != nil {
+		utils.JsonError(w, utils.CartItemAdditionError, http.StatusInternalServerError, err)
+		return
+	}
+	if err := header.SetNotifyEmail(db.DB, utils.GetUserEmailFromContext(r)); err != nil {
+		utils.LogError(utils.CartUnexpectedUpdateError, map[string]interface{}{"error": err.Error()})
+	}
+
+	db.addItemsToCart(w, r, header, req.Items)
+}
+
+// addItemsToCart adds the items to the cart and writes the response, items which break a rule or can't be
+// held are reported per line while the others are still added. The caller holds cartMutex
+func (db *Service) addItemsToCart(w http.ResponseWriter, r *http.Request, header models.CartHeader, items []payloads.CartItem) {
+	//userId is 0 for guest carts
+	userId := utils.GetUserIdFromContext(r)
+
 	//response
-	var cartResp payloads.CartResponse
+	cartResp := toCartResponse(header)
 	var errorMsg []error
+	addLineError := func(lineError *payloads.CartLineWarning) {
+		cartResp.LineErrors = append(cartResp.LineErrors, *lineError)
+		errorMsg = append(errorMsg, errors.New(lineError.Message))
+	}
+
+	//quantity rules apply to what the line ends up with, not only to the added quantity
+	existingLines, err := header.GetLines(db.DB)
+	if err != nil {
+		utils.JsonError(w, utils.CartItemAdditionError, http.StatusInternalServerError, err)
+		return
+	}
+	linesByItem := make(map[models.CartItemKey]models.Cart, len(existingLines))
+	for _, line := range existingLines {
+		linesByItem[line.ItemKey()] = line
+	}
 
-	for _, item := range req.Items {
-		product, err := fetchProductUsingMicroservices(item.ProductID)
-		if err != nil || product == nil {
-			errorMsg = append(errorMsg, fmt.Errorf(utils.ProductNotFoundError, item.ProductID))
+	productIds := make([]int, 0, len(items))
+	for _, item := range items {
+		if item.BundleID == 0 {
+			productIds = append(productIds, item.ProductID)
+		}
+	}
+	batch, err := fetchProductBatch(productIds)
+	if err != nil {
+		utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+
+	for _, item := range items {
+		key := models.CartItemKey{ProductId: item.ProductID}
+		var product map[string]interface{}
+		if item.BundleID > 0 {
+			key = models.CartItemKey{BundleId: item.BundleID}
+			bundle, err := fetchBundle(item.BundleID)
 			if err != nil {
-				utils.LogError(fmt.Sprintf(utils.ProductNotFoundError, item.ProductID), map[string]interface{}{"error": err.Error()})
+				utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+				return
+			}
+			if lineError := bundleUnavailable(0, item.BundleID, bundle); lineError != nil {
+				addLineError(lineError)
 				continue
 			}
-			utils.LogError(fmt.Sprintf(utils.ProductNotFoundError, item.ProductID), map[string]interface{}{})
+			product = bundle
+		} else {
+			var ok bool
+			if product, ok = batch.Products[item.ProductID]; !ok {
+				utils.LogError(fmt.Sprintf(utils.ProductNotFoundError, item.ProductID), map[string]interface{}{"error": batch.Errors[item.ProductID]})
+				addLineError(&payloads.CartLineWarning{
+					ProductId: item.ProductID,
+					Code:      constants.CartWarningProductNotFound,
+					Message:   fmt.Sprintf(utils.ProductNotFoundError, item.ProductID),
+					Blocking:  true,
+				})
+				continue
+			}
+			if item.VariantID == 0 {
+				if lineError := variantRequired(item.ProductID, product); lineError != nil {
+					addLineError(lineError)
+					continue
+				}
+			}
+		}
+		if item.VariantID > 0 && item.BundleID == 0 {
+			//the variant has to belong to the product, its view replaces the product view for the line
+			variant, err := fetchVariant(item.VariantID)
+			if err != nil {
+				utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+				return
+			}
+			if productId, _ := variant["id"].(float64); variant == nil || int(productId) != item.ProductID {
+				addLineError(variantUnavailable(0, item.ProductID, item.VariantID))
+				continue
+			}
+			key.VariantId = item.VariantID
+			product = variant
+		}
+
+		line := linesByItem[key]
+		line.UserId = userId
+		line.ProductId = key.ProductId
+		line.VariantId = key.VariantId
+		line.BundleId = key.BundleId
+		line.Quantity += item.Quantity
+		lineError, err := checkLineQuantity(db.DB, line, product)
+		if err != nil {
+			utils.JsonError(w, utils.CartItemAdditionError, http.StatusInternalServerError, err)
+			return
+		}
+		if lineError != nil {
+			addLineError(lineError)
 			continue
 		}
 
-		if int(product["quantity"].(float64)) < item.Quantity {
-			utils.JsonError(w, constants.ProductQuantityOutOfStock, http.StatusBadRequest, err)
+		//the hold of the line itself is not part of available_quantity, only the added quantity has to fit
+		available := productInt(product, "available_quantity")
+		if available < item.Quantity {
+			addLineError(insufficientStock(line, available))
 			continue
 		}
 
 		//insert into cart table logic int 4
+		addedDiscount, _ := product["discount"].(float64)
 		newCart := models.Cart{
-			UserId:    userId,
-			ProductId: item.ProductID,
-			Quantity:  item.Quantity,
+			CartHeaderId:  header.Id,
+			UserId:        userId,
+			ProductId:     key.ProductId,
+			VariantId:     key.VariantId,
+			BundleId:      key.BundleId,
+			Quantity:      item.Quantity,
+			AddedPrice:    product["price"].(float64),
+			AddedDiscount: addedDiscount,
 		}
 
 		cart, err := newCart.AddToCart(db.DB)
@@ -188,10 +466,23 @@ func (db *Service) AddToCart(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		//the line only keeps the added quantity when the stock could be held for it
+		if err := reserveCartLine(r, cart); err != nil {
+			utils.LogError(utils.ReservationUpdateError, map[string]interface{}{"error": err.Error()})
+			addLineError(insufficientStock(cart, available))
+			if err := cart.RevertQuantity(db.DB, item.Quantity); err != nil {
+				utils.LogError(utils.CartUnexpectedUpdateError, map[string]interface{}{"error": err.Error()})
+			}
+			continue
+		}
+		linesByItem[key] = cart
+
 		//cart response
 		price := product["price"].(float64) * float64(cart.Quantity)
 		cartRespItem := payloads.CartItemResponse{
 			Id:          cart.Id,
+			VariantId:   cart.VariantId,
+			BundleId:    cart.BundleId,
 			Quantity:    cart.Quantity,
 			ReqQuantity: item.Quantity,
 			Product:     product,
@@ -201,8 +492,18 @@ func (db *Service) AddToCart(w http.ResponseWriter, r *http.Request) {
 		cartResp.Items = append(cartResp.Items, cartRespItem)
 	}
 
+	if len(cartResp.Items) > 0 {
+		if err := header.Touch(db.DB); err != nil {
+			utils.LogError(utils.CartUnexpectedUpdateError, map[string]interface{}{"error": err.Error()})
+		}
+		cartResp.ExpiresAt = &header.ExpiresAt
+		if lines, err := header.GetLines(db.DB); err == nil {
+			extendCartLines(r, lines)
+		}
+	}
+
 	if len(errorMsg) > 0 {
-		if len(req.Items)-len(errorMsg) > 0 {
+		if len(items)-len(errorMsg) > 0 {
 			utils.JsonResponseWithError(cartResp, w, constants.SomeItemAddedToCart, http.StatusCreated, errorMsg)
 			return
 		} else {
@@ -213,12 +514,8 @@ func (db *Service) AddToCart(w http.ResponseWriter, r *http.Request) {
 	utils.JsonResponse(cartResp, w, constants.ItemsAddedToCart, http.StatusCreated)
 }
 
+// UpdateCartQty changes the quantity of a line of the cart of the logged-in user or of the guest cart token
 func (db *Service) UpdateCartQty(w http.ResponseWriter, r *http.Request) {
-	token := utils.GetTokenFromRequestHeader(r)
-	if token == "" {
-		utils.JsonError(w, utils.MissingAuthorizationHeader, http.StatusUnauthorized, nil)
-		return
-	}
 	//avoiding race condition
 	cartMutex.Lock()
 	defer cartMutex.Unlock()
@@ -235,8 +532,13 @@ func (db *Service) UpdateCartQty(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var existingCart models.Cart
-	if err := existingCart.GetCartByCartId(db.DB, cartId); err != nil {
+	header, err := activeCartForRequest(db.DB, r, false)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CartItemNotFoundError, cartId), http.StatusNotFound, err)
+		return
+	}
+	existingCart, err := header.GetLine(db.DB, cartId)
+	if err != nil {
 		utils.JsonError(w, fmt.Sprintf(utils.CartItemNotFoundError, cartId), http.StatusNotFound, err)
 		return
 	}
@@ -245,33 +547,55 @@ func (db *Service) UpdateCartQty(w http.ResponseWriter, r *http.Request) {
 		utils.JsonError(w, utils.InvalidCartRequest, http.StatusBadRequest, fmt.Errorf(utils.InvalidCartRequest))
 		return
 	}
-	var method string
+
+	quantity := existingCart.Quantity
 	if req.Method == CartQuantityAddMethod {
-		method = CartQuantitySubMethod
+		quantity += req.Quantity
 	} else if req.Method == CartQuantitySubMethod {
-		method = CartQuantityAddMethod
+		quantity -= req.Quantity
 	}
-
-	if existingCart.Quantity == 0 && req.Method == CartQuantitySubMethod {
-		utils.JsonError(w, utils.CartItemUpdateError, http.StatusInternalServerError, fmt.Errorf(utils.CartItemUpdateError))
+	if req.Quantity <= 0 || quantity < 0 {
+		utils.JsonError(w, utils.CartItemUpdateError, http.StatusBadRequest, fmt.Errorf(utils.CartItemUpdateError))
 		return
 	}
 
-	cartLength := 1
-	cartLengthR, errs := updateProductQuantity(db.DB, token, method, []models.Cart{existingCart}, cartLength, req.Quantity, "update")
-	if len(errs) > 0 {
-		utils.JsonErrorWithExtra(w, utils.CartItemUpdateError, http.StatusInternalServerError, fmt.Errorf(utils.CartItemUpdateError), errs)
-		return
-	}
-	if cartLengthR == 1 {
-		utils.JsonError(w, utils.CartItemUpdateError, http.StatusInternalServerError, fmt.Errorf(utils.CartItemUpdateError))
-		return
+	existingCart.Quantity = quantity
+	if quantity > 0 && !existingCart.IsBundle() {
+		batch, err := fetchProductBatch([]int{existingCart.ProductId})
+		if err != nil {
+			utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+			return
+		}
+		product, ok := batch.Products[existingCart.ProductId]
+		if !ok {
+			utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, existingCart.ProductId), http.StatusNotFound, nil)
+			return
+		}
+		if existingCart.IsVariant() {
+			if product, err = fetchVariant(existingCart.VariantId); err != nil {
+				utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+				return
+			}
+			if product == nil {
+				utils.JsonError(w, fmt.Sprintf(utils.CartVariantUnavailable, existingCart.VariantId), http.StatusNotFound, nil)
+				return
+			}
+		}
+		lineError, err := checkLineQuantity(db.DB, existingCart, product)
+		if err != nil {
+			utils.JsonError(w, utils.CartItemUpdateError, http.StatusInternalServerError, err)
+			return
+		}
+		if lineError != nil {
+			utils.JsonResponseWithError(lineError, w, fmt.Sprintf(utils.CartQuantityRuleError, cartId), http.StatusUnprocessableEntity, []error{errors.New(lineError.Message)})
+			return
+		}
 	}
 
-	if req.Method == CartQuantityAddMethod {
-		existingCart.Quantity += req.Quantity
-	} else if req.Method == CartQuantitySubMethod {
-		existingCart.Quantity -= req.Quantity
+	//hold the new quantity first, the line is only changed when the product service accepted it
+	if err := reserveCartLine(r, existingCart); err != nil {
+		utils.JsonError(w, utils.CartItemUpdateError, http.StatusConflict, err)
+		return
 	}
 
 	if err := existingCart.UpdateCart(db.DB); err != nil {
@@ -282,13 +606,8 @@ func (db *Service) UpdateCartQty(w http.ResponseWriter, r *http.Request) {
 	utils.JsonResponseWithExtra(existingCart, w, fmt.Sprintf(utils.CartItemUpdatedSuccessfully, cartId), http.StatusOK, "UpdateCartQty")
 }
 
+// DeleteCartByCartId removes a line of the cart of the logged-in user or of the guest cart token
 func (db *Service) DeleteCartByCartId(w http.ResponseWriter, r *http.Request) {
-	token := utils.GetTokenFromRequestHeader(r)
-	if token == "" {
-		utils.JsonError(w, utils.MissingAuthorizationHeader, http.StatusUnauthorized, nil)
-		return
-	}
-
 	//avoiding race condition
 	cartMutex.Lock()
 	defer cartMutex.Unlock()
@@ -299,57 +618,28 @@ func (db *Service) DeleteCartByCartId(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req models.Cart
-	if err := req.GetCartByCartId(db.DB, cartId); err != nil {
+	header, err := activeCartForRequest(db.DB, r, false)
+	if err != nil {
 		utils.JsonError(w, fmt.Sprintf(utils.CartItemNotFoundError, cartId), http.StatusNotFound, err)
 		return
 	}
-
-	cartLength := 1
-	cartLengthR, errs := updateProductQuantity(db.DB, token, CartQuantityAddMethod, []models.Cart{req}, cartLength, -1, "delete")
-	if len(errs) > 0 {
-		utils.JsonErrorWithExtra(w, utils.CartItemDeletionError, http.StatusInternalServerError, fmt.Errorf(utils.CartItemDeletionError), errs)
-		return
-	}
-	if cartLengthR == 1 {
-		utils.JsonError(w, utils.CartItemDeletionError, http.StatusInternalServerError, fmt.Errorf(utils.CartItemDeletionError))
-		return
-	}
-
-	utils.JsonResponseWithExtra(req, w, fmt.Sprintf(utils.CartItemDeletedSuccessfully, cartId), http.StatusOK, "DeleteCartByCartId")
-}
-
-func (db *Service) Checkout(w http.ResponseWriter, r *http.Request) {
-	token := r.Header.Get("Authorization")
-	if token == "" {
-		utils.JsonError(w, utils.MissingAuthorizationHeader, http.StatusUnauthorized, nil)
-		return
-	}
-	token = strings.TrimPrefix(token, "Bearer ")
-	//userId, ok := verifyUserUsingIdAndCtxId(r)
-	//if !ok {
-	//	utils.JsonError(w, utils.UnauthorizedError, http.StatusUnauthorized, fmt.Errorf(utils.UserNotFoundError, userId))
-	//	return
-	//}
-	userId := utils.GetUserIdFromContext(r)
-
-	var cart models.Cart
-	carts, err := cart.GetCartByUserId(db.DB, userId)
+	req, err := header.GetLine(db.DB, cartId)
 	if err != nil {
-		utils.JsonError(w, fmt.Sprintf(utils.UserCartNotFoundError, userId), http.StatusNotFound, err)
+		utils.JsonError(w, fmt.Sprintf(utils.CartItemNotFoundError, cartId), http.StatusNotFound, err)
 		return
 	}
 
-	if len(carts) == 0 {
-		utils.JsonError(w, "Cart is empty", http.StatusBadRequest, nil)
-		return
+	//a hold which could not be released expires on its own
+	if err := releaseCartLines(r, []models.Cart{req}); err != nil {
+		utils.LogError(fmt.Sprintf(utils.ReservationReleaseError, utils.CartLineReservationReference(req.Id)), map[string]interface{}{"error": err.Error()})
 	}
 
-	err = db.ValidateCart(carts)
-	if err != nil {
-		utils.JsonError(w, "Cart validation failed", http.StatusBadRequest, err)
+	if err := req.DeleteCartItem(db.DB); err != nil {
+		utils.JsonError(w, utils.CartItemDeletionError, http.StatusInternalServerError, err)
 		return
 	}
+
+	utils.JsonResponseWithExtra(req, w, fmt.Sprintf(utils.CartItemDeletedSuccessfully, cartId), http.StatusOK, "DeleteCartByCartId")
 }
 
 func (db *Service) ValidateCart(cartItems []models.Cart) error {
@@ -358,10 +648,10 @@ func (db *Service) ValidateCart(cartItems []models.Cart) error {
 		// Call Product Microservice to check product availability
 		available, err := db.CheckProductStock(item.ProductId, item.Quantity)
 		if err != nil {
-			return fmt.Errorf("error checking stock for product %s: %v", item.ProductId, err)
+			return fmt.Errorf("error checking stock for product %d: %v", item.ProductId, err)
 		}
 		if !available {
-			return fmt.Errorf("product %s is out of stock", item.ProductId)
+			return fmt.Errorf("product %d is out of stock", item.ProductId)
 		}
 	}
 
@@ -384,16 +674,23 @@ func (db *Service) CheckProductStock(productId int, quantity int) (bool, error)
 		return false, fmt.Errorf("received invalid response from Product Microservice: %v", resp.Status)
 	}
 
-	// Decode the response
+	// Decode the response, the product is wrapped in data
 	var product map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&product); err != nil {
 		return false, fmt.Errorf("failed to decode response from Product Microservice: %v", err)
 	}
+	data, ok := product["data"].(map[string]interface{})
+	if !ok {
+		return false, errors.New(constants.ProductDetailsNotEnough)
+	}
 
 	// Check if the product is in stock
-	stock := int(product["quantity"].(float64))
+	stock, ok := data["quantity"].(float64)
+	if !ok {
+		return false, errors.New(constants.ProductDetailsNotEnough)
+	}
 
-	return stock >= quantity, nil
+	return int(stock) >= quantity, nil
 }
 
 func (db *Service) GetCartByCartId(w http.ResponseWriter, r *http.Request) {
@@ -422,21 +719,16 @@ func (db *Service) GetCartByCartId(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// ClearCart removes every line of the cart of the logged-in user or of the guest cart token
 func (db *Service) ClearCart(w http.ResponseWriter, r *http.Request) {
-	token := utils.GetTokenFromRequestHeader(r)
-	if token == "" {
-		utils.JsonError(w, utils.MissingAuthorizationHeader, http.StatusUnauthorized, nil)
-		return
-	}
-	userId := utils.GetUserIdFromContext(r)
-	if userId == 0 {
-		utils.JsonError(w, utils.UserIdNotFoundInCtx, http.StatusBadRequest, nil)
+	header, err := activeCartForRequest(db.DB, r, false)
+	if err != nil {
+		utils.JsonError(w, utils.CartUnexpectedFetchError, http.StatusNotFound, err)
 		return
 	}
-	var temp models.Cart
-	carts, err := temp.GetCartByUserId(db.DB, userId)
+	carts, err := header.GetLines(db.DB)
 	if err != nil {
-		utils.JsonError(w, fmt.Sprintf(utils.UserCartNotFoundError, userId), http.StatusNotFound, err)
+		utils.JsonError(w, fmt.Sprintf(utils.CartIdNotFoundError, header.Id), http.StatusNotFound, err)
 		return
 	}
 	if len(carts) == 0 {
@@ -448,88 +740,15 @@ func (db *Service) ClearCart(w http.ResponseWriter, r *http.Request) {
 	cartMutex.Lock()
 	defer cartMutex.Unlock()
 
-	//update products
-	cartLength := len(carts)
-	cartLengthR, errs := updateProductQuantity(db.DB, token, CartQuantityAddMethod, carts, cartLength, -1, "clear")
-	if len(errs) > 0 {
-		if cartLength != cartLengthR || cartLength == cartLengthR {
-			utils.JsonErrorWithExtra(
-				w,
-				"Failed to update product quantity", http.StatusInternalServerError, errors.New("failed to update product quantity"),
-				map[string]interface{}{
-					"active_cart_length": cartLengthR,
-					"total_cart_length":  cartLength,
-					"error_messages":     errs,
-				},
-			)
-			return
-		}
+	//a hold which could not be released expires on its own
+	if err := releaseCartLines(r, carts); err != nil {
+		utils.LogError(utils.ReservationUpdateError, map[string]interface{}{"error": err.Error()})
 	}
 
-	utils.JsonResponse(nil, w, utils.CartClearedSuccessfully, http.StatusOK)
-}
-
-func updateProductQuantity(db *gorm.DB, token, method string, carts []models.Cart, cartLength, quantity int, action string) (int, []error) {
-	links := constants.MicroserviceLinks()
-	productQtyUpdateLink := links["updateProductQuantityMSCallLink"]
-	var errs []error
-	if cartLength <= 0 {
-		return cartLength, errs
+	if err := models.DeleteCartItems(db.DB, carts); err != nil {
+		utils.JsonError(w, utils.CartItemDeletionError, http.StatusInternalServerError, err)
+		return
 	}
 
-	for _, item := range carts {
-		if quantity == -1 {
-			quantity = item.Quantity
-		}
-		bodyToSend := map[string]interface{}{
-			"method":   method,
-			"quantity": quantity,
-		}
-		jsonData, err := json.Marshal(bodyToSend)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to marshal body: %w", err))
-			return cartLength, errs
-		}
-		productMicroserviceCall := fmt.Sprintf(productQtyUpdateLink, item.ProductId)
-		req, err := http.NewRequest("POST", productMicroserviceCall, bytes.NewBuffer(jsonData))
-		if err != nil {
-			errs = append(errs, err)
-			return cartLength, errs
-		}
-
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", token)
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			errs = append(errs, err)
-			return cartLength, errs
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			errs = append(errs, fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-			return cartLength, errs
-		}
-
-		var buf bytes.Buffer
-		if _, err := io.Copy(&buf, resp.Body); err != nil {
-			errs = append(errs, fmt.Errorf("failed to read response body: %w", err))
-			return cartLength, errs
-		}
-		body := buf.Bytes()
-		if strings.Contains(string(body), "error") {
-			errs = append(errs, fmt.Errorf("failed to update product quantity: %s", resp.Status))
-			return cartLength, errs
-		}
-
-		if strings.EqualFold(action, "clear") || strings.EqualFold(action, "delete") {
-			if err := item.DeleteCartItem(db); err != nil {
-				errs = append(errs, fmt.Errorf("failed to delete cart item: %w", err))
-				return cartLength, errs
-			}
-		}
-		cartLength--
-	}
-	return cartLength, errs
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.CartClearedSuccessfully, header.Id), http.StatusOK)
 }
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"e-commerce-backend/cart/internal/models"
+	"e-commerce-backend/cart/pkg/constants"
+	"e-commerce-backend/cart/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// validateCartLines compares every line with the product as it is now. Price and discount changes are only
+// reported for lines which recorded the price they were added at, stock is checked against the available
+// quantity and, when other holds make it look short, by re-holding the line itself. The quantity rules of the
+// product are checked last, the product, variant or bundle of every line is returned keyed by cart line id
+func validateCartLines(db *gorm.DB, r *http.Request, lines []models.Cart) (payloads.CartValidationResponse, map[int]map[string]interface{}, error) {
+	resp := payloads.CartValidationResponse{Warnings: []payloads.CartLineWarning{}}
+
+	batch, err := fetchProductBatch(cartProductIds(lines))
+	if err != nil {
+		return resp, nil, err
+	}
+	bundles, err := fetchCartBundles(lines)
+	if err != nil {
+		return resp, nil, err
+	}
+	variants, err := fetchCartVariants(lines)
+	if err != nil {
+		return resp, nil, err
+	}
+
+	lineProducts := make(map[int]map[string]interface{}, len(lines))
+	for _, line := range lines {
+		product, ok := batch.Products[line.ProductId]
+		if line.IsBundle() {
+			product, ok = bundles[line.BundleId]
+			if lineError := bundleUnavailable(line.Id, line.BundleId, product); lineError != nil {
+				resp.Warnings = append(resp.Warnings, *lineError)
+				continue
+			}
+		} else if line.IsVariant() && ok {
+			if product, ok = variants[line.VariantId]; !ok {
+				resp.Warnings = append(resp.Warnings, *variantUnavailable(line.Id, line.ProductId, line.VariantId))
+				continue
+			}
+		}
+		if !ok {
+			warning := payloads.CartLineWarning{CartId: line.Id, ProductId: line.ProductId, Blocking: true}
+			if slices.Contains(batch.Deleted, line.ProductId) {
+				warning.Code = constants.CartWarningProductDeleted
+				warning.Message = fmt.Sprintf(utils.CartProductDeleted, line.ProductId)
+			} else {
+				warning.Code = constants.CartWarningProductNotFound
+				warning.Message = fmt.Sprintf(utils.ProductNotFoundError, line.ProductId)
+			}
+			resp.Warnings = append(resp.Warnings, warning)
+			continue
+		}
+		lineProducts[line.Id] = product
+
+		price, _ := product["price"].(float64)
+		discount, _ := product["discount"].(float64)
+		if line.AddedPrice > 0 {
+			if oldCents, newCents := utils.ToCents(line.AddedPrice), utils.ToCents(price); oldCents != newCents {
+				warning := payloads.CartLineWarning{CartId: line.Id, ProductId: line.ProductId, VariantId: line.VariantId, BundleId: line.BundleId, OldValue: line.AddedPrice, NewValue: price}
+				if newCents > oldCents {
+					warning.Code = constants.CartWarningPriceIncreased
+					warning.Message = fmt.Sprintf(utils.CartPriceIncreased, line.ProductId, line.AddedPrice, price)
+					if line.IsBundle() {
+						warning.Message = fmt.Sprintf(utils.CartBundlePriceUp, line.BundleId, line.AddedPrice, price)
+					}
+				} else {
+					warning.Code = constants.CartWarningPriceDecreased
+					warning.Message = fmt.Sprintf(utils.CartPriceDecreased, line.ProductId, line.AddedPrice, price)
+					if line.IsBundle() {
+						warning.Message = fmt.Sprintf(utils.CartBundlePriceDown, line.BundleId, line.AddedPrice, price)
+					}
+				}
+				resp.Warnings = append(resp.Warnings, warning)
+			}
+
+			if utils.ToCents(line.AddedDiscount) != utils.ToCents(discount) {
+				warning := payloads.CartLineWarning{CartId: line.Id, ProductId: line.ProductId, VariantId: line.VariantId, OldValue: line.AddedDiscount, NewValue: discount}
+				if utils.ToCents(discount) == 0 {
+					warning.Code = constants.CartWarningDiscountExpired
+					warning.Message = fmt.Sprintf(utils.CartDiscountExpired, line.AddedDiscount, line.ProductId)
+				} else {
+					warning.Code = constants.CartWarningDiscountChanged
+					warning.Message = fmt.Sprintf(utils.CartDiscountChanged, line.ProductId, line.AddedDiscount, discount)
+				}
+				resp.Warnings = append(resp.Warnings, warning)
+			}
+		}
+
+		onHand := productInt(product, "quantity")
+		available := productInt(product, "available_quantity")
+		if line.Quantity > available {
+			//available_quantity also excludes the hold of this line, re-holding tells whether the stock is really short
+			if line.Quantity > onHand || reserveCartLine(r, line) != nil {
+				resp.Warnings = append(resp.Warnings, *insufficientStock(line, available))
+			}
+		}
+
+		lineError, err := checkLineQuantity(db, line, product)
+		if err != nil {
+			return resp, nil, err
+		}
+		if lineError != nil {
+			resp.Warnings = append(resp.Warnings, *lineError)
+		}
+	}
+
+	for _, warning := range resp.Warnings {
+		if !warning.Blocking {
+			resp.RequiresAcknowledgement = true
+		}
+	}
+	resp.Valid = len(resp.Warnings) == 0
+	return resp, lineProducts, nil
+}
+
+func hasBlockingWarnings(resp payloads.CartValidationResponse) bool {
+	for _, warning := range resp.Warnings {
+		if warning.Blocking {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateCartLines reports what changed on the cart lines since they were added (POST /user/cart/validate)
+func (db *Service) ValidateCartLines(w http.ResponseWriter, r *http.Request) {
+	header, err := activeCartForRequest(db.DB, r, false)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.JsonError(w, utils.GuestCartNotFoundError, http.StatusNotFound, err)
+			return
+		}
+		utils.JsonError(w, utils.CartValidationError, http.StatusBadRequest, err)
+		return
+	}
+
+	lines, err := header.GetLines(db.DB)
+	if err != nil {
+		utils.JsonError(w, utils.CartValidationError, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp, _, err := validateCartLines(db.DB, r, lines)
+	if err != nil {
+		utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+
+	utils.JsonResponse(resp, w, fmt.Sprintf(utils.CartValidated, len(resp.Warnings)), http.StatusOK)
+}
+
+// AcknowledgeCartChanges accepts the price and discount the customer saw on the changed lines they list
+// (POST /user/cart/acknowledge). Nothing is acknowledged when a listed line changed again since, blocking
+// warnings stay until the line is updated or removed
+func (db *Service) AcknowledgeCartChanges(w http.ResponseWriter, r *http.Request) {
+	var req payloads.CartAcknowledgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	seen := make(map[int]payloads.CartAcknowledgeLine, len(req.Lines))
+	for _, line := range req.Lines {
+		seen[line.CartId] = line
+	}
+
+	header, err := activeCartForRequest(db.DB, r, false)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.JsonError(w, utils.GuestCartNotFoundError, http.StatusNotFound, err)
+			return
+		}
+		utils.JsonError(w, utils.CartAcknowledgeError, http.StatusBadRequest, err)
+		return
+	}
+
+	lines, err := header.GetLines(db.DB)
+	if err != nil {
+		utils.JsonError(w, utils.CartAcknowledgeError, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp, products, err := validateCartLines(db.DB, r, lines)
+	if err != nil {
+		utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+
+	acknowledged := map[int]bool{}
+	remaining := []payloads.CartLineWarning{}
+	for _, warning := range resp.Warnings {
+		line, listed := seen[warning.CartId]
+		if warning.Blocking || !listed {
+			remaining = append(remaining, warning)
+			continue
+		}
+		product := products[warning.CartId]
+		price, _ := product["price"].(float64)
+		discount, _ := product["discount"].(float64)
+		if utils.ToCents(line.Price) != utils.ToCents(price) || utils.ToCents(line.Discount) != utils.ToCents(discount) {
+			utils.JsonResponse(resp, w, fmt.Sprintf(utils.CartAcknowledgeStale, warning.CartId), http.StatusConflict)
+			return
+		}
+		acknowledged[warning.CartId] = true
+	}
+
+	for i := range lines {
+		if !acknowledged[lines[i].Id] {
+			continue
+		}
+		product := products[lines[i].Id]
+		price, _ := product["price"].(float64)
+		discount, _ := product["discount"].(float64)
+		if err := lines[i].UpdateAddedPrice(db.DB, price, discount); err != nil {
+			utils.JsonError(w, utils.CartAcknowledgeError, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	resp.Warnings = remaining
+	resp.RequiresAcknowledgement = false
+	for _, warning := range remaining {
+		if !warning.Blocking {
+			resp.RequiresAcknowledgement = true
+		}
+	}
+	resp.Valid = len(remaining) == 0
+	utils.JsonResponse(resp, w, utils.CartChangesAcknowledged, http.StatusOK)
+}
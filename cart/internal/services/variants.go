@@ -0,0 +1,83 @@
+package services
+
+import (
+	"e-commerce-backend/cart/internal/models"
+	"e-commerce-backend/cart/pkg/constants"
+	"e-commerce-backend/cart/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// fetchVariant looks up the cart view of a variant, a variant the product service doesn't sell is returned as nil
+func fetchVariant(variantId int) (map[string]interface{}, error) {
+	links := constants.MicroserviceLinks()
+	resp, err := http.Get(fmt.Sprintf(links["variantMSCallLink"], variantId))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(utils.ErrorProductMicroservices+": status code %d", resp.StatusCode)
+	}
+
+	var variantResp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&variantResp); err != nil {
+		return nil, err
+	}
+	return variantResp.Data, nil
+}
+
+// fetchCartVariants looks up the variants of the variant lines keyed by variant id, variants no longer sold are
+// left out
+func fetchCartVariants(lines []models.Cart) (map[int]map[string]interface{}, error) {
+	variants := map[int]map[string]interface{}{}
+	for _, line := range lines {
+		if !line.IsVariant() {
+			continue
+		}
+		if _, fetched := variants[line.VariantId]; fetched {
+			continue
+		}
+		variant, err := fetchVariant(line.VariantId)
+		if err != nil {
+			return nil, err
+		}
+		if variant != nil {
+			variants[line.VariantId] = variant
+		}
+	}
+	return variants, nil
+}
+
+// variantUnavailable is the line error of a variant which is unknown or no longer sold
+func variantUnavailable(cartId, productId, variantId int) *payloads.CartLineWarning {
+	return &payloads.CartLineWarning{
+		CartId:    cartId,
+		ProductId: productId,
+		VariantId: variantId,
+		Code:      constants.CartErrorVariantUnavailable,
+		Message:   fmt.Sprintf(utils.CartVariantUnavailable, variantId),
+		Blocking:  true,
+	}
+}
+
+// variantRequired is the line error of a product sold in variants added without picking one
+func variantRequired(productId int, product map[string]interface{}) *payloads.CartLineWarning {
+	if hasVariants, _ := product["has_variants"].(bool); !hasVariants {
+		return nil
+	}
+	return &payloads.CartLineWarning{
+		ProductId: productId,
+		Code:      constants.CartErrorVariantRequired,
+		Message:   fmt.Sprintf(utils.CartVariantRequired, productId),
+		Blocking:  true,
+	}
+}
@@ -0,0 +1,448 @@
+package services
+
+import (
+	"e-commerce-backend/cart/internal/models"
+	"e-commerce-backend/cart/pkg/constants"
+	"e-commerce-backend/cart/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type WishlistServices struct {
+	DB *gorm.DB
+}
+
+func NewWishlistServices(db *gorm.DB) *WishlistServices {
+	return &WishlistServices{db}
+}
+
+type WishlistService interface {
+	GetWishlists(w http.ResponseWriter, r *http.Request)
+	CreateWishlist(w http.ResponseWriter, r *http.Request)
+	GetWishlist(w http.ResponseWriter, r *http.Request)
+	UpdateWishlist(w http.ResponseWriter, r *http.Request)
+	DeleteWishlist(w http.ResponseWriter, r *http.Request)
+	GetSharedWishlist(w http.ResponseWriter, r *http.Request)
+	AddWishlistItem(w http.ResponseWriter, r *http.Request)
+	RemoveWishlistItem(w http.ResponseWriter, r *http.Request)
+	SaveCartLineForLater(w http.ResponseWriter, r *http.Request)
+	MoveCartLineToWishlist(w http.ResponseWriter, r *http.Request)
+	MoveWishlistItemToCart(w http.ResponseWriter, r *http.Request)
+}
+
+// effectivePrice is the unit price after discount, price drops are measured on it
+func effectivePrice(product map[string]interface{}) float64 {
+	price, _ := product["price"].(float64)
+	discount, _ := product["discount"].(float64)
+	return float64(utils.ToCents(price*(100-discount)/100)) / 100
+}
+
+func productInStock(product map[string]interface{}) bool {
+	available, _ := product["available_quantity"].(float64)
+	return available > 0
+}
+
+func getWishlistItemIdFromParams(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["item_id"])
+}
+
+// getUserWishlist loads the wishlist of the path id, it responds itself when the wishlist can't be used
+func (ws *WishlistServices) getUserWishlist(w http.ResponseWriter, r *http.Request) (models.Wishlist, bool) {
+	var wishlist models.Wishlist
+	wishlistId, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return wishlist, false
+	}
+	if err := wishlist.GetWishlistByIdAndUserId(ws.DB, wishlistId, utils.GetUserIdFromContext(r)); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.WishlistNotFoundError, wishlistId), http.StatusNotFound, err)
+		return wishlist, false
+	}
+	return wishlist, true
+}
+
+func validateWishlistRequest(req payloads.WishlistRequest) (string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > constants.MaxWishlistName {
+		return "", errors.New(utils.WishlistNameRequired)
+	}
+	return name, nil
+}
+
+func (ws *WishlistServices) GetWishlists(w http.ResponseWriter, r *http.Request) {
+	userId := utils.GetUserIdFromContext(r)
+
+	wishlists, err := models.GetWishlistsByUserId(ws.DB, userId)
+	if err != nil {
+		utils.JsonError(w, utils.CartUnexpectedFetchError, http.StatusInternalServerError, err)
+		return
+	}
+	if wishlists == nil {
+		wishlists = []models.Wishlist{}
+	}
+
+	utils.JsonResponse(wishlists, w, fmt.Sprintf(utils.WishlistsFetched, userId), http.StatusOK)
+}
+
+func (ws *WishlistServices) CreateWishlist(w http.ResponseWriter, r *http.Request) {
+	var req payloads.WishlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	name, err := validateWishlistRequest(req)
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	wishlist := models.Wishlist{
+		UserId:      utils.GetUserIdFromContext(r),
+		Name:        name,
+		IsPublic:    req.IsPublic,
+		NotifyEmail: utils.GetUserEmailFromContext(r),
+	}
+	if wishlist.IsPublic {
+		wishlist.ShareToken = utils.GenerateRandomToken()
+	}
+	if err := wishlist.CreateWishlist(ws.DB); err != nil {
+		utils.JsonError(w, utils.WishlistCreationError, http.StatusInternalServerError, err)
+		return
+	}
+	wishlist.Items = []models.WishlistItem{}
+
+	utils.JsonResponse(wishlist, w, utils.WishlistCreated, http.StatusCreated)
+}
+
+func (ws *WishlistServices) GetWishlist(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := ws.getUserWishlist(w, r)
+	if !ok {
+		return
+	}
+	utils.JsonResponse(wishlist, w, fmt.Sprintf(utils.WishlistFetched, wishlist.Id), http.StatusOK)
+}
+
+// UpdateWishlist renames the wishlist or changes its visibility, the share token is kept when a list is made
+// private so sharing it again gives the same link
+func (ws *WishlistServices) UpdateWishlist(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := ws.getUserWishlist(w, r)
+	if !ok {
+		return
+	}
+	if wishlist.Kind == models.WishlistKindSavedForLater {
+		utils.JsonError(w, utils.WishlistSavedListReadOnly, http.StatusBadRequest, nil)
+		return
+	}
+
+	var req payloads.WishlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	name, err := validateWishlistRequest(req)
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	wishlist.Name = name
+	wishlist.IsPublic = req.IsPublic
+	if wishlist.IsPublic && wishlist.ShareToken == "" {
+		wishlist.ShareToken = utils.GenerateRandomToken()
+	}
+	if email := utils.GetUserEmailFromContext(r); email != "" {
+		wishlist.NotifyEmail = email
+	}
+	if err := wishlist.UpdateWishlist(ws.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.WishlistUpdateError, wishlist.Id), http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(wishlist, w, fmt.Sprintf(utils.WishlistUpdated, wishlist.Id), http.StatusOK)
+}
+
+func (ws *WishlistServices) DeleteWishlist(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := ws.getUserWishlist(w, r)
+	if !ok {
+		return
+	}
+	if wishlist.Kind == models.WishlistKindSavedForLater {
+		utils.JsonError(w, utils.WishlistSavedListReadOnly, http.StatusBadRequest, nil)
+		return
+	}
+
+	if err := wishlist.DeleteWishlist(ws.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.WishlistDeletionError, wishlist.Id), http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.WishlistDeleted, wishlist.Id), http.StatusOK)
+}
+
+// GetSharedWishlist public view of a shared wishlist, the link stops working once the list is made private
+func (ws *WishlistServices) GetSharedWishlist(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	var wishlist models.Wishlist
+	if err := wishlist.GetWishlistByShareToken(ws.DB, token); err != nil {
+		utils.JsonError(w, utils.SharedWishlistNotFound, http.StatusNotFound, err)
+		return
+	}
+
+	utils.JsonResponse(wishlist, w, fmt.Sprintf(utils.WishlistFetched, wishlist.Id), http.StatusOK)
+}
+
+func (ws *WishlistServices) AddWishlistItem(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := ws.getUserWishlist(w, r)
+	if !ok {
+		return
+	}
+
+	var req payloads.WishlistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductId <= 0 {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+
+	batch, err := fetchProductBatch([]int{req.ProductId})
+	if err != nil {
+		utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+	product, ok := batch.Products[req.ProductId]
+	if !ok {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, req.ProductId), http.StatusNotFound, nil)
+		return
+	}
+
+	inStock := productInStock(product)
+	item := models.WishlistItem{
+		ProductId:   req.ProductId,
+		Quantity:    req.Quantity,
+		LastPrice:   effectivePrice(product),
+		LastInStock: &inStock,
+	}
+	if err := wishlist.AddItem(ws.DB, &item); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.WishlistItemAdditionError, req.ProductId), http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(item, w, fmt.Sprintf(utils.WishlistItemAdded, req.ProductId), http.StatusCreated)
+}
+
+func (ws *WishlistServices) RemoveWishlistItem(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := ws.getUserWishlist(w, r)
+	if !ok {
+		return
+	}
+
+	itemId, err := getWishlistItemIdFromParams(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	item, err := wishlist.GetItem(ws.DB, itemId)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.WishlistItemNotFoundError, itemId), http.StatusNotFound, err)
+		return
+	}
+
+	if err := item.DeleteItem(ws.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.WishlistUpdateError, wishlist.Id), http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.WishlistItemRemoved, itemId), http.StatusOK)
+}
+
+// moveCartLine moves the cart line of the path id onto the wishlist and releases its stock hold
+func (ws *WishlistServices) moveCartLine(w http.ResponseWriter, r *http.Request, wishlist *models.Wishlist) (models.Cart, bool) {
+	var line models.Cart
+	cartId, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidCartRequest, http.StatusBadRequest, err)
+		return line, false
+	}
+	if err := line.GetCartItemByCartAndUserId(ws.DB, utils.GetUserIdFromContext(r), cartId); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CartItemNotFoundError, cartId), http.StatusNotFound, err)
+		return line, false
+	}
+	if line.IsBundle() {
+		utils.JsonError(w, fmt.Sprintf(utils.CartBundleNoWishlist, cartId), http.StatusBadRequest, nil)
+		return line, false
+	}
+	if line.IsVariant() {
+		utils.JsonError(w, fmt.Sprintf(utils.CartVariantNoWishlist, cartId), http.StatusBadRequest, nil)
+		return line, false
+	}
+
+	//without product details the item is still moved, the alert check fills in the price and stock later
+	item := models.WishlistItem{ProductId: line.ProductId, Quantity: line.Quantity}
+	if batch, err := fetchProductBatch([]int{line.ProductId}); err == nil {
+		if product, ok := batch.Products[line.ProductId]; ok {
+			inStock := productInStock(product)
+			item.LastPrice = effectivePrice(product)
+			item.LastInStock = &inStock
+		}
+	}
+
+	if err := models.MoveCartLineToWishlist(ws.DB, line, wishlist, &item); err != nil {
+		utils.JsonError(w, utils.WishlistMoveError, http.StatusInternalServerError, err)
+		return line, false
+	}
+
+	//a hold which could not be released expires on its own
+	if err := releaseCartLines(r, []models.Cart{line}); err != nil {
+		utils.LogError(fmt.Sprintf(utils.ReservationReleaseError, utils.CartLineReservationReference(line.Id)), map[string]interface{}{"error": err.Error()})
+	}
+	return line, true
+}
+
+func (ws *WishlistServices) SaveCartLineForLater(w http.ResponseWriter, r *http.Request) {
+	//avoiding race condition
+	cartMutex.Lock()
+	defer cartMutex.Unlock()
+
+	var saved models.Wishlist
+	if err := saved.GetOrCreateSavedForLater(ws.DB, utils.GetUserIdFromContext(r), utils.GetUserEmailFromContext(r)); err != nil {
+		utils.JsonError(w, utils.WishlistCreationError, http.StatusInternalServerError, err)
+		return
+	}
+
+	line, ok := ws.moveCartLine(w, r, &saved)
+	if !ok {
+		return
+	}
+
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.CartLineSavedForLater, line.Id), http.StatusOK)
+}
+
+func (ws *WishlistServices) MoveCartLineToWishlist(w http.ResponseWriter, r *http.Request) {
+	var req payloads.MoveToWishlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+
+	//avoiding race condition
+	cartMutex.Lock()
+	defer cartMutex.Unlock()
+
+	var wishlist models.Wishlist
+	if err := wishlist.GetWishlistByIdAndUserId(ws.DB, req.WishlistId, utils.GetUserIdFromContext(r)); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.WishlistNotFoundError, req.WishlistId), http.StatusNotFound, err)
+		return
+	}
+
+	line, ok := ws.moveCartLine(w, r, &wishlist)
+	if !ok {
+		return
+	}
+
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.CartLineMovedToWishlist, line.Id, wishlist.Id), http.StatusOK)
+}
+
+// MoveWishlistItemToCart adds the item to the active cart with a stock hold, the item leaves the wishlist only
+// when the stock could be held
+func (ws *WishlistServices) MoveWishlistItemToCart(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := ws.getUserWishlist(w, r)
+	if !ok {
+		return
+	}
+
+	itemId, err := getWishlistItemIdFromParams(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	item, err := wishlist.GetItem(ws.DB, itemId)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.WishlistItemNotFoundError, itemId), http.StatusNotFound, err)
+		return
+	}
+
+	batch, err := fetchProductBatch([]int{item.ProductId})
+	if err != nil {
+		utils.JsonError(w, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+	product, ok := batch.Products[item.ProductId]
+	if !ok {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, item.ProductId), http.StatusNotFound, nil)
+		return
+	}
+
+	//avoiding race condition
+	cartMutex.Lock()
+	defer cartMutex.Unlock()
+
+	userId := utils.GetUserIdFromContext(r)
+	var header models.CartHeader
+	if err := header.GetOrCreateActiveCart(ws.DB, userId); err != nil {
+		utils.JsonError(w, utils.CartItemAdditionError, http.StatusInternalServerError, err)
+		return
+	}
+
+	//the quantity rules apply to the cart line the item is added to
+	lines, err := header.GetLines(ws.DB)
+	if err != nil {
+		utils.JsonError(w, utils.CartItemAdditionError, http.StatusInternalServerError, err)
+		return
+	}
+	merged := models.Cart{UserId: userId, ProductId: item.ProductId, Quantity: item.Quantity}
+	for _, line := range lines {
+		if line.ItemKey() == merged.ItemKey() {
+			merged.Id = line.Id
+			merged.Quantity += line.Quantity
+		}
+	}
+	lineError, err := checkLineQuantity(ws.DB, merged, product)
+	if err != nil {
+		utils.JsonError(w, utils.CartItemAdditionError, http.StatusInternalServerError, err)
+		return
+	}
+	if lineError != nil {
+		utils.JsonResponseWithError(lineError, w, utils.CartItemAdditionError, http.StatusUnprocessableEntity, []error{errors.New(lineError.Message)})
+		return
+	}
+
+	addedDiscount, _ := product["discount"].(float64)
+	newCart := models.Cart{
+		CartHeaderId:  header.Id,
+		UserId:        userId,
+		ProductId:     item.ProductId,
+		Quantity:      item.Quantity,
+		AddedPrice:    product["price"].(float64),
+		AddedDiscount: addedDiscount,
+	}
+	line, err := newCart.AddToCart(ws.DB)
+	if err != nil {
+		utils.JsonError(w, utils.CartItemAdditionError, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := reserveCartLine(r, line); err != nil {
+		if err := line.RevertQuantity(ws.DB, item.Quantity); err != nil {
+			utils.LogError(utils.CartUnexpectedUpdateError, map[string]interface{}{"error": err.Error()})
+		}
+		utils.JsonError(w, fmt.Sprintf(utils.CartOutOfStockError, item.ProductId), http.StatusConflict, err)
+		return
+	}
+
+	if err := item.DeleteItem(ws.DB); err != nil {
+		utils.LogError(fmt.Sprintf(utils.WishlistUpdateError, wishlist.Id), map[string]interface{}{"error": err.Error()})
+	}
+	if err := header.Touch(ws.DB); err != nil {
+		utils.LogError(utils.CartUnexpectedUpdateError, map[string]interface{}{"error": err.Error()})
+	}
+
+	utils.JsonResponse(line, w, fmt.Sprintf(utils.WishlistItemMovedToCart, itemId), http.StatusOK)
+}
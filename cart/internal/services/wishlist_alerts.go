@@ -0,0 +1,98 @@
+package services
+
+import (
+	"e-commerce-backend/cart/internal/models"
+	"e-commerce-backend/shared/notifications/emails"
+	"e-commerce-backend/shared/notifications/emails/templates"
+	"e-commerce-backend/shared/utils"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StartWishlistWatcher periodically compares wishlisted products with what their owners last saw and emails
+// them about price drops and products back in stock
+func StartWishlistWatcher(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			notified, err := checkWishlistProducts(db)
+			if err != nil {
+				utils.LogError(utils.WishlistCheckError, map[string]interface{}{"error": err.Error()})
+				continue
+			}
+			if notified > 0 {
+				utils.LogInfo(fmt.Sprintf(utils.WishlistAlertsSent, notified), nil)
+			}
+		}
+	}()
+}
+
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', 2, 64)
+}
+
+// checkWishlistProducts sends one email per user listing every change, the last seen values are updated for
+// all changed items so a change is only reported once
+func checkWishlistProducts(db *gorm.DB) (int, error) {
+	items, err := models.GetWatchedWishlistItems(db)
+	if err != nil || len(items) == 0 {
+		return 0, err
+	}
+
+	seen := map[int]bool{}
+	var productIds []int
+	for _, item := range items {
+		if !seen[item.ProductId] {
+			seen[item.ProductId] = true
+			productIds = append(productIds, item.ProductId)
+		}
+	}
+	batch, err := fetchProductBatch(productIds)
+	if err != nil {
+		return 0, err
+	}
+
+	alerts := map[string][]emails.WishlistAlertItem{}
+	for _, item := range items {
+		product, ok := batch.Products[item.ProductId]
+		if !ok {
+			continue
+		}
+
+		price := effectivePrice(product)
+		inStock := productInStock(product)
+		priceDropped := item.LastPrice > 0 && utils.ToCents(price) < utils.ToCents(item.LastPrice)
+		//an item whose stock was never looked up only records it, there is nothing it came back from
+		backInStock := inStock && item.LastInStock != nil && !*item.LastInStock
+		if (priceDropped || backInStock) && inStock {
+			name, _ := product["name"].(string)
+			alerts[item.NotifyEmail] = append(alerts[item.NotifyEmail], emails.WishlistAlertItem{
+				ProductName:  name,
+				WishlistName: item.WishlistName,
+				OldPrice:     formatPrice(item.LastPrice),
+				NewPrice:     formatPrice(price),
+				PriceDropped: priceDropped,
+				BackInStock:  backInStock,
+			})
+		}
+
+		//a drop on a product which is out of stock is kept back until it is available again
+		lastPrice := price
+		if !inStock && item.LastPrice > 0 {
+			lastPrice = item.LastPrice
+		}
+		if utils.ToCents(lastPrice) != utils.ToCents(item.LastPrice) || item.LastInStock == nil || inStock != *item.LastInStock {
+			if err := item.UpdateLastSeen(db, lastPrice, inStock); err != nil {
+				utils.LogError(utils.WishlistCheckError, map[string]interface{}{"error": err.Error(), "item": item.Id})
+			}
+		}
+	}
+
+	for email, alertItems := range alerts {
+		emails.EmailWorkerWithGoRoutine(email, templates.WishlistAlertSubject, templates.WISHLIST_ALERT_TEMPLATE, emails.WishlistAlert{Items: alertItems}, nil)
+	}
+	return len(alerts), nil
+}
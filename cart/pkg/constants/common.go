@@ -1,16 +1,118 @@
 package constants
 
-import "e-commerce-backend/shared/utils"
+import (
+	"e-commerce-backend/shared/utils"
+	"time"
+)
+
+const (
+	ReserveProductMSCall      = "/%d/reserve"
+	ReserveBundleMSCall       = "/bundle/%d/reserve"
+	BundleMSCall              = "/bundle/%d"
+	ReserveVariantMSCall      = "/variant/%d/reserve"
+	VariantMSCall             = "/variant/%d"
+	ReleaseReservationsMSCall = "/reservations/release"
+	ExtendReservationsMSCall  = "/reservations/extend"
+	ProductBatchMSCall        = "/batch?ids=%s"
+	OrderCheckoutMSCall       = "/checkout"
+	OrderQuoteMSCall          = "/quote/%d"
+)
+
+// ProductBatchSize ids sent per batch lookup, matches the limit of the product service
+const ProductBatchSize = 100
+
+// Cart defaults and the rates used for the cart total estimate, the order service computes the final amounts
+const (
+	DefaultCurrency       = "USD"
+	CartExpiryDays        = 30
+	CartTaxPercent        = 18
+	FlatShippingFee       = 50.0
+	FreeShippingThreshold = 500.0
+)
+
+// Cart validation warning codes, price and discount changes need an acknowledgement before checkout
+const (
+	CartWarningPriceIncreased    = "price_increased"
+	CartWarningPriceDecreased    = "price_decreased"
+	CartWarningDiscountExpired   = "discount_expired"
+	CartWarningDiscountChanged   = "discount_changed"
+	CartWarningProductDeleted    = "product_deleted"
+	CartWarningProductNotFound   = "product_not_found"
+	CartWarningInsufficientStock = "insufficient_stock"
+)
+
+// Cart quantity rule codes, reported per line when an add, update or checkout breaks a rule of the product
+const (
+	CartErrorBelowMinQuantity     = "below_min_quantity"
+	CartErrorAboveMaxQuantity     = "above_max_quantity"
+	CartErrorInvalidQuantityStep  = "invalid_quantity_step"
+	CartErrorCustomerLimitReached = "customer_limit_reached"
+	CartErrorBundleUnavailable    = "bundle_unavailable"
+	CartErrorVariantRequired      = "variant_required"
+	CartErrorVariantUnavailable   = "variant_unavailable"
+)
+
+// Wishlists, the saved for later list is a wishlist every user gets on first use
+const (
+	SavedForLaterListName = "Saved for later"
+	MaxWishlistName       = 100
+	WishlistCheckEvery    = time.Hour
+)
+
+// Abandoned cart reminders, the sequence is configured with ABANDONED_CART_REMINDER_HOURS and the coupon of the
+// last reminder with ABANDONED_CART_COUPON_PERCENT
+const (
+	DefaultAbandonedCartReminderHours = "24,72"
+	AbandonedCartCheckEvery           = 15 * time.Minute
+	AbandonedCartCouponPrefix         = "COMEBACK"
+)
 
+// Cart sharing and quotes, only users with QuoteCustomerRole can turn a cart into a quote
 const (
-	UpdateProductQuantityMSCall = "/%d/update-quantity"
+	CartShareExpiryDays = 7
+	QuoteCustomerRole   = "business"
+	QuoteAdminRole      = "admin"
+)
+
+// Guest cart merge on login, configured with CART_MERGE_STRATEGY and CART_MERGE_CAP_AT_STOCK
+const (
+	CartMergeStrategySum     = "sum" // add the guest quantity to the account quantity
+	CartMergeStrategyMax     = "max" // keep the larger of both quantities
+	DefaultCartMergeStrategy = CartMergeStrategySum
 )
 
 func MicroserviceLinks() map[string]string {
 	links := map[string]string{}
 
-	updateProductQuantityLink := utils.GetProductMicroserviceLink(UpdateProductQuantityMSCall)
-	links["updateProductQuantityMSCallLink"] = updateProductQuantityLink
+	reserveProductLink := utils.GetProductMicroserviceLink(ReserveProductMSCall)
+	links["reserveProductMSCallLink"] = reserveProductLink
+
+	releaseReservationsLink := utils.GetProductMicroserviceLink(ReleaseReservationsMSCall)
+	links["releaseReservationsMSCallLink"] = releaseReservationsLink
+
+	extendReservationsLink := utils.GetProductMicroserviceLink(ExtendReservationsMSCall)
+	links["extendReservationsMSCallLink"] = extendReservationsLink
+
+	reserveBundleLink := utils.GetProductMicroserviceLink(ReserveBundleMSCall)
+	links["reserveBundleMSCallLink"] = reserveBundleLink
+
+	bundleLink := utils.GetProductMicroserviceLink(BundleMSCall)
+	links["bundleMSCallLink"] = bundleLink
+
+	reserveVariantLink := utils.GetProductMicroserviceLink(ReserveVariantMSCall)
+	links["reserveVariantMSCallLink"] = reserveVariantLink
+
+	variantLink := utils.GetProductMicroserviceLink(VariantMSCall)
+	links["variantMSCallLink"] = variantLink
+
+	productBatchLink := utils.GetProductMicroserviceLink(ProductBatchMSCall)
+	links["productBatchMSCallLink"] = productBatchLink
+
+	orderCheckoutLink := utils.GetOrderMicroserviceLink(OrderCheckoutMSCall)
+	links["orderCheckoutMSCallLink"] = orderCheckoutLink
+
+	orderQuoteLink := utils.GetOrderMicroserviceLink(OrderQuoteMSCall)
+	links["orderQuoteMSCallLink"] = orderQuoteLink
 
 	return links
 }
@@ -1,12 +1,17 @@
 package payloads
 
+import "time"
+
 type CartRequest struct {
 	Items []CartItem `json:"items"`
 }
 
+// CartItem adds either a product, with VariantID set a variant of the product or, with BundleID set, a bundle
 type CartItem struct {
 	Id        int `json:"cart_id"`
 	ProductID int `json:"product_id"`
+	VariantID int `json:"variant_id"`
+	BundleID  int `json:"bundle_id"`
 	Quantity  int `json:"quantity"`
 }
 
@@ -24,3 +29,64 @@ type CartQtyUpdateRequest struct {
 	Quantity int    `json:"quantity"`
 	Method   string `json:"method"`
 }
+
+// CartCheckoutRequest payment details forwarded as is to the order service
+type CartCheckoutRequest struct {
+	PaymentMethod string               `json:"payment_method"`
+	Tenders       []CartCheckoutTender `json:"tenders"`
+}
+
+type CartCheckoutTender struct {
+	PaymentMethod string  `json:"payment_method"`
+	Amount        float64 `json:"amount"`
+	Reference     string  `json:"reference,omitempty"`
+}
+
+// CartAcknowledgeRequest price and discount of every changed line as the customer saw them, lines which are not
+// listed stay unacknowledged
+type CartAcknowledgeRequest struct {
+	Lines []CartAcknowledgeLine `json:"lines"`
+}
+
+type CartAcknowledgeLine struct {
+	CartId   int     `json:"cart_id"`
+	Price    float64 `json:"price"`
+	Discount float64 `json:"discount"`
+}
+
+type CartDetailsRequest struct {
+	CouponCode     string `json:"coupon_code"`
+	Notes          string `json:"notes"`
+	AddressId      int    `json:"address_id"`
+	ShippingMethod string `json:"shipping_method"`
+}
+
+type WishlistRequest struct {
+	Name     string `json:"name"`
+	IsPublic bool   `json:"is_public"`
+}
+
+type WishlistItemRequest struct {
+	ProductId int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+type MoveToWishlistRequest struct {
+	WishlistId int `json:"wishlist_id"`
+}
+
+type QuoteRequest struct {
+	Notes string `json:"notes"`
+}
+
+// QuotePriceRequest negotiated unit price of every quote line and until when the customer can accept them
+type QuotePriceRequest struct {
+	Lines      []QuoteLinePrice `json:"lines"`
+	ExpiresAt  time.Time        `json:"expires_at"`
+	AdminNotes string           `json:"admin_notes"`
+}
+
+type QuoteLinePrice struct {
+	LineId int     `json:"line_id"`
+	Price  float64 `json:"price"`
+}
@@ -1,13 +1,94 @@
 package payloads
 
+import "time"
+
 type CartResponse struct {
-	Items []CartItemResponse `json:"items"`
+	CartId         int                `json:"cart_id"`
+	Status         string             `json:"status"`
+	Currency       string             `json:"currency"`
+	CouponCode     string             `json:"coupon_code,omitempty"`
+	Notes          string             `json:"notes,omitempty"`
+	AddressId      int                `json:"address_id,omitempty"`
+	ShippingMethod string             `json:"shipping_method,omitempty"`
+	ExpiresAt      *time.Time         `json:"expires_at,omitempty"`
+	Items          []CartItemResponse `json:"items"`
+	Totals         *CartTotals        `json:"totals,omitempty"`
+	LineErrors     []CartLineWarning  `json:"line_errors,omitempty"` // items which could not be added and why
 }
 
 type CartItemResponse struct {
 	Id          int                    `json:"cart_id"`
+	VariantId   int                    `json:"variant_id,omitempty"`
+	BundleId    int                    `json:"bundle_id,omitempty"`
 	Quantity    int                    `json:"quantity"`
 	ReqQuantity int                    `json:"-"`
 	Price       float64                `json:"price"`
+	Discount    float64                `json:"discount"`
 	Product     map[string]interface{} `json:"product"`
+	Error       string                 `json:"error,omitempty"` // set when the product of the line could not be fetched
+}
+
+// CartTotals estimate of what the cart costs, the order service computes the final amounts on checkout
+type CartTotals struct {
+	SubTotal         float64 `json:"sub_total"`
+	Discount         float64 `json:"discount"`
+	Tax              float64 `json:"tax"`
+	ShippingEstimate float64 `json:"shipping_estimate"`
+	Total            float64 `json:"total"`
+}
+
+type GuestCartResponse struct {
+	CartToken string       `json:"cart_token"`
+	Cart      CartResponse `json:"cart"`
+}
+
+// ProductBatchResponse products returned by the product service batch lookup, keyed by product id
+type ProductBatchResponse struct {
+	Products map[int]map[string]interface{} `json:"products"`
+	Errors   map[int]string                 `json:"errors"`
+	Deleted  []int                          `json:"deleted"`
+}
+
+// CartLineWarning a change of a cart line since it was added, blocking warnings can't be acknowledged and the
+// line has to be changed or removed before checkout
+type CartLineWarning struct {
+	CartId    int     `json:"cart_id"`
+	ProductId int     `json:"product_id"`
+	VariantId int     `json:"variant_id,omitempty"`
+	BundleId  int     `json:"bundle_id,omitempty"`
+	Code      string  `json:"code"`
+	Message   string  `json:"message"`
+	OldValue  float64 `json:"old_value,omitempty"`
+	NewValue  float64 `json:"new_value,omitempty"`
+	Blocking  bool    `json:"blocking"`
+}
+
+type CartValidationResponse struct {
+	Valid                   bool              `json:"valid"`
+	RequiresAcknowledgement bool              `json:"requires_acknowledgement"`
+	Warnings                []CartLineWarning `json:"warnings"`
+}
+
+// CartCheckoutResponse outcome of handing the cart to the order service, Order is the order as returned by it
+type CartCheckoutResponse struct {
+	CheckoutId int         `json:"checkout_id"`
+	Status     string      `json:"status"`
+	OrderId    int         `json:"order_id"`
+	Order      interface{} `json:"order"`
+}
+
+// SharedCartResponse cart snapshot behind a share token priced with the current products
+type SharedCartResponse struct {
+	Token     string             `json:"token"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	Items     []CartItemResponse `json:"items"`
+	Totals    *CartTotals        `json:"totals,omitempty"`
+}
+
+// QuoteAcceptResponse outcome of accepting a quote, Order is the order as returned by the order service
+type QuoteAcceptResponse struct {
+	QuoteId int         `json:"quote_id"`
+	Status  string      `json:"status"`
+	OrderId int         `json:"order_id"`
+	Order   interface{} `json:"order"`
 }
@@ -12,5 +12,8 @@ func OrderHandler(router *gin.RouterGroup) {
 	router.GET("/", middlewares.GinAuthMiddleware(), orderServices.GetOrders)
 	router.POST("/add", middlewares.GinAuthMiddleware(), orderServices.CreateOrder)
 	router.GET("/:order_id", middlewares.GinAuthMiddleware(), orderServices.GetOrderById)
+	router.POST("/:order_id/cod-collected", middlewares.GinServiceMiddleware(), orderServices.MarkCODCollected)
+	router.GET("/purchased/:product_id", middlewares.GinAuthMiddleware(), orderServices.GetProductPurchase)
 	router.POST("/checkout", middlewares.GinAuthMiddleware(), orderServices.Checkout)
+	router.POST("/quote/:quote_id", middlewares.GinAuthMiddleware(), middlewares.GinServiceMiddleware(), orderServices.QuoteCheckout)
 }
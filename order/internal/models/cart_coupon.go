@@ -0,0 +1,43 @@
+package models
+
+import "gorm.io/gorm"
+
+// CartCoupon coupon the cart service sent with an abandoned cart reminder, read from and redeemed on the
+// reminders of the cart service
+type CartCoupon struct {
+	CouponCode    string
+	CouponPercent float64
+}
+
+// GetUnusedCartCoupon finds a coupon sent to the user which was not redeemed yet, gorm.ErrRecordNotFound otherwise
+func GetUnusedCartCoupon(db *gorm.DB, userId int, code string) (CartCoupon, error) {
+	var coupons []CartCoupon
+	err := db.Table("cart_reminders").Select("coupon_code, coupon_percent").
+		Where("user_id = ? and coupon_code = ? and coupon_order_id = 0", userId, code).Limit(1).Scan(&coupons).Error
+	if err != nil {
+		return CartCoupon{}, err
+	}
+	if len(coupons) == 0 {
+		return CartCoupon{}, gorm.ErrRecordNotFound
+	}
+	return coupons[0], nil
+}
+
+// RedeemCartCoupon marks the coupon used by the order, the update only matches an unused coupon so two orders
+// can't redeem the same one. gorm.ErrRecordNotFound when it was used meanwhile
+func RedeemCartCoupon(db *gorm.DB, userId int, code string, orderId int) error {
+	result := db.Table("cart_reminders").Where("user_id = ? and coupon_code = ? and coupon_order_id = 0", userId, code).
+		Update("coupon_order_id", orderId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ReleaseCartCoupon makes the coupon redeemed by an order which was not paid usable again
+func ReleaseCartCoupon(db *gorm.DB, orderId int) error {
+	return db.Table("cart_reminders").Where("coupon_order_id = ?", orderId).Update("coupon_order_id", 0).Error
+}
@@ -8,20 +8,45 @@ import (
 	"time"
 )
 
+// status codes kept in OrderStatus, in the order of the utils.OrderStatus names
+const (
+	OrderStatusPending = iota
+	OrderStatusProcessing
+	OrderStatusShipped
+	OrderStatusDelivered
+	OrderStatusCancelled
+	OrderStatusFailed
+)
+
 type Order struct {
-	OrderID        int       `gorm:"primaryKey;autoIncrement" json:"order_id"`
-	CustomerID     int       `gorm:"not null" json:"customer_id"`
-	IsPaid         bool      `json:"is_paid"`
-	TotalAmount    float64   `gorm:"not null" json:"total_amount"`
-	Carts          string    `gorm:"type:json" json:"carts"`
-	OrderStatus    int       `json:"order_status" gorm:"default:0"`
-	DiscountCode   string    `gorm:"default:null" json:"discount_code"`
-	DiscountAmount float64   `gorm:"default:null" json:"discount_amount"`
-	TaxAmount      float64   `json:"tax_amount"`
-	SubTotal       float64   `json:"sub_total"`
-	ShippingMethod string    `json:"shipping_method"`
-	CreatedAt      time.Time `json:"-" gorm:"type:datetime;default:CURRENT_TIMESTAMP"`
-	UpdatedAt      time.Time `json:"updated_at" gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
+	OrderID        int         `gorm:"primaryKey;autoIncrement" json:"order_id"`
+	CustomerID     int         `gorm:"not null" json:"customer_id"`
+	IsPaid         bool        `json:"is_paid"`
+	TotalAmount    float64     `gorm:"not null" json:"total_amount"`
+	Carts          string      `gorm:"type:json" json:"carts"`
+	OrderStatus    int         `json:"order_status" gorm:"default:0"`
+	DiscountCode   string      `gorm:"default:null" json:"discount_code"`
+	DiscountAmount float64     `gorm:"default:null" json:"discount_amount"`
+	TaxAmount      float64     `json:"tax_amount"`
+	SubTotal       float64     `json:"sub_total"`
+	ShippingMethod string      `json:"shipping_method"`
+	PaymentMethod  string      `gorm:"default:null" json:"payment_method"`
+	CODFee         float64     `gorm:"default:0" json:"cod_fee"`
+	QuoteID        *int        `gorm:"default:null;uniqueIndex" json:"quote_id,omitempty"` // set when the order was placed from an accepted quote, one order per quote
+	Items          []OrderItem `gorm:"foreignKey:OrderID" json:"items"`
+	CreatedAt      time.Time   `json:"-" gorm:"type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time   `json:"updated_at" gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
+}
+
+// OrderItem what was bought on one line of the order, kept so purchases can be looked up by product
+type OrderItem struct {
+	ID             int     `gorm:"primaryKey;autoIncrement" json:"-"`
+	OrderID        int     `gorm:"not null;index" json:"-"`
+	ProductID      int     `gorm:"not null;index" json:"product_id"`
+	VariantID      int     `gorm:"default:0" json:"variant_id,omitempty"`
+	BundleID       int     `gorm:"default:0" json:"bundle_id,omitempty"`
+	Quantity       int     `gorm:"not null" json:"quantity"`
+	GiftCardAmount float64 `gorm:"default:0" json:"gift_card_amount,omitempty"` // value of each gift card the line issues, 0 for other products
 }
 
 func InitOrderSchemas() {
@@ -30,11 +55,26 @@ func InitOrderSchemas() {
 		return
 	}
 
-	if err := dbs.DB.AutoMigrate(&Order{}); err != nil {
-		log.Fatalf(utils.DatabaseMigrationError, "Order", err)
+	if err := migrateQuoteID(dbs.DB); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "Order quote", err)
+	}
+	if err := dbs.DB.AutoMigrate(&Order{}, &OrderItem{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "Order/OrderItem", err)
 	} else {
-		log.Printf(utils.SchemaMigrationSuccess, "Order")
+		log.Printf(utils.SchemaMigrationSuccess, "Order/OrderItem")
+	}
+}
+
+// migrateQuoteID makes the quote column of older schemas nullable and clears the 0 of orders placed from a cart,
+// so the unique index only covers orders of a quote
+func migrateQuoteID(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Order{}, "quote_id") {
+		return nil
+	}
+	if err := db.Migrator().AlterColumn(&Order{}, "QuoteID"); err != nil {
+		return err
 	}
+	return db.Model(&Order{}).Where("quote_id = 0").Update("quote_id", nil).Error
 }
 
 type OrderInterface interface {
@@ -53,7 +93,7 @@ func (o *Order) GetOrders(db *gorm.DB) ([]Order, error) {
 }
 
 func (o *Order) GetOrderById(db *gorm.DB, id int) error {
-	if err := db.First(&o, id).Error; err != nil {
+	if err := db.Preload("Items").First(&o, id).Error; err != nil {
 		return err
 	}
 	return nil
@@ -74,9 +114,56 @@ func (o *Order) CreateOrder(db *gorm.DB) error {
 	return nil
 }
 
+// Cancel marks the order cancelled, it stays for the record but no longer counts as a purchase
+func (o *Order) Cancel(db *gorm.DB) error {
+	o.OrderStatus = OrderStatusCancelled
+	return db.Model(&Order{}).Where("order_id = ?", o.OrderID).Update("order_status", o.OrderStatus).Error
+}
+
+// HasGiftCards tells whether the order bought gift cards
+func (o *Order) HasGiftCards() bool {
+	for _, item := range o.Items {
+		if item.GiftCardAmount > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (o *Order) UpdateOrder(db *gorm.DB) error {
-	if err := db.Save(&o).Error; err != nil {
+	//items are written once with the order
+	if err := db.Omit("Items").Save(&o).Error; err != nil {
 		return err
 	}
 	return nil
 }
+
+// FindPurchaseOfProduct returns the id of an order of the customer with the product, 0 when there is none.
+// Only orders which are paid or will be paid on delivery count, cancelled orders don't
+func FindPurchaseOfProduct(db *gorm.DB, customerId, productId int) (int, error) {
+	var orderIds []int
+	err := db.Model(&OrderItem{}).
+		Joins("JOIN orders ON orders.order_id = order_items.order_id").
+		Where("orders.customer_id = ? and order_items.product_id = ?", customerId, productId).
+		Where("orders.is_paid = ? or orders.payment_method = ?", true, utils.PaymentMethodCOD).
+		Where("orders.order_status <> ?", OrderStatusCancelled).
+		Order("order_items.order_id").Limit(1).
+		Pluck("order_items.order_id", &orderIds).Error
+	if err != nil || len(orderIds) == 0 {
+		return 0, err
+	}
+	return orderIds[0], nil
+}
+
+// GetPurchasedQuantity sums what the customer bought of the product on its own since the given time, orders which
+// were not paid are left out unless they are cash on delivery, cancelled orders always are
+func GetPurchasedQuantity(db *gorm.DB, customerId, productId int, since time.Time) (int, error) {
+	var purchased int
+	err := db.Model(&OrderItem{}).Select("COALESCE(SUM(order_items.quantity), 0)").
+		Joins("JOIN orders ON orders.order_id = order_items.order_id").
+		Where("orders.customer_id = ? and order_items.product_id = ? and order_items.bundle_id = 0 and orders.created_at >= ?", customerId, productId, since).
+		Where("orders.is_paid = ? or orders.payment_method = ?", true, utils.PaymentMethodCOD).
+		Where("orders.order_status <> ?", OrderStatusCancelled).
+		Scan(&purchased).Error
+	return purchased, err
+}
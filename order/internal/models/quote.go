@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Status of the quotes of the cart service this service moves, see the quote model of the cart service
+const (
+	QuoteStatusPriced   = "priced"
+	QuoteStatusAccepted = "accepted"
+)
+
+// AcceptQuote moves the quote of the customer from priced to accepted for the order, the update only matches a
+// priced quote which has not expired so a quote is never charged twice. gorm.ErrRecordNotFound otherwise
+func AcceptQuote(db *gorm.DB, quoteId, customerId, orderId int) error {
+	result := db.Table("quotes").
+		Where("id = ? and user_id = ? and status = ? and (expires_at is null or expires_at > ?)", quoteId, customerId, QuoteStatusPriced, time.Now()).
+		Updates(map[string]interface{}{"status": QuoteStatusAccepted, "order_id": orderId})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ReopenQuote puts the quote accepted by an order which was not paid back to priced and frees the order's claim
+// on it, so the customer can accept it again
+func ReopenQuote(db *gorm.DB, orderId int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("quotes").Where("order_id = ? and status = ?", orderId, QuoteStatusAccepted).
+			Updates(map[string]interface{}{"status": QuoteStatusPriced, "order_id": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Order{}).Where("order_id = ?", orderId).Update("quote_id", nil).Error
+	})
+}
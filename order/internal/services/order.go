@@ -8,13 +8,14 @@ import (
 	"e-commerce-backend/shared/invoices"
 	"e-commerce-backend/shared/utils"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
-	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -35,6 +36,8 @@ type OrderInterface interface {
 	CreateOrder(c *gin.Context)
 	GetOrderById(c *gin.Context)
 	Checkout(c *gin.Context)
+	QuoteCheckout(c *gin.Context)
+	GetProductPurchase(c *gin.Context)
 }
 
 func (db *Service) GetOrders(c *gin.Context) {
@@ -42,6 +45,42 @@ func (db *Service) GetOrders(c *gin.Context) {
 	c.JSON(200, gin.H{"status": "ok"})
 }
 
+// GetProductPurchase tells whether the user bought the product, the product service asks it to mark reviews
+// as verified purchases
+func (db *Service) GetProductPurchase(c *gin.Context) {
+	if err := constants.ValidateUserWithCtxUserId(c); err != nil {
+		utils.GinError(c, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	userId, err := constants.GetUserIdFromParams(c)
+	if err != nil {
+		utils.GinError(c, fmt.Sprintf(utils.UserNotFoundError, userId), http.StatusBadRequest, err)
+		return
+	}
+	productIdStr := c.Param("product_id")
+	productId, err := strconv.Atoi(productIdStr)
+	if err != nil {
+		utils.GinError(c, fmt.Sprintf(utils.InvalidProductIdParam, productIdStr), http.StatusBadRequest, err)
+		return
+	}
+
+	orderId, err := models.FindPurchaseOfProduct(db.DB, userId, productId)
+	if err != nil {
+		utils.GinError(c, err.Error(), http.StatusInternalServerError, err)
+		return
+	}
+	resp := gin.H{"product_id": productId, "purchased": orderId > 0, "order_id": orderId}
+	utils.GinResponse(resp, c, fmt.Sprintf(utils.ProductPurchaseChecked, productId), http.StatusOK)
+}
+
+// orderItem records what a cart or quote line bought
+func orderItem(line map[string]interface{}, productId int) models.OrderItem {
+	variantId, _ := line["variant_id"].(float64)
+	bundleId, _ := line["bundle_id"].(float64)
+	quantity, _ := line["quantity"].(float64)
+	return models.OrderItem{ProductID: productId, VariantID: int(variantId), BundleID: int(bundleId), Quantity: int(quantity)}
+}
+
 func (db *Service) CreateOrder(c *gin.Context) {
 	if err := constants.ValidateUserWithCtxUserId(c); err != nil {
 		utils.GinError(c, err.Error(), http.StatusBadRequest, err)
@@ -77,6 +116,42 @@ func (db *Service) GetOrderById(c *gin.Context) {
 	utils.GinResponse(order, c, fmt.Sprintf(utils.OrderFetchSuccess, orderId), http.StatusOK)
 }
 
+// MarkCODCollected marks a cash on delivery order paid, called by the payment service once it collected every
+// tender of the order. Calling it again for a paid order changes nothing
+func (db *Service) MarkCODCollected(c *gin.Context) {
+	userId, err := constants.GetUserIdFromParams(c)
+	if err != nil {
+		utils.GinError(c, fmt.Sprintf(utils.UserNotFoundError, userId), http.StatusBadRequest, err)
+		return
+	}
+	orderIdStr := c.Param("order_id")
+	orderId, err := strconv.Atoi(orderIdStr)
+	if err != nil {
+		utils.GinError(c, fmt.Sprintf(utils.OrderIdInvalid, orderIdStr), http.StatusBadRequest, err)
+		return
+	}
+
+	var order models.Order
+	if err := order.GetOrderById(db.DB, orderId); err != nil || order.CustomerID != userId {
+		utils.GinError(c, fmt.Sprintf(utils.OrderNotFound, orderId), http.StatusNotFound, err)
+		return
+	}
+	if order.PaymentMethod != utils.PaymentMethodCOD || order.OrderStatus == models.OrderStatusCancelled {
+		err := fmt.Errorf(utils.OrderNotCOD, orderId)
+		utils.GinError(c, err.Error(), http.StatusConflict, err)
+		return
+	}
+
+	if !order.IsPaid {
+		order.IsPaid = true
+		if err := order.UpdateOrder(db.DB); err != nil {
+			utils.GinError(c, err.Error(), http.StatusInternalServerError, err)
+			return
+		}
+	}
+	utils.GinResponse(order, c, fmt.Sprintf(utils.CODOrderMarkedPaid, orderId), http.StatusOK)
+}
+
 func (db *Service) Checkout(c *gin.Context) {
 	if err := constants.ValidateUserWithCtxUserId(c); err != nil {
 		utils.GinError(c, err.Error(), http.StatusBadRequest, err)
@@ -104,6 +179,10 @@ func (db *Service) Checkout(c *gin.Context) {
 	subTotalPrice, totalDiscount := 0.0, 0.0
 	var order models.Order
 
+	var cartLines []map[string]interface{}
+	var productIds []int
+	bundles := map[int]map[string]interface{}{}
+	variants := map[int]map[string]interface{}{}
 	for _, cart := range carts {
 		cartId := int(cart["cart_id"].(float64))
 
@@ -117,18 +196,93 @@ func (db *Service) Checkout(c *gin.Context) {
 			return
 		}
 		cartData := cart["data"].(map[string]interface{})
+		cartLines = append(cartLines, cartData)
+		if bundleId, _ := cartData["bundle_id"].(float64); bundleId > 0 {
+			bundles[int(bundleId)] = nil
+			continue
+		}
+		if variantId, _ := cartData["variant_id"].(float64); variantId > 0 {
+			variants[int(variantId)] = nil
+		}
+		productIds = append(productIds, int(cartData["product_id"].(float64)))
+	}
 
-		productId := int(cartData["product_id"].(float64))
-		product := fetchProductDetails(c, productId)
-		if product == nil {
-			utils.GinError(c, fmt.Sprintf(utils.ProductNotFoundError, productId), http.StatusBadRequest, err)
+	//all products of the order in one call, every line with a missing product is reported together
+	products, productErrors, err := fetchProductsDetails(c, productIds)
+	if err != nil {
+		utils.GinError(c, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+	for bundleId := range bundles {
+		if bundles[bundleId], err = fetchBundleDetails(c, bundleId); err != nil {
+			utils.GinError(c, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+			return
+		}
+	}
+	for variantId := range variants {
+		if variants[variantId], err = fetchVariantDetails(c, variantId); err != nil {
+			utils.GinError(c, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
 			return
 		}
-		productData := product["data"].(map[string]interface{})
+	}
+	//the quantity rules of a bundle line are the rules of the products in it
+	var componentIds []int
+	for _, bundle := range bundles {
+		for productId := range bundleComponents(bundle) {
+			if _, fetched := products[productId]; !fetched && !slices.Contains(componentIds, productId) {
+				componentIds = append(componentIds, productId)
+			}
+		}
+	}
+	components, _, err := fetchProductsDetails(c, componentIds)
+	if err != nil {
+		utils.GinError(c, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+	for productId, product := range components {
+		products[productId] = product
+	}
+
+	var lineErrors []error
+	for _, cartData := range cartLines {
+		productId := int(cartData["product_id"].(float64))
+		if _, ok := lineProduct(cartData, products, bundles, variants); !ok {
+			msg, found := productErrors[productId]
+			if bundleId, _ := cartData["bundle_id"].(float64); bundleId > 0 {
+				msg, found = fmt.Sprintf(utils.CartBundleUnavailable, int(bundleId)), true
+			} else if variantId, _ := cartData["variant_id"].(float64); variantId > 0 && !found {
+				msg, found = fmt.Sprintf(utils.CartVariantUnavailable, int(variantId)), true
+			}
+			if !found {
+				msg = fmt.Sprintf(utils.ProductNotFoundError, productId)
+			}
+			lineErrors = append(lineErrors, fmt.Errorf("cart %d: %s", int(cartData["id"].(float64)), msg))
+		}
+	}
+	if len(lineErrors) > 0 {
+		err := errors.Join(lineErrors...)
+		utils.GinError(c, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	for _, cartData := range cartLines {
+		cartId := int(cartData["id"].(float64))
+		productId := int(cartData["product_id"].(float64))
+		productData, _ := lineProduct(cartData, products, bundles, variants)
 		if ok := verifyQuantity(int(cartData["quantity"].(float64)), int(productData["quantity"].(float64))); !ok {
 			utils.GinError(c, fmt.Sprintf(utils.CartOutOfStockError, productId), http.StatusBadRequest, nil)
 			return
 		}
+		reason, err := checkLineQuantity(db.DB, userId, cartData, productData, products)
+		if err != nil {
+			utils.GinError(c, err.Error(), http.StatusInternalServerError, err)
+			return
+		}
+		if reason != "" {
+			err := fmt.Errorf("cart %d: %s", cartId, reason)
+			utils.GinError(c, err.Error(), http.StatusUnprocessableEntity, err)
+			return
+		}
 
 		//calculating individual product price
 		eachTotalPrice, eachDiscountAmt := calculatePrice(productData["price"].(float64), productData["discount"].(float64), int(cartData["quantity"].(float64)))
@@ -136,6 +290,11 @@ func (db *Service) Checkout(c *gin.Context) {
 		totalDiscount += eachDiscountAmt
 
 		cartIds = append(cartIds, cartId)
+		item := orderItem(cartData, productId)
+		if category, _ := productData["category"].(string); strings.EqualFold(category, constants.GiftCardProductCategory) {
+			item.GiftCardAmount = productData["price"].(float64)
+		}
+		order.Items = append(order.Items, item)
 
 		//invoice data
 		var invoiceItem invoices.InvoiceItem
@@ -143,25 +302,64 @@ func (db *Service) Checkout(c *gin.Context) {
 		invoiceList.InvoiceItemList = append(invoiceList.InvoiceItemList, invoiceItem)
 	}
 
-	//adding default tax(18%)
-	taxAmt, subTotalPrice := calculateTotalWithTax(subTotalPrice)
-
 	cartItemsJSON, err := json.Marshal(cartIds)
 	if err != nil {
 		utils.GinError(c, err.Error(), http.StatusBadRequest, err)
 		return
 	}
-	//temporary basis
-	order.OrderID = 1
+	order.CustomerID = userId
+	order.SubTotal = subTotalPrice
+	order.DiscountAmount = totalDiscount
+	order.Carts = string(cartItemsJSON)
+
+	//a cart reminder coupon comes off what is left after the product discounts, it is redeemed once the order exists
+	if couponCode := strings.ToUpper(strings.TrimSpace(body.CouponCode)); couponCode != "" {
+		coupon, err := models.GetUnusedCartCoupon(db.DB, userId, couponCode)
+		if err != nil {
+			err := fmt.Errorf(utils.CartCouponInvalid, couponCode)
+			utils.GinError(c, err.Error(), http.StatusConflict, err)
+			return
+		}
+		couponAmt := float64(utils.ToCents(order.SubTotal*coupon.CouponPercent/100)) / 100
+		order.SubTotal -= couponAmt
+		order.DiscountAmount += couponAmt
+		order.DiscountCode = coupon.CouponCode
+	}
+
+	references := make([]string, 0, len(cartIds))
+	for _, cartId := range cartIds {
+		references = append(references, utils.CartLineReservationReference(cartId))
+	}
+	db.completeOrder(c, order, body, invoiceList, references)
+}
+
+// completeOrder taxes, creates and pays the order priced by the caller, then commits the stock held under the
+// references and sends the invoice. It writes the response for every outcome
+func (db *Service) completeOrder(c *gin.Context, order models.Order, body payloads.RequestCart, invoiceList invoices.Invoice, references []string) {
+	//adding default tax(18%)
+	taxAmt, subTotalPrice := calculateTotalWithTax(order.SubTotal)
+
 	order.CreatedAt = time.Now()
 	order.UpdatedAt = time.Now()
 
-	order.CustomerID = userId
 	order.TaxAmount = taxAmt
 	order.SubTotal = subTotalPrice
 	order.TotalAmount = subTotalPrice + taxAmt
-	order.DiscountAmount = totalDiscount
-	order.Carts = string(cartItemsJSON)
+	order.PaymentMethod = strings.ToLower(body.PaymentMethod)
+
+	//cash on delivery adds a fee line and is only offered up to a configured order value
+	tenders := body.Tenders
+	if isCODCheckout(body) {
+		order.PaymentMethod = utils.PaymentMethodCOD
+		order.CODFee = utils.GetCODFee()
+		order.TotalAmount += order.CODFee
+		if utils.ToCents(order.TotalAmount) > utils.ToCents(utils.GetCODMaxOrderValue()) {
+			err := fmt.Errorf(utils.CODOrderValueExceeded, utils.GetCODMaxOrderValue())
+			utils.GinError(c, err.Error(), http.StatusBadRequest, err)
+			return
+		}
+		tenders = fillCODTender(tenders, order.TotalAmount)
+	}
 	//create order
 	if err := order.CreateOrder(db.DB); err != nil {
 		utils.GinError(c, err.Error(), http.StatusBadRequest, err)
@@ -169,26 +367,75 @@ func (db *Service) Checkout(c *gin.Context) {
 	}
 	log.Println("Order created: ", order)
 
-	payResp, err := proceedForPayment(c, order)
+	//the quote is accepted by this order before anything is charged, a second checkout of it fails here
+	if order.QuoteID != nil {
+		if err := models.AcceptQuote(db.DB, *order.QuoteID, order.CustomerID, order.OrderID); err != nil {
+			//the order keeps no claim on a quote it could not accept
+			db.cancelUnpaidOrder(order)
+			err := fmt.Errorf(utils.QuoteNotPriced, *order.QuoteID)
+			utils.GinError(c, err.Error(), http.StatusConflict, err)
+			return
+		}
+	}
+
+	//the coupon belongs to this order from here on, a second checkout with it fails
+	if order.DiscountCode != "" {
+		if err := models.RedeemCartCoupon(db.DB, order.CustomerID, order.DiscountCode, order.OrderID); err != nil {
+			db.cancelUnpaidOrder(order)
+			err := fmt.Errorf(utils.CartCouponInvalid, order.DiscountCode)
+			utils.GinError(c, err.Error(), http.StatusConflict, err)
+			return
+		}
+	}
+
+	//stock held for the order is taken out of the warehouses before any money is captured, a hold which
+	//expired in the meantime fails the checkout instead of overselling
+	if err := commitReservations(order, references); err != nil {
+		db.cancelUnpaidOrder(order)
+		utils.GinError(c, err.Error(), http.StatusConflict, err)
+		return
+	}
+
+	payResp, err := proceedForPayment(c, order, tenders)
 	if err != nil {
+		db.cancelUnpaidOrder(order)
 		utils.GinError(c, err.Error(), http.StatusBadRequest, err)
 		return
 	}
 
-	if payResp["data"] != nil {
-		respData := payResp["data"].(map[string]interface{})
-		paymentId := int(respData["payment_id"].(float64))
-		if paymentId > 0 {
+	//order is paid only when the captured tenders cover the whole total amount, with cash on delivery
+	//the uncollected amount is pending and the order goes to fulfilment unpaid
+	codPending := false
+	if respData, ok := payResp["data"].(map[string]interface{}); ok {
+		isPaid, _ := respData["is_paid"].(bool)
+		paidAmount, _ := respData["paid_amount"].(float64)
+		pendingAmount, _ := respData["pending_amount"].(float64)
+		if isPaid && utils.ToCents(paidAmount) == utils.ToCents(order.TotalAmount) {
 			order.IsPaid = true
 			//	update payment
 			if err := order.UpdateOrder(db.DB); err != nil {
 				utils.GinError(c, "while updating"+err.Error(), http.StatusBadRequest, err)
 				return
 			}
+		} else if utils.ToCents(pendingAmount) > 0 && utils.ToCents(paidAmount)+utils.ToCents(pendingAmount) == utils.ToCents(order.TotalAmount) {
+			codPending = true
+		}
+	}
+	if !order.IsPaid && !codPending {
+		db.cancelUnpaidOrder(order)
+		err := fmt.Errorf(utils.OrderPaymentIncomplete, order.OrderID)
+		utils.GinError(c, err.Error(), http.StatusPaymentRequired, err)
+		return
+	}
+
+	//gift cards are issued by the payment service only against captured money
+	if order.HasGiftCards() && order.IsPaid {
+		if err := issuePurchasedGiftCards(order); err != nil {
+			utils.LogError(fmt.Sprintf(utils.GiftCardPurchaseFailed, order.OrderID), map[string]interface{}{"error": err.Error()})
 		}
 	}
 
-	userData, err := fetchUserDetails(c, userId)
+	userData, err := fetchUserDetails(c, order.CustomerID)
 	if err != nil {
 		utils.LogError("from order services: Failed to fetch user data", map[string]interface{}{"error": err.Error()})
 		return
@@ -198,9 +445,51 @@ func (db *Service) Checkout(c *gin.Context) {
 	GenerateOrderInvoice(order, userData, invoiceList)
 	go SendInvoice()
 
+	if !order.IsPaid {
+		utils.GinResponse(order, c, utils.OrderPlacedWithCOD, http.StatusOK)
+		return
+	}
 	utils.GinResponse(order, c, utils.OrderSuccessful, http.StatusOK)
 }
 
+func isCODCheckout(body payloads.RequestCart) bool {
+	if strings.EqualFold(body.PaymentMethod, utils.PaymentMethodCOD) {
+		return true
+	}
+	for _, tender := range body.Tenders {
+		if strings.EqualFold(tender.PaymentMethod, utils.PaymentMethodCOD) {
+			return true
+		}
+	}
+	return false
+}
+
+// fillCODTender sets the cash on delivery tender to whatever the other tenders leave unpaid, the client
+// can't know the amount up front because the COD fee is added here
+func fillCODTender(tenders []payloads.TenderRequest, totalAmount float64) []payloads.TenderRequest {
+	remaining := utils.ToCents(totalAmount)
+	codIdx := -1
+	var filled []payloads.TenderRequest
+	for _, tender := range tenders {
+		if strings.EqualFold(tender.PaymentMethod, utils.PaymentMethodCOD) {
+			if codIdx == -1 {
+				codIdx = len(filled)
+				filled = append(filled, tender)
+			}
+			continue
+		}
+		remaining -= utils.ToCents(tender.Amount)
+		filled = append(filled, tender)
+	}
+	if codIdx == -1 {
+		codIdx = len(filled)
+		filled = append(filled, payloads.TenderRequest{})
+	}
+	filled[codIdx].PaymentMethod = utils.PaymentMethodCOD
+	filled[codIdx].Amount = float64(remaining) / 100
+	return filled
+}
+
 func fetchUserDetails(c *gin.Context, userId int) (map[string]interface{}, error) {
 	links := constants.MicroserviceLinks()
 	userLinkById := links["userMSCallByIdLink"]
@@ -290,59 +579,142 @@ func fetchCartDetails(c *gin.Context, userId, cartId int) (map[string]interface{
 	return cart, nil
 }
 
-func fetchProductDetails(c *gin.Context, productId int) map[string]interface{} {
+// fetchProductsDetails looks up several products with the batch endpoint of the product service, ids are sent in
+// chunks of ProductBatchSize and the results merged, products which could not be served are returned in the
+// errors map keyed by product id
+func fetchProductsDetails(c *gin.Context, productIds []int) (map[int]map[string]interface{}, map[int]string, error) {
+	products := make(map[int]map[string]interface{}, len(productIds))
+	productErrors := map[int]string{}
 	links := constants.MicroserviceLinks()
-	productLink := links["productMSCallByIdLink"]
+	productLink := links["productMSBatchCallLink"]
 
-	productMicroserviceCall := fmt.Sprintf(productLink, productId)
-	log.Println(productMicroserviceCall)
-	req, err := http.NewRequest(http.MethodGet, productMicroserviceCall, nil)
-	if err != nil {
-		utils.LogError("Failed to create request", map[string]interface{}{"error": err.Error()})
-		return nil
+	for start := 0; start < len(productIds); start += constants.ProductBatchSize {
+		end := min(start+constants.ProductBatchSize, len(productIds))
+		ids := make([]string, 0, end-start)
+		for _, id := range productIds[start:end] {
+			ids = append(ids, strconv.Itoa(id))
+		}
+		productMicroserviceCall := fmt.Sprintf(productLink, strings.Join(ids, ","))
+		log.Println(productMicroserviceCall)
+		req, err := http.NewRequest(http.MethodGet, productMicroserviceCall, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create request to microservice: %v", err)
+		}
+		req.Header.Set("Authorization", utils.GetTokenFromRequestUsingGin(c))
+
+		client := &http.Client{}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to send request to microservice: %v", err)
+		}
+
+		var batchResp struct {
+			Data struct {
+				Products map[int]map[string]interface{} `json:"products"`
+				Errors   map[int]string                 `json:"errors"`
+			} `json:"data"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&batchResp)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, nil, fmt.Errorf("microservice responded with status code %d", resp.StatusCode)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse product details: %v", err)
+		}
+
+		for id, product := range batchResp.Data.Products {
+			products[id] = product
+		}
+		for id, msg := range batchResp.Data.Errors {
+			productErrors[id] = msg
+		}
 	}
+	return products, productErrors, nil
+}
 
-	token := utils.GetTokenFromRequestUsingGin(c)
-	if token == "" {
-		utils.GinError(c, utils.MissingAuthorizationHeader, http.StatusUnauthorized, nil)
-		return nil
+// fetchBundleDetails looks up the cart view of a bundle, a bundle the product service doesn't know is returned as nil
+func fetchBundleDetails(c *gin.Context, bundleId int) (map[string]interface{}, error) {
+	links := constants.MicroserviceLinks()
+	bundleMicroserviceCall := fmt.Sprintf(links["productMSBundleCallLink"], bundleId)
+	req, err := http.NewRequest(http.MethodGet, bundleMicroserviceCall, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request to microservice: %v", err)
 	}
-	req.Header.Set("Authorization", token)
+	req.Header.Set("Authorization", utils.GetTokenFromRequestUsingGin(c))
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		utils.GinErrorWithExtra(c, utils.ErrorProductMicroservices, http.StatusInternalServerError, err, "order.go")
-		return nil
+		return nil, fmt.Errorf("failed to send request to microservice: %v", err)
 	}
 	defer resp.Body.Close()
 
-	var buf bytes.Buffer
-	if _, err = io.Copy(&buf, resp.Body); err != nil {
-		utils.GinErrorWithExtra(c, "utils.ErrorReadingResponseBody", http.StatusInternalServerError, err, "order.go")
-		return nil
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("microservice responded with status code %d", resp.StatusCode)
+	}
+
+	var bundleResp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&bundleResp); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle details: %v", err)
+	}
+	return bundleResp.Data, nil
+}
+
+// fetchVariantDetails looks up the cart view of a variant, a variant the product service no longer sells is
+// returned as nil
+func fetchVariantDetails(c *gin.Context, variantId int) (map[string]interface{}, error) {
+	links := constants.MicroserviceLinks()
+	variantMicroserviceCall := fmt.Sprintf(links["productMSVariantCallLink"], variantId)
+	req, err := http.NewRequest(http.MethodGet, variantMicroserviceCall, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request to microservice: %v", err)
 	}
-	body := buf.Bytes()
+	req.Header.Set("Authorization", utils.GetTokenFromRequestUsingGin(c))
 
-	var product map[string]interface{}
-	if err := utils.ParseJSON(body, &product); err != nil {
-		log.Printf("Error parsing Cart response: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse cart details"})
-		return nil
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to microservice: %v", err)
 	}
+	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusNotFound {
-			if strings.Contains(product["error"].(string), "not found") {
-				utils.GinError(c, product["error"].(string), http.StatusNotFound, nil)
-				return nil
-			}
-		}
-		utils.GinError(c, utils.ErrorCallingCartMicroservice, resp.StatusCode, nil)
-		return nil
+		return nil, fmt.Errorf("microservice responded with status code %d", resp.StatusCode)
 	}
 
-	return product
+	var variantResp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&variantResp); err != nil {
+		return nil, fmt.Errorf("failed to parse variant details: %v", err)
+	}
+	return variantResp.Data, nil
+}
+
+// lineProduct is what a cart line is priced from, bundle lines are priced from their bundle at the bundle price
+// and a bundle which is no longer sold can't be ordered. Variant lines are priced from their variant while the
+// product itself is still sold
+func lineProduct(cartData map[string]interface{}, products, bundles, variants map[int]map[string]interface{}) (map[string]interface{}, bool) {
+	if bundleId, _ := cartData["bundle_id"].(float64); bundleId > 0 {
+		bundle := bundles[int(bundleId)]
+		active, _ := bundle["is_active"].(bool)
+		return bundle, active
+	}
+	product, ok := products[int(cartData["product_id"].(float64))]
+	if variantId, _ := cartData["variant_id"].(float64); variantId > 0 && ok {
+		product, ok = variants[int(variantId)]
+		return product, product != nil
+	}
+	return product, ok
 }
 
 func verifyQuantity(requestQuantity, actualQuantity int) bool {
@@ -366,13 +738,13 @@ func calculateTotalWithTax(totalAmt float64) (float64, float64) {
 	return taxAmt, totalAmt
 }
 
-func proceedForPayment(c *gin.Context, order models.Order) (map[string]interface{}, error) {
+func proceedForPayment(c *gin.Context, order models.Order, tenders []payloads.TenderRequest) (map[string]interface{}, error) {
 	links := constants.MicroserviceLinks()
 	paymentLink := links["paymentMSInitiateCallLink"]
 	paymentMicroserviceCall := fmt.Sprintf(paymentLink, order.OrderID)
 	log.Println(paymentMicroserviceCall)
 
-	payload := map[string]interface{}{"customer_id": order.CustomerID, "total_amount": order.TotalAmount, "order_id": order.OrderID}
+	payload := map[string]interface{}{"customer_id": order.CustomerID, "total_amount": order.TotalAmount, "order_id": order.OrderID, "payment_method": order.PaymentMethod, "tenders": tenders}
 	jsonPayload, _ := json.Marshal(payload)
 	req, err := http.NewRequest(http.MethodPost, paymentMicroserviceCall, bytes.NewBuffer(jsonPayload))
 	if err != nil {
@@ -400,6 +772,8 @@ func proceedForPayment(c *gin.Context, order models.Order) (map[string]interface
 	}
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == http.StatusCreated {
+		} else if resp.StatusCode == http.StatusPaymentRequired {
+			return nil, fmt.Errorf("%s: %v", utils.PaymentFailed, response["error"])
 		} else {
 			return nil, fmt.Errorf("microservice responded with status code %d", resp.StatusCode)
 		}
@@ -408,6 +782,92 @@ func proceedForPayment(c *gin.Context, order models.Order) (map[string]interface
 	return response, nil
 }
 
+// issuePurchasedGiftCards asks the payment service to issue the gift cards bought with a paid order, the payment
+// service reads the cards from the gift card lines of the order
+func issuePurchasedGiftCards(order models.Order) error {
+	links := constants.MicroserviceLinks()
+	giftCardLink := links["paymentMSGiftCardCallLink"]
+	paymentMicroserviceCall := fmt.Sprintf(giftCardLink, order.OrderID)
+	log.Println(paymentMicroserviceCall)
+
+	req, err := http.NewRequest(http.MethodPost, paymentMicroserviceCall, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request to microservice: %v", err)
+	}
+	utils.SetServiceToken(req)
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to microservice: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("microservice responded with status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// commitReservations turns the stock holds of the order into a permanent decrement, either every hold is
+// committed or none is
+func commitReservations(order models.Order, references []string) error {
+	links := constants.MicroserviceLinks()
+	payload := map[string]interface{}{"references": references, "order_id": order.OrderID}
+	return callReservationService(links["productMSCommitCallLink"], payload)
+}
+
+// cancelUnpaidOrder puts the stock committed for an order which was not paid back into the warehouses, makes
+// its quote and coupon usable again and marks the order cancelled
+func (db *Service) cancelUnpaidOrder(order models.Order) {
+	links := constants.MicroserviceLinks()
+	payload := map[string]interface{}{"order_id": order.OrderID}
+	if err := callReservationService(links["productMSCancelCallLink"], payload); err != nil {
+		utils.LogError(fmt.Sprintf(utils.ReservationCancelError, order.OrderID), map[string]interface{}{"error": err.Error()})
+	}
+	if order.QuoteID != nil {
+		if err := models.ReopenQuote(db.DB, order.OrderID); err != nil {
+			utils.LogError(fmt.Sprintf(utils.QuoteReopenFailed, order.OrderID), map[string]interface{}{"error": err.Error()})
+		}
+	}
+	if order.DiscountCode != "" {
+		if err := models.ReleaseCartCoupon(db.DB, order.OrderID); err != nil {
+			utils.LogError(fmt.Sprintf(utils.CouponReleaseFailed, order.OrderID), map[string]interface{}{"error": err.Error()})
+		}
+	}
+	if err := order.Cancel(db.DB); err != nil {
+		utils.LogError(fmt.Sprintf(utils.OrderCancelFailed, order.OrderID), map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// callReservationService calls the reservation endpoints of the product service, which only take calls of the services
+func callReservationService(link string, payload map[string]interface{}) error {
+	log.Println(link)
+	jsonPayload, _ := json.Marshal(payload)
+	req, err := http.NewRequest(http.MethodPost, link, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return fmt.Errorf("failed to create request to microservice: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	utils.SetServiceToken(req)
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to microservice: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err == nil {
+			if msg, ok := body["error"].(string); ok {
+				return fmt.Errorf("%s", msg)
+			}
+		}
+		return fmt.Errorf("microservice responded with status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
 func appendCartToInvoiceItem(invoice *invoices.InvoiceItem, cart, product map[string]interface{}, itemTotalPrice float64) {
 	invoice.Total = strconv.FormatFloat(itemTotalPrice, 'f', -1, 64)
 	invoice.Quantity = strconv.FormatFloat(cart["quantity"].(float64), 'f', -1, 64)
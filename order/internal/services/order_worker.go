@@ -44,6 +44,9 @@ func GenerateOrderInvoice(order models.Order, userData map[string]interface{}, i
 	invoice.SubTotal = strconv.FormatFloat(subTotal, 'f', -1, 64)
 	invoice.TotalAmount = strconv.FormatFloat(totalAmount, 'f', -1, 64)
 	invoice.TotalDiscount = strconv.FormatFloat(discountAmt, 'f', -1, 64)
+	if order.CODFee > 0 {
+		invoice.CODFee = strconv.FormatFloat(order.CODFee, 'f', -1, 64)
+	}
 
 	//seller data
 	invoice.SellerDetails = invoice.UserDetails
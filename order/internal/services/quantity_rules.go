@@ -0,0 +1,95 @@
+package services
+
+import (
+	"e-commerce-backend/order/internal/models"
+	"e-commerce-backend/shared/utils"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func productInt(product map[string]interface{}, key string) int {
+	value, _ := product[key].(float64)
+	return int(value)
+}
+
+// checkQuantityRules returns why the rules of the product don't allow the quantity, empty when they do. purchased
+// is what the customer already bought of it inside the purchase window, the cart checks the same rules
+func checkQuantityRules(productId int, product map[string]interface{}, quantity, purchased int) string {
+	if minQty := productInt(product, "min_order_quantity"); minQty > 1 && quantity < minQty {
+		return fmt.Sprintf(utils.CartBelowMinQuantity, productId, minQty, quantity)
+	}
+	if maxQty := productInt(product, "max_order_quantity"); maxQty > 0 && quantity > maxQty {
+		return fmt.Sprintf(utils.CartAboveMaxQuantity, maxQty, productId, quantity)
+	}
+	if step := productInt(product, "quantity_step"); step > 1 && quantity%step != 0 {
+		return fmt.Sprintf(utils.CartInvalidQtyStep, productId, step, quantity)
+	}
+	if limit := productInt(product, "max_per_customer"); limit > 0 && purchased+quantity > limit {
+		return fmt.Sprintf(utils.CartCustomerLimit, limit, productId, purchased, quantity)
+	}
+	return ""
+}
+
+// purchasedInWindow is what the customer bought of the product inside its purchase window, it is only looked up
+// for products with a per customer limit
+func purchasedInWindow(db *gorm.DB, customerId, productId int, product map[string]interface{}) (int, error) {
+	if productInt(product, "max_per_customer") <= 0 {
+		return 0, nil
+	}
+	var since time.Time
+	if days := productInt(product, "purchase_window_days"); days > 0 {
+		since = time.Now().AddDate(0, 0, -days)
+	}
+	return models.GetPurchasedQuantity(db, customerId, productId, since)
+}
+
+// bundleComponents quantity of every product in one bundle keyed by product id
+func bundleComponents(bundle map[string]interface{}) map[int]int {
+	components := map[int]int{}
+	items, _ := bundle["items"].([]interface{})
+	for _, item := range items {
+		component, _ := item.(map[string]interface{})
+		components[productInt(component, "product_id")] += productInt(component, "quantity")
+	}
+	return components
+}
+
+// checkLineQuantity applies the quantity rules of the product to the cart line, a bundle line applies the rules
+// of every product in the bundle to the component quantity times the bundle quantity, products has to hold the
+// products of the bundles as well. The reason is empty when the line is allowed
+func checkLineQuantity(db *gorm.DB, customerId int, cartData, productData map[string]interface{}, products map[int]map[string]interface{}) (string, error) {
+	quantity := productInt(cartData, "quantity")
+	if bundleId := productInt(cartData, "bundle_id"); bundleId > 0 {
+		components := bundleComponents(productData)
+		productIds := make([]int, 0, len(components))
+		for productId := range components {
+			productIds = append(productIds, productId)
+		}
+		slices.Sort(productIds)
+
+		for _, productId := range productIds {
+			product, ok := products[productId]
+			if !ok {
+				return fmt.Sprintf(utils.CartBundleUnavailable, bundleId), nil
+			}
+			purchased, err := purchasedInWindow(db, customerId, productId, product)
+			if err != nil {
+				return "", err
+			}
+			if reason := checkQuantityRules(productId, product, components[productId]*quantity, purchased); reason != "" {
+				return reason, nil
+			}
+		}
+		return "", nil
+	}
+
+	productId := productInt(cartData, "product_id")
+	purchased, err := purchasedInWindow(db, customerId, productId, productData)
+	if err != nil {
+		return "", err
+	}
+	return checkQuantityRules(productId, productData, quantity, purchased), nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"e-commerce-backend/order/internal/models"
+	"e-commerce-backend/order/pkg/constants"
+	"e-commerce-backend/order/pkg/payloads"
+	"e-commerce-backend/shared/invoices"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuoteCheckout places the order of an accepted quote at its negotiated prices, it is only called by the cart
+// service which already holds the stock of the quote. The quote is accepted here before anything is charged
+func (db *Service) QuoteCheckout(c *gin.Context) {
+	if err := constants.ValidateUserWithCtxUserId(c); err != nil {
+		utils.GinError(c, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	userId, err := constants.GetUserIdFromParams(c)
+	if err != nil {
+		utils.GinError(c, fmt.Sprintf(utils.UserNotFoundError, userId), http.StatusBadRequest, err)
+		return
+	}
+	quoteIdStr := c.Param("quote_id")
+	quoteId, err := strconv.Atoi(quoteIdStr)
+	if err != nil {
+		utils.GinError(c, fmt.Sprintf(utils.QuoteIdInvalid, quoteIdStr), http.StatusBadRequest, err)
+		return
+	}
+
+	var body payloads.RequestCart
+	if err := c.ShouldBindJSON(&body); err != nil {
+		utils.GinError(c, utils.InvalidJSONBody, http.StatusBadRequest, err)
+		return
+	}
+
+	quote, err := fetchQuoteDetails(c, quoteId)
+	if err != nil {
+		utils.GinError(c, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if status, _ := quote["status"].(string); status != "priced" {
+		err := fmt.Errorf(utils.QuoteNotPriced, quoteId)
+		utils.GinError(c, err.Error(), http.StatusConflict, err)
+		return
+	}
+	if expiresAt, _ := quote["expires_at"].(string); expiresAt != "" {
+		if expiry, err := time.Parse(time.RFC3339, expiresAt); err == nil && expiry.Before(time.Now()) {
+			err := fmt.Errorf(utils.QuoteExpired, quoteId, expiry.Format(time.DateOnly))
+			utils.GinError(c, err.Error(), http.StatusConflict, err)
+			return
+		}
+	}
+
+	lines, _ := quote["lines"].([]interface{})
+	var quoteLines []map[string]interface{}
+	var productIds []int
+	for _, item := range lines {
+		line, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		quoteLines = append(quoteLines, line)
+		productIds = append(productIds, int(line["product_id"].(float64)))
+	}
+
+	//products are only needed for the invoice, the price is the negotiated one
+	products, _, err := fetchProductsDetails(c, productIds)
+	if err != nil {
+		utils.GinError(c, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+		return
+	}
+
+	var invoiceList invoices.Invoice
+	var lineIds []int
+	var items []models.OrderItem
+	subTotalPrice := 0.0
+	for _, line := range quoteLines {
+		productId := int(line["product_id"].(float64))
+		productData, ok := products[productId]
+		if !ok {
+			err := fmt.Errorf(utils.ProductNotFoundError, productId)
+			utils.GinError(c, err.Error(), http.StatusBadRequest, err)
+			return
+		}
+		//the variant view carries the option values in its name
+		if variantId, _ := line["variant_id"].(float64); variantId > 0 {
+			variant, err := fetchVariantDetails(c, int(variantId))
+			if err != nil {
+				utils.GinError(c, utils.ErrorProductMicroservices, http.StatusBadGateway, err)
+				return
+			}
+			if variant == nil {
+				err := fmt.Errorf(utils.CartVariantUnavailable, int(variantId))
+				utils.GinError(c, err.Error(), http.StatusBadRequest, err)
+				return
+			}
+			productData = variant
+		}
+
+		negotiatedPrice, _ := line["negotiated_price"].(float64)
+		eachTotalPrice, _ := calculatePrice(negotiatedPrice, 0, int(line["quantity"].(float64)))
+		subTotalPrice += eachTotalPrice
+
+		lineIds = append(lineIds, int(line["id"].(float64)))
+		item := orderItem(line, productId)
+		if category, _ := productData["category"].(string); strings.EqualFold(category, constants.GiftCardProductCategory) {
+			item.GiftCardAmount = negotiatedPrice
+		}
+		items = append(items, item)
+
+		//invoice shows the negotiated price without a further discount
+		invoiceProduct := map[string]interface{}{
+			"price":        negotiatedPrice,
+			"discount":     0.0,
+			"description":  productData["description"],
+			"product_name": productData["name"],
+		}
+		var invoiceItem invoices.InvoiceItem
+		appendCartToInvoiceItem(&invoiceItem, line, invoiceProduct, eachTotalPrice)
+		invoiceList.InvoiceItemList = append(invoiceList.InvoiceItemList, invoiceItem)
+	}
+
+	lineItemsJSON, err := json.Marshal(lineIds)
+	if err != nil {
+		utils.GinError(c, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	order := models.Order{
+		CustomerID: userId,
+		SubTotal:   subTotalPrice,
+		Carts:      string(lineItemsJSON),
+		QuoteID:    &quoteId,
+		Items:      items,
+	}
+	db.completeOrder(c, order, body, invoiceList, []string{utils.QuoteReservationReference(quoteId)})
+}
+
+// fetchQuoteDetails reads the quote of the caller from the cart service
+func fetchQuoteDetails(c *gin.Context, quoteId int) (map[string]interface{}, error) {
+	links := constants.MicroserviceLinks()
+	cartMicroserviceCall := fmt.Sprintf(links["cartMSQuoteCallLink"], quoteId)
+	log.Println(cartMicroserviceCall)
+	req, err := http.NewRequest(http.MethodGet, cartMicroserviceCall, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request to microservice")
+	}
+
+	token := utils.GetTokenFromRequestUsingGin(c)
+	if token == "" {
+		return nil, fmt.Errorf("missing authorization header")
+	}
+	req.Header.Set("Authorization", token)
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf(utils.ErrorCallingCartMicroservice)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf(utils.ErrorCallingCartMicroservice)
+	}
+
+	var quote map[string]interface{}
+	if err := utils.ParseJSON(body, &quote); err != nil {
+		return nil, fmt.Errorf("failed to parse quote details")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf(utils.QuoteNotFoundError, quoteId)
+		}
+		return nil, fmt.Errorf(utils.ErrorCallingCartMicroservice)
+	}
+
+	data, ok := quote["data"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf(utils.QuoteNotFoundError, quoteId)
+	}
+	return data, nil
+}
@@ -8,6 +8,9 @@ import (
 	"strings"
 )
 
+// GiftCardProductCategory products of this category issue gift cards once the order is paid
+const GiftCardProductCategory = "gift card"
+
 func GetUserIdFromParams(c *gin.Context) (int, error) {
 	id := c.Param("id")
 	idInt, err := strconv.Atoi(id)
@@ -4,23 +4,54 @@ import "e-commerce-backend/shared/utils"
 
 const (
 	CartMicroserviceCallById    = "/%d"
+	CartMicroserviceQuote       = "/quotes/%d"
 	ProductMicroserviceCallById = "/%d/cart"
+	ProductMicroserviceCommit   = "/reservations/commit"
+	ProductMicroserviceCancel   = "/reservations/cancel"
+	ProductMicroserviceBatch    = "/batch?ids=%s"
+	ProductMicroserviceBundle   = "/bundle/%d"
+	ProductMicroserviceVariant  = "/variant/%d"
 	PaymentMicroserviceCallById = "/initiate"
+	PaymentMicroserviceGiftCard = "/gift-cards"
 	UserMicroserviceCallById    = "/%d"
 )
 
+// ProductBatchSize ids sent per batch lookup, matches the limit of the product service
+const ProductBatchSize = 100
+
 func MicroserviceLinks() map[string]string {
 	links := map[string]string{}
 
 	productCallByIdLink := utils.GetProductMicroserviceLink(ProductMicroserviceCallById)
 	links["productMSCallByIdLink"] = productCallByIdLink
 
+	productBatchLink := utils.GetProductMicroserviceLink(ProductMicroserviceBatch)
+	links["productMSBatchCallLink"] = productBatchLink
+
+	productBundleLink := utils.GetProductMicroserviceLink(ProductMicroserviceBundle)
+	links["productMSBundleCallLink"] = productBundleLink
+
+	productVariantLink := utils.GetProductMicroserviceLink(ProductMicroserviceVariant)
+	links["productMSVariantCallLink"] = productVariantLink
+
+	productCommitLink := utils.GetProductMicroserviceLink(ProductMicroserviceCommit)
+	links["productMSCommitCallLink"] = productCommitLink
+
+	productCancelLink := utils.GetProductMicroserviceLink(ProductMicroserviceCancel)
+	links["productMSCancelCallLink"] = productCancelLink
+
 	cartCallByIdLink := utils.GetCartMicroserviceLink(CartMicroserviceCallById)
 	links["cartMSCallByIdLink"] = cartCallByIdLink
 
+	cartQuoteLink := utils.GetCartMicroserviceLink(CartMicroserviceQuote)
+	links["cartMSQuoteCallLink"] = cartQuoteLink
+
 	paymentCallByIdLink := utils.GetPaymentMicroserviceLink(PaymentMicroserviceCallById)
 	links["paymentMSInitiateCallLink"] = paymentCallByIdLink
 
+	paymentGiftCardLink := utils.GetPaymentMicroserviceLink(PaymentMicroserviceGiftCard)
+	links["paymentMSGiftCardCallLink"] = paymentGiftCardLink
+
 	userCallByIdLink := utils.GetUserMicroserviceLink(UserMicroserviceCallById)
 	links["userMSCallByIdLink"] = userCallByIdLink
 	return links
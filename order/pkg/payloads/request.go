@@ -1,7 +1,17 @@
 package payloads
 
 type RequestCart struct {
-	Carts []map[string]interface{} `json:"carts"`
+	Carts         []map[string]interface{} `json:"carts"`
+	PaymentMethod string                   `json:"payment_method"`
+	Tenders       []TenderRequest          `json:"tenders"`
+	CouponCode    string                   `json:"coupon_code"` // coupon of a cart reminder, redeemed by the order
+}
+
+// TenderRequest one part of a split payment, forwarded as is to the payment service
+type TenderRequest struct {
+	PaymentMethod string  `json:"payment_method"`
+	Amount        float64 `json:"amount"`
+	Reference     string  `json:"reference,omitempty"`
 }
 
 type OrderRequest struct {
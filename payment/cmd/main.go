@@ -50,4 +50,5 @@ func main() {
 
 func InitSchemas() {
 	models.InitPaymentSchema()
+	models.InitGiftCardSchema()
 }
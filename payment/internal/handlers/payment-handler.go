@@ -11,7 +11,18 @@ import (
 
 func PaymentHandler(r *mux.Router) {
 	paymentService := services.NewPaymentService(dbs.DB)
+	giftCardService := services.NewGiftCardServices(dbs.DB)
 
-	r.Handle("/order/{id}/payment", middlewares.AuthMiddleware(http.HandlerFunc(paymentService.GetPayment))).Methods("POST")
+	r.Handle("/order/{id}/payment", middlewares.AuthMiddleware(http.HandlerFunc(paymentService.GetPayment))).Methods("GET")
 	r.Handle("/order/{id}/payment/initiate", middlewares.AuthMiddleware(http.HandlerFunc(paymentService.InitiatePayment))).Methods("POST")
+	r.Handle("/order/{id}/payment/gift-cards", middlewares.ServiceMiddleware(http.HandlerFunc(giftCardService.PurchaseGiftCards))).Methods("POST")
+
+	//cash on delivery
+	r.Handle("/admin/order/{id}/payment/cod/collect", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(paymentService.CollectCODPayment)))).Methods("POST")
+	r.HandleFunc("/webhooks/delivery", paymentService.DeliveryWebhook).Methods("POST")
+
+	//gift cards
+	r.Handle("/gift-cards/{code}/balance", middlewares.AuthMiddleware(http.HandlerFunc(giftCardService.GetGiftCardBalance))).Methods("GET")
+	r.Handle("/admin/gift-cards/bulk", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(giftCardService.BulkCreateGiftCards)))).Methods("POST")
+	r.Handle("/admin/gift-cards/{code}/redemptions", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(giftCardService.GetGiftCardRedemptions)))).Methods("GET")
 }
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"e-commerce-backend/payment/dbs"
+	"e-commerce-backend/shared/utils"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	GiftCardSourceAdmin    = "admin"
+	GiftCardSourcePurchase = "purchase"
+
+	GiftCardRedemptionRedeem = "redeem"
+	GiftCardRedemptionRefund = "refund"
+)
+
+type GiftCard struct {
+	ID             int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code           string    `gorm:"type:varchar(32);uniqueIndex;not null" json:"code"`
+	InitialBalance float64   `gorm:"not null" json:"initial_balance"`
+	Balance        float64   `gorm:"not null" json:"balance"`
+	Source         string    `gorm:"type:varchar(20);not null" json:"source"` // "admin", "purchase"
+	IssuedBy       int       `gorm:"default:0" json:"issued_by"`
+	IssuedTo       int       `gorm:"default:0" json:"issued_to"`
+	OrderID        int       `gorm:"default:0;index" json:"order_id"` // order the card was bought with
+	IsActive       bool      `gorm:"default:true" json:"is_active"`
+	ExpiresAt      time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// GiftCardRedemption audit trail entry, one per redemption or refund of a gift card tender
+type GiftCardRedemption struct {
+	ID           int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	GiftCardID   int       `gorm:"not null;index" json:"gift_card_id"`
+	OrderID      int       `gorm:"not null;index" json:"order_id"`
+	PaymentID    int       `gorm:"not null;index" json:"payment_id"`
+	Type         string    `gorm:"type:varchar(20);not null" json:"type"` // "redeem", "refund"
+	Amount       float64   `gorm:"not null" json:"amount"`
+	BalanceAfter float64   `gorm:"not null" json:"balance_after"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type GiftCardInterface interface {
+	CreateGiftCard(db *gorm.DB) error
+	GetGiftCardByCode(db *gorm.DB, code string) error
+	IsExpired() bool
+	Redeem(db *gorm.DB, orderId, paymentId int, amount float64) error
+	RefundRedemption(db *gorm.DB, paymentId int) error
+	GetRedemptions(db *gorm.DB) ([]GiftCardRedemption, error)
+}
+
+func InitGiftCardSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&GiftCard{}, &GiftCardRedemption{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "GiftCard/GiftCardRedemption", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "GiftCard/GiftCardRedemption")
+	}
+}
+
+func (gc *GiftCard) CreateGiftCard(db *gorm.DB) error {
+	if err := db.Create(&gc).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (gc *GiftCard) GetGiftCardByCode(db *gorm.DB, code string) error {
+	return db.Where("code = ?", code).First(&gc).Error
+}
+
+func (gc *GiftCard) IsExpired() bool {
+	return time.Now().After(gc.ExpiresAt)
+}
+
+func CountGiftCardsByOrderId(db *gorm.DB, orderId int) (int64, error) {
+	var count int64
+	if err := db.Model(&GiftCard{}).Where("order_id = ? and source = ?", orderId, GiftCardSourcePurchase).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// OrderGiftCardLine gift cards bought on one line of an order, GiftCardAmount is the value of each card
+type OrderGiftCardLine struct {
+	GiftCardAmount float64
+	Quantity       int
+}
+
+// GetOrderGiftCards returns the customer of a paid order and the gift card lines of it, read from the orders of the
+// order service. gorm.ErrRecordNotFound when the order doesn't exist or isn't paid
+func GetOrderGiftCards(db *gorm.DB, orderId int) (int, []OrderGiftCardLine, error) {
+	var customerIds []int
+	if err := db.Table("orders").Where("order_id = ? and is_paid = ?", orderId, true).Pluck("customer_id", &customerIds).Error; err != nil {
+		return 0, nil, err
+	}
+	if len(customerIds) == 0 {
+		return 0, nil, gorm.ErrRecordNotFound
+	}
+
+	var lines []OrderGiftCardLine
+	err := db.Table("order_items").Select("gift_card_amount, quantity").
+		Where("order_id = ? and gift_card_amount > 0", orderId).Scan(&lines).Error
+	return customerIds[0], lines, err
+}
+
+// Redeem deducts amount from the card balance, the card row is locked so concurrent checkouts can't overspend it
+func (gc *GiftCard) Redeem(db *gorm.DB, orderId, paymentId int, amount float64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", gc.Code).First(&gc).Error; err != nil {
+			return err
+		}
+		if !gc.IsActive {
+			return fmt.Errorf(utils.GiftCardInactive, gc.MaskedCode())
+		}
+		if gc.IsExpired() {
+			return fmt.Errorf(utils.GiftCardExpired, gc.MaskedCode())
+		}
+		if utils.ToCents(gc.Balance) < utils.ToCents(amount) {
+			return fmt.Errorf(utils.GiftCardInsufficientBalance, gc.MaskedCode(), gc.Balance)
+		}
+
+		gc.Balance = float64(utils.ToCents(gc.Balance)-utils.ToCents(amount)) / 100
+		if err := tx.Model(&GiftCard{}).Where("id = ?", gc.ID).Update("balance", gc.Balance).Error; err != nil {
+			return err
+		}
+
+		redemption := GiftCardRedemption{
+			GiftCardID:   gc.ID,
+			OrderID:      orderId,
+			PaymentID:    paymentId,
+			Type:         GiftCardRedemptionRedeem,
+			Amount:       amount,
+			BalanceAfter: gc.Balance,
+		}
+		return tx.Create(&redemption).Error
+	})
+}
+
+// RefundRedemption puts the amount redeemed by the payment back on the card
+func (gc *GiftCard) RefundRedemption(db *gorm.DB, paymentId int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var redemption GiftCardRedemption
+		if err := tx.Where("payment_id = ? and type = ?", paymentId, GiftCardRedemptionRedeem).First(&redemption).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&gc, redemption.GiftCardID).Error; err != nil {
+			return err
+		}
+
+		gc.Balance = float64(utils.ToCents(gc.Balance)+utils.ToCents(redemption.Amount)) / 100
+		if err := tx.Model(&GiftCard{}).Where("id = ?", gc.ID).Update("balance", gc.Balance).Error; err != nil {
+			return err
+		}
+
+		refund := GiftCardRedemption{
+			GiftCardID:   gc.ID,
+			OrderID:      redemption.OrderID,
+			PaymentID:    paymentId,
+			Type:         GiftCardRedemptionRefund,
+			Amount:       redemption.Amount,
+			BalanceAfter: gc.Balance,
+		}
+		return tx.Create(&refund).Error
+	})
+}
+
+func (gc *GiftCard) GetRedemptions(db *gorm.DB) ([]GiftCardRedemption, error) {
+	var redemptions []GiftCardRedemption
+	if err := db.Where("gift_card_id = ?", gc.ID).Order("id").Find(&redemptions).Error; err != nil {
+		return nil, err
+	}
+	return redemptions, nil
+}
+
+func (gc *GiftCard) MaskedCode() string {
+	if len(gc.Code) <= 4 {
+		return gc.Code
+	}
+	return "****" + gc.Code[len(gc.Code)-4:]
+}
@@ -4,24 +4,34 @@ import (
 	"e-commerce-backend/payment/dbs"
 	"e-commerce-backend/shared/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
 	"time"
 )
 
 type Payment struct {
-	PaymentID            int       `gorm:"primaryKey;autoIncrement" json:"payment_id"`
-	OrderID              int       `gorm:"not null" json:"order_id"`
-	PaymentMethod        string    `gorm:"not null" json:"payment_method"`
-	PaymentStatus        string    `gorm:"not null" json:"payment_status"` // "Pending", "Completed", "Failed"
-	PaymentFailureReason string    `gorm:"type:text;default:null" json:"payment_failure_reason"`
-	PaymentRetryCount    int       `gorm:"default:0" json:"payment_retry_count"`
-	Amount               float64   `gorm:"not null" json:"amount"`
-	PaymentDate          time.Time `gorm:"autoCreateTime" json:"payment_date"`
+	PaymentID            int        `gorm:"primaryKey;autoIncrement" json:"payment_id"`
+	OrderID              int        `gorm:"not null;index" json:"order_id"`
+	CustomerID           int        `gorm:"default:0" json:"customer_id"`
+	PaymentMethod        string     `gorm:"not null" json:"payment_method"`
+	PaymentStatus        string     `gorm:"not null" json:"payment_status"` // "pending", "paid", "failed", "refunded"
+	PaymentFailureReason string     `gorm:"type:text;default:null" json:"payment_failure_reason"`
+	PaymentRetryCount    int        `gorm:"default:0" json:"payment_retry_count"`
+	Amount               float64    `gorm:"not null" json:"amount"`
+	TenderReference      string     `gorm:"default:null" json:"tender_reference"`
+	CollectedAt          *time.Time `gorm:"default:null" json:"collected_at,omitempty"` // cash on delivery only
+	PaymentDate          time.Time  `gorm:"autoCreateTime" json:"payment_date"`
+	UpdatedAt            time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 type PaymentInterface interface {
 	CreatePayment(db *gorm.DB) error
-	RefundPayment(db *gorm.DB) error
+	UpdatePaymentStatus(db *gorm.DB, status, reason string) error
+	MarkCaptured(db *gorm.DB) error
+	GetPaymentsByOrderId(db *gorm.DB, orderId int) ([]Payment, error)
+	GetCapturedAmount(db *gorm.DB, orderId int) (float64, error)
+	GetPendingCODAmount(db *gorm.DB, orderId int) (float64, error)
+	MarkCollected(db *gorm.DB, reference string) error
 }
 
 func InitPaymentSchema() {
@@ -39,3 +49,75 @@ func (pay *Payment) CreatePayment(db *gorm.DB) error {
 	}
 	return nil
 }
+
+func (pay *Payment) UpdatePaymentStatus(db *gorm.DB, status, reason string) error {
+	pay.PaymentStatus = status
+	pay.PaymentFailureReason = reason
+	updatedFields := map[string]interface{}{"payment_status": status, "payment_failure_reason": reason}
+	if err := db.Model(&Payment{}).Where("payment_id = ?", pay.PaymentID).Updates(updatedFields).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pay *Payment) MarkCaptured(db *gorm.DB) error {
+	pay.PaymentStatus = utils.PaymentStatusPaid
+	updatedFields := map[string]interface{}{"payment_status": pay.PaymentStatus, "tender_reference": pay.TenderReference}
+	if err := db.Model(&Payment{}).Where("payment_id = ?", pay.PaymentID).Updates(updatedFields).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pay *Payment) GetPaymentsByOrderId(db *gorm.DB, orderId int) ([]Payment, error) {
+	var payments []Payment
+	if err := db.Where("order_id = ?", orderId).Order("payment_id").Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// LockOrderPayments locks the order until the transaction ends, so the payments of one order are read and captured
+// by one request at a time. The order row is locked as the first payment of an order has no payment row to lock yet
+func LockOrderPayments(db *gorm.DB, orderId int) error {
+	var orderIds []int
+	return db.Table("orders").Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_id = ?", orderId).Pluck("order_id", &orderIds).Error
+}
+
+// GetCapturedAmount sums every tender of the order that has been captured, refunded and failed tenders are ignored
+func (pay *Payment) GetCapturedAmount(db *gorm.DB, orderId int) (float64, error) {
+	var captured float64
+	if err := db.Model(&Payment{}).Select("COALESCE(SUM(amount), 0)").Where("order_id = ? and payment_status = ?", orderId, utils.PaymentStatusPaid).Scan(&captured).Error; err != nil {
+		return 0, err
+	}
+	return captured, nil
+}
+
+// GetPendingCODAmount sums the cash on delivery tenders of the order which are not collected yet
+func (pay *Payment) GetPendingCODAmount(db *gorm.DB, orderId int) (float64, error) {
+	var pending float64
+	if err := db.Model(&Payment{}).Select("COALESCE(SUM(amount), 0)").Where("order_id = ? and payment_method = ? and payment_status = ?", orderId, utils.PaymentMethodCOD, utils.PaymentStatusPending).Scan(&pending).Error; err != nil {
+		return 0, err
+	}
+	return pending, nil
+}
+
+func GetPendingCODPayments(db *gorm.DB, orderId int) ([]Payment, error) {
+	var payments []Payment
+	if err := db.Where("order_id = ? and payment_method = ? and payment_status = ?", orderId, utils.PaymentMethodCOD, utils.PaymentStatusPending).Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (pay *Payment) MarkCollected(db *gorm.DB, reference string) error {
+	now := time.Now()
+	pay.PaymentStatus = utils.PaymentStatusPaid
+	pay.CollectedAt = &now
+	pay.TenderReference = reference
+	updatedFields := map[string]interface{}{"payment_status": pay.PaymentStatus, "collected_at": now, "tender_reference": reference}
+	if err := db.Model(&Payment{}).Where("payment_id = ? and payment_status = ?", pay.PaymentID, utils.PaymentStatusPending).Updates(updatedFields).Error; err != nil {
+		return err
+	}
+	return nil
+}
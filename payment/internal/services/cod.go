@@ -0,0 +1,136 @@
+package services
+
+import (
+	"crypto/hmac"
+	"e-commerce-backend/payment/internal/models"
+	"e-commerce-backend/payment/pkg/constants"
+	"e-commerce-backend/payment/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// notifyCODCollected tells the order service that the order is paid now
+func notifyCODCollected(customerId, orderId int) error {
+	links := constants.MicroserviceLinks()
+	link := fmt.Sprintf(links["orderMSCODCollectedCallLink"], customerId, orderId)
+	req, err := http.NewRequest(http.MethodPost, link, nil)
+	if err != nil {
+		return err
+	}
+	utils.SetServiceToken(req)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("order service responded with status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// collectCODPayments marks every pending cash on delivery tender of the order as paid. The order service is told
+// before the collection is saved, when it can't be reached nothing is recorded and the collection can be retried
+func collectCODPayments(db *gorm.DB, orderId int, reference string) ([]models.Payment, error) {
+	payments, err := models.GetPendingCODPayments(db, orderId)
+	if err != nil {
+		return nil, err
+	}
+	if len(payments) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i := range payments {
+			if err := payments[i].MarkCollected(tx, reference); err != nil {
+				return err
+			}
+		}
+		if err := notifyCODCollected(payments[0].CustomerID, orderId); err != nil {
+			return fmt.Errorf(utils.CODOrderNotifyError+": %w", orderId, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func writeCODCollectionError(w http.ResponseWriter, orderId int, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.JsonError(w, fmt.Sprintf(utils.CODPaymentNotFound, orderId), http.StatusNotFound, err)
+		return
+	}
+	utils.JsonError(w, fmt.Sprintf(utils.CODCollectionError, orderId), http.StatusInternalServerError, err)
+}
+
+// CollectCODPayment lets an admin record the cash collected for an order
+func (s *Service) CollectCODPayment(w http.ResponseWriter, r *http.Request) {
+	orderId, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.OrderIdInvalid, mux.Vars(r)["id"]), http.StatusBadRequest, err)
+		return
+	}
+
+	//body is optional, it only carries the receipt reference
+	var req payloads.CODCollectRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	payments, err := collectCODPayments(s.DB, orderId, req.Reference)
+	if err != nil {
+		writeCODCollectionError(w, orderId, err)
+		return
+	}
+
+	utils.JsonResponse(toTenderResponses(payments), w, fmt.Sprintf(utils.CODCollectedSuccessfully, orderId), http.StatusOK)
+}
+
+// DeliveryWebhook receives delivery events, the caller is authenticated with a shared secret header
+func (s *Service) DeliveryWebhook(w http.ResponseWriter, r *http.Request) {
+	secret := os.Getenv(constants.DeliveryWebhookSecretEnv)
+	given := r.Header.Get(constants.DeliveryWebhookSecretHeader)
+	if secret == "" || !hmac.Equal([]byte(secret), []byte(given)) {
+		utils.JsonError(w, utils.InvalidWebhookSecret, http.StatusUnauthorized, nil)
+		return
+	}
+
+	var req payloads.DeliveryEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if req.OrderID <= 0 {
+		utils.JsonError(w, utils.OrderIdRequired, http.StatusBadRequest, nil)
+		return
+	}
+
+	//only delivery completes the collection, other events are acknowledged and ignored
+	if !strings.EqualFold(req.Event, constants.DeliveryEventDelivered) {
+		utils.JsonResponse(nil, w, fmt.Sprintf(utils.DeliveryEventIgnored, req.Event), http.StatusOK)
+		return
+	}
+
+	payments, err := collectCODPayments(s.DB, req.OrderID, req.Reference)
+	if err != nil {
+		writeCODCollectionError(w, req.OrderID, err)
+		return
+	}
+
+	utils.JsonResponse(toTenderResponses(payments), w, fmt.Sprintf(utils.CODCollectedSuccessfully, req.OrderID), http.StatusOK)
+}
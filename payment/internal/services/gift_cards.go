@@ -0,0 +1,280 @@
+package services
+
+import (
+	"e-commerce-backend/payment/internal/models"
+	"e-commerce-backend/payment/pkg/constants"
+	"e-commerce-backend/payment/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type GiftCardServices struct {
+	DB *gorm.DB
+}
+
+func NewGiftCardServices(db *gorm.DB) *GiftCardServices {
+	return &GiftCardServices{db}
+}
+
+type GiftCardService interface {
+	BulkCreateGiftCards(w http.ResponseWriter, r *http.Request)
+	PurchaseGiftCards(w http.ResponseWriter, r *http.Request)
+	GetGiftCardBalance(w http.ResponseWriter, r *http.Request)
+	GetGiftCardRedemptions(w http.ResponseWriter, r *http.Request)
+}
+
+// generateGiftCardCode formats a random token as GC-XXXX-XXXX-XXXX-XXXX
+func generateGiftCardCode() string {
+	token := strings.ToUpper(utils.GenerateRandomToken())[:16]
+	parts := []string{constants.GiftCardCodePrefix}
+	for i := 0; i < len(token); i += 4 {
+		parts = append(parts, token[i:i+4])
+	}
+	return strings.Join(parts, "-")
+}
+
+func normalizeGiftCardCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func issueGiftCard(db *gorm.DB, card models.GiftCard) (models.GiftCard, error) {
+	var err error
+	for i := 0; i < constants.GiftCardCodeGenerateTries; i++ {
+		card.Code = generateGiftCardCode()
+		card.Balance = card.InitialBalance
+		if err = card.CreateGiftCard(db); err == nil {
+			return card, nil
+		}
+	}
+	return card, err
+}
+
+func validateGiftCardAmount(amount float64) error {
+	if utils.ToCents(amount) <= 0 {
+		return errors.New("gift card amount is required")
+	}
+	if amount > constants.GiftCardMaxAmount {
+		return fmt.Errorf("gift card amount can't be more than %d", constants.GiftCardMaxAmount)
+	}
+	return nil
+}
+
+func toGiftCardResponse(card models.GiftCard) payloads.GiftCardResponse {
+	return payloads.GiftCardResponse{
+		Code:      card.Code,
+		Balance:   card.Balance,
+		ExpiresAt: card.ExpiresAt,
+	}
+}
+
+func (gs *GiftCardServices) BulkCreateGiftCards(w http.ResponseWriter, r *http.Request) {
+	var req payloads.GiftCardBulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if req.Count <= 0 || req.Count > constants.GiftCardMaxBulkCount {
+		err := fmt.Errorf(utils.GiftCardBulkCountError, constants.GiftCardMaxBulkCount)
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if err := validateGiftCardAmount(req.Amount); err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if req.ValidityDays <= 0 {
+		req.ValidityDays = constants.GiftCardValidityDays
+	}
+
+	adminId := utils.GetUserIdFromContext(r)
+	expiresAt := time.Now().AddDate(0, 0, req.ValidityDays)
+
+	var cards []payloads.GiftCardResponse
+	err := gs.DB.Transaction(func(tx *gorm.DB) error {
+		for i := 0; i < req.Count; i++ {
+			card, err := issueGiftCard(tx, models.GiftCard{
+				InitialBalance: req.Amount,
+				Source:         models.GiftCardSourceAdmin,
+				IssuedBy:       adminId,
+				IssuedTo:       req.IssuedTo,
+				IsActive:       true,
+				ExpiresAt:      expiresAt,
+			})
+			if err != nil {
+				return err
+			}
+			cards = append(cards, toGiftCardResponse(card))
+		}
+		return nil
+	})
+	if err != nil {
+		utils.JsonError(w, utils.GiftCardCreationError, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(cards, w, fmt.Sprintf(utils.GiftCardsCreatedSuccessfully, len(cards)), http.StatusCreated)
+}
+
+// PurchaseGiftCards issues the gift cards bought with an order to the customer of the order, only the order
+// service calls it. The cards are taken from the gift card lines of the order, they are only issued once the order
+// is paid and only once per order
+func (gs *GiftCardServices) PurchaseGiftCards(w http.ResponseWriter, r *http.Request) {
+	orderId, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.OrderIdInvalid, mux.Vars(r)["id"]), http.StatusBadRequest, err)
+		return
+	}
+
+	customerId, lines, err := models.GetOrderGiftCards(gs.DB, orderId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err := fmt.Errorf(utils.OrderPaymentIncomplete, orderId)
+			utils.JsonError(w, err.Error(), http.StatusPaymentRequired, err)
+			return
+		}
+		utils.JsonError(w, fmt.Sprintf(utils.PaymentFetchError, orderId), http.StatusInternalServerError, err)
+		return
+	}
+	if len(lines) == 0 {
+		err := fmt.Errorf(utils.OrderHasNoGiftCards, orderId)
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	var purchaseTotal int64
+	for _, line := range lines {
+		if err := validateGiftCardAmount(line.GiftCardAmount); err != nil || line.Quantity <= 0 {
+			err := fmt.Errorf(utils.OrderGiftCardLineInvalid, orderId)
+			utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+			return
+		}
+		purchaseTotal += utils.ToCents(line.GiftCardAmount) * int64(line.Quantity)
+	}
+
+	var pay models.Payment
+	capturedAmount, err := pay.GetCapturedAmount(gs.DB, orderId)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.PaymentFetchError, orderId), http.StatusInternalServerError, err)
+		return
+	}
+	if utils.ToCents(capturedAmount) < purchaseTotal {
+		err := fmt.Errorf(utils.OrderPaymentIncomplete, orderId)
+		utils.JsonError(w, err.Error(), http.StatusPaymentRequired, err)
+		return
+	}
+
+	issued, err := models.CountGiftCardsByOrderId(gs.DB, orderId)
+	if err != nil {
+		utils.JsonError(w, utils.GiftCardCreationError, http.StatusInternalServerError, err)
+		return
+	}
+	if issued > 0 {
+		err := fmt.Errorf(utils.GiftCardsAlreadyIssued, orderId)
+		utils.JsonError(w, err.Error(), http.StatusConflict, err)
+		return
+	}
+
+	expiresAt := time.Now().AddDate(0, 0, constants.GiftCardValidityDays)
+	var cards []payloads.GiftCardResponse
+	err = gs.DB.Transaction(func(tx *gorm.DB) error {
+		for _, line := range lines {
+			for i := 0; i < line.Quantity; i++ {
+				card, err := issueGiftCard(tx, models.GiftCard{
+					InitialBalance: line.GiftCardAmount,
+					Source:         models.GiftCardSourcePurchase,
+					IssuedTo:       customerId,
+					OrderID:        orderId,
+					IsActive:       true,
+					ExpiresAt:      expiresAt,
+				})
+				if err != nil {
+					return err
+				}
+				cards = append(cards, toGiftCardResponse(card))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.JsonError(w, utils.GiftCardCreationError, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(cards, w, fmt.Sprintf(utils.GiftCardsCreatedSuccessfully, len(cards)), http.StatusCreated)
+}
+
+func (gs *GiftCardServices) GetGiftCardBalance(w http.ResponseWriter, r *http.Request) {
+	code := normalizeGiftCardCode(mux.Vars(r)["code"])
+
+	var card models.GiftCard
+	if err := card.GetGiftCardByCode(gs.DB, code); err != nil {
+		utils.JsonError(w, utils.GiftCardNotFound, http.StatusNotFound, err)
+		return
+	}
+
+	resp := payloads.GiftCardBalanceResponse{
+		Code:           card.MaskedCode(),
+		InitialBalance: card.InitialBalance,
+		Balance:        card.Balance,
+		IsActive:       card.IsActive,
+		IsExpired:      card.IsExpired(),
+		ExpiresAt:      card.ExpiresAt,
+	}
+	utils.JsonResponse(resp, w, utils.GiftCardFetchedSuccessfully, http.StatusOK)
+}
+
+func (gs *GiftCardServices) GetGiftCardRedemptions(w http.ResponseWriter, r *http.Request) {
+	code := normalizeGiftCardCode(mux.Vars(r)["code"])
+
+	var card models.GiftCard
+	if err := card.GetGiftCardByCode(gs.DB, code); err != nil {
+		utils.JsonError(w, utils.GiftCardNotFound, http.StatusNotFound, err)
+		return
+	}
+
+	redemptions, err := card.GetRedemptions(gs.DB)
+	if err != nil {
+		utils.JsonError(w, utils.GiftCardNotFound, http.StatusInternalServerError, err)
+		return
+	}
+	if redemptions == nil {
+		redemptions = []models.GiftCardRedemption{}
+	}
+
+	utils.JsonResponse(redemptions, w, utils.GiftCardFetchedSuccessfully, http.StatusOK)
+}
+
+// giftCardProcessor redeems the card given as tender reference, partial use leaves the rest of the balance on the card
+type giftCardProcessor struct{}
+
+func (giftCardProcessor) Capture(db *gorm.DB, payment *models.Payment, tender payloads.TenderRequest) error {
+	card := models.GiftCard{Code: normalizeGiftCardCode(tender.Reference)}
+	if card.Code == "" {
+		return errors.New(utils.GiftCardCodeRequired)
+	}
+	if err := card.Redeem(db, payment.OrderID, payment.PaymentID, tender.Amount); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New(utils.GiftCardNotFound)
+		}
+		return err
+	}
+	payment.TenderReference = card.MaskedCode()
+	return nil
+}
+
+func (giftCardProcessor) Refund(db *gorm.DB, payment *models.Payment) error {
+	var card models.GiftCard
+	return card.RefundRedemption(db, payment.PaymentID)
+}
+
+func (giftCardProcessor) Deferred() bool {
+	return false
+}
@@ -2,10 +2,13 @@ package services
 
 import (
 	"e-commerce-backend/payment/internal/models"
+	"e-commerce-backend/payment/pkg/constants"
+	"e-commerce-backend/payment/pkg/payloads"
 	"e-commerce-backend/shared/utils"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	"github.com/stripe/stripe-go/v81"
 	"github.com/stripe/stripe-go/v81/paymentintent"
@@ -14,7 +17,7 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"time"
+	"strings"
 
 	"gorm.io/gorm"
 )
@@ -27,6 +30,8 @@ type PaymentService interface {
 	GetPayment(w http.ResponseWriter, r *http.Request)
 	InitiatePayment(w http.ResponseWriter, r *http.Request)
 	RefundPayment(w http.ResponseWriter, r *http.Request)
+	CollectCODPayment(w http.ResponseWriter, r *http.Request)
+	DeliveryWebhook(w http.ResponseWriter, r *http.Request)
 }
 
 func NewPaymentService(db *gorm.DB) *Service {
@@ -44,51 +49,153 @@ func initStripe() {
 }
 
 func (s *Service) GetPayment(w http.ResponseWriter, r *http.Request) {
+	orderId, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.OrderIdInvalid, mux.Vars(r)["id"]), http.StatusBadRequest, err)
+		return
+	}
+
 	var pay models.Payment
+	payments, err := pay.GetPaymentsByOrderId(s.DB, orderId)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.PaymentFetchError, orderId), http.StatusInternalServerError, err)
+		return
+	}
+
+	paidAmount, err := pay.GetCapturedAmount(s.DB, orderId)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.PaymentFetchError, orderId), http.StatusInternalServerError, err)
+		return
+	}
+
+	pendingAmount, err := pay.GetPendingCODAmount(s.DB, orderId)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.PaymentFetchError, orderId), http.StatusInternalServerError, err)
+		return
+	}
 
-	utils.JsonResponse(pay, w, utils.ProductCategoryError, http.StatusCreated)
+	resp := payloads.PaymentResponse{
+		OrderID:       orderId,
+		PaidAmount:    paidAmount,
+		PendingAmount: pendingAmount,
+		Tenders:       toTenderResponses(payments),
+	}
+	utils.JsonResponse(resp, w, fmt.Sprintf(utils.PaymentFetchedSuccessfully, orderId), http.StatusOK)
 }
 
-func ValidatePaymentRequest(req map[string]interface{}) error {
-	if int(req["order_id"].(float64)) <= 0 {
+func ValidatePaymentRequest(req payloads.PaymentRequest) error {
+	if req.OrderID <= 0 {
 		return errors.New("order id is required")
 	}
-	if int(req["customer_id"].(float64)) <= 0 {
+	if req.CustomerID <= 0 {
 		return errors.New("customer id is required")
 	}
-	if int(req["total_amount"].(float64)) <= 0 {
+	if utils.ToCents(req.TotalAmount) <= 0 {
 		return errors.New("total amount is required")
 	}
+	for _, tender := range req.Tenders {
+		if tender.PaymentMethod == "" {
+			return errors.New("payment method is required for every tender")
+		}
+		if utils.ToCents(tender.Amount) <= 0 {
+			return errors.New("amount is required for every tender")
+		}
+	}
 	return nil
 }
 
 func (s *Service) InitiatePayment(w http.ResponseWriter, r *http.Request) {
-
-	var req map[string]interface{}
+	var req payloads.PaymentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.JsonResponse(req, w, utils.InvalidPaymentRequest, http.StatusBadRequest)
+		utils.JsonError(w, utils.InvalidPaymentRequest, http.StatusBadRequest, err)
 		return
 	}
 	if err := ValidatePaymentRequest(req); err != nil {
-		utils.JsonResponse(req, w, utils.PaymentValidationFailed, http.StatusBadRequest)
+		utils.JsonError(w, utils.PaymentValidationFailed, http.StatusBadRequest, err)
 		return
 	}
 	log.Println("request:", req)
-	orderId := int(req["order_id"].(float64))
-	amount := req["total_amount"].(float64)
-
-	//for now using demoPayment
-	payment := demoPayment(orderId, amount)
-	//store payment
-	if err := payment.CreatePayment(s.DB); err != nil {
-		utils.JsonResponse(req, w, utils.PaymentFailed, http.StatusInternalServerError)
+
+	//the order is locked while its payments are read and captured, a concurrent request for it waits and then
+	//sees the tenders captured here
+	var capturedAmount, pendingAmount float64
+	var tenderTotal, codTotal int64
+	var payments []models.Payment
+	var tenderErr error
+	errMsg, errStatus := fmt.Sprintf(utils.PaymentFetchError, req.OrderID), http.StatusInternalServerError
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.LockOrderPayments(tx, req.OrderID); err != nil {
+			return err
+		}
+
+		var pay models.Payment
+		var err error
+		if capturedAmount, err = pay.GetCapturedAmount(tx, req.OrderID); err != nil {
+			return err
+		}
+		if pendingAmount, err = pay.GetPendingCODAmount(tx, req.OrderID); err != nil {
+			return err
+		}
+		remaining := utils.ToCents(req.TotalAmount) - utils.ToCents(capturedAmount) - utils.ToCents(pendingAmount)
+		if remaining <= 0 {
+			errMsg, errStatus = fmt.Sprintf(utils.OrderAlreadyPaid, req.OrderID), http.StatusConflict
+			return errors.New(errMsg)
+		}
+
+		//single payment is treated as one tender covering the remaining amount
+		if len(req.Tenders) == 0 {
+			method := req.PaymentMethod
+			if method == "" {
+				method = constants.DefaultPaymentMethod
+			}
+			req.Tenders = []payloads.TenderRequest{{PaymentMethod: method, Amount: float64(remaining) / 100}}
+		}
+
+		for _, tender := range req.Tenders {
+			tenderTotal += utils.ToCents(tender.Amount)
+			if strings.EqualFold(tender.PaymentMethod, utils.PaymentMethodCOD) {
+				codTotal += utils.ToCents(tender.Amount)
+			}
+		}
+		if tenderTotal != remaining {
+			err := fmt.Errorf(utils.PaymentTenderAmountMismatch, float64(tenderTotal)/100, float64(remaining)/100)
+			errMsg, errStatus = err.Error(), http.StatusBadRequest
+			return err
+		}
+		if codTotal > 0 && utils.ToCents(req.TotalAmount) > utils.ToCents(utils.GetCODMaxOrderValue()) {
+			err := fmt.Errorf(utils.CODOrderValueExceeded, utils.GetCODMaxOrderValue())
+			errMsg, errStatus = err.Error(), http.StatusBadRequest
+			return err
+		}
+
+		//a failed tender keeps its failed and refunded records, only the response reports the failure
+		payments, tenderErr = processTenders(tx, req)
+		return nil
+	})
+	if err != nil {
+		utils.JsonError(w, errMsg, errStatus, err)
 		return
 	}
-	resp := map[string]interface{}{}
-	if payment.PaymentID > 0 {
-		resp["payment_id"] = payment.PaymentID
+
+	resp := payloads.PaymentResponse{
+		OrderID:     req.OrderID,
+		TotalAmount: req.TotalAmount,
+		Tenders:     toTenderResponses(payments),
+	}
+	if tenderErr != nil {
+		resp.PaidAmount = capturedAmount
+		resp.PendingAmount = pendingAmount
+		utils.JsonResponseWithError(resp, w, utils.PaymentFailed, http.StatusPaymentRequired, []error{tenderErr})
+		return
 	}
 
+	for _, payment := range payments {
+		resp.PaymentIds = append(resp.PaymentIds, payment.PaymentID)
+	}
+	resp.PaidAmount = float64(utils.ToCents(capturedAmount)+tenderTotal-codTotal) / 100
+	resp.PendingAmount = float64(utils.ToCents(pendingAmount)+codTotal) / 100
+	resp.IsPaid = utils.ToCents(resp.PaidAmount) == utils.ToCents(req.TotalAmount)
+
 	//this not working
 	//intent := stripePayment(w)
 	//response := map[string]interface{}{
@@ -97,19 +204,6 @@ func (s *Service) InitiatePayment(w http.ResponseWriter, r *http.Request) {
 	utils.JsonResponse(resp, w, utils.PaymentSuccessful, http.StatusCreated)
 }
 
-func demoPayment(orderId int, amount float64) models.Payment {
-	resp := models.Payment{
-		OrderID:              orderId,
-		PaymentMethod:        "xyz",
-		PaymentDate:          time.Now(),
-		PaymentFailureReason: "",
-		PaymentStatus:        utils.PaymentStatusPaid,
-		PaymentRetryCount:    0,
-		Amount:               amount,
-	}
-	return resp
-}
-
 func stripePayment(w http.ResponseWriter) *stripe.PaymentIntent {
 	initStripe()
 	productParams := &stripe.ProductParams{
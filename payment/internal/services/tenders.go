@@ -0,0 +1,162 @@
+package services
+
+import (
+	"e-commerce-backend/payment/internal/models"
+	"e-commerce-backend/payment/pkg/constants"
+	"e-commerce-backend/payment/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// TenderProcessor captures and refunds a single tender of an order, deferred tenders stay pending
+// after capture and are settled later (e.g. cash on delivery)
+type TenderProcessor interface {
+	Capture(db *gorm.DB, payment *models.Payment, tender payloads.TenderRequest) error
+	Refund(db *gorm.DB, payment *models.Payment) error
+	Deferred() bool
+}
+
+var tenderProcessors = map[string]TenderProcessor{
+	constants.PaymentMethodCard:         demoProcessor{},
+	constants.PaymentMethodBankTransfer: demoProcessor{},
+	constants.PaymentMethodGiftCard:     giftCardProcessor{},
+	utils.PaymentMethodCOD:              codProcessor{},
+}
+
+func getTenderProcessor(method string) (TenderProcessor, error) {
+	processor, ok := tenderProcessors[strings.ToLower(method)]
+	if !ok {
+		return nil, fmt.Errorf(utils.PaymentMethodNotSupported, method)
+	}
+	return processor, nil
+}
+
+// demoProcessor stands in for a gateway until stripe integration works
+type demoProcessor struct{}
+
+func (demoProcessor) Capture(db *gorm.DB, payment *models.Payment, tender payloads.TenderRequest) error {
+	if tender.Reference != "" {
+		payment.TenderReference = tender.Reference
+	} else {
+		payment.TenderReference = utils.GenerateRandomToken()
+	}
+	return nil
+}
+
+func (demoProcessor) Refund(db *gorm.DB, payment *models.Payment) error {
+	return nil
+}
+
+func (demoProcessor) Deferred() bool {
+	return false
+}
+
+// codProcessor creates the payment without any gateway call, it is collected when the order is delivered
+type codProcessor struct{}
+
+func (codProcessor) Capture(db *gorm.DB, payment *models.Payment, tender payloads.TenderRequest) error {
+	payment.TenderReference = tender.Reference
+	return nil
+}
+
+func (codProcessor) Refund(db *gorm.DB, payment *models.Payment) error {
+	return nil
+}
+
+func (codProcessor) Deferred() bool {
+	return true
+}
+
+// processTenders captures every tender in order, if one of them fails the tenders already
+// captured in this request are refunded so the order is never left partially paid
+func processTenders(db *gorm.DB, req payloads.PaymentRequest) ([]models.Payment, error) {
+	var payments []models.Payment
+
+	for _, tender := range req.Tenders {
+		processor, err := getTenderProcessor(tender.PaymentMethod)
+		if err != nil {
+			unwindTenders(db, payments)
+			return payments, err
+		}
+
+		payment := models.Payment{
+			OrderID:       req.OrderID,
+			CustomerID:    req.CustomerID,
+			PaymentMethod: strings.ToLower(tender.PaymentMethod),
+			PaymentStatus: utils.PaymentStatusPending,
+			Amount:        tender.Amount,
+		}
+		if err := payment.CreatePayment(db); err != nil {
+			unwindTenders(db, payments)
+			return payments, err
+		}
+
+		if err := processor.Capture(db, &payment, tender); err != nil {
+			if updateErr := payment.UpdatePaymentStatus(db, utils.PaymentStatusFailed, err.Error()); updateErr != nil {
+				utils.LogError(fmt.Sprintf(utils.PaymentStatusUpdateError, payment.PaymentID), map[string]interface{}{"error": updateErr})
+			}
+			payments = append(payments, payment)
+			unwindTenders(db, payments)
+			return payments, fmt.Errorf(utils.PaymentTenderFailed, payment.PaymentMethod, err)
+		}
+
+		if processor.Deferred() {
+			payments = append(payments, payment)
+			continue
+		}
+
+		if err := payment.MarkCaptured(db); err != nil {
+			payments = append(payments, payment)
+			unwindTenders(db, payments)
+			return payments, err
+		}
+		payments = append(payments, payment)
+	}
+
+	return payments, nil
+}
+
+func unwindTenders(db *gorm.DB, payments []models.Payment) {
+	for i := range payments {
+		payment := &payments[i]
+		if payment.PaymentStatus == utils.PaymentStatusPending && payment.PaymentMethod == utils.PaymentMethodCOD {
+			if err := payment.UpdatePaymentStatus(db, utils.PaymentStatusCanceled, utils.PaymentRemainderFailed); err != nil {
+				utils.LogError(fmt.Sprintf(utils.PaymentStatusUpdateError, payment.PaymentID), map[string]interface{}{"error": err})
+			}
+			continue
+		}
+		if payment.PaymentStatus != utils.PaymentStatusPaid {
+			continue
+		}
+
+		processor, err := getTenderProcessor(payment.PaymentMethod)
+		if err == nil {
+			err = processor.Refund(db, payment)
+		}
+		if err != nil {
+			utils.LogError(fmt.Sprintf(utils.PaymentRefundFailed, payment.PaymentID), map[string]interface{}{"error": err})
+			continue
+		}
+
+		if err := payment.UpdatePaymentStatus(db, utils.PaymentStatusRefunded, utils.PaymentRemainderFailed); err != nil {
+			utils.LogError(fmt.Sprintf(utils.PaymentStatusUpdateError, payment.PaymentID), map[string]interface{}{"error": err})
+		}
+	}
+}
+
+func toTenderResponses(payments []models.Payment) []payloads.TenderResponse {
+	tenders := make([]payloads.TenderResponse, 0, len(payments))
+	for _, payment := range payments {
+		tenders = append(tenders, payloads.TenderResponse{
+			PaymentID:     payment.PaymentID,
+			PaymentMethod: payment.PaymentMethod,
+			PaymentStatus: payment.PaymentStatus,
+			Amount:        payment.Amount,
+			FailureReason: payment.PaymentFailureReason,
+		})
+	}
+	return tenders
+}
@@ -1 +1,40 @@
 package constants
+
+import "e-commerce-backend/shared/utils"
+
+// Supported tender methods
+const (
+	PaymentMethodCard         = "card"
+	PaymentMethodBankTransfer = "bank_transfer"
+)
+
+const DefaultPaymentMethod = PaymentMethodCard
+
+const PaymentMethodGiftCard = "gift_card"
+
+// Gift cards
+const (
+	GiftCardCodePrefix        = "GC"
+	GiftCardValidityDays      = 365
+	GiftCardMaxBulkCount      = 500
+	GiftCardMaxAmount         = 10000
+	GiftCardCodeGenerateTries = 5
+)
+
+// Cash on delivery collection
+const (
+	DeliveryEventDelivered      = "delivered"
+	DeliveryWebhookSecretHeader = "X-Webhook-Secret"
+	DeliveryWebhookSecretEnv    = "DELIVERY_WEBHOOK_SECRET"
+)
+
+// Order service
+const OrderMicroserviceCODCollected = "/%d/cod-collected"
+
+func MicroserviceLinks() map[string]string {
+	links := map[string]string{}
+
+	orderCODCollectedLink := utils.GetOrderMicroserviceLink(OrderMicroserviceCODCollected)
+	links["orderMSCODCollectedCallLink"] = orderCODCollectedLink
+	return links
+}
@@ -1 +1,34 @@
 package payloads
+
+type PaymentRequest struct {
+	OrderID       int             `json:"order_id"`
+	CustomerID    int             `json:"customer_id"`
+	TotalAmount   float64         `json:"total_amount"`
+	PaymentMethod string          `json:"payment_method"`
+	Tenders       []TenderRequest `json:"tenders"`
+}
+
+// TenderRequest one part of a split payment, e.g. a card covering half of the order
+type TenderRequest struct {
+	PaymentMethod string  `json:"payment_method"`
+	Amount        float64 `json:"amount"`
+	Reference     string  `json:"reference"`
+}
+
+type GiftCardBulkRequest struct {
+	Count        int     `json:"count"`
+	Amount       float64 `json:"amount"`
+	IssuedTo     int     `json:"issued_to"`
+	ValidityDays int     `json:"validity_days"`
+}
+
+// DeliveryEventRequest sent by the delivery partner webhook, cash is collected on "delivered"
+type DeliveryEventRequest struct {
+	OrderID   int    `json:"order_id"`
+	Event     string `json:"event"`
+	Reference string `json:"reference"`
+}
+
+type CODCollectRequest struct {
+	Reference string `json:"reference"`
+}
@@ -1 +1,37 @@
 package payloads
+
+import "time"
+
+type PaymentResponse struct {
+	OrderID     int     `json:"order_id"`
+	TotalAmount float64 `json:"total_amount"`
+	PaidAmount  float64 `json:"paid_amount"`
+	// PendingAmount cash on delivery tenders which are not collected yet
+	PendingAmount float64          `json:"pending_amount"`
+	IsPaid        bool             `json:"is_paid"`
+	PaymentIds    []int            `json:"payment_ids"`
+	Tenders       []TenderResponse `json:"tenders"`
+}
+
+type TenderResponse struct {
+	PaymentID     int     `json:"payment_id"`
+	PaymentMethod string  `json:"payment_method"`
+	PaymentStatus string  `json:"payment_status"`
+	Amount        float64 `json:"amount"`
+	FailureReason string  `json:"failure_reason,omitempty"`
+}
+
+type GiftCardResponse struct {
+	Code      string    `json:"code"`
+	Balance   float64   `json:"balance"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type GiftCardBalanceResponse struct {
+	Code           string    `json:"code"`
+	InitialBalance float64   `json:"initial_balance"`
+	Balance        float64   `json:"balance"`
+	IsActive       bool      `json:"is_active"`
+	IsExpired      bool      `json:"is_expired"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
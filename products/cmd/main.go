@@ -3,7 +3,10 @@ package main
 import (
 	"e-commerce-backend/products/dbs"
 	"e-commerce-backend/products/internal/handlers"
+	"e-commerce-backend/products/internal/media"
 	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/internal/services"
+	"e-commerce-backend/products/pkg/constants"
 	"e-commerce-backend/shared/middlewares"
 	"e-commerce-backend/shared/utils"
 	"fmt"
@@ -12,6 +15,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
@@ -22,6 +26,12 @@ func main() {
 	db := dbs.DB
 
 	InitSchemas()
+	if err := services.BuildSearchIndex(db); err != nil {
+		log.Fatalf("Failed to build the search index: %v", err)
+	}
+	services.StartReservationSweeper(db, constants.ReservationSweepEvery)
+	services.StartStockAlertWorker(db, constants.StockAlertEvery)
+	services.StartPriceScheduler(db, constants.PriceRuleSweepEvery)
 
 	r := mux.NewRouter()
 	//r.Use(middlewares.AuthMiddleware)
@@ -36,7 +46,7 @@ func main() {
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"X-Requested-With", "Content-Type", "Authorization"},
+		AllowedHeaders: []string{"X-Requested-With", "Content-Type", "Authorization", utils.CartTokenHeader},
 	})
 
 	handlers.ProductHandler(r)
@@ -44,6 +54,26 @@ func main() {
 	if err := godotenv.Load("../../.env"); err != nil {
 		log.Fatal(".env file not found from main.go")
 	}
+	mediaRoot, mediaURL := os.Getenv("MEDIA_ROOT"), os.Getenv("MEDIA_BASE_URL")
+	if mediaRoot == "" {
+		mediaRoot = constants.DefaultMediaRoot
+	}
+	if mediaURL == "" {
+		mediaURL = constants.DefaultMediaURL
+	}
+	storage := media.NewLocalStorage(mediaRoot, mediaURL)
+	services.SetImageStorage(storage)
+	//a base url pointing somewhere else, e.g. a CDN, serves the files itself
+	if strings.HasPrefix(mediaURL, "/") {
+		r.PathPrefix(storage.BaseURL + "/").Handler(storage.Handler()).Methods(http.MethodGet)
+	}
+
+	if strategy := os.Getenv("STOCK_ALLOCATION"); strategy != "" {
+		if err := models.SetAllocationStrategy(strategy); err != nil {
+			log.Fatalf("Invalid STOCK_ALLOCATION: %v", err)
+		}
+	}
+
 	port := os.Getenv("PRODUCT_PORT")
 	if port == "" {
 		port = "8081"
@@ -57,4 +87,15 @@ func main() {
 
 func InitSchemas() {
 	models.InitProductSchema()
+	models.InitTagSchema()
+	models.InitCategorySchema()
+	models.InitReservationSchema()
+	models.InitBundleSchema()
+	models.InitVariantSchema()
+	models.InitImageSchema()
+	models.InitReviewSchema()
+	models.InitImportSchema()
+	models.InitInventorySchema()
+	models.InitStockAlertSchema()
+	models.InitPriceSchema()
 }
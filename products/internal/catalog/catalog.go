@@ -0,0 +1,161 @@
+package catalog
+
+import (
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// TagSeparator separates the tags of a product within one csv cell
+const TagSeparator = "|"
+
+// Columns of a catalog in the order they are exported, imports take any of them in any order
+var Columns = []string{
+	"sku", "seller_id", "name", "description", "price", "quantity", "discount", "category", "category_id", "tags",
+	"min_order_quantity", "max_order_quantity", "quantity_step", "max_per_customer", "purchase_window_days",
+	"reorder_threshold",
+}
+
+func isColumn(name string) bool {
+	for _, column := range Columns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFormat picks the format asked for, or the one of the file extension when none is
+func ParseFormat(format, fileName string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	}
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatJSONL, "ndjson":
+		return FormatJSONL, nil
+	}
+	return "", fmt.Errorf(utils.InvalidCatalogFormat, format)
+}
+
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Record one product of a catalog, the json names are the column names
+type Record struct {
+	SKU                string   `json:"sku"`
+	SellerID           int      `json:"seller_id"`
+	Name               string   `json:"name"`
+	Description        string   `json:"description"`
+	Price              float64  `json:"price"`
+	Quantity           int      `json:"quantity"`
+	Discount           float64  `json:"discount"`
+	Category           string   `json:"category"`
+	CategoryID         int      `json:"category_id"`
+	Tags               []string `json:"tags"`
+	MinOrderQty        int      `json:"min_order_quantity"`
+	MaxOrderQty        int      `json:"max_order_quantity"`
+	QuantityStep       int      `json:"quantity_step"`
+	MaxPerCustomer     int      `json:"max_per_customer"`
+	PurchaseWindowDays int      `json:"purchase_window_days"`
+	ReorderThreshold   int      `json:"reorder_threshold"`
+}
+
+// values cells of the record in the order of Columns
+func (rec Record) values() []string {
+	return []string{
+		rec.SKU, strconv.Itoa(rec.SellerID), rec.Name, rec.Description, formatFloat(rec.Price), strconv.Itoa(rec.Quantity),
+		formatFloat(rec.Discount), rec.Category, strconv.Itoa(rec.CategoryID), strings.Join(rec.Tags, TagSeparator),
+		strconv.Itoa(rec.MinOrderQty), strconv.Itoa(rec.MaxOrderQty), strconv.Itoa(rec.QuantityStep),
+		strconv.Itoa(rec.MaxPerCustomer), strconv.Itoa(rec.PurchaseWindowDays), strconv.Itoa(rec.ReorderThreshold),
+	}
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// Row product read from an imported catalog, Values holds the cells of the columns the file has by column name
+type Row struct {
+	Number int // line of the row in the file, the header of a csv is line 1
+	Values map[string]string
+	Err    error // set when the row couldn't be read at all
+}
+
+// FieldError problem with one cell of a row
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Request turns the row into a product request. An empty cell leaves the field as it is on an update, except
+// for tags where a present but empty cell clears them like an empty list does on the API
+func (row Row) Request() (payloads.ProductRequest, []FieldError) {
+	var req payloads.ProductRequest
+	var errs []FieldError
+	invalid := func(field, value string) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(utils.InvalidCatalogValue, value)})
+	}
+	parseInt := func(field string, target *int) {
+		if value := row.Values[field]; value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				invalid(field, value)
+				return
+			}
+			*target = parsed
+		}
+	}
+	parseFloat := func(field string, target *float64) {
+		if value := row.Values[field]; value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 0 {
+				invalid(field, value)
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	req.SKU = row.Values["sku"]
+	req.PName = row.Values["name"]
+	req.PDesc = row.Values["description"]
+	req.Category = row.Values["category"]
+	parseInt("seller_id", &req.SellerID)
+	parseFloat("price", &req.Price)
+	parseInt("quantity", &req.Quantity)
+	parseFloat("discount", &req.Discount)
+	parseInt("category_id", &req.CategoryID)
+	parseInt("min_order_quantity", &req.MinOrderQty)
+	parseInt("max_order_quantity", &req.MaxOrderQty)
+	parseInt("quantity_step", &req.QuantityStep)
+	parseInt("max_per_customer", &req.MaxPerCustomer)
+	parseInt("purchase_window_days", &req.PurchaseWindowDays)
+	parseInt("reorder_threshold", &req.ReorderThreshold)
+	if req.Quantity < 0 {
+		invalid("quantity", row.Values["quantity"])
+	}
+
+	if value, ok := row.Values["tags"]; ok {
+		req.Tags = []string{}
+		for _, tag := range strings.Split(value, TagSeparator) {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				req.Tags = append(req.Tags, tag)
+			}
+		}
+	}
+	return req, errs
+}
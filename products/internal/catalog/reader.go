@@ -0,0 +1,177 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"e-commerce-backend/shared/utils"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// columnName is the column a name of the file stands for, through the mapping when it has one
+func columnName(name string, mapping map[string]string) string {
+	name = strings.TrimSpace(name)
+	if mapped, ok := mapping[name]; ok {
+		name = mapped
+	}
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Read reads every row of the catalog, mapping renames the columns of the file to ours. A file which can't be
+// read as a whole, e.g. a csv with an unknown column, is an error while a bad row only sets the Err of the row
+func Read(r io.Reader, format string, mapping map[string]string, maxRows int) ([]Row, error) {
+	var rows []Row
+	var err error
+	if format == FormatCSV {
+		rows, err = readCSV(r, mapping, maxRows)
+	} else {
+		rows, err = readJSONL(r, mapping, maxRows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New(utils.CatalogEmpty)
+	}
+	return rows, nil
+}
+
+func readCSV(r io.Reader, mapping map[string]string, maxRows int) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New(utils.CatalogEmpty)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(utils.CatalogReadError, err)
+	}
+
+	columns := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		if i == 0 {
+			//spreadsheets like to start the file with a byte order mark
+			name = strings.TrimPrefix(name, "\uFEFF")
+		}
+		column := columnName(name, mapping)
+		if !isColumn(column) {
+			return nil, fmt.Errorf(utils.UnknownCatalogColumn, name)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf(utils.DuplicateCatalogColumn, column)
+		}
+		seen[column] = true
+		columns[i] = column
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if len(rows) == maxRows {
+			return nil, fmt.Errorf(utils.CatalogRowLimit, maxRows)
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, fmt.Errorf(utils.CatalogReadError, err)
+			}
+			rows = append(rows, Row{Number: parseErr.StartLine, Err: parseErr})
+			continue
+		}
+		if isBlank(record) {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		row := Row{Number: line, Values: make(map[string]string, len(columns))}
+		for i, value := range record {
+			if i < len(columns) {
+				row.Values[columns[i]] = strings.TrimSpace(value)
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func isBlank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func readJSONL(r io.Reader, mapping map[string]string, maxRows int) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	var rows []Row
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if len(rows) == maxRows {
+			return nil, fmt.Errorf(utils.CatalogRowLimit, maxRows)
+		}
+		row := Row{Number: line}
+		row.Values, row.Err = jsonValues(text, mapping)
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf(utils.CatalogReadError, err)
+	}
+	return rows, nil
+}
+
+// jsonValues flattens one json object into cells like the ones of a csv, a list becomes the tags cell
+func jsonValues(text []byte, mapping map[string]string) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf(utils.CatalogReadError, err)
+	}
+
+	values := make(map[string]string, len(object))
+	for name, value := range object {
+		column := columnName(name, mapping)
+		if !isColumn(column) {
+			return nil, fmt.Errorf(utils.UnknownCatalogColumn, name)
+		}
+		if _, ok := values[column]; ok {
+			return nil, fmt.Errorf(utils.DuplicateCatalogColumn, column)
+		}
+		switch v := value.(type) {
+		case nil:
+			continue
+		case string:
+			values[column] = strings.TrimSpace(v)
+		case json.Number:
+			values[column] = v.String()
+		case bool:
+			values[column] = fmt.Sprint(v)
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				text, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf(utils.InvalidCatalogValue, fmt.Sprint(value))
+				}
+				items = append(items, text)
+			}
+			values[column] = strings.Join(items, TagSeparator)
+		default:
+			return nil, fmt.Errorf(utils.InvalidCatalogValue, fmt.Sprint(value))
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,54 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+)
+
+// Writer writes records in one of the catalog formats, Flush has to be called once the last one is written
+type Writer interface {
+	Write(rec Record) error
+	Flush() error
+}
+
+// NewWriter starts a catalog in the format, a csv gets its header right away
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	if format == FormatCSV {
+		writer := csv.NewWriter(w)
+		if err := writer.Write(Columns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{writer}, nil
+	}
+	return &jsonlWriter{json.NewEncoder(w)}, nil
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (cw *csvWriter) Write(rec Record) error {
+	return cw.writer.Write(rec.values())
+}
+
+func (cw *csvWriter) Flush() error {
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+// Write puts the record on a line of its own, Encode ends every value with a newline
+func (jw *jsonlWriter) Write(rec Record) error {
+	if rec.Tags == nil {
+		rec.Tags = []string{}
+	}
+	return jw.encoder.Encode(rec)
+}
+
+func (jw *jsonlWriter) Flush() error {
+	return nil
+}
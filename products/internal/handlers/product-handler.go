@@ -14,19 +14,96 @@ func ProductHandler(r *mux.Router) {
 
 	// implementing mux router
 	r.Handle("/products", http.HandlerFunc(productService.GetProducts)).Methods(http.MethodGet)
+	//registered before /product/{id} so "batch" is not taken for an id
+	r.Handle("/product/batch", http.HandlerFunc(productService.GetProductsBatch)).Methods(http.MethodGet)
+	//tag management, registered before /product/{id} for the same reason
+	r.Handle("/product/tags", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.GetTags)))).Methods(http.MethodGet)
+	r.Handle("/product/tags/merge", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.MergeTags)))).Methods(http.MethodPost)
+	r.Handle("/product/tags/{id}", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.RenameTag)))).Methods(http.MethodPut)
+	r.Handle("/product/tags/{id}", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.DeleteTag)))).Methods(http.MethodDelete)
+	//bulk catalog import and export, imports run in the background and are followed through their job
+	r.Handle("/product/import", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "seller", "admin")(http.HandlerFunc(productService.ImportProducts)))).Methods(http.MethodPost)
+	r.Handle("/product/import/{id}", middlewares.AuthMiddleware(http.HandlerFunc(productService.GetImportJob))).Methods(http.MethodGet)
+	r.Handle("/product/export", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "seller", "admin")(http.HandlerFunc(productService.ExportProducts)))).Methods(http.MethodGet)
+	//seller dashboard, each seller only sees their own products
+	r.Handle("/product/seller/products", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "seller", "admin")(http.HandlerFunc(productService.GetSellerProducts)))).Methods(http.MethodGet)
+	r.Handle("/product/seller/sales", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "seller", "admin")(http.HandlerFunc(productService.GetSellerSales)))).Methods(http.MethodGet)
+	r.Handle("/product/seller/low-stock", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "seller", "admin")(http.HandlerFunc(productService.GetSellerLowStock)))).Methods(http.MethodGet)
+	//warehouses, stock is kept per warehouse and every change of it goes into the stock ledger
+	r.Handle("/product/warehouses", middlewares.AuthMiddleware(http.HandlerFunc(productService.GetWarehouses))).Methods(http.MethodGet)
+	r.Handle("/product/warehouses", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.CreateWarehouse)))).Methods(http.MethodPost)
+	r.Handle("/product/warehouses/{id}", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.UpdateWarehouse)))).Methods(http.MethodPut)
+	//scheduled price rules, the scheduler keeps the sale prices of the products in their scope
+	r.Handle("/product/price-rules", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.GetPriceRules)))).Methods(http.MethodGet)
+	r.Handle("/product/price-rules", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.CreatePriceRule)))).Methods(http.MethodPost)
+	r.Handle("/product/price-rules/{id}", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.GetPriceRuleById)))).Methods(http.MethodGet)
+	r.Handle("/product/price-rules/{id}", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.UpdatePriceRule)))).Methods(http.MethodPut)
+	r.Handle("/product/price-rules/{id}", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.DeletePriceRule)))).Methods(http.MethodDelete)
 	r.Handle("/product/{id}", http.HandlerFunc(productService.GetProductById)).Methods(http.MethodGet)
+	r.Handle("/product/{id}/price-history", http.HandlerFunc(productService.GetPriceHistory)).Methods(http.MethodGet)
 	r.Handle("/product/{id}/cart", http.HandlerFunc(productService.GetProductByIdForCart)).Methods(http.MethodGet)
 	r.Handle("/products/filter", http.HandlerFunc(productService.FilterProducts)).Methods(http.MethodGet)
-	r.Handle("/product/add", middlewares.AuthMiddleware(http.HandlerFunc(productService.AddProduct))).Methods(http.MethodPost)
-	r.Handle("/product/update/{id}", middlewares.AuthMiddleware(http.HandlerFunc(productService.UpdateProduct))).Methods(http.MethodPut)
-	r.Handle("/product/delete/{id}", middlewares.AuthMiddleware(http.HandlerFunc(productService.DeleteProduct))).Methods(http.MethodDelete)
+	r.Handle("/products/search", http.HandlerFunc(productService.SearchProducts)).Methods(http.MethodGet)
+	r.Handle("/product/add", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "seller", "admin")(http.HandlerFunc(productService.AddProduct)))).Methods(http.MethodPost)
+	r.Handle("/product/update/{id}", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.UpdateProduct)))).Methods(http.MethodPut)
+	r.Handle("/product/delete/{id}", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.DeleteProduct)))).Methods(http.MethodDelete)
+	//category tree, products are assigned to a category by id
 	r.HandleFunc("/products/categories", productService.FetchCategories).Methods(http.MethodGet)
-	//retrieve categories
-	//add category api(admin only)
-	//filter out category
-	//media upload api
-	r.Handle("/product/{id}/image-upload", http.HandlerFunc(productService.UploadProductImageHandler)).Methods(http.MethodPost)
-	r.Handle("/product/{id}/update-quantity", middlewares.AuthMiddleware(http.HandlerFunc(productService.UpdateProductQuantityHandler))).Methods(http.MethodPost)
+	r.Handle("/product/categories", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.CreateCategory)))).Methods(http.MethodPost)
+	r.Handle("/product/categories/{id}", http.HandlerFunc(productService.GetCategoryById)).Methods(http.MethodGet)
+	r.Handle("/product/categories/{id}", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.UpdateCategory)))).Methods(http.MethodPut)
+	r.Handle("/product/categories/{id}", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.DeleteCategory)))).Methods(http.MethodDelete)
+	r.Handle("/product/{id}/category", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.AssignProductCategory)))).Methods(http.MethodPut)
+	//product images, the files are served by the media storage
+	r.Handle("/product/{id}/images", http.HandlerFunc(productService.GetProductImages)).Methods(http.MethodGet)
+	r.Handle("/product/{id}/images", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.UploadProductImageHandler)))).Methods(http.MethodPost)
+	r.Handle("/product/{id}/image-upload", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.UploadProductImageHandler)))).Methods(http.MethodPost)
+	r.Handle("/product/{id}/images/order", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.ReorderProductImages)))).Methods(http.MethodPut)
+	r.Handle("/product/{id}/images/{imageId}", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.DeleteProductImage)))).Methods(http.MethodDelete)
+	r.Handle("/product/{id}/inventory", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.GetProductInventory)))).Methods(http.MethodGet)
+	r.Handle("/product/{id}/inventory/movements", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.GetStockMovements)))).Methods(http.MethodGet)
+	r.Handle("/product/{id}/inventory/movements", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.RecordStockMovement)))).Methods(http.MethodPost)
+	r.Handle("/product/{id}/inventory/transfers", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.TransferStock)))).Methods(http.MethodPost)
+	r.Handle("/product/{id}/update-quantity", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.UpdateProductQuantityHandler)))).Methods(http.MethodPost)
+	r.Handle("/product/{id}/seller", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.AssignProductSeller)))).Methods(http.MethodPut)
+
+	//stock reservations, carts hold stock here instead of moving Product.Quantity. Only the cart and order
+	//services hold, release and commit stock, the references are easy to guess
+	r.Handle("/product/{id}/reserve", middlewares.ServiceMiddleware(http.HandlerFunc(productService.ReserveStock))).Methods(http.MethodPost)
+	r.Handle("/product/reservations/release", middlewares.ServiceMiddleware(http.HandlerFunc(productService.ReleaseReservations))).Methods(http.MethodPost)
+	r.Handle("/product/reservations/extend", middlewares.ServiceMiddleware(http.HandlerFunc(productService.ExtendReservations))).Methods(http.MethodPost)
+	r.Handle("/product/reservations/commit", middlewares.ServiceMiddleware(http.HandlerFunc(productService.CommitReservations))).Methods(http.MethodPost)
+	r.Handle("/product/reservations/cancel", middlewares.ServiceMiddleware(http.HandlerFunc(productService.CancelReservations))).Methods(http.MethodPost)
+
+	//bundles, several products sold as one cart line at the bundle price
+	r.Handle("/product/bundles", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.CreateBundle)))).Methods(http.MethodPost)
+	r.Handle("/product/bundle/{id}", http.HandlerFunc(productService.GetBundleById)).Methods(http.MethodGet)
+	r.Handle("/product/bundle/{id}", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.DeleteBundle)))).Methods(http.MethodDelete)
+	r.Handle("/product/bundle/{id}/reserve", middlewares.ServiceMiddleware(http.HandlerFunc(productService.ReserveBundle))).Methods(http.MethodPost)
+
+	//options and variants, each variant has its own sku, price, stock and images
+	r.Handle("/product/{id}/options", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.SetProductOptions)))).Methods(http.MethodPut)
+	r.Handle("/product/{id}/variants", http.HandlerFunc(productService.GetProductVariants)).Methods(http.MethodGet)
+	r.Handle("/product/{id}/variants", middlewares.AuthMiddleware(productService.RequireProductOwner(http.HandlerFunc(productService.CreateVariant)))).Methods(http.MethodPost)
+	r.Handle("/product/variant/{id}", http.HandlerFunc(productService.GetVariantById)).Methods(http.MethodGet)
+	r.Handle("/product/variant/{id}", middlewares.AuthMiddleware(productService.RequireVariantOwner(http.HandlerFunc(productService.UpdateVariant)))).Methods(http.MethodPut)
+	r.Handle("/product/variant/{id}", middlewares.AuthMiddleware(productService.RequireVariantOwner(http.HandlerFunc(productService.DeleteVariant)))).Methods(http.MethodDelete)
+	//back in stock notifications, customers are emailed once when the product or variant is restocked
+	r.Handle("/product/{id}/back-in-stock", middlewares.GuestOrAuthMiddleware(http.HandlerFunc(productService.SubscribeBackInStock))).Methods(http.MethodPost)
+	r.Handle("/product/{id}/back-in-stock", middlewares.GuestOrAuthMiddleware(http.HandlerFunc(productService.UnsubscribeBackInStock))).Methods(http.MethodDelete)
+	r.Handle("/product/back-in-stock/confirm", http.HandlerFunc(productService.ConfirmBackInStock)).Methods(http.MethodPost)
+	r.Handle("/product/variant/{id}/reserve", middlewares.ServiceMiddleware(http.HandlerFunc(productService.ReserveVariant))).Methods(http.MethodPost)
+
+	//reviews are published once approved, the product rating is kept from the approved ones
+	r.Handle("/products/{id}/reviews", http.HandlerFunc(productService.GetProductReviews)).Methods(http.MethodGet)
+	r.Handle("/product/{id}/reviews", middlewares.AuthMiddleware(http.HandlerFunc(productService.CreateReview))).Methods(http.MethodPost)
+	r.Handle("/product/reviews/moderation", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.GetModerationQueue)))).Methods(http.MethodGet)
+	r.Handle("/product/reviews/{id}/moderation", middlewares.AuthMiddleware(middlewares.RoleMiddleware(dbs.DB, "admin")(http.HandlerFunc(productService.ModerateReview)))).Methods(http.MethodPut)
+	r.Handle("/product/reviews/{id}", http.HandlerFunc(productService.GetReviewById)).Methods(http.MethodGet)
+	r.Handle("/product/reviews/{id}", middlewares.AuthMiddleware(http.HandlerFunc(productService.UpdateReview))).Methods(http.MethodPut)
+	r.Handle("/product/reviews/{id}", middlewares.AuthMiddleware(http.HandlerFunc(productService.DeleteReview))).Methods(http.MethodDelete)
+	r.Handle("/product/reviews/{id}/vote", middlewares.AuthMiddleware(http.HandlerFunc(productService.VoteReview))).Methods(http.MethodPost)
+	r.Handle("/product/reviews/{id}/photos", middlewares.AuthMiddleware(http.HandlerFunc(productService.UploadReviewPhotos))).Methods(http.MethodPost)
 
 	//more filters
 	r.Handle("/products/deals", http.HandlerFunc(productService.GetDeals)).Methods(http.MethodGet)
@@ -34,5 +111,4 @@ func ProductHandler(r *mux.Router) {
 	r.Handle("/products/featured", http.HandlerFunc(productService.GetFeatured)).Methods(http.MethodGet)
 	//r.Handle("/products/bestsellers", http.HandlerFunc(productService.GetBestSellers)).Methods(http.MethodGet)
 	//r.Handle("/products/new-arrivals", http.HandlerFunc(productService.GetNewArrivals)).Methods(http.MethodGet)
-	//r.Handle("/products/{id}/reviews", http.HandlerFunc(productService.GetProductReviews)).Methods(http.MethodGet)
 }
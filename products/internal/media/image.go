@@ -0,0 +1,163 @@
+package media
+
+import (
+	"bytes"
+	"e-commerce-backend/shared/utils"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// ErrInvalidImage wraps every error caused by the uploaded file rather than by the server
+var ErrInvalidImage = errors.New("invalid image")
+
+// allowedTypes extension of the image types which can be uploaded, keyed by the sniffed content type
+var allowedTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// ThumbnailSize name of a thumbnail and the longest side it is scaled down to
+type ThumbnailSize struct {
+	Name string
+	Side int
+}
+
+// DefaultThumbnailSizes generated for every uploaded image
+var DefaultThumbnailSizes = []ThumbnailSize{
+	{"small", 150},
+	{"medium", 400},
+	{"large", 800},
+}
+
+// Limits an image has to keep to, sizes are in bytes and dimensions in pixels
+type Limits struct {
+	MaxBytes     int64
+	MinDimension int
+	MaxDimension int
+}
+
+// File encoded image ready to be stored
+type File struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+// ProcessedImage the uploaded image as it was sent and its thumbnails keyed by size name
+type ProcessedImage struct {
+	Original   File
+	Thumbnails map[string]File
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidImage, fmt.Sprintf(format, args...))
+}
+
+// Process checks the uploaded bytes against the limits and generates the thumbnails. The type is sniffed from
+// the content, never taken from the file name or the client, and the dimensions are read before the image is
+// decoded so a small file can't make the server decode a huge picture
+func Process(data []byte, limits Limits, sizes []ThumbnailSize) (*ProcessedImage, error) {
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, invalid(utils.ImageTooLarge, limits.MaxBytes)
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedTypes[contentType]
+	if !ok {
+		return nil, invalid(utils.ImageTypeNotAllowed, contentType)
+	}
+
+	config, err := decodeConfig(data, contentType)
+	if err != nil {
+		return nil, invalid(utils.ImageDecodeError)
+	}
+	if config.Width < limits.MinDimension || config.Height < limits.MinDimension ||
+		config.Width > limits.MaxDimension || config.Height > limits.MaxDimension {
+		return nil, invalid(utils.ImageDimensionsInvalid, config.Width, config.Height, limits.MinDimension, limits.MaxDimension)
+	}
+	img, err := decode(data, contentType)
+	if err != nil {
+		return nil, invalid(utils.ImageDecodeError)
+	}
+
+	processed := &ProcessedImage{
+		Original:   File{Data: data, ContentType: contentType, Ext: ext, Width: config.Width, Height: config.Height},
+		Thumbnails: make(map[string]File, len(sizes)),
+	}
+	for _, size := range sizes {
+		thumbnail, err := resize(img, contentType, size.Side)
+		if err != nil {
+			return nil, err
+		}
+		processed.Thumbnails[size.Name] = thumbnail
+	}
+	return processed, nil
+}
+
+func decodeConfig(data []byte, contentType string) (image.Config, error) {
+	reader := bytes.NewReader(data)
+	switch contentType {
+	case "image/jpeg":
+		return jpeg.DecodeConfig(reader)
+	case "image/png":
+		return png.DecodeConfig(reader)
+	case "image/gif":
+		return gif.DecodeConfig(reader)
+	}
+	return webp.DecodeConfig(reader)
+}
+
+// decode reads the image, only the first frame of an animated gif is kept
+func decode(data []byte, contentType string) (image.Image, error) {
+	reader := bytes.NewReader(data)
+	switch contentType {
+	case "image/jpeg":
+		return jpeg.Decode(reader)
+	case "image/png":
+		return png.Decode(reader)
+	case "image/gif":
+		return gif.Decode(reader)
+	}
+	return webp.Decode(reader)
+}
+
+// resize scales the image down so its longest side is at most side, smaller images are never scaled up. Jpeg
+// thumbnails stay jpeg, the other types become png so transparency is kept
+func resize(img image.Image, contentType string, side int) (File, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if longest := max(width, height); longest > side {
+		width = max(1, width*side/longest)
+		height = max(1, height*side/longest)
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	thumbnail := File{Width: width, Height: height}
+	if contentType == "image/jpeg" {
+		if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85}); err != nil {
+			return thumbnail, err
+		}
+		thumbnail.ContentType, thumbnail.Ext = "image/jpeg", "jpg"
+	} else {
+		if err := png.Encode(&buf, scaled); err != nil {
+			return thumbnail, err
+		}
+		thumbnail.ContentType, thumbnail.Ext = "image/png", "png"
+	}
+	thumbnail.Data = buf.Bytes()
+	return thumbnail, nil
+}
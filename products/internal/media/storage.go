@@ -0,0 +1,80 @@
+package media
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage where the image files are kept, keys are slash separated paths like "products/12/3f2c.jpg"
+type Storage interface {
+	Put(key string, data []byte) error
+	Delete(key string) error
+	URL(key string) string
+}
+
+// LocalStorage keeps the files below Root on the local file system, they are served under BaseURL
+type LocalStorage struct {
+	Root    string
+	BaseURL string
+}
+
+func NewLocalStorage(root, baseURL string) *LocalStorage {
+	return &LocalStorage{Root: root, BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (s *LocalStorage) path(key string) string {
+	return filepath.Join(s.Root, filepath.FromSlash(filepath.Clean("/"+key)))
+}
+
+// Put writes the file next to its final place first so a file is never seen half written
+func (s *LocalStorage) Put(key string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Delete removes the file, a file already gone is not an error
+func (s *LocalStorage) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.BaseURL + "/" + key
+}
+
+// Handler serves the stored files, directories are not listed
+func (s *LocalStorage) Handler() http.Handler {
+	files := http.StripPrefix(s.BaseURL+"/", http.FileServer(http.Dir(s.Root)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
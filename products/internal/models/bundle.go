@@ -0,0 +1,121 @@
+package models
+
+import (
+	"e-commerce-backend/products/dbs"
+	"e-commerce-backend/shared/utils"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductBundle several products sold together as one cart line at the bundle price
+type ProductBundle struct {
+	ID          int                 `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name        string              `json:"name" gorm:"type:varchar(150);not null"`
+	Description string              `json:"description"`
+	Price       float64             `json:"price" gorm:"not null"`
+	IsActive    bool                `json:"is_active" gorm:"default:true"`
+	Items       []ProductBundleItem `json:"items" gorm:"foreignKey:BundleID"`
+	CreatedAt   time.Time           `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time           `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// ProductBundleItem quantity of a product in one bundle
+type ProductBundleItem struct {
+	ID        int `json:"id" gorm:"primaryKey;autoIncrement"`
+	BundleID  int `json:"bundle_id" gorm:"not null;index"`
+	ProductID int `json:"product_id" gorm:"not null"`
+	Quantity  int `json:"quantity" gorm:"default:1"`
+}
+
+type ProductBundleInterface interface {
+	CreateBundle(db *gorm.DB) error
+	GetBundleById(db *gorm.DB, id int) error
+	Deactivate(db *gorm.DB) error
+	GetStock(db *gorm.DB) (int, int, error)
+	Reserve(db *gorm.DB, reference string, quantity int, ttl time.Duration) error
+}
+
+func InitBundleSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&ProductBundle{}, &ProductBundleItem{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "ProductBundle/ProductBundleItem", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "ProductBundle/ProductBundleItem")
+	}
+}
+
+// CreateBundle stores the bundle together with its items
+func (b *ProductBundle) CreateBundle(db *gorm.DB) error {
+	b.IsActive = true
+	return db.Create(&b).Error
+}
+
+func (b *ProductBundle) GetBundleById(db *gorm.DB, id int) error {
+	return db.Preload("Items").Where("id = ?", id).First(&b).Error
+}
+
+// Deactivate stops selling the bundle, carts still holding it are told on validation
+func (b *ProductBundle) Deactivate(db *gorm.DB) error {
+	b.IsActive = false
+	return db.Model(&ProductBundle{}).Where("id = ?", b.ID).Update("is_active", false).Error
+}
+
+func (b *ProductBundle) productIds() []int {
+	ids := make([]int, 0, len(b.Items))
+	for _, item := range b.Items {
+		ids = append(ids, item.ProductID)
+	}
+	return ids
+}
+
+// GetStock returns how many bundles the on hand and the available stock of its products make up, a deleted
+// product leaves the bundle without stock
+func (b *ProductBundle) GetStock(db *gorm.DB) (int, int, error) {
+	if len(b.Items) == 0 {
+		return 0, 0, nil
+	}
+	products, err := GetProductsByIds(db, b.productIds())
+	if err != nil {
+		return 0, 0, err
+	}
+	reserved, err := GetReservedQuantities(db, b.productIds())
+	if err != nil {
+		return 0, 0, err
+	}
+	byId := make(map[int]Product, len(products))
+	for _, product := range products {
+		byId[product.ID] = product
+	}
+
+	onHand, available := -1, -1
+	for _, item := range b.Items {
+		product, ok := byId[item.ProductID]
+		if !ok || item.Quantity <= 0 {
+			return 0, 0, nil
+		}
+		itemOnHand := product.Quantity / item.Quantity
+		itemAvailable := max(product.Quantity-reserved[item.ProductID], 0) / item.Quantity
+		if onHand < 0 || itemOnHand < onHand {
+			onHand = itemOnHand
+		}
+		if available < 0 || itemAvailable < available {
+			available = itemAvailable
+		}
+	}
+	return onHand, available, nil
+}
+
+// Reserve holds the products of quantity bundles under the reference, either every product is held or none
+func (b *ProductBundle) Reserve(db *gorm.DB, reference string, quantity int, ttl time.Duration) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, item := range b.Items {
+			var reservation StockReservation
+			if err := reservation.Reserve(tx, item.ProductID, reference, item.Quantity*quantity, ttl); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"e-commerce-backend/products/dbs"
+	"e-commerce-backend/shared/utils"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ImportStatusPending   = "pending"
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+)
+
+// ImportJob catalog import running in the background, a dry run checks every row and counts what would be
+// created or updated without writing anything
+type ImportJob struct {
+	ID            int              `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID        int              `json:"user_id" gorm:"not null;index"` // who started the import
+	SellerID      int              `json:"seller_id" gorm:"not null"`     // seller of the rows without a seller_id
+	FileName      string           `json:"file_name" gorm:"type:varchar(255)"`
+	Format        string           `json:"format" gorm:"type:varchar(10);not null"`
+	DryRun        bool             `json:"dry_run" gorm:"default:false"`
+	Status        string           `json:"status" gorm:"type:varchar(20);not null;index"`
+	TotalRows     int              `json:"total_rows"`
+	ProcessedRows int              `json:"processed_rows"`
+	Created       int              `json:"created"`
+	Updated       int              `json:"updated"`
+	Unchanged     int              `json:"unchanged"`
+	Failed        int              `json:"failed"`
+	Error         string           `json:"error,omitempty" gorm:"type:varchar(255)"` // why a failed job stopped
+	Errors        []ImportRowError `json:"errors" gorm:"foreignKey:JobID"`
+	CreatedAt     time.Time        `json:"created_at" gorm:"autoCreateTime"`
+	StartedAt     *time.Time       `json:"started_at,omitempty"`
+	FinishedAt    *time.Time       `json:"finished_at,omitempty"`
+}
+
+// ImportRowError why a row of an import was skipped, Field is empty when the row as a whole was
+type ImportRowError struct {
+	ID      int    `json:"-" gorm:"primaryKey;autoIncrement"`
+	JobID   int    `json:"-" gorm:"not null;index"`
+	Row     int    `json:"row"`
+	SKU     string `json:"sku,omitempty" gorm:"type:varchar(64)"`
+	Field   string `json:"field,omitempty" gorm:"type:varchar(50)"`
+	Message string `json:"message" gorm:"type:varchar(255)"`
+}
+
+type ImportJobInterface interface {
+	CreateImportJob(db *gorm.DB) error
+	GetImportJobById(db *gorm.DB, id int) error
+	Start(db *gorm.DB) error
+	SaveProgress(db *gorm.DB, rowErrors []ImportRowError) error
+	Finish(db *gorm.DB, status, reason string) error
+}
+
+func InitImportSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&ImportJob{}, &ImportRowError{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "ImportJob/ImportRowError", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "ImportJob/ImportRowError")
+	}
+}
+
+func (j *ImportJob) CreateImportJob(db *gorm.DB) error {
+	j.Status = ImportStatusPending
+	return db.Omit("Errors").Create(&j).Error
+}
+
+func (j *ImportJob) GetImportJobById(db *gorm.DB, id int) error {
+	return db.Preload("Errors", func(db *gorm.DB) *gorm.DB {
+		return db.Order("`row`, id")
+	}).Where("id = ?", id).First(&j).Error
+}
+
+func (j *ImportJob) Start(db *gorm.DB) error {
+	now := time.Now()
+	j.Status, j.StartedAt = ImportStatusRunning, &now
+	return db.Model(&ImportJob{}).Where("id = ?", j.ID).Updates(map[string]interface{}{"status": j.Status, "started_at": j.StartedAt}).Error
+}
+
+// SaveProgress stores the counts of the job and the row errors found since the last save
+func (j *ImportJob) SaveProgress(db *gorm.DB, rowErrors []ImportRowError) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(rowErrors) > 0 {
+			for i := range rowErrors {
+				rowErrors[i].JobID = j.ID
+			}
+			if err := tx.Create(&rowErrors).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&ImportJob{}).Where("id = ?", j.ID).UpdateColumns(map[string]interface{}{
+			"processed_rows": j.ProcessedRows,
+			"created":        j.Created,
+			"updated":        j.Updated,
+			"unchanged":      j.Unchanged,
+			"failed":         j.Failed,
+		}).Error
+	})
+}
+
+// Finish marks the job completed or failed, reason says why a failed job stopped
+func (j *ImportJob) Finish(db *gorm.DB, status, reason string) error {
+	now := time.Now()
+	j.Status, j.Error, j.FinishedAt = status, reason, &now
+	return db.Model(&ImportJob{}).Where("id = ?", j.ID).
+		Updates(map[string]interface{}{"status": status, "error": reason, "finished_at": j.FinishedAt}).Error
+}
+
+// EachProductBatch hands the not deleted products to fn a batch at a time in id order, sellerId 0 goes through
+// the products of every seller
+func EachProductBatch(db *gorm.DB, sellerId, batchSize int, fn func([]Product) error) error {
+	query := db.Model(&Product{}).Where("is_deleted = ?", false)
+	if sellerId > 0 {
+		query = query.Where("seller_id = ?", sellerId)
+	}
+	var batch []Product
+	return query.FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
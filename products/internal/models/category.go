@@ -0,0 +1,243 @@
+package models
+
+import (
+	"e-commerce-backend/products/dbs"
+	"e-commerce-backend/shared/utils"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Category node of the category tree, ParentID 0 is a top level category
+type Category struct {
+	ID          int         `json:"id" gorm:"primaryKey;autoIncrement"`
+	ParentID    int         `json:"parent_id" gorm:"default:0;index"`
+	Name        string      `json:"name" gorm:"type:varchar(100);not null"`
+	Slug        string      `json:"slug" gorm:"type:varchar(120);not null;uniqueIndex"`
+	Description string      `json:"description" gorm:"type:text;default:null"`
+	ImageURL    string      `json:"image_url" gorm:"type:varchar(255);default:null"`
+	SortOrder   int         `json:"sort_order" gorm:"default:0"`
+	Children    []*Category `json:"children,omitempty" gorm:"-"`
+	CreatedAt   time.Time   `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time   `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// CategoryCrumb one step of the path from the top level category down to the category of a product
+type CategoryCrumb struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type CategoryInterface interface {
+	CreateCategory(db *gorm.DB) error
+	GetCategoryById(db *gorm.DB, id int) error
+	UpdateCategory(db *gorm.DB, updatedFields map[string]interface{}) error
+	DeleteCategory(db *gorm.DB) error
+}
+
+func InitCategorySchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&Category{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "Category", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "Category")
+	}
+	if err := backfillProductCategories(db); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "Product categories", err)
+	}
+}
+
+// backfillProductCategories turns the free text categories of products without a category id into top level
+// categories, products already assigned are left alone so it only does work once
+func backfillProductCategories(db *gorm.DB) error {
+	var names []string
+	if err := db.Model(&Product{}).Distinct("category").Where("category_id = 0 and category <> ''").Pluck("category", &names).Error; err != nil {
+		return err
+	}
+	for _, name := range names {
+		category := Category{Name: name, Slug: Slugify(name)}
+		if err := db.Where("slug = ?", category.Slug).FirstOrCreate(&category).Error; err != nil {
+			return err
+		}
+		if err := db.Model(&Product{}).Where("category_id = 0 and category = ?", name).Update("category_id", category.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slugify lowercases name and joins its words with dashes, "Home & Garden" becomes "home-garden"
+func Slugify(name string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+func (c *Category) CreateCategory(db *gorm.DB) error {
+	return db.Create(&c).Error
+}
+
+func (c *Category) GetCategoryById(db *gorm.DB, id int) error {
+	return db.Where("id = ?", id).First(&c).Error
+}
+
+func (c *Category) GetCategoryBySlug(db *gorm.DB, slug string) error {
+	return db.Where("slug = ?", slug).First(&c).Error
+}
+
+// UpdateCategory applies the changed fields, a new name is copied onto the products of the category so the
+// category text of the product views stays in step
+func (c *Category) UpdateCategory(db *gorm.DB, updatedFields map[string]interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Category{}).Where("id = ?", c.ID).Updates(updatedFields).Error; err != nil {
+			return err
+		}
+		if name, ok := updatedFields["name"].(string); ok {
+			if err := tx.Model(&Product{}).Where("category_id = ?", c.ID).Update("category", name).Error; err != nil {
+				return err
+			}
+		}
+		return c.GetCategoryById(tx, c.ID)
+	})
+}
+
+// DeleteCategory removes the category, callers check that it has no children and no products first
+func (c *Category) DeleteCategory(db *gorm.DB) error {
+	return db.Delete(&Category{}, c.ID).Error
+}
+
+// HasChildren tells whether other categories sit below the category
+func (c *Category) HasChildren(db *gorm.DB) (bool, error) {
+	var count int64
+	if err := db.Model(&Category{}).Where("parent_id = ?", c.ID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CountProducts counts the not deleted products assigned to the category itself
+func (c *Category) CountProducts(db *gorm.DB) (int64, error) {
+	var count int64
+	if err := db.Model(&Product{}).Where("category_id = ? and is_deleted = ?", c.ID, false).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetProductIds returns the ids of the not deleted products assigned to the category itself
+func (c *Category) GetProductIds(db *gorm.DB) ([]int, error) {
+	var ids []int
+	if err := db.Model(&Product{}).Where("category_id = ? and is_deleted = ?", c.ID, false).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// CategoryIndex every category keyed by id, loaded once to walk the tree without a query per step
+type CategoryIndex map[int]*Category
+
+func LoadCategoryIndex(db *gorm.DB) (CategoryIndex, error) {
+	var categories []*Category
+	if err := db.Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	index := make(CategoryIndex, len(categories))
+	for _, category := range categories {
+		index[category.ID] = category
+	}
+	return index, nil
+}
+
+// Tree nests the categories under their parents, siblings are ordered by sort order then name
+func (index CategoryIndex) Tree() []*Category {
+	var roots []*Category
+	for _, category := range index {
+		category.Children = nil
+	}
+	for _, category := range index {
+		if parent, ok := index[category.ParentID]; ok {
+			parent.Children = append(parent.Children, category)
+		} else {
+			roots = append(roots, category)
+		}
+	}
+	sortCategories(roots)
+	return roots
+}
+
+func sortCategories(categories []*Category) {
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].SortOrder != categories[j].SortOrder {
+			return categories[i].SortOrder < categories[j].SortOrder
+		}
+		return categories[i].Name < categories[j].Name
+	})
+	for _, category := range categories {
+		sortCategories(category.Children)
+	}
+}
+
+// Breadcrumbs is the path from the top level category down to id, empty when id is not a category
+func (index CategoryIndex) Breadcrumbs(id int) []CategoryCrumb {
+	crumbs := []CategoryCrumb{}
+	//the visited guard stops on a broken parent chain instead of looping
+	visited := map[int]bool{}
+	for category, ok := index[id]; ok && !visited[category.ID]; category, ok = index[category.ParentID] {
+		visited[category.ID] = true
+		crumbs = append([]CategoryCrumb{{ID: category.ID, Name: category.Name, Slug: category.Slug}}, crumbs...)
+	}
+	return crumbs
+}
+
+// Descendants returns id with the ids of every category below it
+func (index CategoryIndex) Descendants(id int) []int {
+	children := map[int][]int{}
+	for _, category := range index {
+		children[category.ParentID] = append(children[category.ParentID], category.ID)
+	}
+	ids := []int{id}
+	seen := map[int]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids
+}
+
+// IsDescendant tells whether candidate sits below id, used to keep a category from moving under itself
+func (index CategoryIndex) IsDescendant(id, candidate int) bool {
+	for _, descendant := range index.Descendants(id)[1:] {
+		if descendant == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// FindByNameOrSlug looks up a category by its slug or, ignoring case, its name
+func (index CategoryIndex) FindByNameOrSlug(value string) (*Category, bool) {
+	for _, category := range index {
+		if category.Slug == value || strings.EqualFold(category.Name, value) {
+			return category, true
+		}
+	}
+	return nil, false
+}
+
+// SlugExists tells whether another category already uses the slug
+func SlugExists(db *gorm.DB, slug string, excludeId int) (bool, error) {
+	var count int64
+	if err := db.Model(&Category{}).Where("slug = ? and id <> ?", slug, excludeId).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
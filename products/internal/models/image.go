@@ -0,0 +1,165 @@
+package models
+
+import (
+	"e-commerce-backend/products/dbs"
+	"e-commerce-backend/shared/utils"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductImage uploaded image of a product, the product shows its images by Position with the first one as the
+// main image. URLs are kept with the storage keys so responses don't need the storage
+type ProductImage struct {
+	ID          int                     `json:"id" gorm:"primaryKey;autoIncrement"`
+	ProductID   int                     `json:"product_id" gorm:"not null;index"`
+	Position    int                     `json:"position" gorm:"default:0"`
+	StorageKey  string                  `json:"-" gorm:"type:varchar(255);not null"`
+	URL         string                  `json:"url" gorm:"type:varchar(512);not null"`
+	ContentType string                  `json:"content_type" gorm:"type:varchar(50);not null"`
+	Width       int                     `json:"width"`
+	Height      int                     `json:"height"`
+	Size        int                     `json:"size"` // bytes of the original file
+	AltText     string                  `json:"alt_text" gorm:"type:varchar(255)"`
+	Thumbnails  []ProductImageThumbnail `json:"thumbnails" gorm:"foreignKey:ImageID"`
+	CreatedAt   time.Time               `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// ProductImageThumbnail scaled down copy of an image, one per thumbnail size
+type ProductImageThumbnail struct {
+	ID         int    `json:"-" gorm:"primaryKey;autoIncrement"`
+	ImageID    int    `json:"-" gorm:"not null;uniqueIndex:idx_image_thumbnail_size"`
+	Size       string `json:"size" gorm:"type:varchar(20);not null;uniqueIndex:idx_image_thumbnail_size"`
+	StorageKey string `json:"-" gorm:"type:varchar(255);not null"`
+	URL        string `json:"url" gorm:"type:varchar(512);not null"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+}
+
+type ProductImageInterface interface {
+	GetImageById(db *gorm.DB, productId, id int) error
+	DeleteImage(db *gorm.DB) error
+	StorageKeys() []string
+}
+
+func InitImageSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&ProductImage{}, &ProductImageThumbnail{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "ProductImage/ProductImageThumbnail", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "ProductImage/ProductImageThumbnail")
+	}
+}
+
+func orderThumbnails(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+func CountProductImages(db *gorm.DB, productId int) (int64, error) {
+	var count int64
+	err := db.Model(&ProductImage{}).Where("product_id = ?", productId).Count(&count).Error
+	return count, err
+}
+
+// AddProductImages appends the images after the ones the product already has
+func AddProductImages(db *gorm.DB, productId int, images []ProductImage) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var last struct{ Position *int }
+		if err := tx.Model(&ProductImage{}).Select("MAX(position) AS position").Where("product_id = ?", productId).Scan(&last).Error; err != nil {
+			return err
+		}
+		next := 0
+		if last.Position != nil {
+			next = *last.Position + 1
+		}
+		for i := range images {
+			images[i].ProductID = productId
+			images[i].Position = next + i
+		}
+		return tx.Create(&images).Error
+	})
+}
+
+func GetImagesByProductId(db *gorm.DB, productId int) ([]ProductImage, error) {
+	images := []ProductImage{}
+	if err := db.Preload("Thumbnails", orderThumbnails).Where("product_id = ?", productId).Order("position, id").Find(&images).Error; err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// GetImagesByProductIds returns the images of every product keyed by product id, in one query for all of them
+func GetImagesByProductIds(db *gorm.DB, productIds []int) (map[int][]ProductImage, error) {
+	byProduct := make(map[int][]ProductImage, len(productIds))
+	if len(productIds) == 0 {
+		return byProduct, nil
+	}
+	var images []ProductImage
+	if err := db.Preload("Thumbnails", orderThumbnails).Where("product_id IN ?", productIds).Order("position, id").Find(&images).Error; err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		byProduct[image.ProductID] = append(byProduct[image.ProductID], image)
+	}
+	return byProduct, nil
+}
+
+func (i *ProductImage) GetImageById(db *gorm.DB, productId, id int) error {
+	return db.Preload("Thumbnails", orderThumbnails).Where("id = ? and product_id = ?", id, productId).First(&i).Error
+}
+
+// DeleteImage removes the image and its thumbnails, the images after it move up so positions stay contiguous.
+// The files are left to the caller
+func (i *ProductImage) DeleteImage(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("image_id = ?", i.ID).Delete(&ProductImageThumbnail{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&ProductImage{}, i.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&ProductImage{}).Where("product_id = ? and position > ?", i.ProductID, i.Position).
+			UpdateColumn("position", gorm.Expr("position - 1")).Error
+	})
+}
+
+// StorageKeys keys of the image file and of its thumbnails
+func (i *ProductImage) StorageKeys() []string {
+	keys := []string{i.StorageKey}
+	for _, thumbnail := range i.Thumbnails {
+		keys = append(keys, thumbnail.StorageKey)
+	}
+	return keys
+}
+
+// ReorderProductImages gives the images the order of imageIds, which has to hold every image of the product once
+func ReorderProductImages(db *gorm.DB, productId int, imageIds []int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var current []int
+		if err := tx.Model(&ProductImage{}).Where("product_id = ?", productId).Pluck("id", &current).Error; err != nil {
+			return err
+		}
+		known := make(map[int]bool, len(current))
+		for _, id := range current {
+			known[id] = true
+		}
+		if len(imageIds) != len(current) {
+			return errors.New(utils.InvalidImageOrder)
+		}
+		for _, id := range imageIds {
+			if !known[id] {
+				return errors.New(utils.InvalidImageOrder)
+			}
+			delete(known, id)
+		}
+
+		for position, id := range imageIds {
+			if err := tx.Model(&ProductImage{}).Where("id = ?", id).UpdateColumn("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,569 @@
+package models
+
+import (
+	"e-commerce-backend/products/dbs"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MovementReceipt    = "receipt"
+	MovementSale       = "sale"
+	MovementReturn     = "return"
+	MovementAdjustment = "adjustment"
+	MovementTransfer   = "transfer"
+)
+
+// DefaultWarehouseCode warehouse holding the stock of products added without one, created on migration
+const DefaultWarehouseCode = "default"
+
+const (
+	AllocationPriority  = "priority"   // warehouses by Priority, the lowest first
+	AllocationMostStock = "most_stock" // the warehouse with the most available stock first, splits orders the least
+)
+
+// ErrInsufficientStock wraps every stock change refused because the stock isn't there
+var ErrInsufficientStock = errors.New(utils.InsufficientStock)
+
+func stockError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInsufficientStock, fmt.Sprintf(format, args...))
+}
+
+// allocationStrategy how reservations pick the warehouses they are served from, main sets it from the config
+var allocationStrategy = AllocationPriority
+
+// Warehouse location stock is kept in, inactive warehouses keep their stock but are not allocated from
+type Warehouse struct {
+	ID        int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Code      string    `json:"code" gorm:"type:varchar(32);not null;uniqueIndex"`
+	Name      string    `json:"name" gorm:"type:varchar(100);not null"`
+	Address   string    `json:"address" gorm:"type:varchar(255)"`
+	Priority  int       `json:"priority" gorm:"default:0"`
+	IsActive  bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// InventoryLevel stock of a product, or of one of its variants, on hand in a warehouse. Product.Quantity and
+// ProductVariant.Quantity are the sums of these and only change together with them through ApplyMovement
+type InventoryLevel struct {
+	ID          int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	WarehouseID int       `json:"warehouse_id" gorm:"not null;uniqueIndex:idx_inventory_location"`
+	ProductID   int       `json:"product_id" gorm:"not null;uniqueIndex:idx_inventory_location;index"`
+	VariantID   int       `json:"variant_id" gorm:"default:0;uniqueIndex:idx_inventory_location"`
+	OnHand      int       `json:"on_hand" gorm:"not null;default:0"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// StockMovement entry of the stock ledger, movements are only ever appended. Quantity is the signed change of the
+// stock on hand at the location and BalanceAfter what was left there after it
+type StockMovement struct {
+	ID           int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	WarehouseID  int       `json:"warehouse_id" gorm:"not null;index"`
+	ProductID    int       `json:"product_id" gorm:"not null;index:idx_movement_item"`
+	VariantID    int       `json:"variant_id" gorm:"default:0;index:idx_movement_item"`
+	Type         string    `json:"type" gorm:"type:varchar(20);not null;index"`
+	Quantity     int       `json:"quantity" gorm:"not null"`
+	BalanceAfter int       `json:"balance_after"`
+	Reason       string    `json:"reason" gorm:"type:varchar(255)"`
+	Reference    string    `json:"reference,omitempty" gorm:"type:varchar(64);index"` // e.g. "order-12" or the id of a transfer
+	ActorID      int       `json:"actor_id" gorm:"default:0"`                         // user who moved the stock, 0 for the system
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// ReservationAllocation part of a reservation held in one warehouse, a reservation larger than the stock of a
+// single warehouse is split over several. Allocations only count while their reservation is active
+type ReservationAllocation struct {
+	ID            int `json:"-" gorm:"primaryKey;autoIncrement"`
+	ReservationID int `json:"reservation_id" gorm:"not null;index"`
+	WarehouseID   int `json:"warehouse_id" gorm:"not null;index:idx_allocation_location"`
+	ProductID     int `json:"product_id" gorm:"not null;index:idx_allocation_location"`
+	VariantID     int `json:"variant_id" gorm:"default:0;index:idx_allocation_location"`
+	Quantity      int `json:"quantity" gorm:"not null"`
+}
+
+// MovementFilter which movements of a product are listed, zero fields don't filter
+type MovementFilter struct {
+	WarehouseID int
+	VariantID   int
+	Type        string
+	Limit       int
+	Offset      int
+}
+
+type WarehouseInterface interface {
+	CreateWarehouse(db *gorm.DB) error
+	GetWarehouseById(db *gorm.DB, id int) error
+	UpdateWarehouse(db *gorm.DB, updatedFields map[string]interface{}) error
+}
+
+func InitInventorySchema() {
+	db := dbs.DB
+	hadLevels := db.Migrator().HasTable(&InventoryLevel{})
+	if err := db.AutoMigrate(&Warehouse{}, &InventoryLevel{}, &StockMovement{}, &ReservationAllocation{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "Warehouse/InventoryLevel/StockMovement/ReservationAllocation", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "Warehouse/InventoryLevel/StockMovement/ReservationAllocation")
+	}
+
+	warehouse := Warehouse{Code: DefaultWarehouseCode, Name: "Default warehouse", IsActive: true}
+	if err := db.Where("code = ?", DefaultWarehouseCode).FirstOrCreate(&warehouse).Error; err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "Warehouse default", err)
+	}
+	//stock kept before warehouses existed moves into the default warehouse with an opening balance
+	if !hadLevels {
+		if err := backfillInventory(db, warehouse.ID); err != nil {
+			log.Fatalf(utils.DatabaseMigrationError, "InventoryLevel backfill", err)
+		}
+	}
+}
+
+func backfillInventory(db *gorm.DB, warehouseId int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("INSERT INTO inventory_levels (warehouse_id, product_id, variant_id, on_hand, updated_at) "+
+			"SELECT ?, id, 0, quantity, NOW() FROM products WHERE quantity > 0", warehouseId).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("INSERT INTO inventory_levels (warehouse_id, product_id, variant_id, on_hand, updated_at) "+
+			"SELECT ?, product_id, id, quantity, NOW() FROM product_variants WHERE quantity > 0", warehouseId).Error; err != nil {
+			return err
+		}
+		return tx.Exec("INSERT INTO stock_movements (warehouse_id, product_id, variant_id, type, quantity, balance_after, reason, reference, actor_id, created_at) "+
+			"SELECT warehouse_id, product_id, variant_id, ?, on_hand, on_hand, ?, '', 0, NOW() FROM inventory_levels", MovementAdjustment, "opening balance").Error
+	})
+}
+
+// SetAllocationStrategy picks how reservations choose their warehouses
+func SetAllocationStrategy(strategy string) error {
+	if strategy != AllocationPriority && strategy != AllocationMostStock {
+		return fmt.Errorf(utils.InvalidAllocationStrategy, strategy)
+	}
+	allocationStrategy = strategy
+	return nil
+}
+
+func IsMovementType(movementType string) bool {
+	switch movementType {
+	case MovementReceipt, MovementSale, MovementReturn, MovementAdjustment, MovementTransfer:
+		return true
+	}
+	return false
+}
+
+func OrderReference(orderId int) string {
+	return fmt.Sprintf("order-%d", orderId)
+}
+
+func (wh *Warehouse) CreateWarehouse(db *gorm.DB) error {
+	return db.Create(&wh).Error
+}
+
+func (wh *Warehouse) GetWarehouseById(db *gorm.DB, id int) error {
+	return db.Where("id = ?", id).First(&wh).Error
+}
+
+func (wh *Warehouse) UpdateWarehouse(db *gorm.DB, updatedFields map[string]interface{}) error {
+	if err := db.Model(&Warehouse{}).Where("id = ?", wh.ID).Updates(updatedFields).Error; err != nil {
+		return err
+	}
+	return wh.GetWarehouseById(db, wh.ID)
+}
+
+func GetWarehouses(db *gorm.DB) ([]Warehouse, error) {
+	warehouses := []Warehouse{}
+	if err := db.Order("priority, id").Find(&warehouses).Error; err != nil {
+		return nil, err
+	}
+	return warehouses, nil
+}
+
+// WarehouseCodeExists tells whether another warehouse than excludeId has the code
+func WarehouseCodeExists(db *gorm.DB, code string, excludeId int) (bool, error) {
+	var count int64
+	err := db.Model(&Warehouse{}).Where("code = ? and id <> ?", code, excludeId).Count(&count).Error
+	return count > 0, err
+}
+
+func defaultWarehouse(db *gorm.DB) (Warehouse, error) {
+	var warehouse Warehouse
+	err := db.Where("code = ?", DefaultWarehouseCode).First(&warehouse).Error
+	return warehouse, err
+}
+
+// lockItem locks the row of the product or variant so stock changes of one item, reservations included, run one
+// after the other
+func lockItem(tx *gorm.DB, productId, variantId int) error {
+	if variantId > 0 {
+		var variant ProductVariant
+		return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? and product_id = ?", variantId, productId).First(&variant).Error
+	}
+	var product Product
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", productId).First(&product).Error
+}
+
+// reservedByWarehouse sums the allocations of the active reservations of an item per warehouse, the allocations
+// of excludeReservation are left out
+func reservedByWarehouse(db *gorm.DB, productId, variantId, excludeReservation int) (map[int]int, error) {
+	var rows []struct {
+		WarehouseID int
+		Reserved    int
+	}
+	if err := db.Model(&ReservationAllocation{}).
+		Select("reservation_allocations.warehouse_id, COALESCE(SUM(reservation_allocations.quantity), 0) AS reserved").
+		Joins("JOIN stock_reservations ON stock_reservations.id = reservation_allocations.reservation_id").
+		Where("stock_reservations.status = ? and stock_reservations.expires_at > ?", ReservationStatusActive, time.Now()).
+		Where("reservation_allocations.product_id = ? and reservation_allocations.variant_id = ? and reservation_allocations.reservation_id <> ?", productId, variantId, excludeReservation).
+		Group("reservation_allocations.warehouse_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	reserved := make(map[int]int, len(rows))
+	for _, row := range rows {
+		reserved[row.WarehouseID] = row.Reserved
+	}
+	return reserved, nil
+}
+
+// locationStock stock of an item in one warehouse
+type locationStock struct {
+	WarehouseID int
+	Priority    int
+	IsActive    bool
+	OnHand      int
+	Reserved    int
+}
+
+func (ls locationStock) available() int {
+	return max(ls.OnHand-ls.Reserved, 0)
+}
+
+func itemStock(db *gorm.DB, productId, variantId, excludeReservation int) ([]locationStock, error) {
+	var stock []locationStock
+	if err := db.Model(&InventoryLevel{}).
+		Select("inventory_levels.warehouse_id, warehouses.priority, warehouses.is_active, inventory_levels.on_hand").
+		Joins("JOIN warehouses ON warehouses.id = inventory_levels.warehouse_id").
+		Where("inventory_levels.product_id = ? and inventory_levels.variant_id = ?", productId, variantId).
+		Order("warehouses.priority, inventory_levels.warehouse_id").Scan(&stock).Error; err != nil {
+		return nil, err
+	}
+	reserved, err := reservedByWarehouse(db, productId, variantId, excludeReservation)
+	if err != nil {
+		return nil, err
+	}
+	for i := range stock {
+		stock[i].Reserved = reserved[stock[i].WarehouseID]
+	}
+	return stock, nil
+}
+
+// allocateReservation spreads the reservation over the active warehouses following the allocation strategy,
+// replacing the allocations it had. The item has to be locked
+func allocateReservation(tx *gorm.DB, sr *StockReservation) error {
+	if err := tx.Where("reservation_id = ?", sr.ID).Delete(&ReservationAllocation{}).Error; err != nil {
+		return err
+	}
+	stock, err := itemStock(tx, sr.ProductID, sr.VariantID, sr.ID)
+	if err != nil {
+		return err
+	}
+	if allocationStrategy == AllocationMostStock {
+		sort.SliceStable(stock, func(i, j int) bool {
+			return stock[i].available() > stock[j].available()
+		})
+	}
+
+	remaining := sr.Quantity
+	var allocations []ReservationAllocation
+	for _, location := range stock {
+		if remaining == 0 {
+			break
+		}
+		take := min(location.available(), remaining)
+		if !location.IsActive || take == 0 {
+			continue
+		}
+		allocations = append(allocations, ReservationAllocation{
+			ReservationID: sr.ID,
+			WarehouseID:   location.WarehouseID,
+			ProductID:     sr.ProductID,
+			VariantID:     sr.VariantID,
+			Quantity:      take,
+		})
+		remaining -= take
+	}
+	if remaining > 0 {
+		return stockError(utils.StockAllocationFailed, sr.Quantity, ItemLabel(sr.ProductID, sr.VariantID))
+	}
+	if len(allocations) == 0 {
+		return nil
+	}
+	return tx.Create(&allocations).Error
+}
+
+// ItemLabel names a product or variant in messages
+func ItemLabel(productId, variantId int) string {
+	if variantId > 0 {
+		return fmt.Sprintf("variant with ID %d", variantId)
+	}
+	return fmt.Sprintf("product with ID %d", productId)
+}
+
+// commitAllocatedStock takes the stock of a committed reservation out of the warehouses it was allocated in,
+// reservations made before they were allocated are allocated first
+func commitAllocatedStock(tx *gorm.DB, reservation *StockReservation, orderId int) error {
+	var allocations []ReservationAllocation
+	if err := tx.Where("reservation_id = ?", reservation.ID).Find(&allocations).Error; err != nil {
+		return err
+	}
+	if len(allocations) == 0 {
+		if err := lockItem(tx, reservation.ProductID, reservation.VariantID); err != nil {
+			return err
+		}
+		if err := allocateReservation(tx, reservation); err != nil {
+			return err
+		}
+		if err := tx.Where("reservation_id = ?", reservation.ID).Find(&allocations).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, allocation := range allocations {
+		movement := StockMovement{
+			WarehouseID: allocation.WarehouseID,
+			ProductID:   allocation.ProductID,
+			VariantID:   allocation.VariantID,
+			Type:        MovementSale,
+			Quantity:    -allocation.Quantity,
+			Reason:      reservation.Reference,
+			Reference:   OrderReference(orderId),
+		}
+		if err := ApplyMovement(tx, &movement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyMovement appends the movement to the ledger and moves the stock of the location and of the item with it.
+// Decrements are conditional updates, so stock never goes below zero even without a lock, but callers checking
+// availability first have to hold the item lock
+func ApplyMovement(tx *gorm.DB, movement *StockMovement) error {
+	level := InventoryLevel{WarehouseID: movement.WarehouseID, ProductID: movement.ProductID, VariantID: movement.VariantID}
+	if err := tx.Where("warehouse_id = ? and product_id = ? and variant_id = ?", level.WarehouseID, level.ProductID, level.VariantID).
+		FirstOrCreate(&level).Error; err != nil {
+		return err
+	}
+
+	result := tx.Model(&InventoryLevel{}).Where("id = ? and on_hand + ? >= 0", level.ID, movement.Quantity).
+		UpdateColumn("on_hand", gorm.Expr("on_hand + ?", movement.Quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return stockError(utils.WarehouseStockInsufficient, ItemLabel(movement.ProductID, movement.VariantID), movement.WarehouseID)
+	}
+	if err := tx.Model(&InventoryLevel{}).Select("on_hand").Where("id = ?", level.ID).Scan(&movement.BalanceAfter).Error; err != nil {
+		return err
+	}
+
+	var item interface{} = &Product{}
+	itemId, outOfStock := movement.ProductID, stockError(utils.ProductOutOfStockError, movement.ProductID)
+	if movement.VariantID > 0 {
+		item, itemId, outOfStock = &ProductVariant{}, movement.VariantID, stockError(utils.VariantOutOfStockError, movement.VariantID)
+	}
+	result = tx.Model(item).Where("id = ? and quantity + ? >= 0", itemId, movement.Quantity).
+		UpdateColumn("quantity", gorm.Expr("quantity + ?", movement.Quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return outOfStock
+	}
+	var after int
+	if err := tx.Model(item).Select("quantity").Where("id = ?", itemId).Scan(&after).Error; err != nil {
+		return err
+	}
+	if err := recordStockChange(tx, item, itemId, movement.ProductID, movement.VariantID, after-movement.Quantity, after); err != nil {
+		return err
+	}
+	return tx.Create(movement).Error
+}
+
+// RecordMovement applies a movement made by a user, e.g. goods received or counted, a zero WarehouseID books it
+// in the default warehouse. Stock held by reservations can't be taken out of a location
+func RecordMovement(db *gorm.DB, movement *StockMovement) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if movement.WarehouseID == 0 {
+			warehouse, err := defaultWarehouse(tx)
+			if err != nil {
+				return err
+			}
+			movement.WarehouseID = warehouse.ID
+		}
+		if err := lockItem(tx, movement.ProductID, movement.VariantID); err != nil {
+			return err
+		}
+		if movement.Quantity < 0 {
+			if err := checkLocationAvailable(tx, movement.WarehouseID, movement.ProductID, movement.VariantID, -movement.Quantity); err != nil {
+				return err
+			}
+		}
+		return ApplyMovement(tx, movement)
+	})
+}
+
+func checkLocationAvailable(tx *gorm.DB, warehouseId, productId, variantId, quantity int) error {
+	stock, err := itemStock(tx, productId, variantId, 0)
+	if err != nil {
+		return err
+	}
+	for _, location := range stock {
+		if location.WarehouseID == warehouseId {
+			if location.available() >= quantity {
+				return nil
+			}
+			return stockError(utils.WarehouseStockUnavailable, ItemLabel(productId, variantId), location.available(), warehouseId)
+		}
+	}
+	return stockError(utils.WarehouseStockUnavailable, ItemLabel(productId, variantId), 0, warehouseId)
+}
+
+// TransferStock moves stock between two warehouses as a pair of transfer movements sharing the reference
+func TransferStock(db *gorm.DB, from, to StockMovement, quantity int) ([]StockMovement, error) {
+	from.Type, to.Type = MovementTransfer, MovementTransfer
+	from.Quantity, to.Quantity = -quantity, quantity
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockItem(tx, from.ProductID, from.VariantID); err != nil {
+			return err
+		}
+		if err := checkLocationAvailable(tx, from.WarehouseID, from.ProductID, from.VariantID, quantity); err != nil {
+			return err
+		}
+		if err := ApplyMovement(tx, &from); err != nil {
+			return err
+		}
+		return ApplyMovement(tx, &to)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []StockMovement{from, to}, nil
+}
+
+// SetStockQuantity brings the total stock of an item to quantity, for the APIs which set the quantity directly.
+// Stock is added to the default warehouse and taken from the warehouses with free stock, default warehouse first
+func SetStockQuantity(tx *gorm.DB, productId, variantId, quantity, actorId int, reason string) error {
+	if err := lockItem(tx, productId, variantId); err != nil {
+		return err
+	}
+	stock, err := itemStock(tx, productId, variantId, 0)
+	if err != nil {
+		return err
+	}
+	onHand := 0
+	for _, location := range stock {
+		onHand += location.OnHand
+	}
+	delta := quantity - onHand
+	if delta == 0 {
+		return nil
+	}
+
+	warehouse, err := defaultWarehouse(tx)
+	if err != nil {
+		return err
+	}
+	movement := func(warehouseId, change int) *StockMovement {
+		return &StockMovement{
+			WarehouseID: warehouseId,
+			ProductID:   productId,
+			VariantID:   variantId,
+			Type:        MovementAdjustment,
+			Quantity:    change,
+			Reason:      reason,
+			ActorID:     actorId,
+		}
+	}
+	if delta > 0 {
+		return ApplyMovement(tx, movement(warehouse.ID, delta))
+	}
+
+	sort.SliceStable(stock, func(i, j int) bool {
+		return stock[i].WarehouseID == warehouse.ID && stock[j].WarehouseID != warehouse.ID
+	})
+	remaining := -delta
+	for _, location := range stock {
+		take := min(location.available(), remaining)
+		if take == 0 {
+			continue
+		}
+		if err := ApplyMovement(tx, movement(location.WarehouseID, -take)); err != nil {
+			return err
+		}
+		if remaining -= take; remaining == 0 {
+			return nil
+		}
+	}
+	return stockError(utils.StockHeldByReservations, ItemLabel(productId, variantId), quantity)
+}
+
+// GetProductInventory lists the stock of the product and of its variants per warehouse
+func GetProductInventory(db *gorm.DB, productId int) ([]payloads.InventoryLevelResponse, error) {
+	var levels []payloads.InventoryLevelResponse
+	if err := db.Model(&InventoryLevel{}).
+		Select("inventory_levels.warehouse_id, warehouses.code AS warehouse_code, warehouses.name AS warehouse_name, inventory_levels.variant_id, inventory_levels.on_hand").
+		Joins("JOIN warehouses ON warehouses.id = inventory_levels.warehouse_id").
+		Where("inventory_levels.product_id = ?", productId).
+		Order("inventory_levels.variant_id, warehouses.priority, inventory_levels.warehouse_id").Scan(&levels).Error; err != nil {
+		return nil, err
+	}
+
+	reserved := map[int]map[int]int{}
+	for i := range levels {
+		level := &levels[i]
+		if _, ok := reserved[level.VariantID]; !ok {
+			byWarehouse, err := reservedByWarehouse(db, productId, level.VariantID, 0)
+			if err != nil {
+				return nil, err
+			}
+			reserved[level.VariantID] = byWarehouse
+		}
+		level.Reserved = reserved[level.VariantID][level.WarehouseID]
+		level.Available = max(level.OnHand-level.Reserved, 0)
+	}
+	if levels == nil {
+		levels = []payloads.InventoryLevelResponse{}
+	}
+	return levels, nil
+}
+
+// GetStockMovements pages through the ledger of a product, newest first
+func GetStockMovements(db *gorm.DB, productId int, filter MovementFilter) ([]StockMovement, int64, error) {
+	query := db.Model(&StockMovement{}).Where("product_id = ?", productId)
+	if filter.WarehouseID > 0 {
+		query = query.Where("warehouse_id = ?", filter.WarehouseID)
+	}
+	if filter.VariantID > 0 {
+		query = query.Where("variant_id = ?", filter.VariantID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	movements := []StockMovement{}
+	if err := query.Order("id DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&movements).Error; err != nil {
+		return nil, 0, err
+	}
+	return movements, total, nil
+}
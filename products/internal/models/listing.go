@@ -0,0 +1,232 @@
+package models
+
+import (
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// productSort column a sort key orders by and its direction when no order is asked for
+type productSort struct {
+	column string
+	desc   bool
+}
+
+var productSortKeys = map[string]productSort{
+	"price":      {"price", false},
+	"rating":     {"rating", true},
+	"newest":     {"created_at", true},
+	"discount":   {EffectiveDiscountColumn, true},
+	"popularity": {"sold_count", true},
+}
+
+const (
+	DefaultProductSort = "newest"
+	SortOrderAsc       = "asc"
+	SortOrderDesc      = "desc"
+)
+
+// ListOptions page of a product listing, Cursor is the NextCursor of the previous page
+type ListOptions struct {
+	Limit  int
+	Cursor string
+	Sort   string
+	Order  string
+}
+
+// ProductPage one page of a listing, Total counts every product of the listing
+type ProductPage struct {
+	Items      []payloads.ProductResponse
+	Total      int64
+	NextCursor string
+}
+
+// pageCursor where the previous page stopped, Sort keeps a cursor from being used with another order
+type pageCursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    int         `json:"id"`
+}
+
+func (o ListOptions) sort() (productSort, string, error) {
+	key := o.Sort
+	if key == "" {
+		key = DefaultProductSort
+	}
+	sort, ok := productSortKeys[key]
+	if !ok {
+		return sort, "", fmt.Errorf(utils.InvalidListSort, key)
+	}
+	switch o.Order {
+	case "":
+	case SortOrderAsc:
+		sort.desc = false
+	case SortOrderDesc:
+		sort.desc = true
+	default:
+		return sort, "", fmt.Errorf(utils.InvalidListOrder, o.Order)
+	}
+	order := SortOrderAsc
+	if sort.desc {
+		order = SortOrderDesc
+	}
+	return sort, key + ":" + order, nil
+}
+
+// Validate checks sort, order and cursor before any query runs
+func (o ListOptions) Validate() error {
+	_, sortId, err := o.sort()
+	if err != nil {
+		return err
+	}
+	if o.Cursor != "" {
+		if _, err := decodeCursor(o.Cursor, sortId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeCursor(encoded, sortId string) (pageCursor, error) {
+	var cursor pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, errors.New(utils.InvalidListCursor)
+	}
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.Sort != sortId {
+		return cursor, errors.New(utils.InvalidListCursor)
+	}
+	return cursor, nil
+}
+
+func encodeCursor(cursor pageCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// sortValue is the value of the sort column of the product as it is stored in a cursor
+func sortValue(product Product, column string) interface{} {
+	switch column {
+	case "price":
+		return product.Price
+	case "rating":
+		return product.Rating
+	case EffectiveDiscountColumn:
+		return product.EffectiveDiscount()
+	case "sold_count":
+		return product.SoldCount
+	}
+	return product.CreatedAt.Format(time.RFC3339Nano)
+}
+
+// cursorValue turns the value read back from a cursor into what the sort column is compared with
+func cursorValue(value interface{}, column string) (interface{}, error) {
+	if column != "created_at" {
+		number, ok := value.(float64)
+		if !ok {
+			return nil, errors.New(utils.InvalidListCursor)
+		}
+		return number, nil
+	}
+	text, _ := value.(string)
+	createdAt, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		return nil, errors.New(utils.InvalidListCursor)
+	}
+	return createdAt, nil
+}
+
+// ListProducts pages through the not deleted products matching scope with keyset pagination, products sharing a
+// sort value are ordered by id so no product is skipped or repeated between pages
+func ListProducts(db *gorm.DB, scope func(*gorm.DB) *gorm.DB, opts ListOptions) (ProductPage, error) {
+	var page ProductPage
+	sort, sortId, err := opts.sort()
+	if err != nil {
+		return page, err
+	}
+	query := func() *gorm.DB {
+		return scope(db.Model(&Product{}).Where("is_deleted = ?", false))
+	}
+
+	if err := query().Count(&page.Total).Error; err != nil {
+		return page, err
+	}
+
+	direction, compare := "ASC", ">"
+	if sort.desc {
+		direction, compare = "DESC", "<"
+	}
+	listing := query().Order(fmt.Sprintf("%s %s, id %s", sort.column, direction, direction)).Limit(opts.Limit + 1)
+	if opts.Cursor != "" {
+		cursor, err := decodeCursor(opts.Cursor, sortId)
+		if err != nil {
+			return page, err
+		}
+		value, err := cursorValue(cursor.Value, sort.column)
+		if err != nil {
+			return page, err
+		}
+		listing = listing.Where(fmt.Sprintf("(%s %s ?) OR (%s = ? AND id %s ?)", sort.column, compare, sort.column, compare), value, value, cursor.ID)
+	}
+
+	var products []Product
+	if err := listing.Find(&products).Error; err != nil {
+		return page, err
+	}
+	if len(products) > opts.Limit {
+		products = products[:opts.Limit]
+		last := products[len(products)-1]
+		page.NextCursor = encodeCursor(pageCursor{Sort: sortId, Value: sortValue(last, sort.column), ID: last.ID})
+	}
+
+	page.Items, err = ToProductResponses(db, products)
+	return page, err
+}
+
+// ToProductResponses maps products to their responses with tags, breadcrumbs and images, fetched once for all
+// of them
+func ToProductResponses(db *gorm.DB, products []Product) ([]payloads.ProductResponse, error) {
+	ids := make([]int, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+	tags, err := GetTagNamesByProductIds(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := LoadCategoryIndex(db)
+	if err != nil {
+		return nil, err
+	}
+	images, err := GetImagesByProductIds(db, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]payloads.ProductResponse, 0, len(products))
+	for i := range products {
+		var resp payloads.ProductResponse
+		if err := CopyStructIntoStruct(&products[i], &resp); err != nil {
+			return nil, err
+		}
+		resp.InStock = products[i].IsInStock()
+		products[i].SetPricing(&resp)
+		resp.Breadcrumbs = categories.Breadcrumbs(products[i].CategoryID)
+		resp.Tags = tags[products[i].ID]
+		if tags[products[i].ID] == nil {
+			resp.Tags = []string{}
+		}
+		resp.Images = images[products[i].ID]
+		if images[products[i].ID] == nil {
+			resp.Images = []ProductImage{}
+		}
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
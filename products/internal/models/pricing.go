@@ -0,0 +1,345 @@
+package models
+
+import (
+	"e-commerce-backend/products/dbs"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PriceRuleSale  = "sale"
+	PriceRuleFlash = "flash" // short sale listed with the deals
+)
+
+const (
+	DiscountPercentage = "percentage"
+	DiscountFixed      = "fixed" // amount off the product price, applied as the percent of the price it makes
+)
+
+const (
+	PriceScopeAll      = "all"
+	PriceScopeProduct  = "product"
+	PriceScopeCategory = "category" // the category and every category below it
+	PriceScopeTag      = "tag"
+)
+
+const (
+	PriceReasonOpening     = "opening price"
+	PriceReasonAdded       = "product added"
+	PriceReasonUpdated     = "price updated"
+	PriceReasonRuleStarted = "price rule started"
+	PriceReasonRuleEnded   = "price rule ended"
+)
+
+// EffectiveDiscountColumn discount a product is sold at, the larger of its own discount and the one of its price
+// rule while the sale runs. Listings sort on it, it has to match EffectiveDiscount so page cursors line up
+const EffectiveDiscountColumn = "(CASE WHEN sale_discount > discount AND (sale_ends_at IS NULL OR sale_ends_at > NOW()) THEN sale_discount ELSE discount END)"
+
+// PriceRule scheduled discount of the products in its scope between StartsAt and EndsAt. When several rules
+// cover a product the one with the highest Priority applies, the largest discount among equal priorities
+type PriceRule struct {
+	ID           int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name         string    `json:"name" gorm:"type:varchar(100);not null"`
+	Type         string    `json:"type" gorm:"type:varchar(10);not null;default:sale"`
+	DiscountType string    `json:"discount_type" gorm:"type:varchar(10);not null"`
+	Value        float64   `json:"value" gorm:"not null"` // percent or amount off, by DiscountType
+	Scope        string    `json:"scope" gorm:"type:varchar(10);not null"`
+	ScopeID      int       `json:"scope_id" gorm:"default:0"` // product, category or tag id, 0 for every product
+	Priority     int       `json:"priority" gorm:"default:0"`
+	StartsAt     time.Time `json:"starts_at" gorm:"not null;index:idx_price_rule_period"`
+	EndsAt       time.Time `json:"ends_at" gorm:"not null;index:idx_price_rule_period"`
+	IsActive     bool      `json:"is_active" gorm:"default:true"` // paused rules don't apply within their period either
+	CreatedBy    int       `json:"created_by" gorm:"default:0"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// PriceHistory price a product was sold at from CreatedAt on, a row is added on every change of the effective
+// price whatever caused it. Variants with a price of their own follow the discount of their product
+type PriceHistory struct {
+	ID             int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	ProductID      int       `json:"product_id" gorm:"not null;index:idx_price_history_product"`
+	Price          float64   `json:"price"`           // list price
+	Discount       float64   `json:"discount"`        // effective discount in percent
+	EffectivePrice float64   `json:"effective_price"` // price after the discount
+	PriceRuleID    int       `json:"price_rule_id" gorm:"default:0"`
+	Reason         string    `json:"reason" gorm:"type:varchar(50)"`
+	ActorID        int       `json:"actor_id" gorm:"default:0"` // user who changed the price, 0 for the scheduler
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime;index:idx_price_history_product"`
+}
+
+type PriceRuleInterface interface {
+	CreatePriceRule(db *gorm.DB) error
+	GetPriceRuleById(db *gorm.DB, id int) error
+	UpdatePriceRule(db *gorm.DB, updatedFields map[string]interface{}) error
+	DeletePriceRule(db *gorm.DB) error
+}
+
+func InitPriceSchema() {
+	db := dbs.DB
+	hadHistory := db.Migrator().HasTable(&PriceHistory{})
+	if err := db.AutoMigrate(&PriceRule{}, &PriceHistory{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "PriceRule/PriceHistory", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "PriceRule/PriceHistory")
+	}
+	//the history starts with the prices products have when it is added
+	if !hadHistory {
+		if err := db.Exec("INSERT INTO price_histories (product_id, price, discount, effective_price, price_rule_id, reason, actor_id, created_at) "+
+			"SELECT id, price, discount, ROUND(price * (100 - discount) / 100, 2), 0, ?, 0, NOW() FROM products", PriceReasonOpening).Error; err != nil {
+			log.Fatalf(utils.DatabaseMigrationError, "PriceHistory backfill", err)
+		}
+	}
+}
+
+// EffectiveDiscount discount in percent the product is sold at, a sale which has ended no longer counts even
+// before the scheduler clears it
+func (p *Product) EffectiveDiscount() float64 {
+	if p.SaleDiscount > p.Discount && (p.SaleEndsAt == nil || time.Now().Before(*p.SaleEndsAt)) {
+		return p.SaleDiscount
+	}
+	return p.Discount
+}
+
+// EffectivePrice price of the product after its effective discount
+func (p *Product) EffectivePrice() float64 {
+	return roundPrice(p.Price * (100 - p.EffectiveDiscount()) / 100)
+}
+
+// SetPricing fills the pricing of a response copied from the product, Discount is what the product is sold at
+func (p *Product) SetPricing(resp *payloads.ProductResponse) {
+	resp.Discount = p.EffectiveDiscount()
+	resp.ProductDiscount = p.Discount
+	resp.SaleEndsAt = nil
+	if resp.Discount > p.Discount {
+		resp.SaleEndsAt = p.SaleEndsAt
+	}
+}
+
+func roundPrice(price float64) float64 {
+	return float64(utils.ToCents(price)) / 100
+}
+
+func (pr *PriceRule) CreatePriceRule(db *gorm.DB) error {
+	return db.Create(&pr).Error
+}
+
+func (pr *PriceRule) GetPriceRuleById(db *gorm.DB, id int) error {
+	return db.Where("id = ?", id).First(&pr).Error
+}
+
+func (pr *PriceRule) UpdatePriceRule(db *gorm.DB, updatedFields map[string]interface{}) error {
+	if err := db.Model(&pr).Updates(updatedFields).Error; err != nil {
+		return err
+	}
+	return pr.GetPriceRuleById(db, pr.ID)
+}
+
+func (pr *PriceRule) DeletePriceRule(db *gorm.DB) error {
+	return db.Delete(&PriceRule{}, pr.ID).Error
+}
+
+// percentOff discount the rule gives on price in percent, fixed amounts are capped at the price
+func (pr *PriceRule) percentOff(price float64) float64 {
+	if pr.DiscountType == DiscountPercentage {
+		return pr.Value
+	}
+	if price <= 0 {
+		return 0
+	}
+	return min(roundPrice(pr.Value*100/price), 100)
+}
+
+// GetPriceRules lists the rules by status: "active" running now, "scheduled" still to start, "expired" ended,
+// any other status every rule
+func GetPriceRules(db *gorm.DB, status string, now time.Time) ([]PriceRule, error) {
+	query := db.Model(&PriceRule{})
+	switch status {
+	case "active":
+		query = query.Where("is_active = ? and starts_at <= ? and ends_at > ?", true, now, now)
+	case "scheduled":
+		query = query.Where("starts_at > ?", now)
+	case "expired":
+		query = query.Where("ends_at <= ?", now)
+	}
+	rules := []PriceRule{}
+	err := query.Order("starts_at DESC, id DESC").Find(&rules).Error
+	return rules, err
+}
+
+// ruleCoverage products each running rule applies to, the rules in the order they win
+type ruleCoverage struct {
+	rules    []PriceRule
+	products []map[int]bool // nil for rules covering every product
+}
+
+func loadRuleCoverage(db *gorm.DB, now time.Time) (ruleCoverage, error) {
+	var coverage ruleCoverage
+	if err := db.Where("is_active = ? and starts_at <= ? and ends_at > ?", true, now, now).
+		Order("priority DESC, id").Find(&coverage.rules).Error; err != nil {
+		return coverage, err
+	}
+
+	var categories CategoryIndex
+	for _, rule := range coverage.rules {
+		var ids []int
+		switch rule.Scope {
+		case PriceScopeAll:
+			coverage.products = append(coverage.products, nil)
+			continue
+		case PriceScopeProduct:
+			ids = []int{rule.ScopeID}
+		case PriceScopeCategory:
+			if categories == nil {
+				index, err := LoadCategoryIndex(db)
+				if err != nil {
+					return coverage, err
+				}
+				categories = index
+			}
+			if err := db.Model(&Product{}).Where("category_id IN ?", categories.Descendants(rule.ScopeID)).Pluck("id", &ids).Error; err != nil {
+				return coverage, err
+			}
+		case PriceScopeTag:
+			tagged, err := GetProductIdsByTagIds(db, []int{rule.ScopeID})
+			if err != nil {
+				return coverage, err
+			}
+			ids = tagged
+		}
+		covered := make(map[int]bool, len(ids))
+		for _, id := range ids {
+			covered[id] = true
+		}
+		coverage.products = append(coverage.products, covered)
+	}
+	return coverage, nil
+}
+
+// bestRule is the winning rule for the product and the discount it gives, nil when no rule covers it
+func (c ruleCoverage) bestRule(product *Product) (*PriceRule, float64) {
+	var best *PriceRule
+	bestDiscount := 0.0
+	for i := range c.rules {
+		rule := &c.rules[i]
+		if best != nil && rule.Priority < best.Priority {
+			break
+		}
+		if c.products[i] != nil && !c.products[i][product.ID] {
+			continue
+		}
+		if discount := rule.percentOff(product.Price); best == nil || discount > bestDiscount {
+			best, bestDiscount = rule, discount
+		}
+	}
+	return best, bestDiscount
+}
+
+// ApplyPriceRules brings the sale discount of the products in line with the rules running at now, for the
+// products of productIds or every product when it is nil. Every change of an effective price is recorded in the
+// price history. It reports how many products changed
+func ApplyPriceRules(db *gorm.DB, now time.Time, productIds []int, actorId int) (int, error) {
+	coverage, err := loadRuleCoverage(db, now)
+	if err != nil {
+		return 0, err
+	}
+
+	query := db.Where("is_deleted = ?", false)
+	if productIds != nil {
+		query = query.Where("id IN ?", productIds)
+	}
+	changed := 0
+	var products []Product
+	err = query.FindInBatches(&products, 500, func(_ *gorm.DB, _ int) error {
+		for i := range products {
+			product := &products[i]
+			rule, discount := coverage.bestRule(product)
+			ruleId, endsAt, reason := 0, (*time.Time)(nil), PriceReasonRuleEnded
+			if rule != nil {
+				ruleId, endsAt, reason = rule.ID, &rule.EndsAt, PriceReasonRuleStarted
+			}
+			if ruleId == product.PriceRuleID && discount == product.SaleDiscount && sameTime(endsAt, product.SaleEndsAt) {
+				continue
+			}
+			product.PriceRuleID, product.SaleDiscount, product.SaleEndsAt = ruleId, discount, endsAt
+			if err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(&Product{}).Where("id = ?", product.ID).UpdateColumns(map[string]interface{}{
+					"price_rule_id": ruleId,
+					"sale_discount": discount,
+					"sale_ends_at":  endsAt,
+				}).Error; err != nil {
+					return err
+				}
+				return recordPriceChange(tx, product, reason, actorId)
+			}); err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	}).Error
+	return changed, err
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// recordPriceChange adds the price of the product to its history when it differs from the last price recorded
+func recordPriceChange(tx *gorm.DB, product *Product, reason string, actorId int) error {
+	entry := PriceHistory{
+		ProductID:      product.ID,
+		Price:          product.Price,
+		Discount:       product.EffectiveDiscount(),
+		EffectivePrice: product.EffectivePrice(),
+		Reason:         reason,
+		ActorID:        actorId,
+	}
+	if entry.Discount > product.Discount {
+		entry.PriceRuleID = product.PriceRuleID
+	}
+
+	var last PriceHistory
+	err := tx.Where("product_id = ?", product.ID).Order("id DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return err
+	}
+	if last.ID > 0 && utils.ToCents(last.EffectivePrice) == utils.ToCents(entry.EffectivePrice) &&
+		utils.ToCents(last.Price) == utils.ToCents(entry.Price) {
+		return nil
+	}
+	return tx.Create(&entry).Error
+}
+
+// GetPriceHistory returns the prices of the product since the given time, newest first, with the price it had
+// when the period started
+func GetPriceHistory(db *gorm.DB, productId int, since time.Time) ([]PriceHistory, error) {
+	history := []PriceHistory{}
+	if err := db.Where("product_id = ? and created_at >= ?", productId, since).Order("id DESC").Find(&history).Error; err != nil {
+		return nil, err
+	}
+	var opening []PriceHistory
+	if err := db.Where("product_id = ? and created_at < ?", productId, since).Order("id DESC").Limit(1).Find(&opening).Error; err != nil {
+		return nil, err
+	}
+	return append(history, opening...), nil
+}
+
+// LowestPrice lowest effective price in the history, false for an empty history
+func LowestPrice(history []PriceHistory) (float64, bool) {
+	if len(history) == 0 {
+		return 0, false
+	}
+	lowest := history[0].EffectivePrice
+	for _, entry := range history[1:] {
+		lowest = min(lowest, entry.EffectivePrice)
+	}
+	return lowest, true
+}
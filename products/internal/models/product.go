@@ -6,7 +6,6 @@ import (
 	"e-commerce-backend/shared/utils"
 	"errors"
 	"fmt"
-	"github.com/google/uuid"
 	"log"
 	"reflect"
 	"strings"
@@ -17,7 +16,8 @@ import (
 
 type Product struct {
 	ID         int       `json:"id"`
-	SellerID   uuid.UUID `json:"seller_id" gorm:"not null"`
+	SellerID   int       `json:"seller_id" gorm:"not null;default:0;index"`            // user id of the seller, 0 until an admin assigns one
+	SKU        string    `json:"sku" gorm:"type:varchar(64);default:null;uniqueIndex"` // catalog imports upsert on it
 	PName      string    `json:"name" gorm:"unique;not null;column:name"`
 	PDesc      string    `json:"description" gorm:"column:description"`
 	Price      float64   `json:"price" gorm:"not null"`
@@ -25,78 +25,155 @@ type Product struct {
 	IsDeleted  bool      `json:"is_deleted" gorm:"default:false"`
 	InStock    bool      `json:"in_stock" gorm:"default:true"`
 	Discount   float64   `json:"discount" gorm:"default:0"`
-	Category   string    `json:"category" gorm:"not null"`
+	Category   string    `json:"category" gorm:"not null"` // name of the category, kept for the services reading it
+	CategoryID int       `json:"category_id" gorm:"default:0;index"`
 	IsFeatured bool      `json:"is_featured" gorm:"default:false"`
 	TaxRate    float64   `json:"tax_rate" gorm:"default:0"`
 	CreatedAt  time.Time `json:"created_at" gorm:"type:datetime;default:CURRENT_TIMESTAMP"`
 	UpdatedAt  time.Time `json:"updated_at" gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
-	Rating     float64   `json:"rating" gorm:"default:0"`
+	Rating     float64   `json:"rating" gorm:"default:0"`           // average of the approved reviews, see RefreshProductRating
+	SoldCount  int       `json:"sold_count" gorm:"default:0;index"` // units sold through committed orders
+
+	RatingCount     int                      `json:"rating_count" gorm:"default:0"`
+	RatingHistogram payloads.RatingHistogram `json:"rating_histogram" gorm:"type:varchar(100)"`
+
+	//quantity rules enforced by the cart, 0 means no limit for the max ones
+	MinOrderQty        int `json:"min_order_quantity" gorm:"default:1"`
+	MaxOrderQty        int `json:"max_order_quantity" gorm:"default:0"`
+	QuantityStep       int `json:"quantity_step" gorm:"default:1"` // e.g. 6 for products sold in packs of six
+	MaxPerCustomer     int `json:"max_per_customer" gorm:"default:0"`
+	PurchaseWindowDays int `json:"purchase_window_days" gorm:"default:0"` // window of MaxPerCustomer, 0 counts every purchase
+
+	ReorderThreshold int `json:"reorder_threshold" gorm:"default:0"` // seller and admins are alerted when stock goes down to it, 0 for no alerts
+
+	//sale of the price rule applying now, kept by the price scheduler. Discount is the product's own discount
+	SaleDiscount float64    `json:"sale_discount" gorm:"default:0"`
+	PriceRuleID  int        `json:"price_rule_id" gorm:"default:0;index"`
+	SaleEndsAt   *time.Time `json:"sale_ends_at"`
 }
 
 type ProductTag struct {
-	ProductID int `json:"product_id"`
-	TagID     int `json:"tag_id"`
+	ProductID int `json:"product_id" gorm:"index"`
+	TagID     int `json:"tag_id" gorm:"index"`
 }
 
 func InitProductSchema() {
 	db := dbs.DB
+	hadSoldCount := db.Migrator().HasColumn(&Product{}, "sold_count")
+	if err := migrateSellerID(db); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "Product seller", err)
+	}
 	if err := db.AutoMigrate(&Product{}, &ProductTag{}); err != nil {
 		log.Fatalf(utils.DatabaseMigrationError, "Product/ProductTag", err)
 	} else {
 		log.Printf(utils.SchemaMigrationSuccess, "Product/ProductTag")
 	}
+	//the sold count of existing products is filled once, when the column is added
+	if !hadSoldCount && db.Migrator().HasTable(&StockReservation{}) {
+		if err := backfillSoldCounts(db); err != nil {
+			log.Fatalf(utils.DatabaseMigrationError, "Product sold counts", err)
+		}
+	}
 }
 
-func (p *Product) CheckProductExistsById(db *gorm.DB, id int) error {
-	return db.Where("id = ? AND is_deleted = ?", id, false).First(&p).Error
+// migrateSellerID drops the uuid seller column of older schemas so it comes back as the int id of the seller,
+// users have int ids and no product was ever tied to one through the uuid
+func migrateSellerID(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&Product{}) {
+		return nil
+	}
+	columns, err := db.Migrator().ColumnTypes(&Product{})
+	if err != nil {
+		return err
+	}
+	for _, column := range columns {
+		if column.Name() == "seller_id" && !strings.Contains(strings.ToLower(column.DatabaseTypeName()), "int") {
+			return db.Migrator().DropColumn(&Product{}, "seller_id")
+		}
+	}
+	return nil
 }
 
-func GetProducts() ([]payloads.ProductResponse, []error) {
-	var products []Product
-	var resProducts []payloads.ProductResponse
-	var errs []error
-	db := dbs.DB
-	if err := db.Where("is_deleted =?", false).Find(&products).Error; err != nil {
-		return nil, []error{fmt.Errorf(utils.DatabaseConnectionError)}
-	}
+func backfillSoldCounts(db *gorm.DB) error {
+	sold := db.Model(&StockReservation{}).Select("COALESCE(SUM(quantity), 0)").Where("product_id = products.id and status = ?", ReservationStatusCommitted)
+	return db.Model(&Product{}).Where("1 = 1").UpdateColumn("sold_count", sold).Error
+}
 
-	if len(products) == 0 {
-		return nil, []error{errors.New("no products found")}
+// IsInStock tells whether the product has stock left, in_stock is set in the transaction of every stock change
+func (p *Product) IsInStock() bool {
+	return p.InStock
+}
+
+// LowStockThreshold stock at which the product counts as low on stock, its reorder threshold when it has one
+func (p *Product) LowStockThreshold(fallback int) int {
+	if p.ReorderThreshold > 0 {
+		return p.ReorderThreshold
 	}
+	return fallback
+}
 
-	for _, product := range products {
-		var resProduct payloads.ProductResponse
-		if product.Quantity <= 0 {
-			product.InStock = false
-			product.UpdateProduct(db, product.ID, map[string]interface{}{"in_stock": false})
-		}
-		if err := CopyStructIntoStruct(&product, &resProduct); err != nil {
-			utils.SimpleLog("error", err.Error())
-			return nil, []error{err}
-		}
-		resProducts = append(resProducts, resProduct)
+// ValidateQuantityRules rejects rules no quantity could satisfy
+func (p *Product) ValidateQuantityRules() error {
+	if p.MinOrderQty < 0 || p.MaxOrderQty < 0 || p.QuantityStep < 0 || p.MaxPerCustomer < 0 || p.PurchaseWindowDays < 0 {
+		return errors.New(utils.InvalidQuantityRules)
+	}
+	if p.MaxOrderQty > 0 && p.MaxOrderQty < p.MinOrderQty {
+		return errors.New(utils.InvalidQuantityRules)
 	}
+	if p.ReorderThreshold < 0 {
+		return errors.New(utils.InvalidReorderThreshold)
+	}
+	return nil
+}
 
-	for i, product := range resProducts {
-		tags, err := FetchProductTagsName(db, product.ID)
-		if err != nil {
-			errs = append(errs, err...)
-		}
+func (p *Product) CheckProductExistsById(db *gorm.DB, id int) error {
+	return db.Where("id = ? AND is_deleted = ?", id, false).First(&p).Error
+}
 
-		if tags == nil {
-			resProducts[i].Tags = []string{}
-		} else {
-			resProducts[i].Tags = tags
-		}
+// GetProductBySKU finds the product with the sku, deleted products included as the sku stays taken
+func (p *Product) GetProductBySKU(db *gorm.DB, sku string) error {
+	return db.Where("sku = ?", sku).First(&p).Error
+}
+
+// ProductSKUExists tells whether another product than excludeId uses the sku
+func ProductSKUExists(db *gorm.DB, sku string, excludeId int) (bool, error) {
+	var count int64
+	err := db.Model(&Product{}).Where("sku = ? and id <> ?", sku, excludeId).Count(&count).Error
+	return count > 0, err
+}
+
+// ProductNameExists tells whether another product than excludeId has the name, names are unique
+func ProductNameExists(db *gorm.DB, name string, excludeId int) (bool, error) {
+	var count int64
+	err := db.Model(&Product{}).Where("name = ? and id <> ?", name, excludeId).Count(&count).Error
+	return count > 0, err
+}
+
+// GetProductsByIds fetches the not deleted products among ids with a single query
+func GetProductsByIds(db *gorm.DB, ids []int) ([]Product, error) {
+	var products []Product
+	if err := db.Where("id IN ? AND is_deleted = ?", ids, false).Find(&products).Error; err != nil {
+		return nil, err
 	}
+	return products, nil
+}
 
-	if len(errs) > 0 {
-		utils.SimpleLog("error", utils.TagFetchError, errs)
-		return nil, errs
+// GetAllProducts fetches every product which is not deleted
+func GetAllProducts(db *gorm.DB) ([]Product, error) {
+	var products []Product
+	if err := db.Where("is_deleted = ?", false).Find(&products).Error; err != nil {
+		return nil, err
 	}
+	return products, nil
+}
 
-	utils.SimpleLog("info", utils.ProductsFetchedSuccessfully, len(resProducts))
-	return resProducts, nil
+// GetDeletedProductIds returns which of ids belong to soft deleted products
+func GetDeletedProductIds(db *gorm.DB, ids []int) ([]int, error) {
+	var deleted []int
+	if err := db.Model(&Product{}).Where("id IN ? AND is_deleted = ?", ids, true).Pluck("id", &deleted).Error; err != nil {
+		return nil, err
+	}
+	return deleted, nil
 }
 
 func (p *Product) FetchProductResp(db *gorm.DB, id int) (*payloads.ProductResponse, error) {
@@ -105,30 +182,81 @@ func (p *Product) FetchProductResp(db *gorm.DB, id int) (*payloads.ProductRespon
 		return nil, err
 	}
 
-	if productResp.Quantity <= 0 {
-		productResp.InStock = false
-		p.UpdateProduct(db, productResp.ID, map[string]interface{}{"in_stock": false})
+	if err := CopyStructIntoStruct(p, &productResp); err != nil {
+		return nil, err
 	}
+	//reads never write, stock is only reported as it is
+	productResp.InStock = p.IsInStock()
+	p.SetPricing(&productResp)
 
-	if err := CopyStructIntoStruct(p, &productResp); err != nil {
+	productResp.Breadcrumbs = []CategoryCrumb{}
+	if p.CategoryID > 0 {
+		categories, err := LoadCategoryIndex(db)
+		if err != nil {
+			return nil, err
+		}
+		productResp.Breadcrumbs = categories.Breadcrumbs(p.CategoryID)
+	}
+
+	images, err := GetImagesByProductId(db, p.ID)
+	if err != nil {
 		return nil, err
 	}
+	productResp.Images = images
 	return &productResp, nil
 }
 
-func (p *Product) AddProduct(db *gorm.DB) (int, error) {
+// AddProduct creates the product, its quantity goes into the default warehouse as stock moved by actorId
+func (p *Product) AddProduct(db *gorm.DB, actorId int) (int, error) {
 	p.ID = utils.GenerateRandomID()
-	if err := db.Create(&p).Error; err != nil {
+	quantity := p.Quantity
+	err := db.Transaction(func(tx *gorm.DB) error {
+		p.Quantity = 0
+		if err := tx.Create(&p).Error; err != nil {
+			return err
+		}
+		if err := SetStockQuantity(tx, p.ID, 0, quantity, actorId, "opening stock"); err != nil {
+			return err
+		}
+		if err := recordPriceChange(tx, p, PriceReasonAdded, actorId); err != nil {
+			return err
+		}
+		return syncInStock(tx, &Product{}, p.ID)
+	})
+	p.Quantity, p.InStock = quantity, quantity > 0
+	if err != nil {
 		return 0, err
 	}
 	return p.ID, nil
 }
 
-func (p *Product) UpdateProduct(db *gorm.DB, id int, updatedFields map[string]interface{}) error {
-	if err := db.Model(&p).Where("id = ?", id).Updates(updatedFields).Error; err != nil {
-		return err
-	}
-	return nil
+// UpdateProduct applies the changed fields, a changed Quantity is booked in the stock ledger as moved by actorId
+// and a changed price in the price history
+func (p *Product) UpdateProduct(db *gorm.DB, id int, updatedFields map[string]interface{}, actorId int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if quantity, ok := updatedFields["Quantity"].(int); ok {
+			delete(updatedFields, "Quantity")
+			if err := SetStockQuantity(tx, id, 0, quantity, actorId, "quantity updated"); err != nil {
+				return err
+			}
+		}
+		if len(updatedFields) == 0 {
+			return nil
+		}
+		_, priceChanged := updatedFields["Price"]
+		_, discountChanged := updatedFields["Discount"]
+		if err := tx.Model(&p).Where("id = ?", id).Updates(updatedFields).Error; err != nil {
+			return err
+		}
+		if !priceChanged && !discountChanged {
+			return nil
+		}
+		var updated Product
+		if err := tx.Where("id = ?", id).First(&updated).Error; err != nil {
+			return err
+		}
+		return recordPriceChange(tx, &updated, PriceReasonUpdated, actorId)
+	})
 }
 
 func (p *Product) DeleteProduct(db *gorm.DB, id int) error {
@@ -143,12 +271,11 @@ func (p *Product) DeleteProduct(db *gorm.DB, id int) error {
 	return nil
 }
 
-func (p *Product) FetchProductCategories(db *gorm.DB) ([]string, error) {
-	var categories []string
-	if err := db.Table("products").Select("DISTINCT category").Where("is_deleted = ?", false).Pluck("category", &categories).Error; err != nil {
-		return nil, err
-	}
-	return categories, nil
+// AssignCategory moves the product into the category, the category name is copied into Category
+func (p *Product) AssignCategory(db *gorm.DB, category *Category) error {
+	p.CategoryID = category.ID
+	p.Category = category.Name
+	return db.Model(&Product{}).Where("id = ?", p.ID).Updates(map[string]interface{}{"category_id": category.ID, "category": category.Name}).Error
 }
 
 func CopyStructIntoStruct(struct1, struct2 interface{}) error {
@@ -187,11 +314,8 @@ func FetchProductTagsName(db *gorm.DB, productID int) ([]string, []error) {
 	var errs []error
 	var tags []Tag
 
-	if err := db.Find(&productTags, productID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-		} else {
-			return tagWithName, []error{err}
-		}
+	if err := db.Where("product_id = ?", productID).Find(&productTags).Error; err != nil {
+		return tagWithName, []error{err}
 	}
 
 	var tagIDs []int
@@ -216,82 +340,88 @@ func FetchProductTagsName(db *gorm.DB, productID int) ([]string, []error) {
 	return tagWithName, nil
 }
 
-func (p *Product) UpdateProductQuantity(db *gorm.DB) error {
-	if p.Quantity <= 0 {
-		p.InStock = false
-	}
-	// update quantity and in_stock
-	if err := db.Model(&p).Where("id =?", p.ID).Updates(map[string]interface{}{"quantity": p.Quantity, "in_stock": p.InStock}).Error; err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // FilterCriteria represents the criteria for filtering products
 type FilterCriteria struct {
 	PName       string   `json:"name"`
 	MinPrice    float64  `json:"min_price"`
 	MaxPrice    float64  `json:"max_price"`
 	MinRating   float64  `json:"min_rating"`
-	Category    string   `json:"category"`
+	Category    string   `json:"category"`    // slug or name of a category, products below it match too
+	CategoryID  int      `json:"category_id"` // products of the category and of every category below it
 	MinQuantity int      `json:"min_quantity"`
 	MaxQuantity int      `json:"max_quantity"`
 	Tags        []string `json:"tags"`
+	TagMode     string   `json:"tag_mode"` // "any" matches products with one of the tags, "all" (default) with every one
+	Options     []string `json:"options"`  // "size:M,color:Red", a single variant has to match all of them
 }
 
-func FilterProduct(db *gorm.DB, criteria FilterCriteria) ([]payloads.ProductResponse, error) {
-	var products []Product
-	query := db.Model(&Product{}).Where("is_deleted = ?", false)
-
-	// Dynamically apply filters to the query
-	if criteria.PName != "" {
-		query = query.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(criteria.PName)+"%")
-	}
-	if criteria.MinPrice > 0 {
-		query = query.Where("price >= ?", criteria.MinPrice)
-	}
-	if criteria.MaxPrice > 0 {
-		query = query.Where("price <= ?", criteria.MaxPrice)
-	}
-	if criteria.MinRating > 0 {
-		query = query.Where("rating >= ?", criteria.MinRating)
-	}
-	if criteria.Category != "" {
-		query = query.Where("LOWER(category) LIKE ?", "%"+strings.ToLower(criteria.Category)+"%")
-	}
-	if criteria.MinQuantity > 0 {
-		query = query.Where("quantity >= ?", criteria.MinQuantity)
-	}
-	if criteria.MaxQuantity > 0 {
-		query = query.Where("quantity <= ?", criteria.MaxQuantity)
-	}
-	// Uncomment this if you have a Tags column or join for filtering
-	// if criteria.Tags != "" {
-	//     query = query.Where("tags LIKE ?", "%"+criteria.Tags+"%")
-	// }
-
-	// Execute the query
-	if err := query.Find(&products).Error; err != nil {
-		return nil, fmt.Errorf("error fetching products: %w", err)
+// FilterScope turns the criteria into the conditions of a product listing
+func FilterScope(db *gorm.DB, criteria FilterCriteria) (func(*gorm.DB) *gorm.DB, error) {
+	categories, err := LoadCategoryIndex(db)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching categories: %w", err)
 	}
 
-	// Map products to payloads
-	filteredProducts := make([]payloads.ProductResponse, len(products))
-	for i, product := range products {
-		filteredProducts[i] = payloads.ProductResponse{
-			ID:         product.ID,
-			PName:      product.PName,
-			PDesc:      product.PDesc,
-			Price:      product.Price,
-			Quantity:   product.Quantity,
-			IsDeleted:  product.IsDeleted,
-			Category:   product.Category,
-			IsFeatured: product.IsFeatured,
-			TaxRate:    product.TaxRate,
-			Rating:     product.Rating,
+	return func(query *gorm.DB) *gorm.DB {
+		// Dynamically apply filters to the query
+		if criteria.PName != "" {
+			query = query.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(criteria.PName)+"%")
+		}
+		if criteria.MinPrice > 0 {
+			query = query.Where("price >= ?", criteria.MinPrice)
+		}
+		if criteria.MaxPrice > 0 {
+			query = query.Where("price <= ?", criteria.MaxPrice)
+		}
+		if criteria.MinRating > 0 {
+			query = query.Where("rating >= ?", criteria.MinRating)
+		}
+		if criteria.CategoryID > 0 {
+			query = query.Where("category_id IN ?", categories.Descendants(criteria.CategoryID))
+		}
+		if criteria.Category != "" {
+			//text which is no category of the tree still matches the category text of the products
+			if category, ok := categories.FindByNameOrSlug(criteria.Category); ok {
+				query = query.Where("category_id IN ?", categories.Descendants(category.ID))
+			} else {
+				query = query.Where("LOWER(category) LIKE ?", "%"+strings.ToLower(criteria.Category)+"%")
+			}
+		}
+		if criteria.MinQuantity > 0 {
+			query = query.Where("quantity >= ?", criteria.MinQuantity)
+		}
+		if criteria.MaxQuantity > 0 {
+			query = query.Where("quantity <= ?", criteria.MaxQuantity)
+		}
+		if options := parseOptionFilters(criteria.Options); len(options) > 0 {
+			query = query.Where("id IN (?)", variantsWithOptions(db, options))
+		}
+		if tags := normalizeTagNames(criteria.Tags); len(tags) > 0 {
+			query = query.Where("id IN (?)", productsWithTags(db, tags, criteria.TagMode == TagModeAny))
+		}
+		return query
+	}, nil
+}
+
+// parseOptionFilters reads "name:value" pairs, pairs without a name or a value are dropped
+func parseOptionFilters(pairs []string) map[string]string {
+	options := map[string]string{}
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if ok && name != "" && value != "" {
+			options[strings.ToLower(name)] = strings.ToLower(value)
 		}
 	}
+	return options
+}
 
-	return filteredProducts, nil
+// variantsWithOptions selects the products with a variant still sold which has every one of the option values
+func variantsWithOptions(db *gorm.DB, options map[string]string) *gorm.DB {
+	variants := db.Model(&ProductVariant{}).Select("product_id").Where("is_deleted = ?", false)
+	for name, value := range options {
+		matching := db.Model(&VariantOptionValue{}).Select("variant_id").Where("LOWER(name) = ? and LOWER(value) = ?", name, value)
+		variants = variants.Where("id IN (?)", matching)
+	}
+	return variants
 }
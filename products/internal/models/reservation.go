@@ -0,0 +1,303 @@
+package models
+
+import (
+	"e-commerce-backend/products/dbs"
+	"e-commerce-backend/shared/utils"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ReservationStatusActive    = "active"
+	ReservationStatusReleased  = "released"
+	ReservationStatusCommitted = "committed"
+	ReservationStatusExpired   = "expired"
+	ReservationStatusCanceled  = "canceled" // committed for an order which was not paid, the stock went back
+)
+
+// StockReservation holds stock of a product for a reference (e.g. a cart) until it expires, is released or is
+// committed by an order, only committing decrements Product.Quantity. Holds with VariantID set are taken from the
+// stock of the variant instead, every hold is allocated to the warehouses it will ship from
+type StockReservation struct {
+	ID        int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	ProductID int       `json:"product_id" gorm:"not null;index:idx_reservation_product_reference"`
+	VariantID int       `json:"variant_id,omitempty" gorm:"default:0;index"`
+	Reference string    `json:"reference" gorm:"type:varchar(64);not null;index:idx_reservation_product_reference;index"` // e.g. "cart-line-12"
+	Quantity  int       `json:"quantity" gorm:"not null"`
+	Status    string    `json:"status" gorm:"type:varchar(20);not null;index"` // "active", "released", "committed", "expired"
+	OrderID   int       `json:"order_id" gorm:"default:0"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+type StockReservationInterface interface {
+	Reserve(db *gorm.DB, productId int, reference string, quantity int, ttl time.Duration) error
+	Release(db *gorm.DB, productId int, reference string) error
+	ReserveVariant(db *gorm.DB, variantId int, reference string, quantity int, ttl time.Duration) error
+	ReleaseVariant(db *gorm.DB, variantId int, reference string) error
+}
+
+func InitReservationSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&StockReservation{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "StockReservation", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "StockReservation")
+	}
+}
+
+func activeReservations(db *gorm.DB) *gorm.DB {
+	return db.Model(&StockReservation{}).Where("status = ? and expires_at > ?", ReservationStatusActive, time.Now())
+}
+
+// GetReservedQuantity sums the unexpired holds on the stock of a product, excludeReference leaves out the holds
+// of one reference
+func GetReservedQuantity(db *gorm.DB, productId int, excludeReference string) (int, error) {
+	var reserved int
+	query := activeReservations(db).Select("COALESCE(SUM(quantity), 0)").Where("product_id = ? and variant_id = ?", productId, 0)
+	if excludeReference != "" {
+		query = query.Where("reference <> ?", excludeReference)
+	}
+	if err := query.Scan(&reserved).Error; err != nil {
+		return 0, err
+	}
+	return reserved, nil
+}
+
+// GetReservedQuantities sums the unexpired holds of several products at once, keyed by product id
+func GetReservedQuantities(db *gorm.DB, productIds []int) (map[int]int, error) {
+	var rows []struct {
+		ProductID int
+		Reserved  int
+	}
+	if err := activeReservations(db).Select("product_id, COALESCE(SUM(quantity), 0) as reserved").Where("product_id IN ? and variant_id = ?", productIds, 0).Group("product_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	reserved := make(map[int]int, len(rows))
+	for _, row := range rows {
+		reserved[row.ProductID] = row.Reserved
+	}
+	return reserved, nil
+}
+
+// GetAvailableQuantity is the stock which can still be reserved, on hand minus unexpired reservations
+func (p *Product) GetAvailableQuantity(db *gorm.DB) (int, error) {
+	reserved, err := GetReservedQuantity(db, p.ID, "")
+	if err != nil {
+		return 0, err
+	}
+	return max(p.Quantity-reserved, 0), nil
+}
+
+// Reserve sets the quantity held for the reference on the product, the product row is locked so two carts
+// can't reserve the same last unit
+func (sr *StockReservation) Reserve(db *gorm.DB, productId int, reference string, quantity int, ttl time.Duration) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var product Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? and is_deleted = ?", productId, false).First(&product).Error; err != nil {
+			return err
+		}
+
+		reserved, err := GetReservedQuantity(tx, productId, reference)
+		if err != nil {
+			return err
+		}
+		if product.Quantity-reserved < quantity {
+			return fmt.Errorf(utils.InsufficientStockToReserve, productId, max(product.Quantity-reserved, 0))
+		}
+
+		//one hold per product and reference, expired ones are replaced as well
+		err = tx.Where("product_id = ? and variant_id = ? and reference = ? and status = ?", productId, 0, reference, ReservationStatusActive).First(&sr).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		sr.Quantity = quantity
+		sr.ExpiresAt = time.Now().Add(ttl)
+		if err == nil {
+			if err := tx.Model(&StockReservation{}).Where("id = ?", sr.ID).Updates(map[string]interface{}{"quantity": sr.Quantity, "expires_at": sr.ExpiresAt}).Error; err != nil {
+				return err
+			}
+			return allocateReservation(tx, sr)
+		}
+
+		sr.ProductID = productId
+		sr.Reference = reference
+		sr.Status = ReservationStatusActive
+		if err := tx.Create(&sr).Error; err != nil {
+			return err
+		}
+		return allocateReservation(tx, sr)
+	})
+}
+
+func (sr *StockReservation) Release(db *gorm.DB, productId int, reference string) error {
+	return db.Model(&StockReservation{}).Where("product_id = ? and variant_id = ? and reference = ? and status = ?", productId, 0, reference, ReservationStatusActive).Update("status", ReservationStatusReleased).Error
+}
+
+// GetVariantReservedQuantity sums the unexpired holds on a variant, excludeReference leaves out the holds of one reference
+func GetVariantReservedQuantity(db *gorm.DB, variantId int, excludeReference string) (int, error) {
+	var reserved int
+	query := activeReservations(db).Select("COALESCE(SUM(quantity), 0)").Where("variant_id = ?", variantId)
+	if excludeReference != "" {
+		query = query.Where("reference <> ?", excludeReference)
+	}
+	if err := query.Scan(&reserved).Error; err != nil {
+		return 0, err
+	}
+	return reserved, nil
+}
+
+// ReserveVariant sets the quantity held for the reference on the variant, the variant row is locked like the
+// product row in Reserve
+func (sr *StockReservation) ReserveVariant(db *gorm.DB, variantId int, reference string, quantity int, ttl time.Duration) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var variant ProductVariant
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? and is_deleted = ?", variantId, false).First(&variant).Error; err != nil {
+			return err
+		}
+
+		reserved, err := GetVariantReservedQuantity(tx, variantId, reference)
+		if err != nil {
+			return err
+		}
+		if variant.Quantity-reserved < quantity {
+			return fmt.Errorf(utils.InsufficientVariantStock, variantId, max(variant.Quantity-reserved, 0))
+		}
+
+		err = tx.Where("variant_id = ? and reference = ? and status = ?", variantId, reference, ReservationStatusActive).First(&sr).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		sr.Quantity = quantity
+		sr.ExpiresAt = time.Now().Add(ttl)
+		if err == nil {
+			if err := tx.Model(&StockReservation{}).Where("id = ?", sr.ID).Updates(map[string]interface{}{"quantity": sr.Quantity, "expires_at": sr.ExpiresAt}).Error; err != nil {
+				return err
+			}
+			return allocateReservation(tx, sr)
+		}
+
+		sr.ProductID = variant.ProductID
+		sr.VariantID = variantId
+		sr.Reference = reference
+		sr.Status = ReservationStatusActive
+		if err := tx.Create(&sr).Error; err != nil {
+			return err
+		}
+		return allocateReservation(tx, sr)
+	})
+}
+
+func (sr *StockReservation) ReleaseVariant(db *gorm.DB, variantId int, reference string) error {
+	return db.Model(&StockReservation{}).Where("variant_id = ? and reference = ? and status = ?", variantId, reference, ReservationStatusActive).Update("status", ReservationStatusReleased).Error
+}
+
+func ReleaseReservations(db *gorm.DB, references []string) (int64, error) {
+	result := db.Model(&StockReservation{}).Where("reference IN ? and status = ?", references, ReservationStatusActive).Update("status", ReservationStatusReleased)
+	return result.RowsAffected, result.Error
+}
+
+// ExtendReservations pushes the expiry of every unexpired hold of the references
+func ExtendReservations(db *gorm.DB, references []string, ttl time.Duration) (int64, error) {
+	result := activeReservations(db).Where("reference IN ?", references).Update("expires_at", time.Now().Add(ttl))
+	return result.RowsAffected, result.Error
+}
+
+// CommitReservations turns the holds of the references into a sale, the stock is taken out of the warehouses each
+// hold was allocated in with conditional updates, so either every hold is committed or none is. A reference whose
+// hold expired fails the commit, the stock it held may be held by somebody else by now
+func CommitReservations(db *gorm.DB, references []string, orderId int) ([]StockReservation, error) {
+	var reservations []StockReservation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := activeReservations(tx).Where("reference IN ?", references).Order("product_id").Find(&reservations).Error; err != nil {
+			return err
+		}
+		if len(reservations) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		held := make(map[string]bool, len(reservations))
+		for _, reservation := range reservations {
+			held[reservation.Reference] = true
+		}
+		for _, reference := range references {
+			if !held[reference] {
+				return fmt.Errorf(utils.ReservationNotHeld, reference)
+			}
+		}
+
+		for i := range reservations {
+			reservation := &reservations[i]
+			if err := commitAllocatedStock(tx, reservation, orderId); err != nil {
+				return err
+			}
+			if err := tx.Model(&Product{}).Where("id = ?", reservation.ProductID).UpdateColumn("sold_count", gorm.Expr("sold_count + ?", reservation.Quantity)).Error; err != nil {
+				return err
+			}
+
+			reservation.Status = ReservationStatusCommitted
+			reservation.OrderID = orderId
+			if err := tx.Model(&StockReservation{}).Where("id = ?", reservation.ID).Updates(map[string]interface{}{"status": reservation.Status, "order_id": orderId}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+// CancelCommittedReservations puts the stock committed for an order back into the warehouses it was taken from,
+// for orders which were not paid after all. It returns how many holds were canceled
+func CancelCommittedReservations(db *gorm.DB, orderId int) (int, error) {
+	var reservations []StockReservation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_id = ? and status = ?", orderId, ReservationStatusCommitted).
+			Order("product_id").Find(&reservations).Error; err != nil {
+			return err
+		}
+
+		for _, reservation := range reservations {
+			var allocations []ReservationAllocation
+			if err := tx.Where("reservation_id = ?", reservation.ID).Find(&allocations).Error; err != nil {
+				return err
+			}
+			for _, allocation := range allocations {
+				movement := StockMovement{
+					WarehouseID: allocation.WarehouseID,
+					ProductID:   allocation.ProductID,
+					VariantID:   allocation.VariantID,
+					Type:        MovementReturn,
+					Quantity:    allocation.Quantity,
+					Reason:      reservation.Reference,
+					Reference:   OrderReference(orderId),
+				}
+				if err := ApplyMovement(tx, &movement); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&Product{}).Where("id = ?", reservation.ProductID).UpdateColumn("sold_count", gorm.Expr("GREATEST(sold_count - ?, 0)", reservation.Quantity)).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&StockReservation{}).Where("id = ?", reservation.ID).Update("status", ReservationStatusCanceled).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return len(reservations), err
+}
+
+// ExpireReservations marks holds past their expiry, availability already ignores them so this only keeps the table tidy
+func ExpireReservations(db *gorm.DB) (int64, error) {
+	result := db.Model(&StockReservation{}).Where("status = ? and expires_at <= ?", ReservationStatusActive, time.Now()).Update("status", ReservationStatusExpired)
+	return result.RowsAffected, result.Error
+}
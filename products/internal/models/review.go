@@ -0,0 +1,300 @@
+package models
+
+import (
+	"e-commerce-backend/products/dbs"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ReviewStatusPending  = "pending"
+	ReviewStatusApproved = "approved"
+	ReviewStatusRejected = "rejected"
+)
+
+// Review rating of a product by a customer, a customer reviews a product once. Reviews are only shown and
+// counted in the product rating once a moderator approved them, an edited review goes back to moderation
+type Review struct {
+	ID               int           `json:"id" gorm:"primaryKey;autoIncrement"`
+	ProductID        int           `json:"product_id" gorm:"not null;uniqueIndex:idx_review_product_user;index:idx_review_product_status"`
+	UserID           int           `json:"user_id" gorm:"not null;uniqueIndex:idx_review_product_user"`
+	Rating           int           `json:"rating" gorm:"not null"`
+	Title            string        `json:"title" gorm:"type:varchar(150)"`
+	Body             string        `json:"body" gorm:"type:text"`
+	VerifiedPurchase bool          `json:"verified_purchase" gorm:"default:false"`
+	Status           string        `json:"status" gorm:"type:varchar(20);default:pending;index:idx_review_product_status"`
+	ModerationNote   string        `json:"moderation_note,omitempty" gorm:"type:varchar(255)"`
+	ModeratedBy      int           `json:"moderated_by,omitempty" gorm:"default:0"`
+	ModeratedAt      *time.Time    `json:"moderated_at,omitempty"`
+	HelpfulCount     int           `json:"helpful_count" gorm:"default:0"`
+	NotHelpfulCount  int           `json:"not_helpful_count" gorm:"default:0"`
+	Photos           []ReviewPhoto `json:"photos" gorm:"foreignKey:ReviewID"`
+	CreatedAt        time.Time     `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        time.Time     `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+type ReviewPhoto struct {
+	ID                  int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	ReviewID            int    `json:"-" gorm:"not null;index"`
+	StorageKey          string `json:"-" gorm:"type:varchar(255);not null"`
+	URL                 string `json:"url" gorm:"type:varchar(512);not null"`
+	ThumbnailStorageKey string `json:"-" gorm:"type:varchar(255);not null"`
+	ThumbnailURL        string `json:"thumbnail_url" gorm:"type:varchar(512);not null"`
+	Width               int    `json:"width"`
+	Height              int    `json:"height"`
+}
+
+// ReviewVote whether a customer found a review helpful, one vote per customer and review
+type ReviewVote struct {
+	ID       int  `json:"-" gorm:"primaryKey;autoIncrement"`
+	ReviewID int  `json:"review_id" gorm:"not null;uniqueIndex:idx_review_vote_user"`
+	UserID   int  `json:"user_id" gorm:"not null;uniqueIndex:idx_review_vote_user"`
+	Helpful  bool `json:"helpful"`
+}
+
+// ReviewListOptions which reviews of a listing are returned and in which order, Status is only set by moderation
+type ReviewListOptions struct {
+	Status       string
+	Rating       int
+	VerifiedOnly bool
+	Sort         string
+	Limit        int
+	Offset       int
+}
+
+// reviewSortKeys order of the review listings, newest first when none is asked for
+var reviewSortKeys = map[string]string{
+	"newest":  "created_at DESC, id DESC",
+	"oldest":  "created_at ASC, id ASC",
+	"helpful": "helpful_count DESC, created_at DESC, id DESC",
+	"highest": "rating DESC, created_at DESC, id DESC",
+	"lowest":  "rating ASC, created_at DESC, id DESC",
+}
+
+const DefaultReviewSort = "newest"
+
+type ReviewInterface interface {
+	CreateReview(db *gorm.DB) error
+	GetReviewById(db *gorm.DB, id int) error
+	UpdateReview(db *gorm.DB, updatedFields map[string]interface{}) error
+	DeleteReview(db *gorm.DB) error
+	Moderate(db *gorm.DB, status, note string, moderatorId int) error
+	Vote(db *gorm.DB, userId int, helpful bool) error
+	AddPhotos(db *gorm.DB, photos []ReviewPhoto) error
+}
+
+func InitReviewSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&Review{}, &ReviewPhoto{}, &ReviewVote{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "Review/ReviewPhoto/ReviewVote", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "Review/ReviewPhoto/ReviewVote")
+	}
+}
+
+func IsReviewSort(sort string) bool {
+	_, ok := reviewSortKeys[sort]
+	return ok
+}
+
+func (rv *Review) CreateReview(db *gorm.DB) error {
+	rv.Status = ReviewStatusPending
+	return db.Create(&rv).Error
+}
+
+func (rv *Review) GetReviewById(db *gorm.DB, id int) error {
+	return db.Preload("Photos", orderPhotos).Where("id = ?", id).First(&rv).Error
+}
+
+func orderPhotos(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+// ReviewExists tells whether the user already reviewed the product
+func ReviewExists(db *gorm.DB, productId, userId int) (bool, error) {
+	var count int64
+	err := db.Model(&Review{}).Where("product_id = ? and user_id = ?", productId, userId).Count(&count).Error
+	return count > 0, err
+}
+
+// UpdateReview applies the author's changes and sends the review back to moderation, an approved review stops
+// counting in the product rating until it is approved again
+func (rv *Review) UpdateReview(db *gorm.DB, updatedFields map[string]interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		wasApproved := rv.Status == ReviewStatusApproved
+		updatedFields["status"] = ReviewStatusPending
+		if err := tx.Model(&Review{}).Where("id = ?", rv.ID).Updates(updatedFields).Error; err != nil {
+			return err
+		}
+		if wasApproved {
+			if err := RefreshProductRating(tx, rv.ProductID); err != nil {
+				return err
+			}
+		}
+		return rv.GetReviewById(tx, rv.ID)
+	})
+}
+
+// DeleteReview removes the review with its photos and votes, the files of the photos are left to the caller
+func (rv *Review) DeleteReview(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("review_id = ?", rv.ID).Delete(&ReviewPhoto{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("review_id = ?", rv.ID).Delete(&ReviewVote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&Review{}, rv.ID).Error; err != nil {
+			return err
+		}
+		if rv.Status == ReviewStatusApproved {
+			return RefreshProductRating(tx, rv.ProductID)
+		}
+		return nil
+	})
+}
+
+// Moderate approves or rejects the review, the product rating follows when the review starts or stops counting
+func (rv *Review) Moderate(db *gorm.DB, status, note string, moderatorId int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		changesRating := (rv.Status == ReviewStatusApproved) != (status == ReviewStatusApproved)
+		now := time.Now()
+		updatedFields := map[string]interface{}{
+			"status":          status,
+			"moderation_note": note,
+			"moderated_by":    moderatorId,
+			"moderated_at":    &now,
+		}
+		if err := tx.Model(&Review{}).Where("id = ?", rv.ID).Updates(updatedFields).Error; err != nil {
+			return err
+		}
+		if changesRating {
+			if err := RefreshProductRating(tx, rv.ProductID); err != nil {
+				return err
+			}
+		}
+		return rv.GetReviewById(tx, rv.ID)
+	})
+}
+
+// Vote records the vote of the user, voting again replaces the earlier vote. The counts are recounted from the
+// votes so they can't drift
+func (rv *Review) Vote(db *gorm.DB, userId int, helpful bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var vote ReviewVote
+		err := tx.Where("review_id = ? and user_id = ?", rv.ID, userId).First(&vote).Error
+		switch {
+		case err == nil:
+			if err := tx.Model(&vote).Update("helpful", helpful).Error; err != nil {
+				return err
+			}
+		case err == gorm.ErrRecordNotFound:
+			if err := tx.Create(&ReviewVote{ReviewID: rv.ID, UserID: userId, Helpful: helpful}).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		var counts struct {
+			Helpful    int
+			NotHelpful int
+		}
+		if err := tx.Model(&ReviewVote{}).
+			Select("COALESCE(SUM(CASE WHEN helpful THEN 1 ELSE 0 END), 0) AS helpful, COALESCE(SUM(CASE WHEN helpful THEN 0 ELSE 1 END), 0) AS not_helpful").
+			Where("review_id = ?", rv.ID).Scan(&counts).Error; err != nil {
+			return err
+		}
+		rv.HelpfulCount, rv.NotHelpfulCount = counts.Helpful, counts.NotHelpful
+		return tx.Model(&Review{}).Where("id = ?", rv.ID).
+			UpdateColumns(map[string]interface{}{"helpful_count": counts.Helpful, "not_helpful_count": counts.NotHelpful}).Error
+	})
+}
+
+// AddPhotos attaches the photos and sends the review back to moderation like any other change
+func (rv *Review) AddPhotos(db *gorm.DB, photos []ReviewPhoto) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := range photos {
+			photos[i].ReviewID = rv.ID
+		}
+		if err := tx.Create(&photos).Error; err != nil {
+			return err
+		}
+		return rv.UpdateReview(tx, map[string]interface{}{})
+	})
+}
+
+func (rv *Review) PhotoStorageKeys() []string {
+	keys := make([]string, 0, 2*len(rv.Photos))
+	for _, photo := range rv.Photos {
+		keys = append(keys, photo.StorageKey, photo.ThumbnailStorageKey)
+	}
+	return keys
+}
+
+// ListReviews pages through the reviews of a product, productId 0 lists the reviews of every product
+func ListReviews(db *gorm.DB, productId int, opts ReviewListOptions) ([]Review, int64, error) {
+	query := db.Model(&Review{}).Where("status = ?", opts.Status)
+	if productId > 0 {
+		query = query.Where("product_id = ?", productId)
+	}
+	if opts.Rating > 0 {
+		query = query.Where("rating = ?", opts.Rating)
+	}
+	if opts.VerifiedOnly {
+		query = query.Where("verified_purchase = ?", true)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	order, ok := reviewSortKeys[opts.Sort]
+	if !ok {
+		order = reviewSortKeys[DefaultReviewSort]
+	}
+	reviews := []Review{}
+	if err := query.Preload("Photos", orderPhotos).Order(order).Limit(opts.Limit).Offset(opts.Offset).Find(&reviews).Error; err != nil {
+		return nil, 0, err
+	}
+	return reviews, total, nil
+}
+
+// RefreshProductRating recomputes the average rating, the count and the histogram of the product from its
+// approved reviews
+func RefreshProductRating(db *gorm.DB, productId int) error {
+	var rows []struct {
+		Rating int
+		Count  int
+	}
+	if err := db.Model(&Review{}).Select("rating, COUNT(*) AS count").
+		Where("product_id = ? and status = ?", productId, ReviewStatusApproved).
+		Group("rating").Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	var histogram payloads.RatingHistogram
+	count, sum := 0, 0
+	for _, row := range rows {
+		if row.Rating < 1 || row.Rating > len(histogram) {
+			continue
+		}
+		histogram[row.Rating-1] = row.Count
+		count += row.Count
+		sum += row.Rating * row.Count
+	}
+	average := 0.0
+	if count > 0 {
+		average = math.Round(float64(sum)/float64(count)*100) / 100
+	}
+	return db.Model(&Product{}).Where("id = ?", productId).UpdateColumns(map[string]interface{}{
+		"rating":           average,
+		"rating_count":     count,
+		"rating_histogram": histogram,
+	}).Error
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"e-commerce-backend/products/pkg/payloads"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AssignSeller moves the product to another seller
+func (p *Product) AssignSeller(db *gorm.DB, sellerId int) error {
+	if err := db.Model(&Product{}).Where("id = ?", p.ID).UpdateColumn("seller_id", sellerId).Error; err != nil {
+		return err
+	}
+	p.SellerID = sellerId
+	return nil
+}
+
+// sellerCommittedReservations reservations of the seller's products which became orders between from and to,
+// a reservation is committed when its order is placed so UpdatedAt is the time of the sale
+func sellerCommittedReservations(db *gorm.DB, sellerId int, from, to time.Time) *gorm.DB {
+	return db.Model(&StockReservation{}).
+		Joins("JOIN products ON products.id = stock_reservations.product_id").
+		Where("products.seller_id = ? and stock_reservations.status = ?", sellerId, ReservationStatusCommitted).
+		Where("stock_reservations.updated_at >= ? and stock_reservations.updated_at < ?", from, to)
+}
+
+// GetSellerSales sums the units the seller sold per product between from and to, best selling first
+func GetSellerSales(db *gorm.DB, sellerId int, from, to time.Time) (payloads.SellerSalesResponse, error) {
+	sales := payloads.SellerSalesResponse{From: from, To: to, Products: []payloads.ProductSales{}}
+	if err := sellerCommittedReservations(db, sellerId, from, to).
+		Select("stock_reservations.product_id, products.name, SUM(stock_reservations.quantity) AS units_sold, " +
+			"COUNT(DISTINCT stock_reservations.order_id) AS orders, products.sold_count").
+		Group("stock_reservations.product_id, products.name, products.sold_count").
+		Order("units_sold DESC, stock_reservations.product_id").
+		Scan(&sales.Products).Error; err != nil {
+		return sales, err
+	}
+
+	//an order with several of the seller's products is counted once in the totals
+	var totals struct {
+		Units  int
+		Orders int
+	}
+	if err := sellerCommittedReservations(db, sellerId, from, to).
+		Select("COALESCE(SUM(stock_reservations.quantity), 0) AS units, COUNT(DISTINCT stock_reservations.order_id) AS orders").
+		Scan(&totals).Error; err != nil {
+		return sales, err
+	}
+	sales.TotalUnits, sales.TotalOrders = totals.Units, totals.Orders
+	return sales, nil
+}
+
+// GetVariantReservedQuantities sums the unexpired holds of several variants at once, keyed by variant id
+func GetVariantReservedQuantities(db *gorm.DB, variantIds []int) (map[int]int, error) {
+	var rows []struct {
+		VariantID int
+		Reserved  int
+	}
+	if err := activeReservations(db).Select("variant_id, COALESCE(SUM(quantity), 0) as reserved").Where("variant_id IN ?", variantIds).Group("variant_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	reserved := make(map[int]int, len(rows))
+	for _, row := range rows {
+		reserved[row.VariantID] = row.Reserved
+	}
+	return reserved, nil
+}
+
+// GetSellerLowStock lists the products of the seller with at most threshold units available, products sold in
+// variants are listed per variant as the product quantity isn't what is sold. With perProduct the reorder
+// threshold of each product is used and threshold only for products without one. The fewest units come first
+func GetSellerLowStock(db *gorm.DB, sellerId, threshold int, perProduct bool) ([]payloads.LowStockItem, error) {
+	items := []payloads.LowStockItem{}
+	var products []Product
+	if err := db.Where("seller_id = ? and is_deleted = ?", sellerId, false).Order("id").Find(&products).Error; err != nil {
+		return nil, err
+	}
+	if len(products) == 0 {
+		return items, nil
+	}
+
+	ids := make([]int, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	withVariants, err := GetProductIdsWithVariants(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	reserved, err := GetReservedQuantities(db, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[int]string, len(products))
+	thresholds := make(map[int]int, len(products))
+	var variantProducts []int
+	for _, product := range products {
+		thresholds[product.ID] = threshold
+		if perProduct {
+			thresholds[product.ID] = product.LowStockThreshold(threshold)
+		}
+		if withVariants[product.ID] {
+			names[product.ID] = product.PName
+			variantProducts = append(variantProducts, product.ID)
+			continue
+		}
+		if available := product.Quantity - reserved[product.ID]; available <= thresholds[product.ID] {
+			items = append(items, payloads.LowStockItem{
+				ProductID: product.ID,
+				Name:      product.PName,
+				Quantity:  product.Quantity,
+				Reserved:  reserved[product.ID],
+				Available: max(available, 0),
+			})
+		}
+	}
+
+	if len(variantProducts) > 0 {
+		var variants []ProductVariant
+		if err := db.Preload("Options").Where("product_id IN ? and is_deleted = ?", variantProducts, false).Order("product_id, id").Find(&variants).Error; err != nil {
+			return nil, err
+		}
+		variantIds := make([]int, len(variants))
+		for i, variant := range variants {
+			variantIds[i] = variant.ID
+		}
+		variantReserved, err := GetVariantReservedQuantities(db, variantIds)
+		if err != nil {
+			return nil, err
+		}
+		for _, variant := range variants {
+			if available := variant.Quantity - variantReserved[variant.ID]; available <= thresholds[variant.ProductID] {
+				items = append(items, payloads.LowStockItem{
+					ProductID: variant.ProductID,
+					VariantID: variant.ID,
+					Name:      fmt.Sprintf("%s (%s)", names[variant.ProductID], variant.Title()),
+					SKU:       variant.SKU,
+					Quantity:  variant.Quantity,
+					Reserved:  variantReserved[variant.ID],
+					Available: max(available, 0),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Available < items[j].Available
+	})
+	return items, nil
+}
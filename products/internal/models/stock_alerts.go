@@ -0,0 +1,224 @@
+package models
+
+import (
+	"e-commerce-backend/products/dbs"
+	"e-commerce-backend/shared/utils"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StockEventLowStock    = "low_stock"     // stock went down to the reorder threshold of the product
+	StockEventBackInStock = "back_in_stock" // stock went from 0 to positive while customers were waiting for it
+)
+
+// StockEvent change of stock somebody has to be told about. Events are written in the transaction of the stock
+// change and sent later by the stock alert worker, so an alert is never sent for a change that was rolled back
+type StockEvent struct {
+	ID          int        `json:"id" gorm:"primaryKey;autoIncrement"`
+	ProductID   int        `json:"product_id" gorm:"not null;index"`
+	VariantID   int        `json:"variant_id" gorm:"default:0"`
+	Type        string     `json:"type" gorm:"type:varchar(20);not null"`
+	Quantity    int        `json:"quantity"`  // stock right after the change
+	Threshold   int        `json:"threshold"` // reorder threshold crossed, low stock events only
+	ProcessedAt *time.Time `json:"processed_at" gorm:"index"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// BackInStockSubscription customer waiting for a product, or one of its variants, to be in stock again. It is
+// notified once, subscribing again after that waits for the next restock. Guests confirm the subscription with
+// the token emailed to them, the same token cancels it
+type BackInStockSubscription struct {
+	ID          int        `json:"id" gorm:"primaryKey;autoIncrement"`
+	ProductID   int        `json:"product_id" gorm:"not null;uniqueIndex:idx_back_in_stock_subscriber"`
+	VariantID   int        `json:"variant_id" gorm:"default:0;uniqueIndex:idx_back_in_stock_subscriber"`
+	Email       string     `json:"email" gorm:"type:varchar(100);not null;uniqueIndex:idx_back_in_stock_subscriber"`
+	UserID      int        `json:"user_id" gorm:"default:0"` // 0 for guests
+	Token       string     `json:"-" gorm:"type:varchar(64);default:null;uniqueIndex"`
+	ConfirmedAt *time.Time `json:"confirmed_at"` // signed in customers are confirmed right away, only confirmed subscriptions are notified
+	NotifiedAt  *time.Time `json:"notified_at"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func InitStockAlertSchema() {
+	db := dbs.DB
+	hadEvents := db.Migrator().HasTable(&StockEvent{})
+	hadUnconfirmed := db.Migrator().HasTable(&BackInStockSubscription{}) && !db.Migrator().HasColumn(&BackInStockSubscription{}, "confirmed_at")
+	if err := db.AutoMigrate(&StockEvent{}, &BackInStockSubscription{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "StockEvent/BackInStockSubscription", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "StockEvent/BackInStockSubscription")
+	}
+	//subscriptions of signed in customers from before confirmation were made with the email of their account
+	if hadUnconfirmed {
+		if err := db.Model(&BackInStockSubscription{}).Where("user_id <> 0").UpdateColumn("confirmed_at", gorm.Expr("created_at")).Error; err != nil {
+			log.Fatalf(utils.DatabaseMigrationError, "BackInStockSubscription confirmation", err)
+		}
+	}
+	//in_stock was only corrected on reads before stock changes kept it up to date, it is set right once
+	if !hadEvents {
+		if err := syncAllInStock(db); err != nil {
+			log.Fatalf(utils.DatabaseMigrationError, "Product in_stock", err)
+		}
+	}
+}
+
+func syncAllInStock(db *gorm.DB) error {
+	if err := db.Model(&Product{}).Where("1 = 1").UpdateColumn("in_stock", gorm.Expr("quantity > 0")).Error; err != nil {
+		return err
+	}
+	return db.Model(&ProductVariant{}).Where("1 = 1").UpdateColumn("in_stock", gorm.Expr("quantity > 0")).Error
+}
+
+// syncInStock sets in_stock of a product or variant from its quantity, item is &Product{} or &ProductVariant{}
+func syncInStock(tx *gorm.DB, item interface{}, id int) error {
+	return tx.Model(item).Where("id = ?", id).UpdateColumn("in_stock", gorm.Expr("quantity > 0")).Error
+}
+
+// recordStockChange keeps in_stock in line with the quantity and writes the events of the change, it runs in the
+// transaction of the movement that took the stock from before to after
+func recordStockChange(tx *gorm.DB, item interface{}, itemId, productId, variantId, before, after int) error {
+	if err := syncInStock(tx, item, itemId); err != nil {
+		return err
+	}
+
+	if before <= 0 && after > 0 {
+		waiting, err := hasBackInStockSubscribers(tx, productId, variantId)
+		if err != nil {
+			return err
+		}
+		if waiting {
+			event := StockEvent{ProductID: productId, VariantID: variantId, Type: StockEventBackInStock, Quantity: after}
+			if err := tx.Create(&event).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if after < before {
+		var threshold int
+		if err := tx.Model(&Product{}).Select("reorder_threshold").Where("id = ?", productId).Scan(&threshold).Error; err != nil {
+			return err
+		}
+		//only the change crossing the threshold alerts, stock staying below it doesn't alert again
+		if threshold > 0 && before > threshold && after <= threshold {
+			event := StockEvent{ProductID: productId, VariantID: variantId, Type: StockEventLowStock, Quantity: after, Threshold: threshold}
+			if err := tx.Create(&event).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasBackInStockSubscribers(db *gorm.DB, productId, variantId int) (bool, error) {
+	var count int64
+	err := db.Model(&BackInStockSubscription{}).
+		Where("product_id = ? and variant_id = ? and confirmed_at IS NOT NULL and notified_at IS NULL", productId, variantId).Count(&count).Error
+	return count > 0, err
+}
+
+// Subscribe adds the subscription and loads it back with its token. A confirmed subscription, the one of a signed
+// in customer, waits for the next restock even after being notified. An unconfirmed one, the one of a guest,
+// changes nothing on an existing subscription until the token is confirmed
+func (s *BackInStockSubscription) Subscribe(db *gorm.DB) error {
+	s.NotifiedAt = nil
+	s.Token = utils.GenerateRandomToken()
+	updates := map[string]interface{}{"token": gorm.Expr("COALESCE(token, ?)", s.Token)}
+	if s.ConfirmedAt != nil {
+		updates["notified_at"] = nil
+		updates["user_id"] = s.UserID
+		updates["confirmed_at"] = s.ConfirmedAt
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "variant_id"}, {Name: "email"}},
+		DoUpdates: clause.Assignments(updates),
+	}).Create(s).Error
+	if err != nil {
+		return err
+	}
+	return db.Where("product_id = ? and variant_id = ? and email = ?", s.ProductID, s.VariantID, s.Email).First(s).Error
+}
+
+// ConfirmBackInStock confirms the subscription of the token, it waits for the next restock from now on.
+// gorm.ErrRecordNotFound for an unknown token
+func ConfirmBackInStock(db *gorm.DB, token string) (BackInStockSubscription, error) {
+	var subscription BackInStockSubscription
+	result := db.Model(&BackInStockSubscription{}).Where("token = ?", token).
+		Updates(map[string]interface{}{"confirmed_at": time.Now(), "notified_at": nil})
+	if result.Error != nil {
+		return subscription, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return subscription, gorm.ErrRecordNotFound
+	}
+	err := db.Where("token = ?", token).First(&subscription).Error
+	return subscription, err
+}
+
+// GetBackInStockSubscriptionByToken finds the subscription of the token on the product
+func GetBackInStockSubscriptionByToken(db *gorm.DB, productId int, token string) (BackInStockSubscription, error) {
+	var subscription BackInStockSubscription
+	err := db.Where("product_id = ? and token = ?", productId, token).First(&subscription).Error
+	return subscription, err
+}
+
+// UnsubscribeBackInStock removes the subscription of the email, reports whether there was one
+func UnsubscribeBackInStock(db *gorm.DB, productId, variantId int, email string) (bool, error) {
+	result := db.Where("product_id = ? and variant_id = ? and email = ?", productId, variantId, email).Delete(&BackInStockSubscription{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetPendingStockEvents returns the oldest events not sent yet
+func GetPendingStockEvents(db *gorm.DB, limit int) ([]StockEvent, error) {
+	var events []StockEvent
+	err := db.Where("processed_at IS NULL").Order("id").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// Claim marks the event processed before it is sent, so a failing send never leads to a second alert. It reports
+// false when another worker got the event first
+func (e *StockEvent) Claim(db *gorm.DB) (bool, error) {
+	now := time.Now()
+	result := db.Model(&StockEvent{}).Where("id = ? and processed_at IS NULL", e.ID).UpdateColumn("processed_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	e.ProcessedAt = &now
+	return result.RowsAffected > 0, nil
+}
+
+// ClaimBackInStockSubscribers returns the confirmed subscribers waiting for the item and marks them notified, each
+// subscription fires once
+func ClaimBackInStockSubscribers(db *gorm.DB, productId, variantId int) ([]BackInStockSubscription, error) {
+	var subscriptions []BackInStockSubscription
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("product_id = ? and variant_id = ? and confirmed_at IS NOT NULL and notified_at IS NULL", productId, variantId).
+			Find(&subscriptions).Error; err != nil {
+			return err
+		}
+		if len(subscriptions) == 0 {
+			return nil
+		}
+		ids := make([]int, len(subscriptions))
+		for i, subscription := range subscriptions {
+			ids[i] = subscription.ID
+		}
+		return tx.Model(&BackInStockSubscription{}).Where("id IN ?", ids).UpdateColumn("notified_at", time.Now()).Error
+	})
+	return subscriptions, err
+}
+
+// StockAlertRecipients emails of the seller of a product and of the admins, low stock alerts go to them
+func StockAlertRecipients(db *gorm.DB, sellerId int, adminRole string) ([]string, error) {
+	var recipients []string
+	err := db.Table("users").
+		Where("id = ? OR id IN (?)", sellerId, db.Table("roles").Select("user_id").Where("role = ?", adminRole)).
+		Where("is_deleted = ? and is_active = ?", false, true).
+		Distinct().Pluck("email", &recipients).Error
+	return recipients, err
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 
 	"gorm.io/gorm"
 )
@@ -15,6 +16,19 @@ type Tag struct {
 	Name string `json:"name" gorm:"unique;not null"`
 }
 
+// TagUsage tag with the number of products using it
+type TagUsage struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	ProductCount int    `json:"product_count"`
+}
+
+// tag modes of the tag filter
+const (
+	TagModeAny = "any"
+	TagModeAll = "all"
+)
+
 func NewTag() *Tag {
 	return &Tag{}
 }
@@ -46,7 +60,7 @@ func FetchTagById(db *gorm.DB, tagId int) (*Tag, error) {
 
 func GetTagsByProductId(db *gorm.DB, productId int) ([]Tag, error) {
 	var tags []Tag
-	if err := db.Select("id").Where("product_id = ?", productId).Find(&tags).Error; err != nil {
+	if err := db.Joins("JOIN product_tags ON product_tags.tag_id = tags.id").Where("product_tags.product_id = ?", productId).Find(&tags).Error; err != nil {
 		return nil, err
 	}
 	return tags, nil
@@ -56,19 +70,18 @@ func CheckAndCreateProductTags(db *gorm.DB, tags []string, pId int) ([]int, map[
 	tagErrors := make(map[string]error)
 	var tagIds []int
 
-	if len(tags) == 0 || tags == nil {
-		if pId == 0 {
+	//an empty list clears the tags, no list at all keeps them
+	if len(tags) == 0 {
+		if pId == 0 || tags != nil {
 		} else {
 			existingTags, err := GetTagsByProductId(db, pId)
 			if err != nil {
+				tagErrors[""] = fmt.Errorf(utils.TagExistError, err)
 				return []int{}, tagErrors
 			}
-			if len(existingTags) > 0 {
-				var existingTagIds []int
-				for _, tag := range existingTagIds {
-					tagIds = append(tagIds, tag)
-				}
-				return existingTagIds, tagErrors
+			//no tags sent keeps the tags of the product
+			for _, tag := range existingTags {
+				tagIds = append(tagIds, tag.ID)
 			}
 		}
 		return tagIds, tagErrors
@@ -104,7 +117,7 @@ func AddTagToProduct(db *gorm.DB, tagIds []int, productID int) []error {
 			TagID:     tagID,
 		}
 		if err := db.Create(&productTag).Error; err != nil {
-			errs = append(errs, fmt.Errorf("failed to create product[%d]-tag[%d] association: %v", tagID, productID, err))
+			errs = append(errs, fmt.Errorf("failed to create product[%d]-tag[%d] association: %v", productID, tagID, err))
 		}
 	}
 	if len(errs) > 0 {
@@ -174,3 +187,103 @@ func UpdateTagToProduct(db *gorm.DB, newTagIds []int, productID int) []error {
 
 	return errs
 }
+
+// GetTagNamesByProductIds returns the tag names of every product among ids with a single query
+func GetTagNamesByProductIds(db *gorm.DB, ids []int) (map[int][]string, error) {
+	var rows []struct {
+		ProductID int
+		Name      string
+	}
+	if err := db.Table("product_tags").Select("product_tags.product_id, tags.name").
+		Joins("JOIN tags ON tags.id = product_tags.tag_id").
+		Where("product_tags.product_id IN ?", ids).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	tags := make(map[int][]string, len(ids))
+	for _, row := range rows {
+		tags[row.ProductID] = append(tags[row.ProductID], row.Name)
+	}
+	return tags, nil
+}
+
+// normalizeTagNames trims and lowercases the tag names of a filter, duplicates and blanks are dropped
+func normalizeTagNames(tags []string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			names = append(names, tag)
+		}
+	}
+	return names
+}
+
+// productsWithTags selects the products tagged with one of the tags when any is set, with every one otherwise
+func productsWithTags(db *gorm.DB, tags []string, any bool) *gorm.DB {
+	query := db.Table("product_tags").Select("product_tags.product_id").
+		Joins("JOIN tags ON tags.id = product_tags.tag_id").
+		Where("LOWER(tags.name) IN ?", tags)
+	if any {
+		return query
+	}
+	return query.Group("product_tags.product_id").Having("COUNT(DISTINCT product_tags.tag_id) = ?", len(tags))
+}
+
+// GetTagsWithUsage lists every tag with the number of products tagged with it, deleted products are not counted
+func GetTagsWithUsage(db *gorm.DB) ([]TagUsage, error) {
+	var usage []TagUsage
+	if err := db.Table("tags").Select("tags.id, tags.name, COUNT(products.id) AS product_count").
+		Joins("LEFT JOIN product_tags ON product_tags.tag_id = tags.id").
+		Joins("LEFT JOIN products ON products.id = product_tags.product_id AND products.is_deleted = ?", false).
+		Group("tags.id, tags.name").Order("tags.name").Scan(&usage).Error; err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// GetProductIdsByTagIds returns the products tagged with one of the tags
+func GetProductIdsByTagIds(db *gorm.DB, tagIds []int) ([]int, error) {
+	var ids []int
+	if err := db.Model(&ProductTag{}).Distinct("product_id").Where("tag_id IN ?", tagIds).Pluck("product_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (t *Tag) Rename(db *gorm.DB, name string) error {
+	t.Name = name
+	return db.Model(&Tag{}).Where("id = ?", t.ID).Update("name", name).Error
+}
+
+// MergeTags moves the products of the source tags onto the target tag and removes the source tags, a product
+// already tagged with the target keeps a single association
+func MergeTags(db *gorm.DB, sourceIds []int, targetId int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		tagged := tx.Model(&ProductTag{}).Select("product_id").Where("tag_id = ?", targetId)
+		var productIds []int
+		if err := tx.Model(&ProductTag{}).Distinct("product_id").Where("tag_id IN ? AND product_id NOT IN (?)", sourceIds, tagged).Pluck("product_id", &productIds).Error; err != nil {
+			return err
+		}
+		for _, productId := range productIds {
+			if err := tx.Create(&ProductTag{ProductID: productId, TagID: targetId}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("tag_id IN ?", sourceIds).Delete(&ProductTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", sourceIds).Delete(&Tag{}).Error
+	})
+}
+
+// DeleteTag removes the tag from every product and then the tag itself
+func (t *Tag) DeleteTag(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", t.ID).Delete(&ProductTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Tag{}, t.ID).Error
+	})
+}
@@ -0,0 +1,289 @@
+package models
+
+import (
+	"e-commerce-backend/products/dbs"
+	"e-commerce-backend/shared/utils"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductOption what a product is sold in, e.g. "size" with the values "S", "M" and "L"
+type ProductOption struct {
+	ID        int      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ProductID int      `json:"product_id" gorm:"not null;index"`
+	Name      string   `json:"name" gorm:"type:varchar(50);not null"`
+	Values    []string `json:"values" gorm:"serializer:json;type:text"`
+}
+
+// ProductVariant one sellable combination of the option values of a product, it has its own stock and a price
+// which replaces the product price when set
+type ProductVariant struct {
+	ID        int                  `json:"id" gorm:"primaryKey;autoIncrement"`
+	ProductID int                  `json:"product_id" gorm:"not null;index"`
+	SKU       string               `json:"sku" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Barcode   string               `json:"barcode" gorm:"type:varchar(64);default:null"`
+	Price     float64              `json:"price" gorm:"default:0"` // 0 sells the variant at the product price
+	Quantity  int                  `json:"quantity" gorm:"not null"`
+	InStock   bool                 `json:"in_stock" gorm:"default:true"`
+	IsDeleted bool                 `json:"is_deleted" gorm:"default:false"`
+	Options   []VariantOptionValue `json:"options" gorm:"foreignKey:VariantID"`
+	Images    []VariantImage       `json:"images" gorm:"foreignKey:VariantID"`
+	CreatedAt time.Time            `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time            `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// VariantOptionValue value of one option for a variant, ProductID is kept so products can be filtered on it
+type VariantOptionValue struct {
+	ID        int    `json:"-" gorm:"primaryKey;autoIncrement"`
+	VariantID int    `json:"-" gorm:"not null;index"`
+	ProductID int    `json:"-" gorm:"not null;index:idx_variant_option_filter"`
+	Name      string `json:"name" gorm:"type:varchar(50);not null;index:idx_variant_option_filter"`
+	Value     string `json:"value" gorm:"type:varchar(100);not null;index:idx_variant_option_filter"`
+}
+
+type VariantImage struct {
+	ID        int    `json:"-" gorm:"primaryKey;autoIncrement"`
+	VariantID int    `json:"-" gorm:"not null;index"`
+	URL       string `json:"url" gorm:"type:varchar(255);not null"`
+	Position  int    `json:"position" gorm:"default:0"`
+}
+
+type ProductVariantInterface interface {
+	CreateVariant(db *gorm.DB) error
+	GetVariantById(db *gorm.DB, id int) error
+	UpdateVariant(db *gorm.DB, updatedFields map[string]interface{}, options []VariantOptionValue, images []VariantImage) error
+	DeleteVariant(db *gorm.DB) error
+	EffectivePrice(product *Product) float64
+}
+
+func InitVariantSchema() {
+	db := dbs.DB
+	if err := db.AutoMigrate(&ProductOption{}, &ProductVariant{}, &VariantOptionValue{}, &VariantImage{}); err != nil {
+		log.Fatalf(utils.DatabaseMigrationError, "ProductOption/ProductVariant", err)
+	} else {
+		log.Printf(utils.SchemaMigrationSuccess, "ProductOption/ProductVariant")
+	}
+}
+
+func GetProductOptions(db *gorm.DB, productId int) ([]ProductOption, error) {
+	var options []ProductOption
+	if err := db.Where("product_id = ?", productId).Order("id").Find(&options).Error; err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// SetProductOptions replaces the options of the product, callers check that the variants still sold fit them
+func SetProductOptions(db *gorm.DB, productId int, options []ProductOption) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id = ?", productId).Delete(&ProductOption{}).Error; err != nil {
+			return err
+		}
+		for i := range options {
+			options[i].ID = 0
+			options[i].ProductID = productId
+		}
+		if len(options) == 0 {
+			return nil
+		}
+		return tx.Create(&options).Error
+	})
+}
+
+// ValidateVariantOptions checks that values holds exactly one allowed value for every option of the product
+func ValidateVariantOptions(options []ProductOption, values map[string]string) error {
+	if len(values) != len(options) {
+		return fmt.Errorf(utils.VariantOptionsMismatch, len(options))
+	}
+	for _, option := range options {
+		value, ok := values[option.Name]
+		if !ok {
+			return fmt.Errorf(utils.VariantOptionMissing, option.Name)
+		}
+		if !slices.Contains(option.Values, value) {
+			return fmt.Errorf(utils.VariantOptionValueInvalid, value, option.Name)
+		}
+	}
+	return nil
+}
+
+// HasVariants tells whether the product is only sold through its variants
+func HasVariants(db *gorm.DB, productId int) (bool, error) {
+	var count int64
+	if err := db.Model(&ProductVariant{}).Where("product_id = ? and is_deleted = ?", productId, false).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetProductIdsWithVariants returns which of ids are sold through variants
+func GetProductIdsWithVariants(db *gorm.DB, ids []int) (map[int]bool, error) {
+	var productIds []int
+	if err := db.Model(&ProductVariant{}).Distinct("product_id").Where("product_id IN ? and is_deleted = ?", ids, false).Pluck("product_id", &productIds).Error; err != nil {
+		return nil, err
+	}
+	withVariants := make(map[int]bool, len(productIds))
+	for _, id := range productIds {
+		withVariants[id] = true
+	}
+	return withVariants, nil
+}
+
+func GetVariantsByProductId(db *gorm.DB, productId int) ([]ProductVariant, error) {
+	var variants []ProductVariant
+	if err := db.Preload("Options").Preload("Images", orderImages).Where("product_id = ? and is_deleted = ?", productId, false).Order("id").Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+func orderImages(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
+}
+
+// FindVariantByOptions returns the id of the variant of the product selling exactly these option values, 0 if
+// there is none
+func FindVariantByOptions(db *gorm.DB, productId int, values map[string]string) (int, error) {
+	variants, err := GetVariantsByProductId(db, productId)
+	if err != nil {
+		return 0, err
+	}
+	for _, variant := range variants {
+		if sameOptions(variant.OptionMap(), values) {
+			return variant.ID, nil
+		}
+	}
+	return 0, nil
+}
+
+func sameOptions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if b[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateVariant creates the variant, its quantity goes into the default warehouse as stock moved by actorId
+func (v *ProductVariant) CreateVariant(db *gorm.DB, actorId int) error {
+	quantity := v.Quantity
+	err := db.Transaction(func(tx *gorm.DB) error {
+		v.Quantity, v.InStock = 0, false
+		if err := tx.Create(&v).Error; err != nil {
+			return err
+		}
+		if err := SetStockQuantity(tx, v.ProductID, v.ID, quantity, actorId, "opening stock"); err != nil {
+			return err
+		}
+		return syncInStock(tx, &ProductVariant{}, v.ID)
+	})
+	v.Quantity, v.InStock = quantity, quantity > 0
+	return err
+}
+
+func (v *ProductVariant) GetVariantById(db *gorm.DB, id int) error {
+	return db.Preload("Options").Preload("Images", orderImages).Where("id = ? and is_deleted = ?", id, false).First(&v).Error
+}
+
+// UpdateVariant applies the changed fields, options and images replace the current ones when they are not nil.
+// A changed quantity is booked in the stock ledger as moved by actorId
+func (v *ProductVariant) UpdateVariant(db *gorm.DB, updatedFields map[string]interface{}, options []VariantOptionValue, images []VariantImage, actorId int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if quantity, ok := updatedFields["quantity"].(int); ok {
+			delete(updatedFields, "quantity")
+			if err := SetStockQuantity(tx, v.ProductID, v.ID, quantity, actorId, "quantity updated"); err != nil {
+				return err
+			}
+		}
+		if len(updatedFields) > 0 {
+			if err := tx.Model(&ProductVariant{}).Where("id = ?", v.ID).Updates(updatedFields).Error; err != nil {
+				return err
+			}
+		}
+		if options != nil {
+			if err := tx.Where("variant_id = ?", v.ID).Delete(&VariantOptionValue{}).Error; err != nil {
+				return err
+			}
+			for i := range options {
+				options[i].VariantID = v.ID
+				options[i].ProductID = v.ProductID
+			}
+			if len(options) > 0 {
+				if err := tx.Create(&options).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if images != nil {
+			if err := tx.Where("variant_id = ?", v.ID).Delete(&VariantImage{}).Error; err != nil {
+				return err
+			}
+			for i := range images {
+				images[i].VariantID = v.ID
+			}
+			if len(images) > 0 {
+				if err := tx.Create(&images).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return v.GetVariantById(tx, v.ID)
+	})
+}
+
+// DeleteVariant stops selling the variant, carts still holding it are told on validation
+func (v *ProductVariant) DeleteVariant(db *gorm.DB) error {
+	v.IsDeleted = true
+	return db.Model(&ProductVariant{}).Where("id = ?", v.ID).Update("is_deleted", true).Error
+}
+
+func (v *ProductVariant) OptionMap() map[string]string {
+	values := make(map[string]string, len(v.Options))
+	for _, option := range v.Options {
+		values[option.Name] = option.Value
+	}
+	return values
+}
+
+// Title joins the option values in option order, e.g. "M / Red"
+func (v *ProductVariant) Title() string {
+	values := make([]string, 0, len(v.Options))
+	for _, option := range v.Options {
+		values = append(values, option.Value)
+	}
+	return strings.Join(values, " / ")
+}
+
+func (v *ProductVariant) EffectivePrice(product *Product) float64 {
+	if v.Price > 0 {
+		return v.Price
+	}
+	return product.Price
+}
+
+// GetAvailableQuantity is the stock of the variant which can still be reserved
+func (v *ProductVariant) GetAvailableQuantity(db *gorm.DB) (int, error) {
+	reserved, err := GetVariantReservedQuantity(db, v.ID, "")
+	if err != nil {
+		return 0, err
+	}
+	return max(v.Quantity-reserved, 0), nil
+}
+
+// SKUExists tells whether another variant already uses the sku, deleted variants keep their sku
+func SKUExists(db *gorm.DB, sku string, excludeId int) (bool, error) {
+	var count int64
+	if err := db.Model(&ProductVariant{}).Where("sku = ? and id <> ?", sku, excludeId).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
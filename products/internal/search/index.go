@@ -0,0 +1,388 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// field weights of BM25F, a term in the name counts three times a term of the description
+const (
+	nameWeight        = 3.0
+	tagWeight         = 2.0
+	categoryWeight    = 1.5
+	descriptionWeight = 1.0
+
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// synonymScore and typoScore scale the score of terms matched through a synonym or with typos
+	synonymScore = 0.8
+	typoScore    = 0.5
+)
+
+// Document what the index knows about one product
+type Document struct {
+	ID          int
+	Name        string
+	Description string
+	Category    string
+	Tags        []string
+	Price       float64
+	Rating      float64
+}
+
+type indexedDocument struct {
+	Document
+	length float64  // weighted number of terms
+	terms  []string // terms the document is posted under
+}
+
+// Index inverted index of the products held in memory, it is safe for concurrent use
+type Index struct {
+	mu          sync.RWMutex
+	docs        map[int]*indexedDocument
+	postings    map[string]map[int]float64 // term -> product id -> weighted term frequency
+	totalLength float64
+	synonyms    map[string][]string
+}
+
+func NewIndex(synonyms [][]string) *Index {
+	idx := &Index{
+		docs:     map[int]*indexedDocument{},
+		postings: map[string]map[int]float64{},
+		synonyms: map[string][]string{},
+	}
+	for _, group := range synonyms {
+		for _, word := range group {
+			term := Stem(strings.ToLower(word))
+			for _, other := range group {
+				if other != word {
+					idx.synonyms[term] = append(idx.synonyms[term], Stem(strings.ToLower(other)))
+				}
+			}
+		}
+	}
+	return idx
+}
+
+// Rebuild replaces the whole content of the index
+func (idx *Index) Rebuild(docs []Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.docs = make(map[int]*indexedDocument, len(docs))
+	idx.postings = map[string]map[int]float64{}
+	idx.totalLength = 0
+	for _, doc := range docs {
+		idx.add(doc)
+	}
+}
+
+// Upsert indexes the product, replacing what was indexed for it before
+func (idx *Index) Upsert(doc Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(doc.ID)
+	idx.add(doc)
+}
+
+func (idx *Index) Remove(id int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+}
+
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.docs)
+}
+
+func (idx *Index) add(doc Document) {
+	frequencies := map[string]float64{}
+	addField := func(text string, weight float64) {
+		for _, term := range Tokenize(text) {
+			frequencies[term] += weight
+		}
+	}
+	addField(doc.Name, nameWeight)
+	addField(doc.Description, descriptionWeight)
+	addField(doc.Category, categoryWeight)
+	addField(strings.Join(doc.Tags, " "), tagWeight)
+
+	indexed := &indexedDocument{Document: doc}
+	for term, frequency := range frequencies {
+		if idx.postings[term] == nil {
+			idx.postings[term] = map[int]float64{}
+		}
+		idx.postings[term][doc.ID] = frequency
+		indexed.length += frequency
+		indexed.terms = append(indexed.terms, term)
+	}
+	idx.docs[doc.ID] = indexed
+	idx.totalLength += indexed.length
+}
+
+func (idx *Index) remove(id int) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range doc.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLength -= doc.length
+	delete(idx.docs, id)
+}
+
+// Query what to search for, the filters narrow the matches before facets are counted
+type Query struct {
+	Text      string
+	Category  string
+	Tags      []string
+	MinPrice  float64
+	MaxPrice  float64
+	MinRating float64
+	Limit     int
+	Offset    int
+}
+
+type Hit struct {
+	ID    int     `json:"id"`
+	Score float64 `json:"score"`
+}
+
+// FacetCount number of matching products sharing a value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type Facets struct {
+	Categories []FacetCount `json:"categories"`
+	Tags       []FacetCount `json:"tags"`
+	Prices     []FacetCount `json:"prices"`
+	Ratings    []FacetCount `json:"ratings"`
+}
+
+type Result struct {
+	Hits   []Hit  `json:"hits"`
+	Total  int    `json:"total"`
+	Facets Facets `json:"facets"`
+}
+
+// priceBuckets upper bounds of the price facet, the last bucket has none
+var priceBuckets = []struct {
+	label string
+	upper float64
+}{
+	{"0-25", 25}, {"25-50", 50}, {"50-100", 100}, {"100-250", 250}, {"250+", math.Inf(1)},
+}
+
+// ratingBuckets minimum ratings of the rating facet, a product rated 4.5 is counted in each of them
+var ratingBuckets = []float64{4, 3, 2, 1}
+
+// expandedTerm a term to look up with the factor of how it relates to the query term
+type expandedTerm struct {
+	term   string
+	factor float64
+}
+
+// expand looks up the indexed terms a query term stands for: itself, its synonyms and, when neither is
+// indexed, the indexed terms within typo distance
+func (idx *Index) expand(term string) []expandedTerm {
+	var terms []expandedTerm
+	if _, ok := idx.postings[term]; ok {
+		terms = append(terms, expandedTerm{term, 1})
+	}
+	for _, synonym := range idx.synonyms[term] {
+		if _, ok := idx.postings[synonym]; ok {
+			terms = append(terms, expandedTerm{synonym, synonymScore})
+		}
+	}
+	if len(terms) > 0 {
+		return terms
+	}
+	if distance := typoDistance(term); distance > 0 {
+		for indexed := range idx.postings {
+			if withinDistance(term, indexed, distance) {
+				terms = append(terms, expandedTerm{indexed, typoScore})
+			}
+		}
+	}
+	return terms
+}
+
+// Search ranks the products matching the query with BM25, every query term has to match a product either
+// directly, through a synonym or with typos. An empty text matches every product
+func (idx *Index) Search(q Query) Result {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	scores := map[int]float64{}
+	terms := Tokenize(q.Text)
+	if len(terms) == 0 {
+		for id := range idx.docs {
+			scores[id] = 0
+		}
+	}
+
+	n := float64(len(idx.docs))
+	avgLength := 1.0
+	if n > 0 && idx.totalLength > 0 {
+		avgLength = idx.totalLength / n
+	}
+	for i, term := range terms {
+		termScores := map[int]float64{}
+		for _, expanded := range idx.expand(term) {
+			postings := idx.postings[expanded.term]
+			df := float64(len(postings))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			for id, frequency := range postings {
+				length := idx.docs[id].length
+				score := idf * frequency * (bm25K1 + 1) / (frequency + bm25K1*(1-bm25B+bm25B*length/avgLength))
+				termScores[id] = max(termScores[id], score*expanded.factor)
+			}
+		}
+		//products missing a term drop out
+		if i == 0 {
+			scores = termScores
+			continue
+		}
+		for id := range scores {
+			if score, ok := termScores[id]; ok {
+				scores[id] += score
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	var hits []Hit
+	facets := newFacetCounter()
+	for id, score := range scores {
+		doc := idx.docs[id]
+		if !q.matches(doc) {
+			continue
+		}
+		hits = append(hits, Hit{ID: id, Score: math.Round(score*1000) / 1000})
+		facets.add(doc)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+
+	result := Result{Total: len(hits), Facets: facets.facets(), Hits: []Hit{}}
+	if q.Offset < len(hits) {
+		hits = hits[q.Offset:]
+		if q.Limit > 0 && q.Limit < len(hits) {
+			hits = hits[:q.Limit]
+		}
+		result.Hits = hits
+	}
+	return result
+}
+
+func (q Query) matches(doc *indexedDocument) bool {
+	if q.Category != "" && !strings.EqualFold(doc.Category, q.Category) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		found := false
+		for _, docTag := range doc.Tags {
+			if strings.EqualFold(docTag, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.MinPrice > 0 && doc.Price < q.MinPrice {
+		return false
+	}
+	if q.MaxPrice > 0 && doc.Price > q.MaxPrice {
+		return false
+	}
+	return doc.Rating >= q.MinRating
+}
+
+type facetCounter struct {
+	categories map[string]int
+	tags       map[string]int
+	prices     []int
+	ratings    []int
+}
+
+func newFacetCounter() *facetCounter {
+	return &facetCounter{
+		categories: map[string]int{},
+		tags:       map[string]int{},
+		prices:     make([]int, len(priceBuckets)),
+		ratings:    make([]int, len(ratingBuckets)),
+	}
+}
+
+func (f *facetCounter) add(doc *indexedDocument) {
+	if doc.Category != "" {
+		f.categories[doc.Category]++
+	}
+	for _, tag := range doc.Tags {
+		f.tags[tag]++
+	}
+	for i, bucket := range priceBuckets {
+		if doc.Price < bucket.upper {
+			f.prices[i]++
+			break
+		}
+	}
+	for i, minimum := range ratingBuckets {
+		if doc.Rating >= minimum {
+			f.ratings[i]++
+		}
+	}
+}
+
+func (f *facetCounter) facets() Facets {
+	facets := Facets{
+		Categories: sortedCounts(f.categories),
+		Tags:       sortedCounts(f.tags),
+		Prices:     []FacetCount{},
+		Ratings:    []FacetCount{},
+	}
+	for i, bucket := range priceBuckets {
+		facets.Prices = append(facets.Prices, FacetCount{Value: bucket.label, Count: f.prices[i]})
+	}
+	for i, minimum := range ratingBuckets {
+		facets.Ratings = append(facets.Ratings, FacetCount{Value: strconv.FormatFloat(minimum, 'f', -1, 64) + "+", Count: f.ratings[i]})
+	}
+	return facets
+}
+
+// sortedCounts orders the values of a facet by count, ties by value
+func sortedCounts(counts map[string]int) []FacetCount {
+	facet := make([]FacetCount, 0, len(counts))
+	for value, count := range counts {
+		facet = append(facet, FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(facet, func(i, j int) bool {
+		if facet[i].Count != facet[j].Count {
+			return facet[i].Count > facet[j].Count
+		}
+		return facet[i].Value < facet[j].Value
+	})
+	return facet
+}
@@ -0,0 +1,115 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopWords are left out of the index and of queries, they match nearly every product
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"the": true, "to": true, "with": true,
+}
+
+// DefaultSynonyms terms searched together, a query for one also matches products using the others
+var DefaultSynonyms = [][]string{
+	{"tv", "television"},
+	{"phone", "smartphone", "mobile", "cellphone"},
+	{"laptop", "notebook"},
+	{"sofa", "couch"},
+	{"tshirt", "tee"},
+	{"sneaker", "trainer"},
+	{"headphone", "headset", "earphone"},
+	{"fridge", "refrigerator"},
+}
+
+// Tokenize lowercases text and splits it into stemmed terms, stop words are dropped
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if stopWords[word] {
+			continue
+		}
+		terms = append(terms, Stem(word))
+	}
+	return terms
+}
+
+// Stem strips common english suffixes so "shoes", "shoe" and "running", "run" meet on one term. It is a light
+// stemmer, words of three letters or fewer and numbers are kept as they are
+func Stem(word string) string {
+	if len(word) <= 3 || unicode.IsDigit(rune(word[0])) {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "sses"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"):
+		return word
+	case strings.HasSuffix(word, "ing") && len(word) > 5:
+		return undouble(word[:len(word)-3])
+	case strings.HasSuffix(word, "ed") && len(word) > 4:
+		return undouble(word[:len(word)-2])
+	case strings.HasSuffix(word, "es") && len(word) > 4 && strings.ContainsAny(word[len(word)-3:len(word)-2], "sxz"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "s"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// undouble turns "runn" back into "run" once "ing" is stripped from "running"
+func undouble(stem string) string {
+	n := len(stem)
+	if n >= 3 && stem[n-1] == stem[n-2] && !strings.ContainsRune("lsz", rune(stem[n-1])) {
+		return stem[:n-1]
+	}
+	return stem
+}
+
+// typoDistance is how many edits a query term may be away from an indexed term, short terms have to match
+func typoDistance(term string) int {
+	switch {
+	case len(term) >= 8:
+		return 2
+	case len(term) >= 4:
+		return 1
+	}
+	return 0
+}
+
+// withinDistance tells whether the edit distance of a and b is at most max, it gives up as soon as a row of
+// the distance table is above max
+func withinDistance(a, b string, max int) bool {
+	if diff := len(a) - len(b); diff > max || -diff > max {
+		return false
+	}
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > max {
+			return false
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)] <= max
+}
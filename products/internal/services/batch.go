@@ -0,0 +1,104 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/constants"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// parseProductIds reads the comma separated ids query param, duplicates are dropped
+func parseProductIds(raw string) ([]int, error) {
+	var ids []int
+	seen := map[int]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil || id <= 0 {
+			return nil, errors.New(utils.InvalidProductIDError)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New(utils.ProductBatchIdsRequired)
+	}
+	if len(ids) > constants.MaxBatchProductIds {
+		return nil, fmt.Errorf(utils.ProductBatchSizeExceeded, constants.MaxBatchProductIds)
+	}
+	return ids, nil
+}
+
+// GetProductsBatch returns the cart view of several products in one round trip (GET /product/batch?ids=1,2,3),
+// ids which are unknown or deleted are reported per id instead of failing the request, deleted ids are also listed
+// in Deleted so callers can tell them apart from unknown ones
+func (db *Service) GetProductsBatch(w http.ResponseWriter, r *http.Request) {
+	ids, err := parseProductIds(r.URL.Query().Get("ids"))
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	products, err := models.GetProductsByIds(db.DB, ids)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+
+	reserved, err := models.GetReservedQuantities(db.DB, ids)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+
+	deleted, err := models.GetDeletedProductIds(db.DB, ids)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+
+	withVariants, err := models.GetProductIdsWithVariants(db.DB, ids)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := payloads.ProductBatchResponse{
+		Products: make(map[int]map[string]interface{}, len(products)),
+		Errors:   map[int]string{},
+		Deleted:  deleted,
+	}
+	for _, id := range deleted {
+		resp.Errors[id] = fmt.Sprintf(utils.ProductDeletedError, id)
+	}
+	for i := range products {
+		var productResp payloads.ProductResponse
+		if err := models.CopyStructIntoStruct(&products[i], &productResp); err != nil {
+			resp.Errors[products[i].ID] = err.Error()
+			continue
+		}
+		products[i].SetPricing(&productResp)
+		available := max(products[i].Quantity-reserved[products[i].ID], 0)
+		resp.Products[products[i].ID] = toCartProduct(&productResp, available)
+		resp.Products[products[i].ID]["has_variants"] = withVariants[products[i].ID]
+	}
+	for _, id := range ids {
+		if _, ok := resp.Products[id]; !ok {
+			if _, failed := resp.Errors[id]; !failed {
+				resp.Errors[id] = fmt.Sprintf(utils.ProductNotFoundError, id)
+			}
+		}
+	}
+
+	utils.JsonResponse(resp, w, fmt.Sprintf(utils.ProductsBatchFetched, len(resp.Products), len(resp.Errors)), http.StatusOK)
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+type BundleService interface {
+	CreateBundle(w http.ResponseWriter, r *http.Request)
+	GetBundleById(w http.ResponseWriter, r *http.Request)
+	DeleteBundle(w http.ResponseWriter, r *http.Request)
+	ReserveBundle(w http.ResponseWriter, r *http.Request)
+}
+
+// toCartBundle is the bundle view used by the cart and order services, it carries the same keys as a cart
+// product so a bundle line is priced like any other line
+func toCartBundle(bundle *models.ProductBundle, onHand, available int) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                 bundle.ID,
+		"name":               bundle.Name,
+		"description":        bundle.Description,
+		"price":              bundle.Price,
+		"quantity":           onHand,
+		"available_quantity": available,
+		"discount":           0.0,
+		"is_active":          bundle.IsActive,
+		"is_bundle":          true,
+		"items":              bundle.Items,
+	}
+}
+
+func validateBundleRequest(db *gorm.DB, req payloads.BundleRequest) error {
+	if req.Name == "" || req.Price <= 0 || len(req.Items) == 0 {
+		return errors.New(utils.InvalidBundleDataError)
+	}
+	for _, item := range req.Items {
+		if item.ProductID <= 0 || item.Quantity <= 0 {
+			return errors.New(utils.InvalidBundleDataError)
+		}
+		var product models.Product
+		if err := product.CheckProductExistsById(db, item.ProductID); err != nil {
+			return fmt.Errorf(utils.BundleProductNotFound, item.ProductID)
+		}
+		//bundles hold product stock, a product sold in variants has none
+		if hasVariants, err := models.HasVariants(db, item.ProductID); err != nil || hasVariants {
+			return fmt.Errorf(utils.ProductRequiresVariant, item.ProductID)
+		}
+	}
+	return nil
+}
+
+// CreateBundle adds a bundle of existing products (POST /product/bundles), admin only
+func (db *Service) CreateBundle(w http.ResponseWriter, r *http.Request) {
+	var req payloads.BundleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if err := validateBundleRequest(db.DB, req); err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	bundle := models.ProductBundle{Name: req.Name, Description: req.Description, Price: req.Price}
+	for _, item := range req.Items {
+		bundle.Items = append(bundle.Items, models.ProductBundleItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+	if err := bundle.CreateBundle(db.DB); err != nil {
+		utils.JsonError(w, utils.BundleCreationError, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(bundle, w, fmt.Sprintf(utils.BundleCreated, bundle.ID), http.StatusCreated)
+}
+
+// GetBundleById returns the cart view of the bundle (GET /product/bundle/{id}), inactive bundles are still
+// served so carts holding them can tell the shopper
+func (db *Service) GetBundleById(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidBundleIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var bundle models.ProductBundle
+	if err := bundle.GetBundleById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.BundleNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+
+	onHand, available, err := bundle.GetStock(db.DB)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(toCartBundle(&bundle, onHand, available), w, fmt.Sprintf(utils.BundleFetched, id), http.StatusOK)
+}
+
+// DeleteBundle stops selling the bundle (DELETE /product/bundle/{id}), admin only
+func (db *Service) DeleteBundle(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidBundleIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var bundle models.ProductBundle
+	if err := bundle.GetBundleById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.BundleNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+	if err := bundle.Deactivate(db.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.BundleDeletionError, id), http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.BundleDeleted, id), http.StatusOK)
+}
+
+// ReserveBundle holds the products of the bundle for a reference (POST /product/bundle/{id}/reserve), quantity
+// is in bundles and 0 releases the hold
+func (db *Service) ReserveBundle(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidBundleIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	req, err := decodeReservationRequest(r)
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Quantity == 0 {
+		released, err := models.ReleaseReservations(db.DB, []string{req.Reference})
+		if err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.ReservationReleaseError, req.Reference), http.StatusInternalServerError, err)
+			return
+		}
+		utils.JsonResponse(nil, w, fmt.Sprintf(utils.ReservationsReleased, released), http.StatusOK)
+		return
+	}
+
+	var bundle models.ProductBundle
+	if err := bundle.GetBundleById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.BundleNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+	if !bundle.IsActive {
+		utils.JsonError(w, fmt.Sprintf(utils.BundleInactiveError, id), http.StatusConflict, nil)
+		return
+	}
+
+	if err := bundle.Reserve(db.DB, req.Reference, req.Quantity, reservationTTL(req.TTLSeconds)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.JsonError(w, fmt.Sprintf(utils.BundleInactiveError, id), http.StatusConflict, err)
+			return
+		}
+		utils.JsonError(w, fmt.Sprintf(utils.BundleReservationFailed, id), http.StatusConflict, err)
+		return
+	}
+
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.BundleStockReserved, id), http.StatusOK)
+}
@@ -0,0 +1,524 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/catalog"
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/constants"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/middlewares"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+type CatalogService interface {
+	ImportProducts(w http.ResponseWriter, r *http.Request)
+	GetImportJob(w http.ResponseWriter, r *http.Request)
+	ExportProducts(w http.ResponseWriter, r *http.Request)
+}
+
+type rowOutcome int
+
+const (
+	rowFailed rowOutcome = iota
+	rowCreated
+	rowUpdated
+	rowUnchanged
+)
+
+// catalogImport state of one import job while its rows are applied
+type catalogImport struct {
+	db      *gorm.DB
+	job     *models.ImportJob
+	isAdmin bool
+	sellers map[int]error  // result of the seller check of each seller_id met
+	skus    map[string]int // row each sku was first met on
+}
+
+func (ci *catalogImport) rowError(row catalog.Row, sku, field, message string) []models.ImportRowError {
+	return []models.ImportRowError{{Row: row.Number, SKU: sku, Field: field, Message: message}}
+}
+
+// seller is the seller of a row, a seller_id other than the one of the job needs an admin like on AddProduct
+func (ci *catalogImport) seller(requested int) (int, error) {
+	if requested == 0 || requested == ci.job.SellerID {
+		return ci.job.SellerID, nil
+	}
+	if !ci.isAdmin {
+		return 0, errors.New(utils.ProductSellerForbidden)
+	}
+	checkErr, checked := ci.sellers[requested]
+	if !checked {
+		_, checkErr = checkSeller(ci.db, requested)
+		ci.sellers[requested] = checkErr
+	}
+	return requested, checkErr
+}
+
+// importRow validates the row and, unless the job is a dry run, creates or updates the product of its sku
+func (ci *catalogImport) importRow(row catalog.Row) (int, rowOutcome, []models.ImportRowError) {
+	if row.Err != nil {
+		return 0, rowFailed, ci.rowError(row, "", "", row.Err.Error())
+	}
+	req, fieldErrors := row.Request()
+	sku := req.SKU
+	if sku == "" {
+		return 0, rowFailed, ci.rowError(row, "", "sku", utils.CatalogSKURequired)
+	}
+	if len(sku) > constants.MaxSKULength {
+		return 0, rowFailed, ci.rowError(row, "", "sku", fmt.Sprintf(utils.InvalidCatalogValue, sku))
+	}
+	if first, ok := ci.skus[sku]; ok {
+		return 0, rowFailed, ci.rowError(row, sku, "sku", fmt.Sprintf(utils.DuplicateCatalogSKU, sku, first))
+	}
+	ci.skus[sku] = row.Number
+	if len(fieldErrors) > 0 {
+		rowErrors := make([]models.ImportRowError, 0, len(fieldErrors))
+		for _, fieldError := range fieldErrors {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row.Number, SKU: sku, Field: fieldError.Field, Message: fieldError.Message})
+		}
+		return 0, rowFailed, rowErrors
+	}
+
+	sellerId, err := ci.seller(req.SellerID)
+	if err != nil {
+		return 0, rowFailed, ci.rowError(row, sku, "seller_id", err.Error())
+	}
+	if err := resolveProductCategory(ci.db, &req); err != nil {
+		return 0, rowFailed, ci.rowError(row, sku, "category", err.Error())
+	}
+
+	var existing models.Product
+	err = existing.GetProductBySKU(ci.db, sku)
+	switch {
+	case err == nil:
+		if existing.IsDeleted {
+			return 0, rowFailed, ci.rowError(row, sku, "sku", fmt.Sprintf(utils.ProductSKUDeleted, sku))
+		}
+		if existing.SellerID != ci.job.SellerID && !ci.isAdmin {
+			return 0, rowFailed, ci.rowError(row, sku, "sku", fmt.Sprintf(utils.ProductNotOwned, existing.ID))
+		}
+		if req.SellerID == 0 {
+			sellerId = existing.SellerID
+		}
+		return ci.updateProduct(row, existing, req, sellerId)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ci.createProduct(row, req, sellerId)
+	}
+	return 0, rowFailed, ci.rowError(row, sku, "", utils.DatabaseConnectionError)
+}
+
+func (ci *catalogImport) checkName(row catalog.Row, sku, name string, excludeId int) []models.ImportRowError {
+	taken, err := models.ProductNameExists(ci.db, name, excludeId)
+	if err != nil {
+		return ci.rowError(row, sku, "", utils.DatabaseConnectionError)
+	}
+	if taken {
+		return ci.rowError(row, sku, "name", fmt.Sprintf(utils.ProductNameTaken, name))
+	}
+	return nil
+}
+
+func (ci *catalogImport) createProduct(row catalog.Row, req payloads.ProductRequest, sellerId int) (int, rowOutcome, []models.ImportRowError) {
+	if req.PName == "" {
+		return 0, rowFailed, ci.rowError(row, req.SKU, "name", utils.CatalogFieldRequired)
+	}
+	if req.Price == 0 {
+		return 0, rowFailed, ci.rowError(row, req.SKU, "price", utils.CatalogFieldRequired)
+	}
+	if rowErrors := ci.checkName(row, req.SKU, req.PName, 0); rowErrors != nil {
+		return 0, rowFailed, rowErrors
+	}
+	var product models.Product
+	if err := models.CopyStructIntoStruct(&req, &product); err != nil {
+		return 0, rowFailed, ci.rowError(row, req.SKU, "", utils.InvalidProductDataError)
+	}
+	product.SellerID = sellerId
+	if err := product.ValidateQuantityRules(); err != nil {
+		return 0, rowFailed, ci.rowError(row, req.SKU, "", err.Error())
+	}
+	if ci.job.DryRun {
+		return 0, rowCreated, nil
+	}
+
+	err := ci.db.Transaction(func(tx *gorm.DB) error {
+		id, err := product.AddProduct(tx, ci.job.UserID)
+		if err != nil {
+			return err
+		}
+		return setImportedTags(tx, req.Tags, id, true)
+	})
+	if err != nil {
+		return 0, rowFailed, ci.rowError(row, req.SKU, "", utils.ImportRowWriteError)
+	}
+	return product.ID, rowCreated, nil
+}
+
+func (ci *catalogImport) updateProduct(row catalog.Row, existing models.Product, req payloads.ProductRequest, sellerId int) (int, rowOutcome, []models.ImportRowError) {
+	merged := existing
+	if err := models.CopyStructIntoStruct(&req, &merged); err != nil {
+		return 0, rowFailed, ci.rowError(row, req.SKU, "", utils.InvalidProductDataError)
+	}
+	if err := merged.ValidateQuantityRules(); err != nil {
+		return 0, rowFailed, ci.rowError(row, req.SKU, "", err.Error())
+	}
+	if req.PName != "" && req.PName != existing.PName {
+		if rowErrors := ci.checkName(row, req.SKU, req.PName, existing.ID); rowErrors != nil {
+			return 0, rowFailed, rowErrors
+		}
+	}
+
+	updatedFields := trackUpdatedProductFields(existing, req)
+	if sellerId != existing.SellerID {
+		updatedFields["SellerID"] = sellerId
+	}
+	tagsChanged, err := importedTagsChanged(ci.db, req.Tags, existing.ID)
+	if err != nil {
+		return 0, rowFailed, ci.rowError(row, req.SKU, "", utils.DatabaseConnectionError)
+	}
+	if len(updatedFields) == 0 && !tagsChanged {
+		return existing.ID, rowUnchanged, nil
+	}
+	if ci.job.DryRun {
+		return 0, rowUpdated, nil
+	}
+
+	err = ci.db.Transaction(func(tx *gorm.DB) error {
+		if len(updatedFields) > 0 {
+			if err := existing.UpdateProduct(tx, existing.ID, updatedFields, ci.job.UserID); err != nil {
+				return err
+			}
+		}
+		if tagsChanged {
+			return setImportedTags(tx, req.Tags, existing.ID, false)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, rowFailed, ci.rowError(row, req.SKU, "", utils.ImportRowWriteError)
+	}
+	return existing.ID, rowUpdated, nil
+}
+
+// importedTagsChanged tells whether the tags of the row differ from the ones of the product, a row without a
+// tags column keeps them
+func importedTagsChanged(db *gorm.DB, tags []string, productId int) (bool, error) {
+	if tags == nil {
+		return false, nil
+	}
+	current, err := models.GetTagNamesByProductIds(db, []int{productId})
+	if err != nil {
+		return false, err
+	}
+	have := map[string]bool{}
+	for _, name := range current[productId] {
+		have[name] = true
+	}
+	want := map[string]bool{}
+	for _, name := range tags {
+		want[name] = true
+	}
+	if len(have) != len(want) {
+		return true, nil
+	}
+	for name := range want {
+		if !have[name] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// setImportedTags resolves the tags like AddProduct and UpdateProduct do, creating the missing ones
+func setImportedTags(tx *gorm.DB, tags []string, productId int, created bool) error {
+	if created && len(tags) == 0 {
+		return nil
+	}
+	tagIds, tagErrors := models.CheckAndCreateProductTags(tx, tags, productId)
+	if len(tagErrors) > 0 {
+		return errors.New(utils.TagCreationFailed)
+	}
+	var errs []error
+	if created {
+		errs = models.AddTagToProduct(tx, tagIds, productId)
+	} else {
+		errs = models.UpdateTagToProduct(tx, tagIds, productId)
+	}
+	if len(errs) > 0 {
+		return errors.New(utils.ErrorsToString(errs))
+	}
+	return nil
+}
+
+// saveProgress stores the counts and row errors of the job and brings the search index up to date with the
+// products written since the last save
+func (ci *catalogImport) saveProgress(rowErrors []models.ImportRowError, written []int) {
+	if err := ci.job.SaveProgress(ci.db, rowErrors); err != nil {
+		utils.LogError(fmt.Sprintf(utils.ImportJobFailed, ci.job.ID), map[string]interface{}{"error": err.Error()})
+	}
+	if len(written) > 0 {
+		indexProducts(ci.db, written...)
+	}
+}
+
+// runImport applies the rows of the job one after the other, a failing row is reported and skipped so the
+// other rows still go in
+func (db *Service) runImport(job *models.ImportJob, rows []catalog.Row, isAdmin bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			utils.LogError(fmt.Sprintf(utils.ImportJobFailed, job.ID), map[string]interface{}{"error": fmt.Sprint(recovered)})
+			if err := job.Finish(db.DB, models.ImportStatusFailed, utils.InternalServerError); err != nil {
+				utils.LogError(fmt.Sprintf(utils.ImportJobFailed, job.ID), map[string]interface{}{"error": err.Error()})
+			}
+		}
+	}()
+	if err := job.Start(db.DB); err != nil {
+		utils.LogError(fmt.Sprintf(utils.ImportJobFailed, job.ID), map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	ci := &catalogImport{db: db.DB, job: job, isAdmin: isAdmin, sellers: map[int]error{}, skus: map[string]int{}}
+	var rowErrors []models.ImportRowError
+	var written []int
+	stored := 0
+	for i, row := range rows {
+		id, outcome, errs := ci.importRow(row)
+		switch outcome {
+		case rowCreated:
+			job.Created++
+		case rowUpdated:
+			job.Updated++
+		case rowUnchanged:
+			job.Unchanged++
+		default:
+			job.Failed++
+			if stored < constants.MaxImportRowErrors {
+				errs = errs[:min(len(errs), constants.MaxImportRowErrors-stored)]
+				rowErrors = append(rowErrors, errs...)
+				stored += len(errs)
+			}
+		}
+		if id > 0 && outcome != rowUnchanged {
+			written = append(written, id)
+		}
+		job.ProcessedRows++
+
+		if (i+1)%constants.ImportProgressEvery == 0 {
+			ci.saveProgress(rowErrors, written)
+			rowErrors, written = nil, nil
+		}
+	}
+	ci.saveProgress(rowErrors, written)
+	if err := job.Finish(db.DB, models.ImportStatusCompleted, ""); err != nil {
+		utils.LogError(fmt.Sprintf(utils.ImportJobFailed, job.ID), map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// ImportProducts starts an import of the catalog sent in the file field of a multipart form (POST /product/import).
+// The format comes from the format field or the file extension, mapping is a JSON object renaming the columns of
+// the file to ours and dry_run only reports what the import would do. Rows are matched with products by sku, the
+// file is read right away and the rows are applied in the background, follow the job at GET /product/import/{id}
+func (db *Service) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, constants.MaxImportBytes)
+	if err := r.ParseMultipartForm(constants.MaxImportMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.JsonError(w, fmt.Sprintf(utils.CatalogTooLarge, constants.MaxImportBytes), http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		utils.JsonError(w, utils.InvalidMultipartForm, http.StatusBadRequest, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.JsonError(w, utils.CatalogFileRequired, http.StatusBadRequest, err)
+		return
+	}
+	defer file.Close()
+
+	format, err := catalog.ParseFormat(r.FormValue("format"), header.Filename)
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	mapping := map[string]string{}
+	if value := r.FormValue("mapping"); value != "" {
+		if err := json.Unmarshal([]byte(value), &mapping); err != nil {
+			utils.JsonError(w, utils.InvalidColumnMapping, http.StatusBadRequest, err)
+			return
+		}
+	}
+	dryRun := false
+	if value := r.FormValue("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.InvalidCatalogValue, value), http.StatusBadRequest, err)
+			return
+		}
+	}
+	requestedSeller := 0
+	if value := r.FormValue("seller_id"); value != "" {
+		if requestedSeller, err = strconv.Atoi(value); err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.InvalidCatalogValue, value), http.StatusBadRequest, err)
+			return
+		}
+	}
+	sellerId, status, err := db.resolveProductSeller(r, requestedSeller)
+	if err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+	userId := utils.GetUserIdFromContext(r)
+	isAdmin, err := middlewares.HasRole(db.DB, userId, constants.AdminRole)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.SellerCheckFailed, userId), http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := catalog.Read(file, format, mapping, constants.MaxImportRows)
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	job := models.ImportJob{
+		UserID:    userId,
+		SellerID:  sellerId,
+		FileName:  header.Filename,
+		Format:    format,
+		DryRun:    dryRun,
+		TotalRows: len(rows),
+		Errors:    []models.ImportRowError{},
+	}
+	if err := job.CreateImportJob(db.DB); err != nil {
+		utils.JsonError(w, utils.ImportJobCreationError, http.StatusInternalServerError, err)
+		return
+	}
+	//the job runs on its own copy, the response is written from this one
+	running := job
+	go db.runImport(&running, rows, isAdmin)
+
+	utils.JsonResponse(job, w, fmt.Sprintf(utils.ImportJobStarted, job.ID, job.ID), http.StatusAccepted)
+}
+
+// GetImportJob returns the progress and the row errors of an import (GET /product/import/{id}), to the user who
+// started it or an admin
+func (db *Service) GetImportJob(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidImportJobID, http.StatusBadRequest, err)
+		return
+	}
+	var job models.ImportJob
+	if err := job.GetImportJobById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ImportJobNotFound, id), http.StatusNotFound, err)
+		return
+	}
+
+	userId := utils.GetUserIdFromContext(r)
+	if job.UserID != userId {
+		isAdmin, err := middlewares.HasRole(db.DB, userId, constants.AdminRole)
+		if err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.SellerCheckFailed, userId), http.StatusInternalServerError, err)
+			return
+		}
+		if !isAdmin {
+			utils.JsonError(w, fmt.Sprintf(utils.ImportJobNotOwned, id), http.StatusForbidden, nil)
+			return
+		}
+	}
+	utils.JsonResponse(job, w, fmt.Sprintf(utils.ImportJobFetched, id), http.StatusOK)
+}
+
+func exportRecord(product models.Product, tags []string) catalog.Record {
+	sort.Strings(tags)
+	return catalog.Record{
+		SKU:                product.SKU,
+		SellerID:           product.SellerID,
+		Name:               product.PName,
+		Description:        product.PDesc,
+		Price:              product.Price,
+		Quantity:           product.Quantity,
+		Discount:           product.Discount,
+		Category:           product.Category,
+		CategoryID:         product.CategoryID,
+		Tags:               tags,
+		MinOrderQty:        product.MinOrderQty,
+		MaxOrderQty:        product.MaxOrderQty,
+		QuantityStep:       product.QuantityStep,
+		MaxPerCustomer:     product.MaxPerCustomer,
+		PurchaseWindowDays: product.PurchaseWindowDays,
+		ReorderThreshold:   product.ReorderThreshold,
+	}
+}
+
+// ExportProducts streams the catalog in the columns an import takes (GET /product/export?format=csv|jsonl),
+// sellers get their own products and admins every product or the ones of ?seller_id
+func (db *Service) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format, err := catalog.ParseFormat(query.Get("format"), "products."+catalog.FormatCSV)
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	userId := utils.GetUserIdFromContext(r)
+	isAdmin, err := middlewares.HasRole(db.DB, userId, constants.AdminRole)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.SellerCheckFailed, userId), http.StatusInternalServerError, err)
+		return
+	}
+	sellerId := userId
+	if isAdmin {
+		sellerId = 0
+		if value := query.Get("seller_id"); value != "" {
+			if sellerId, err = strconv.Atoi(value); err != nil {
+				utils.JsonError(w, fmt.Sprintf(utils.InvalidCatalogValue, value), http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", catalog.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "products."+format))
+	writer, err := catalog.NewWriter(w, format)
+	if err != nil {
+		utils.JsonError(w, utils.CatalogExportError, http.StatusInternalServerError, err)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	err = models.EachProductBatch(db.DB, sellerId, constants.ExportBatchSize, func(products []models.Product) error {
+		ids := make([]int, len(products))
+		for i, product := range products {
+			ids[i] = product.ID
+		}
+		tags, err := models.GetTagNamesByProductIds(db.DB, ids)
+		if err != nil {
+			return err
+		}
+		for _, product := range products {
+			if err := writer.Write(exportRecord(product, tags[product.ID])); err != nil {
+				return err
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		//the status is sent with the first rows, a failure past them can only cut the export short
+		utils.LogError(utils.CatalogExportError, map[string]interface{}{"error": err.Error()})
+	}
+}
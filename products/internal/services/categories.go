@@ -0,0 +1,321 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type CategoryService interface {
+	FetchCategories(w http.ResponseWriter, r *http.Request)
+	GetCategoryById(w http.ResponseWriter, r *http.Request)
+	CreateCategory(w http.ResponseWriter, r *http.Request)
+	UpdateCategory(w http.ResponseWriter, r *http.Request)
+	DeleteCategory(w http.ResponseWriter, r *http.Request)
+	AssignProductCategory(w http.ResponseWriter, r *http.Request)
+}
+
+// checkCategorySlug makes the slug of the request, from the name when none is sent, and checks that no other
+// category uses it. The returned status tells a taken slug from a failed lookup
+func checkCategorySlug(db *gorm.DB, slug, name string, excludeId int) (string, int, error) {
+	if slug = models.Slugify(slug); slug == "" {
+		slug = models.Slugify(name)
+	}
+	if slug == "" {
+		return "", http.StatusBadRequest, errors.New(utils.InvalidCategoryDataError)
+	}
+	exists, err := models.SlugExists(db, slug, excludeId)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if exists {
+		return "", http.StatusConflict, fmt.Errorf(utils.CategorySlugExists, slug)
+	}
+	return slug, http.StatusOK, nil
+}
+
+// resolveProductCategory fills in both the category id and the category name of a product request, the id wins
+// and a category sent by name or slug only has to exist in the tree
+func resolveProductCategory(db *gorm.DB, req *payloads.ProductRequest) error {
+	if req.CategoryID == 0 && req.Category == "" {
+		return nil
+	}
+	categories, err := models.LoadCategoryIndex(db)
+	if err != nil {
+		return err
+	}
+	category, ok := categories[req.CategoryID]
+	if req.CategoryID == 0 {
+		category, ok = categories.FindByNameOrSlug(req.Category)
+	}
+	if !ok {
+		if req.CategoryID > 0 {
+			return fmt.Errorf(utils.CategoryByIdNotFound, req.CategoryID)
+		}
+		return fmt.Errorf(utils.CategoryByNameNotFound, req.Category)
+	}
+	req.CategoryID = category.ID
+	req.Category = category.Name
+	return nil
+}
+
+// FetchCategories returns the category tree (GET /products/categories)
+func (db *Service) FetchCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := models.LoadCategoryIndex(db.DB)
+	if err != nil {
+		utils.JsonError(w, utils.CategoryNotFoundError, http.StatusNotFound, err)
+		return
+	}
+
+	utils.JsonResponse(categories.Tree(), w, utils.CategoriesFetchedSuccessfully, http.StatusOK)
+}
+
+// GetCategoryById returns the category with its subcategories and the path down to it
+func (db *Service) GetCategoryById(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidCategoryIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	categories, err := models.LoadCategoryIndex(db.DB)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	category, ok := categories[id]
+	if !ok {
+		utils.JsonError(w, fmt.Sprintf(utils.CategoryByIdNotFound, id), http.StatusNotFound, nil)
+		return
+	}
+	categories.Tree()
+
+	resp := map[string]interface{}{
+		"category":    category,
+		"breadcrumbs": categories.Breadcrumbs(id),
+	}
+	utils.JsonResponse(resp, w, fmt.Sprintf(utils.CategoryFetched, id), http.StatusOK)
+}
+
+// CreateCategory adds a category to the tree (POST /product/categories), admin only
+func (db *Service) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var req payloads.CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		utils.JsonError(w, utils.InvalidCategoryDataError, http.StatusBadRequest, nil)
+		return
+	}
+
+	category := models.Category{Name: req.Name}
+	if req.ParentID != nil && *req.ParentID > 0 {
+		var parent models.Category
+		if err := parent.GetCategoryById(db.DB, *req.ParentID); err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.CategoryByIdNotFound, *req.ParentID), http.StatusBadRequest, err)
+			return
+		}
+		category.ParentID = parent.ID
+	}
+	slug, status, err := checkCategorySlug(db.DB, req.Slug, req.Name, 0)
+	if err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+	category.Slug = slug
+	if req.Description != nil {
+		category.Description = *req.Description
+	}
+	if req.ImageURL != nil {
+		category.ImageURL = *req.ImageURL
+	}
+	if req.SortOrder != nil {
+		category.SortOrder = *req.SortOrder
+	}
+
+	if err := category.CreateCategory(db.DB); err != nil {
+		utils.JsonError(w, utils.CategoryCreationError, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(category, w, fmt.Sprintf(utils.CategoryCreated, category.ID), http.StatusCreated)
+}
+
+// UpdateCategory changes or moves a category (PUT /product/categories/{id}), admin only. A category can't be
+// moved below itself or one of its subcategories
+func (db *Service) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidCategoryIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var req payloads.CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+
+	categories, err := models.LoadCategoryIndex(db.DB)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CategoryUpdateError, id), http.StatusInternalServerError, err)
+		return
+	}
+	existing, ok := categories[id]
+	if !ok {
+		utils.JsonError(w, fmt.Sprintf(utils.CategoryByIdNotFound, id), http.StatusNotFound, nil)
+		return
+	}
+	category := *existing
+
+	updatedFields := map[string]interface{}{}
+	if name := strings.TrimSpace(req.Name); name != "" && name != category.Name {
+		updatedFields["name"] = name
+	}
+	if req.Slug != "" {
+		slug, status, err := checkCategorySlug(db.DB, req.Slug, "", id)
+		if err != nil {
+			utils.JsonError(w, err.Error(), status, err)
+			return
+		}
+		if slug != category.Slug {
+			updatedFields["slug"] = slug
+		}
+	}
+	if req.ParentID != nil && *req.ParentID != category.ParentID {
+		parentId := *req.ParentID
+		if parentId > 0 {
+			if _, ok := categories[parentId]; !ok {
+				utils.JsonError(w, fmt.Sprintf(utils.CategoryByIdNotFound, parentId), http.StatusBadRequest, nil)
+				return
+			}
+		}
+		if parentId == id || categories.IsDescendant(id, parentId) {
+			utils.JsonError(w, fmt.Sprintf(utils.CategoryParentInvalid, id), http.StatusBadRequest, nil)
+			return
+		}
+		updatedFields["parent_id"] = parentId
+	}
+	if req.Description != nil {
+		updatedFields["description"] = *req.Description
+	}
+	if req.ImageURL != nil {
+		updatedFields["image_url"] = *req.ImageURL
+	}
+	if req.SortOrder != nil {
+		updatedFields["sort_order"] = *req.SortOrder
+	}
+	if len(updatedFields) == 0 {
+		utils.JsonResponse(category, w, fmt.Sprintf(utils.CategoryUpdated, id), http.StatusOK)
+		return
+	}
+
+	if err := category.UpdateCategory(db.DB, updatedFields); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CategoryUpdateError, id), http.StatusInternalServerError, err)
+		return
+	}
+	//the category name is searched with the products
+	if _, renamed := updatedFields["name"]; renamed {
+		if productIds, err := category.GetProductIds(db.DB); err != nil {
+			utils.LogError(fmt.Sprintf(utils.CategoryUpdateError, id), map[string]interface{}{"error": err.Error()})
+		} else if len(productIds) > 0 {
+			indexProducts(db.DB, productIds...)
+		}
+	}
+
+	utils.JsonResponse(category, w, fmt.Sprintf(utils.CategoryUpdated, id), http.StatusOK)
+}
+
+// DeleteCategory removes an empty category (DELETE /product/categories/{id}), admin only. Subcategories and
+// products have to be moved out first
+func (db *Service) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidCategoryIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var category models.Category
+	if err := category.GetCategoryById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CategoryByIdNotFound, id), http.StatusNotFound, err)
+		return
+	}
+
+	hasChildren, err := category.HasChildren(db.DB)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CategoryDeletionError, id), http.StatusInternalServerError, err)
+		return
+	}
+	if hasChildren {
+		utils.JsonError(w, fmt.Sprintf(utils.CategoryHasChildren, id), http.StatusConflict, nil)
+		return
+	}
+	products, err := category.CountProducts(db.DB)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CategoryDeletionError, id), http.StatusInternalServerError, err)
+		return
+	}
+	if products > 0 {
+		utils.JsonError(w, fmt.Sprintf(utils.CategoryHasProducts, id, products), http.StatusConflict, nil)
+		return
+	}
+
+	if err := category.DeleteCategory(db.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CategoryDeletionError, id), http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.CategoryDeleted, id), http.StatusOK)
+}
+
+// AssignProductCategory moves a product into a category by id (PUT /product/{id}/category)
+func (db *Service) AssignProductCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var req payloads.ProductCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if req.CategoryID <= 0 {
+		utils.JsonError(w, utils.InvalidCategoryIDError, http.StatusBadRequest, nil)
+		return
+	}
+
+	var product models.Product
+	if err := product.CheckProductExistsById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+	var category models.Category
+	if err := category.GetCategoryById(db.DB, req.CategoryID); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.CategoryByIdNotFound, req.CategoryID), http.StatusBadRequest, err)
+		return
+	}
+
+	if err := product.AssignCategory(db.DB, &category); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductCategoryAssignError, id), http.StatusInternalServerError, err)
+		return
+	}
+	indexProducts(db.DB, id)
+
+	productResp, err := product.FetchProductResp(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+	utils.JsonResponse(productResp, w, fmt.Sprintf(utils.ProductCategoryAssigned, id, category.ID), http.StatusOK)
+}
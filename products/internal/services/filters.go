@@ -2,6 +2,7 @@ package services
 
 import (
 	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/constants"
 	"e-commerce-backend/shared/utils"
 	"fmt"
 	"log"
@@ -9,6 +10,9 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 func (db *Service) FilterProducts(w http.ResponseWriter, r *http.Request) {
@@ -28,8 +32,8 @@ func (db *Service) FilterProducts(w http.ResponseWriter, r *http.Request) {
 
 	// List of allowed filter keys
 	FilterKey := []string{
-		"name", "min_price", "max_price", "min_rating", "category",
-		"min_quantity", "max_quantity", "tags",
+		"name", "min_price", "max_price", "min_rating", "category", "category_id",
+		"min_quantity", "max_quantity", "tags", "tag_mode", "options",
 	}
 
 	// Iterate over query params and set them if they are valid
@@ -41,10 +45,18 @@ func (db *Service) FilterProducts(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	log.Printf("%+v", criteria)
+	if criteria.TagMode != "" && criteria.TagMode != models.TagModeAny && criteria.TagMode != models.TagModeAll {
+		utils.JsonError(w, fmt.Sprintf(utils.InvalidTagMode, criteria.TagMode), http.StatusBadRequest, nil)
+		return
+	}
 
 	// Fetch filtered products and return response
-	resp, _ := models.FilterProduct(db.DB, criteria)
-	utils.JsonResponse(resp, w, "filtered data", http.StatusOK)
+	scope, err := models.FilterScope(db.DB, criteria)
+	if err != nil {
+		utils.JsonError(w, utils.ProductsFetchError, http.StatusInternalServerError, err)
+		return
+	}
+	db.listProducts(w, r, scope, "filtered data")
 }
 
 // Check if a key is in the valid filter keys
@@ -96,7 +108,7 @@ func setField(obj interface{}, fieldName string, value string) error {
 					return fmt.Errorf("invalid bool value for field %s", fieldName)
 				}
 			case reflect.Slice:
-				if fieldName == "tags" {
+				if fieldName == "tags" || fieldName == "options" {
 					fieldValue.Set(reflect.ValueOf(strings.Split(value, ",")))
 				}
 			default:
@@ -210,7 +222,7 @@ func SetField(obj interface{}, fieldName string, value string) error {
 					return fmt.Errorf("invalid bool value for field %s", fieldName)
 				}
 			case reflect.Slice:
-				if fieldName == "tags" {
+				if fieldName == "tags" || fieldName == "options" {
 					fieldValue.Set(reflect.ValueOf(strings.Split(value, ",")))
 				}
 			default:
@@ -258,40 +270,25 @@ func (db *Service) GetCategories(w http.ResponseWriter, r *http.Request) {
 }
 
 func (db *Service) GetFeatured(w http.ResponseWriter, r *http.Request) {
-	var products []models.Product
-
-	// Fetch featured products
-	err := db.DB.Where("is_featured = ?", true).Find(&products).Error
-	if err != nil {
-		utils.JsonError(w, utils.ProductsFetchError, http.StatusInternalServerError, err)
-		return
-	}
-
-	utils.JsonResponseWithExtra(products, w, utils.ProductsFetchedSuccessfully, http.StatusOK, "getFeatured")
+	db.listProducts(w, r, func(query *gorm.DB) *gorm.DB {
+		return query.Where("is_featured = ?", true)
+	}, utils.ProductsFetchedSuccessfully)
 }
 
+// GetOffers lists the products on sale through a price rule running now
 func (db *Service) GetOffers(w http.ResponseWriter, r *http.Request) {
-	var products []models.Product
-
-	// Fetch products with offers (discount > 0)
-	err := db.DB.Where("discount > ?", 0).Find(&products).Error
-	if err != nil {
-		utils.JsonError(w, utils.ProductsFetchError, http.StatusInternalServerError, err)
-		return
-	}
-
-	utils.JsonResponseWithExtra(products, w, "Products with offers fetched successfully", http.StatusOK, "getOffers")
+	now := time.Now()
+	db.listProducts(w, r, func(query *gorm.DB) *gorm.DB {
+		return query.Where("sale_discount > ? and sale_ends_at > ?", 0, now)
+	}, utils.OffersFetched)
 }
 
+// GetDeals lists the products of running flash deals and the ones on sale by at least DealMinDiscount percent
 func (db *Service) GetDeals(w http.ResponseWriter, r *http.Request) {
-	var products []models.Product
-
-	// Fetch products with discounts (deals)
-	err := db.DB.Where("discount >= ?", 20).Find(&products).Error
-	if err != nil {
-		utils.JsonError(w, utils.ProductsFetchError, http.StatusInternalServerError, err)
-		return
-	}
-
-	utils.JsonResponseWithExtra(products, w, "Deals fetched successfully", http.StatusOK, "getDeals")
+	now := time.Now()
+	flashRules := db.DB.Model(&models.PriceRule{}).Select("id").Where("type = ?", models.PriceRuleFlash)
+	db.listProducts(w, r, func(query *gorm.DB) *gorm.DB {
+		return query.Where("sale_discount > ? and sale_ends_at > ?", 0, now).
+			Where("price_rule_id IN (?) OR sale_discount >= ?", flashRules, constants.DealMinDiscount)
+	}, utils.DealsFetched)
 }
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/media"
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/constants"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type ImageService interface {
+	GetProductImages(w http.ResponseWriter, r *http.Request)
+	DeleteProductImage(w http.ResponseWriter, r *http.Request)
+	ReorderProductImages(w http.ResponseWriter, r *http.Request)
+}
+
+// imageStorage where uploaded images are kept, main replaces it with the configured storage
+var imageStorage media.Storage = media.NewLocalStorage(constants.DefaultMediaRoot, constants.DefaultMediaURL)
+
+var imageLimits = media.Limits{
+	MaxBytes:     constants.MaxImageBytes,
+	MinDimension: constants.MinImageDimension,
+	MaxDimension: constants.MaxImageDimension,
+}
+
+func SetImageStorage(storage media.Storage) {
+	imageStorage = storage
+}
+
+// imageKey names the files of an image after a random id, the name the client sent is never used
+func imageKey(productId int, name, ext string) string {
+	return fmt.Sprintf("products/%d/%s.%s", productId, name, ext)
+}
+
+// storeImage writes the image and its thumbnails, nothing is left behind when one of them can't be written
+func storeImage(productId int, processed *media.ProcessedImage) (models.ProductImage, error) {
+	name := uuid.NewString()
+	original := processed.Original
+	image := models.ProductImage{
+		StorageKey:  imageKey(productId, name, original.Ext),
+		ContentType: original.ContentType,
+		Width:       original.Width,
+		Height:      original.Height,
+		Size:        len(original.Data),
+	}
+	image.URL = imageStorage.URL(image.StorageKey)
+	if err := imageStorage.Put(image.StorageKey, original.Data); err != nil {
+		return image, err
+	}
+
+	for _, size := range media.DefaultThumbnailSizes {
+		file := processed.Thumbnails[size.Name]
+		thumbnail := models.ProductImageThumbnail{
+			Size:       size.Name,
+			StorageKey: imageKey(productId, name+"_"+size.Name, file.Ext),
+			Width:      file.Width,
+			Height:     file.Height,
+		}
+		thumbnail.URL = imageStorage.URL(thumbnail.StorageKey)
+		if err := imageStorage.Put(thumbnail.StorageKey, file.Data); err != nil {
+			deleteImageFiles(image.StorageKeys())
+			return image, err
+		}
+		image.Thumbnails = append(image.Thumbnails, thumbnail)
+	}
+	return image, nil
+}
+
+// deleteImageFiles removes stored files, a file which can't be removed is only logged as its image is gone
+func deleteImageFiles(keys []string) {
+	for _, key := range keys {
+		if err := imageStorage.Delete(key); err != nil {
+			utils.LogError(fmt.Sprintf(utils.ImageFileDeleteError, key), map[string]interface{}{"error": err.Error()})
+		}
+	}
+}
+
+func readFormFile(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	//one byte more than allowed is enough to tell the file is too large
+	return io.ReadAll(io.LimitReader(file, constants.MaxImageBytes+1))
+}
+
+// UploadProductImageHandler adds the files of the image field of a multipart form to the images of the product
+// (POST /product/{id}/images), an optional alt_text field describes them. Every file is checked and its
+// thumbnails generated before anything is stored, so an upload is kept or dropped as a whole
+func (db *Service) UploadProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+	var product models.Product
+	if err := product.CheckProductExistsById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, constants.MaxUploadBytes)
+	if err := r.ParseMultipartForm(constants.MaxImageBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.JsonError(w, fmt.Sprintf(utils.ImageTooLarge, constants.MaxUploadBytes), http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		utils.JsonError(w, utils.InvalidMultipartForm, http.StatusBadRequest, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	files := r.MultipartForm.File["image"]
+	if len(files) == 0 {
+		utils.JsonError(w, utils.NoImageUploaded, http.StatusBadRequest, nil)
+		return
+	}
+
+	count, err := models.CountProductImages(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	if int(count)+len(files) > constants.MaxProductImages {
+		utils.JsonError(w, fmt.Sprintf(utils.ImageLimitReached, id, constants.MaxProductImages), http.StatusBadRequest, nil)
+		return
+	}
+
+	processed := make([]*media.ProcessedImage, 0, len(files))
+	for _, header := range files {
+		data, err := readFormFile(header)
+		if err != nil {
+			utils.JsonError(w, utils.FileRetrieveFailed, http.StatusBadRequest, err)
+			return
+		}
+		image, err := media.Process(data, imageLimits, media.DefaultThumbnailSizes)
+		if err != nil {
+			if errors.Is(err, media.ErrInvalidImage) {
+				utils.JsonError(w, fmt.Sprintf("%s: %s", header.Filename, err.Error()), http.StatusBadRequest, err)
+				return
+			}
+			utils.JsonError(w, utils.ErrorSavingFile, http.StatusInternalServerError, err)
+			return
+		}
+		processed = append(processed, image)
+	}
+
+	altText := strings.TrimSpace(r.FormValue("alt_text"))
+	images := make([]models.ProductImage, 0, len(processed))
+	var stored []string
+	for _, p := range processed {
+		image, err := storeImage(id, p)
+		if err != nil {
+			deleteImageFiles(stored)
+			utils.JsonError(w, utils.UnableToSaveFile, http.StatusInternalServerError, err)
+			return
+		}
+		image.AltText = altText
+		stored = append(stored, image.StorageKeys()...)
+		images = append(images, image)
+	}
+	if err := models.AddProductImages(db.DB, id, images); err != nil {
+		deleteImageFiles(stored)
+		utils.JsonError(w, utils.ErrorSavingFile, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(images, w, fmt.Sprintf(utils.ImagesUploaded, len(images), id), http.StatusCreated)
+}
+
+// GetProductImages returns the images of the product in display order (GET /product/{id}/images)
+func (db *Service) GetProductImages(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+	var product models.Product
+	if err := product.CheckProductExistsById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+
+	images, err := models.GetImagesByProductId(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(images, w, fmt.Sprintf(utils.ImagesFetched, len(images), id), http.StatusOK)
+}
+
+// DeleteProductImage removes an image with its thumbnails (DELETE /product/{id}/images/{imageId})
+func (db *Service) DeleteProductImage(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+	imageId, err := strconv.Atoi(mux.Vars(r)["imageId"])
+	if err != nil {
+		utils.JsonError(w, utils.InvalidImageIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var image models.ProductImage
+	if err := image.GetImageById(db.DB, id, imageId); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ImageNotFound, imageId, id), http.StatusNotFound, err)
+		return
+	}
+	if err := image.DeleteImage(db.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ImageDeletionError, imageId), http.StatusInternalServerError, err)
+		return
+	}
+	//the files go once nothing refers to them any more
+	deleteImageFiles(image.StorageKeys())
+
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.ImageDeleted, imageId, id), http.StatusOK)
+}
+
+// ReorderProductImages sets the display order of the images (PUT /product/{id}/images/order), the first image
+// becomes the main image of the product
+func (db *Service) ReorderProductImages(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+	var req payloads.ImageOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	var product models.Product
+	if err := product.CheckProductExistsById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+
+	if err := models.ReorderProductImages(db.DB, id, req.ImageIDs); err != nil {
+		if err.Error() == utils.InvalidImageOrder {
+			utils.JsonError(w, utils.InvalidImageOrder, http.StatusBadRequest, err)
+			return
+		}
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+
+	images, err := models.GetImagesByProductId(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(images, w, fmt.Sprintf(utils.ImagesReordered, id), http.StatusOK)
+}
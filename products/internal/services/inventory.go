@@ -0,0 +1,348 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/constants"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type InventoryService interface {
+	CreateWarehouse(w http.ResponseWriter, r *http.Request)
+	GetWarehouses(w http.ResponseWriter, r *http.Request)
+	UpdateWarehouse(w http.ResponseWriter, r *http.Request)
+	GetProductInventory(w http.ResponseWriter, r *http.Request)
+	RecordStockMovement(w http.ResponseWriter, r *http.Request)
+	GetStockMovements(w http.ResponseWriter, r *http.Request)
+	TransferStock(w http.ResponseWriter, r *http.Request)
+}
+
+// checkWarehouse loads the warehouse stock is moved in, stock can only be received into an active one
+func checkWarehouse(db *gorm.DB, id int, receiving bool) (int, error) {
+	var warehouse models.Warehouse
+	if err := warehouse.GetWarehouseById(db, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusNotFound, fmt.Errorf(utils.WarehouseNotFound, id)
+		}
+		return http.StatusInternalServerError, errors.New(utils.DatabaseConnectionError)
+	}
+	if receiving && !warehouse.IsActive {
+		return http.StatusBadRequest, fmt.Errorf(utils.WarehouseInactive, id)
+	}
+	return http.StatusOK, nil
+}
+
+// checkVariantOfProduct makes sure stock of a variant is only moved through the product it belongs to
+func checkVariantOfProduct(db *gorm.DB, variantId, productId int) (int, error) {
+	if variantId == 0 {
+		return http.StatusOK, nil
+	}
+	var variant models.ProductVariant
+	if err := variant.GetVariantById(db, variantId); err != nil || variant.ProductID != productId {
+		return http.StatusBadRequest, fmt.Errorf(utils.VariantNotOfProduct, variantId, productId)
+	}
+	return http.StatusOK, nil
+}
+
+func validWarehouseCode(code string) bool {
+	return code != "" && len(code) <= constants.MaxWarehouseCode
+}
+
+// CreateWarehouse adds a warehouse stock can be kept in (POST /product/warehouses)
+func (db *Service) CreateWarehouse(w http.ResponseWriter, r *http.Request) {
+	var req payloads.WarehouseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	req.Code = strings.TrimSpace(req.Code)
+	req.Name = strings.TrimSpace(req.Name)
+	if !validWarehouseCode(req.Code) || req.Name == "" {
+		utils.JsonError(w, fmt.Sprintf(utils.InvalidWarehouseData, constants.MaxWarehouseCode), http.StatusBadRequest, nil)
+		return
+	}
+	exists, err := models.WarehouseCodeExists(db.DB, req.Code, 0)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	if exists {
+		utils.JsonError(w, fmt.Sprintf(utils.WarehouseCodeExists, req.Code), http.StatusConflict, nil)
+		return
+	}
+
+	warehouse := models.Warehouse{Code: req.Code, Name: req.Name, IsActive: true}
+	if req.Address != nil {
+		warehouse.Address = *req.Address
+	}
+	if req.Priority != nil {
+		warehouse.Priority = *req.Priority
+	}
+	if req.IsActive != nil {
+		warehouse.IsActive = *req.IsActive
+	}
+	if err := warehouse.CreateWarehouse(db.DB); err != nil {
+		utils.JsonError(w, utils.WarehouseCreationError, http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(warehouse, w, fmt.Sprintf(utils.WarehouseCreated, warehouse.ID), http.StatusCreated)
+}
+
+// GetWarehouses lists the warehouses in allocation priority order (GET /product/warehouses)
+func (db *Service) GetWarehouses(w http.ResponseWriter, r *http.Request) {
+	warehouses, err := models.GetWarehouses(db.DB)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(warehouses, w, fmt.Sprintf(utils.WarehousesFetched, len(warehouses)), http.StatusOK)
+}
+
+// UpdateWarehouse changes a warehouse, deactivating it keeps its stock but stops new allocations from it
+// (PUT /product/warehouses/{id})
+func (db *Service) UpdateWarehouse(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidWarehouseIDError, http.StatusBadRequest, err)
+		return
+	}
+	var warehouse models.Warehouse
+	if err := warehouse.GetWarehouseById(db.DB, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.JsonError(w, fmt.Sprintf(utils.WarehouseNotFound, id), http.StatusNotFound, err)
+			return
+		}
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+
+	var req payloads.WarehouseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	updatedFields := map[string]interface{}{}
+	if code := strings.TrimSpace(req.Code); code != "" && code != warehouse.Code {
+		if !validWarehouseCode(code) {
+			utils.JsonError(w, fmt.Sprintf(utils.InvalidWarehouseData, constants.MaxWarehouseCode), http.StatusBadRequest, nil)
+			return
+		}
+		exists, err := models.WarehouseCodeExists(db.DB, code, id)
+		if err != nil {
+			utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+			return
+		}
+		if exists {
+			utils.JsonError(w, fmt.Sprintf(utils.WarehouseCodeExists, code), http.StatusConflict, nil)
+			return
+		}
+		updatedFields["code"] = code
+	}
+	if name := strings.TrimSpace(req.Name); name != "" && name != warehouse.Name {
+		updatedFields["name"] = name
+	}
+	if req.Address != nil && *req.Address != warehouse.Address {
+		updatedFields["address"] = *req.Address
+	}
+	if req.Priority != nil && *req.Priority != warehouse.Priority {
+		updatedFields["priority"] = *req.Priority
+	}
+	if req.IsActive != nil && *req.IsActive != warehouse.IsActive {
+		updatedFields["is_active"] = *req.IsActive
+	}
+	if len(updatedFields) == 0 {
+		utils.JsonResponse(warehouse, w, fmt.Sprintf(utils.WarehouseUpdated, id), http.StatusOK)
+		return
+	}
+
+	if err := warehouse.UpdateWarehouse(db.DB, updatedFields); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.WarehouseUpdateError, id), http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(warehouse, w, fmt.Sprintf(utils.WarehouseUpdated, id), http.StatusOK)
+}
+
+// GetProductInventory returns the stock of the product and its variants per warehouse (GET /product/{id}/inventory)
+func (db *Service) GetProductInventory(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	levels, err := models.GetProductInventory(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.InventoryFetchError, id), http.StatusInternalServerError, err)
+		return
+	}
+	inventory := payloads.ProductInventoryResponse{ProductID: id, Levels: levels}
+	for _, level := range levels {
+		inventory.OnHand += level.OnHand
+		inventory.Reserved += level.Reserved
+		inventory.Available += level.Available
+	}
+	utils.JsonResponse(inventory, w, fmt.Sprintf(utils.InventoryFetched, id), http.StatusOK)
+}
+
+// RecordStockMovement books stock received, returned or counted in a warehouse (POST /product/{id}/inventory/movements)
+func (db *Service) RecordStockMovement(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+	var req payloads.StockMovementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+
+	// sales and transfers are only booked by orders and the transfer endpoint
+	switch req.Type {
+	case models.MovementReceipt, models.MovementReturn:
+		if req.Quantity <= 0 {
+			utils.JsonError(w, fmt.Sprintf(utils.InvalidMovementQuantity, req.Type), http.StatusBadRequest, nil)
+			return
+		}
+	case models.MovementAdjustment:
+		if req.Quantity == 0 {
+			utils.JsonError(w, fmt.Sprintf(utils.InvalidMovementQuantity, req.Type), http.StatusBadRequest, nil)
+			return
+		}
+	default:
+		utils.JsonError(w, fmt.Sprintf(utils.InvalidMovementType, req.Type), http.StatusBadRequest, nil)
+		return
+	}
+	if status, err := checkWarehouse(db.DB, req.WarehouseID, req.Quantity > 0); err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+	if status, err := checkVariantOfProduct(db.DB, req.VariantID, id); err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+
+	movement := models.StockMovement{
+		WarehouseID: req.WarehouseID,
+		ProductID:   id,
+		VariantID:   req.VariantID,
+		Type:        req.Type,
+		Quantity:    req.Quantity,
+		Reason:      req.Reason,
+		ActorID:     utils.GetUserIdFromContext(r),
+	}
+	if err := models.RecordMovement(db.DB, &movement); err != nil {
+		if errors.Is(err, models.ErrInsufficientStock) {
+			utils.JsonError(w, err.Error(), http.StatusConflict, err)
+			return
+		}
+		utils.JsonError(w, fmt.Sprintf(utils.StockMovementError, id), http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(movement, w, fmt.Sprintf(utils.StockMoved, id), http.StatusCreated)
+}
+
+// GetStockMovements pages through the stock ledger of the product, newest first
+// (GET /product/{id}/inventory/movements?warehouse_id=&variant_id=&type=&limit=&offset=)
+func (db *Service) GetStockMovements(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := models.MovementFilter{Type: query.Get("type"), Limit: constants.DefaultMovementLimit}
+	if filter.Type != "" && !models.IsMovementType(filter.Type) {
+		utils.JsonError(w, fmt.Sprintf(utils.InvalidInventoryParam, "type"), http.StatusBadRequest, nil)
+		return
+	}
+	for param, target := range map[string]*int{
+		"warehouse_id": &filter.WarehouseID,
+		"variant_id":   &filter.VariantID,
+		"limit":        &filter.Limit,
+		"offset":       &filter.Offset,
+	} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			utils.JsonError(w, fmt.Sprintf(utils.InvalidInventoryParam, param), http.StatusBadRequest, err)
+			return
+		}
+		*target = parsed
+	}
+	if filter.Limit == 0 || filter.Limit > constants.MaxMovementLimit {
+		filter.Limit = constants.MaxMovementLimit
+	}
+
+	movements, total, err := models.GetStockMovements(db.DB, id, filter)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.InventoryFetchError, id), http.StatusInternalServerError, err)
+		return
+	}
+	resp := payloads.StockMovementListResponse{Movements: movements, Total: total, Limit: filter.Limit, Offset: filter.Offset}
+	utils.JsonResponse(resp, w, fmt.Sprintf(utils.StockMovementsFetched, len(movements), id), http.StatusOK)
+}
+
+// TransferStock moves stock of the product between two warehouses (POST /product/{id}/inventory/transfers)
+func (db *Service) TransferStock(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+	var req payloads.StockTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if req.Quantity <= 0 || req.FromWarehouseID == req.ToWarehouseID {
+		utils.JsonError(w, utils.InvalidTransfer, http.StatusBadRequest, nil)
+		return
+	}
+	if status, err := checkWarehouse(db.DB, req.FromWarehouseID, false); err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+	if status, err := checkWarehouse(db.DB, req.ToWarehouseID, true); err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+	if status, err := checkVariantOfProduct(db.DB, req.VariantID, id); err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+
+	from := models.StockMovement{
+		WarehouseID: req.FromWarehouseID,
+		ProductID:   id,
+		VariantID:   req.VariantID,
+		Reason:      req.Reason,
+		Reference:   uuid.NewString(),
+		ActorID:     utils.GetUserIdFromContext(r),
+	}
+	to := from
+	to.WarehouseID = req.ToWarehouseID
+	movements, err := models.TransferStock(db.DB, from, to, req.Quantity)
+	if err != nil {
+		if errors.Is(err, models.ErrInsufficientStock) {
+			utils.JsonError(w, err.Error(), http.StatusConflict, err)
+			return
+		}
+		utils.JsonError(w, fmt.Sprintf(utils.StockMovementError, id), http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(movements, w, fmt.Sprintf(utils.StockTransferred, req.Quantity, id, req.FromWarehouseID, req.ToWarehouseID), http.StatusCreated)
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/constants"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// listQuery the paging, sorting and field selection of a listing request
+type listQuery struct {
+	options models.ListOptions
+	fields  []string
+}
+
+// productFields json names of the fields a listing can be narrowed to
+var productFields = func() map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(payloads.ProductResponse{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+	}
+	return fields
+}()
+
+// parseListQuery reads limit, cursor, sort, order and fields, the same for every product listing
+func parseListQuery(r *http.Request) (listQuery, error) {
+	params := r.URL.Query()
+	q := listQuery{options: models.ListOptions{
+		Limit:  constants.DefaultListLimit,
+		Cursor: params.Get("cursor"),
+		Sort:   params.Get("sort"),
+		Order:  strings.ToLower(params.Get("order")),
+	}}
+	if limit := params.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > constants.MaxListLimit {
+			return q, fmt.Errorf(utils.InvalidListLimit, constants.MaxListLimit)
+		}
+		q.options.Limit = parsed
+	}
+	if err := q.options.Validate(); err != nil {
+		return q, err
+	}
+
+	if fields := params.Get("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			field = strings.TrimSpace(field)
+			if !productFields[field] {
+				return q, fmt.Errorf(utils.InvalidListField, field)
+			}
+			q.fields = append(q.fields, field)
+		}
+	}
+	return q, nil
+}
+
+// selectFields keeps only the asked for fields of every product, the id is always kept
+func selectFields(items []payloads.ProductResponse, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return items, nil
+	}
+	raw, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var full []map[string]interface{}
+	if err := json.Unmarshal(raw, &full); err != nil {
+		return nil, err
+	}
+
+	selected := make([]map[string]interface{}, 0, len(full))
+	for _, item := range full {
+		sparse := map[string]interface{}{"id": item["id"]}
+		for _, field := range fields {
+			if value, ok := item[field]; ok {
+				sparse[field] = value
+			}
+		}
+		selected = append(selected, sparse)
+	}
+	return selected, nil
+}
+
+// listProducts writes the page of the products matching scope asked for by the request
+func (db *Service) listProducts(w http.ResponseWriter, r *http.Request, scope func(*gorm.DB) *gorm.DB, message string) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := models.ListProducts(db.DB, scope, q.options)
+	if err != nil {
+		utils.JsonError(w, utils.ProductsFetchError, http.StatusInternalServerError, err)
+		return
+	}
+	items, err := selectFields(page.Items, q.fields)
+	if err != nil {
+		utils.JsonError(w, utils.ProductsFetchError, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := payloads.ProductListResponse{Items: items, Total: page.Total, Limit: q.options.Limit, NextCursor: page.NextCursor}
+	utils.JsonResponse(resp, w, message, http.StatusOK)
+}
+
+func allProducts(query *gorm.DB) *gorm.DB {
+	return query
+}
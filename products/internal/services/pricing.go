@@ -0,0 +1,322 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/constants"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PriceRuleService interface {
+	CreatePriceRule(w http.ResponseWriter, r *http.Request)
+	GetPriceRules(w http.ResponseWriter, r *http.Request)
+	GetPriceRuleById(w http.ResponseWriter, r *http.Request)
+	UpdatePriceRule(w http.ResponseWriter, r *http.Request)
+	DeletePriceRule(w http.ResponseWriter, r *http.Request)
+	GetPriceHistory(w http.ResponseWriter, r *http.Request)
+}
+
+// StartPriceScheduler applies the price rules right away and then periodically, so sales start and end on time
+// and products moved into or out of the scope of a rule get its price
+func StartPriceScheduler(db *gorm.DB, interval time.Duration) {
+	applyPriceRules(db, 0)
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			applyPriceRules(db, 0)
+		}
+	}()
+}
+
+// applyPriceRules reprices every product, rule changes of actorId are applied at once instead of on the next run
+func applyPriceRules(db *gorm.DB, actorId int) {
+	changed, err := models.ApplyPriceRules(db, time.Now(), nil, actorId)
+	if err != nil {
+		utils.LogError(utils.PriceRulesApplyError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if changed > 0 {
+		utils.LogInfo(fmt.Sprintf(utils.PriceRulesApplied, changed), nil)
+	}
+}
+
+// checkPriceRule validates the rule as it will be saved and that the product, category or tag it applies to exists
+func checkPriceRule(db *gorm.DB, rule *models.PriceRule) (int, error) {
+	if rule.Name == "" || len(rule.Name) > constants.MaxPriceRuleName {
+		return http.StatusBadRequest, fmt.Errorf(utils.InvalidPriceRuleName, constants.MaxPriceRuleName)
+	}
+	if rule.Type != models.PriceRuleSale && rule.Type != models.PriceRuleFlash {
+		return http.StatusBadRequest, fmt.Errorf(utils.InvalidPriceRuleType, rule.Type)
+	}
+	if rule.DiscountType != models.DiscountPercentage && rule.DiscountType != models.DiscountFixed {
+		return http.StatusBadRequest, fmt.Errorf(utils.InvalidDiscountType, rule.DiscountType)
+	}
+	if rule.Value <= 0 || (rule.DiscountType == models.DiscountPercentage && rule.Value > 100) {
+		return http.StatusBadRequest, errors.New(utils.InvalidPriceRuleValue)
+	}
+	if !rule.EndsAt.After(rule.StartsAt) {
+		return http.StatusBadRequest, errors.New(utils.InvalidPriceRulePeriod)
+	}
+	if rule.Type == models.PriceRuleFlash && rule.EndsAt.Sub(rule.StartsAt) > constants.MaxFlashDealDuration {
+		return http.StatusBadRequest, fmt.Errorf(utils.FlashDealTooLong, constants.MaxFlashDealDuration)
+	}
+
+	var err error
+	switch rule.Scope {
+	case models.PriceScopeAll:
+		rule.ScopeID = 0
+		return http.StatusOK, nil
+	case models.PriceScopeProduct:
+		var product models.Product
+		err = product.CheckProductExistsById(db, rule.ScopeID)
+	case models.PriceScopeCategory:
+		var category models.Category
+		err = category.GetCategoryById(db, rule.ScopeID)
+	case models.PriceScopeTag:
+		_, err = models.FetchTagById(db, rule.ScopeID)
+	default:
+		return http.StatusBadRequest, fmt.Errorf(utils.InvalidPriceRuleScope, rule.Scope)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusBadRequest, fmt.Errorf(utils.PriceRuleScopeNotFound, rule.Scope, rule.ScopeID)
+		}
+		return http.StatusInternalServerError, errors.New(utils.DatabaseConnectionError)
+	}
+	return http.StatusOK, nil
+}
+
+// CreatePriceRule schedules a sale or flash deal (POST /product/price-rules)
+func (db *Service) CreatePriceRule(w http.ResponseWriter, r *http.Request) {
+	var req payloads.PriceRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+
+	rule := models.PriceRule{
+		Name:         strings.TrimSpace(req.Name),
+		Type:         req.Type,
+		DiscountType: req.DiscountType,
+		Scope:        req.Scope,
+		StartsAt:     time.Now(),
+		IsActive:     true,
+		CreatedBy:    utils.GetUserIdFromContext(r),
+	}
+	if rule.Type == "" {
+		rule.Type = models.PriceRuleSale
+	}
+	if req.Value != nil {
+		rule.Value = *req.Value
+	}
+	if req.ScopeID != nil {
+		rule.ScopeID = *req.ScopeID
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.StartsAt != nil {
+		rule.StartsAt = *req.StartsAt
+	}
+	if req.EndsAt != nil {
+		rule.EndsAt = *req.EndsAt
+	}
+	if req.IsActive != nil {
+		rule.IsActive = *req.IsActive
+	}
+	if status, err := checkPriceRule(db.DB, &rule); err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+
+	if err := rule.CreatePriceRule(db.DB); err != nil {
+		utils.JsonError(w, utils.PriceRuleCreationError, http.StatusInternalServerError, err)
+		return
+	}
+	applyPriceRules(db.DB, rule.CreatedBy)
+	utils.JsonResponse(rule, w, fmt.Sprintf(utils.PriceRuleCreated, rule.ID), http.StatusCreated)
+}
+
+// GetPriceRules lists the price rules, ?status=active|scheduled|expired narrows them (GET /product/price-rules)
+func (db *Service) GetPriceRules(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", "active", "scheduled", "expired":
+	default:
+		utils.JsonError(w, fmt.Sprintf(utils.InvalidPriceRuleStatus, status), http.StatusBadRequest, nil)
+		return
+	}
+
+	rules, err := models.GetPriceRules(db.DB, status, time.Now())
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(rules, w, fmt.Sprintf(utils.PriceRulesFetched, len(rules)), http.StatusOK)
+}
+
+func (db *Service) fetchPriceRule(w http.ResponseWriter, r *http.Request) (models.PriceRule, bool) {
+	var rule models.PriceRule
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidPriceRuleIDError, http.StatusBadRequest, err)
+		return rule, false
+	}
+	if err := rule.GetPriceRuleById(db.DB, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.JsonError(w, fmt.Sprintf(utils.PriceRuleNotFound, id), http.StatusNotFound, err)
+			return rule, false
+		}
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return rule, false
+	}
+	return rule, true
+}
+
+// GetPriceRuleById returns a price rule (GET /product/price-rules/{id})
+func (db *Service) GetPriceRuleById(w http.ResponseWriter, r *http.Request) {
+	rule, ok := db.fetchPriceRule(w, r)
+	if !ok {
+		return
+	}
+	utils.JsonResponse(rule, w, fmt.Sprintf(utils.PriceRuleFetched, rule.ID), http.StatusOK)
+}
+
+// UpdatePriceRule changes a price rule, the prices it sets follow at once (PUT /product/price-rules/{id})
+func (db *Service) UpdatePriceRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := db.fetchPriceRule(w, r)
+	if !ok {
+		return
+	}
+	var req payloads.PriceRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+
+	updated := rule
+	if name := strings.TrimSpace(req.Name); name != "" {
+		updated.Name = name
+	}
+	if req.Type != "" {
+		updated.Type = req.Type
+	}
+	if req.DiscountType != "" {
+		updated.DiscountType = req.DiscountType
+	}
+	if req.Value != nil {
+		updated.Value = *req.Value
+	}
+	if req.Scope != "" {
+		updated.Scope = req.Scope
+	}
+	if req.ScopeID != nil {
+		updated.ScopeID = *req.ScopeID
+	}
+	if req.Priority != nil {
+		updated.Priority = *req.Priority
+	}
+	if req.StartsAt != nil {
+		updated.StartsAt = *req.StartsAt
+	}
+	if req.EndsAt != nil {
+		updated.EndsAt = *req.EndsAt
+	}
+	if req.IsActive != nil {
+		updated.IsActive = *req.IsActive
+	}
+	if status, err := checkPriceRule(db.DB, &updated); err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+
+	updatedFields := map[string]interface{}{
+		"name":          updated.Name,
+		"type":          updated.Type,
+		"discount_type": updated.DiscountType,
+		"value":         updated.Value,
+		"scope":         updated.Scope,
+		"scope_id":      updated.ScopeID,
+		"priority":      updated.Priority,
+		"starts_at":     updated.StartsAt,
+		"ends_at":       updated.EndsAt,
+		"is_active":     updated.IsActive,
+	}
+	if err := rule.UpdatePriceRule(db.DB, updatedFields); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.PriceRuleUpdateError, rule.ID), http.StatusInternalServerError, err)
+		return
+	}
+	applyPriceRules(db.DB, utils.GetUserIdFromContext(r))
+	utils.JsonResponse(rule, w, fmt.Sprintf(utils.PriceRuleUpdated, rule.ID), http.StatusOK)
+}
+
+// DeletePriceRule removes a price rule, products on its sale go back to their own price at once
+// (DELETE /product/price-rules/{id})
+func (db *Service) DeletePriceRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := db.fetchPriceRule(w, r)
+	if !ok {
+		return
+	}
+	if err := rule.DeletePriceRule(db.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.PriceRuleDeletionError, rule.ID), http.StatusInternalServerError, err)
+		return
+	}
+	applyPriceRules(db.DB, utils.GetUserIdFromContext(r))
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.PriceRuleDeleted, rule.ID), http.StatusOK)
+}
+
+// GetPriceHistory returns the prices of the product over the last ?days days with the lowest of them
+// (GET /product/{id}/price-history)
+func (db *Service) GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+	days := constants.DefaultPriceHistoryDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 1 || days > constants.MaxPriceHistoryDays {
+			utils.JsonError(w, fmt.Sprintf(utils.InvalidPriceHistoryDays, constants.MaxPriceHistoryDays), http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	var product models.Product
+	if err := product.CheckProductExistsById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+	history, err := models.GetPriceHistory(db.DB, id, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.PriceHistoryFetchError, id), http.StatusInternalServerError, err)
+		return
+	}
+	lowest, ok := models.LowestPrice(history)
+	if !ok {
+		lowest = product.EffectivePrice()
+	}
+	resp := payloads.PriceHistoryResponse{ProductID: id, Days: days, LowestPrice: lowest, History: history}
+	utils.JsonResponse(resp, w, fmt.Sprintf(utils.PriceHistoryFetched, id), http.StatusOK)
+}
+
+// attachLowestPrice adds the lowest price of the last DefaultPriceHistoryDays days to the product page
+func attachLowestPrice(db *gorm.DB, productResp *payloads.ProductResponse) error {
+	history, err := models.GetPriceHistory(db, productResp.ID, time.Now().AddDate(0, 0, -constants.DefaultPriceHistoryDays))
+	if err != nil {
+		return err
+	}
+	if lowest, ok := models.LowestPrice(history); ok {
+		productResp.LowestPrice = &lowest
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/constants"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ReservationService interface {
+	ReserveStock(w http.ResponseWriter, r *http.Request)
+	ReleaseReservations(w http.ResponseWriter, r *http.Request)
+	ExtendReservations(w http.ResponseWriter, r *http.Request)
+	CommitReservations(w http.ResponseWriter, r *http.Request)
+	CancelReservations(w http.ResponseWriter, r *http.Request)
+}
+
+func reservationTTL(seconds int) time.Duration {
+	ttl := time.Duration(seconds) * time.Second
+	if ttl <= 0 {
+		return constants.DefaultReservationTTL
+	}
+	return min(ttl, constants.MaxReservationTTL)
+}
+
+func decodeReservationBatch(r *http.Request) (payloads.ReservationBatchRequest, error) {
+	var req payloads.ReservationBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, err
+	}
+	if len(req.References) == 0 {
+		return req, errors.New(utils.ReservationReferenceRequired)
+	}
+	return req, nil
+}
+
+// decodeReservationRequest reads the hold of a single product, bundle or variant
+func decodeReservationRequest(r *http.Request) (payloads.ReservationRequest, error) {
+	var req payloads.ReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, errors.New(utils.InvalidRequestBody)
+	}
+	if req.Reference == "" || len(req.Reference) > constants.MaxReservationReference {
+		return req, errors.New(utils.ReservationReferenceRequired)
+	}
+	if req.Quantity < 0 {
+		return req, errors.New(utils.InvalidRequestBody)
+	}
+	return req, nil
+}
+
+// ReserveStock holds stock of the product for a reference without touching Product.Quantity, products sold in
+// variants are held through ReserveVariant
+func (db *Service) ReserveStock(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	req, err := decodeReservationRequest(r)
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	var reservation models.StockReservation
+	if req.Quantity == 0 {
+		if err := reservation.Release(db.DB, id, req.Reference); err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.ReservationReleaseError, req.Reference), http.StatusInternalServerError, err)
+			return
+		}
+		utils.JsonResponse(nil, w, fmt.Sprintf(utils.ReservationsReleased, 1), http.StatusOK)
+		return
+	}
+
+	hasVariants, err := models.HasVariants(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ReservationFailed, id), http.StatusInternalServerError, err)
+		return
+	}
+	if hasVariants {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductRequiresVariant, id), http.StatusConflict, nil)
+		return
+	}
+
+	if err := reservation.Reserve(db.DB, id, req.Reference, req.Quantity, reservationTTL(req.TTLSeconds)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+			return
+		}
+		utils.JsonError(w, fmt.Sprintf(utils.ReservationFailed, id), http.StatusConflict, err)
+		return
+	}
+
+	utils.JsonResponse(reservation, w, fmt.Sprintf(utils.StockReserved, id), http.StatusOK)
+}
+
+func (db *Service) ReleaseReservations(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeReservationBatch(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+
+	released, err := models.ReleaseReservations(db.DB, req.References)
+	if err != nil {
+		utils.JsonError(w, utils.ReservationUpdateError, http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.ReservationsReleased, released), http.StatusOK)
+}
+
+func (db *Service) ExtendReservations(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeReservationBatch(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+
+	extended, err := models.ExtendReservations(db.DB, req.References, reservationTTL(req.TTLSeconds))
+	if err != nil {
+		utils.JsonError(w, utils.ReservationUpdateError, http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.ReservationsExtended, extended), http.StatusOK)
+}
+
+// CommitReservations decrements the stock held by the references once the order is placed
+func (db *Service) CommitReservations(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeReservationBatch(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if req.OrderID <= 0 {
+		utils.JsonError(w, utils.OrderIdRequired, http.StatusBadRequest, nil)
+		return
+	}
+
+	reservations, err := models.CommitReservations(db.DB, req.References, req.OrderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.JsonError(w, utils.ReservationNotFound, http.StatusNotFound, err)
+			return
+		}
+		utils.JsonError(w, fmt.Sprintf(utils.ReservationCommitError, req.OrderID), http.StatusConflict, err)
+		return
+	}
+	utils.JsonResponse(reservations, w, fmt.Sprintf(utils.ReservationsCommitted, req.OrderID), http.StatusOK)
+}
+
+// CancelReservations returns the stock committed for an order which could not be paid
+func (db *Service) CancelReservations(w http.ResponseWriter, r *http.Request) {
+	var req payloads.ReservationBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if req.OrderID <= 0 {
+		utils.JsonError(w, utils.OrderIdRequired, http.StatusBadRequest, nil)
+		return
+	}
+
+	canceled, err := models.CancelCommittedReservations(db.DB, req.OrderID)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ReservationCancelError, req.OrderID), http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.ReservationsCanceled, canceled, req.OrderID), http.StatusOK)
+}
+
+// StartReservationSweeper expires stale holds in the background until the process stops
+func StartReservationSweeper(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			expired, err := models.ExpireReservations(db)
+			if err != nil {
+				utils.LogError(utils.ReservationUpdateError, map[string]interface{}{"error": err.Error()})
+				continue
+			}
+			if expired > 0 {
+				utils.LogInfo(fmt.Sprintf(utils.ReservationsExpired, expired), nil)
+			}
+		}
+	}()
+}
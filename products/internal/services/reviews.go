@@ -0,0 +1,490 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/media"
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/constants"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReviewService interface {
+	GetProductReviews(w http.ResponseWriter, r *http.Request)
+	CreateReview(w http.ResponseWriter, r *http.Request)
+	GetReviewById(w http.ResponseWriter, r *http.Request)
+	UpdateReview(w http.ResponseWriter, r *http.Request)
+	DeleteReview(w http.ResponseWriter, r *http.Request)
+	VoteReview(w http.ResponseWriter, r *http.Request)
+	UploadReviewPhotos(w http.ResponseWriter, r *http.Request)
+	GetModerationQueue(w http.ResponseWriter, r *http.Request)
+	ModerateReview(w http.ResponseWriter, r *http.Request)
+}
+
+// reviewPhotoSizes review photos only get one thumbnail, shown in the review list
+var reviewPhotoSizes = []media.ThumbnailSize{{Name: "small", Side: 150}}
+
+// checkVerifiedPurchase asks the order service whether the user bought the product, with the caller's token
+func checkVerifiedPurchase(r *http.Request, userId, productId int) (bool, error) {
+	link := fmt.Sprintf(constants.MicroserviceLinks()["orderMSPurchaseCallLink"], userId, productId)
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", r.Header.Get("Authorization"))
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf(utils.ErrorCallingOrderMicroservice)
+	}
+
+	var body struct {
+		Data struct {
+			Purchased bool `json:"purchased"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return false, err
+	}
+	return body.Data.Purchased, nil
+}
+
+// validateReviewText checks the rating and the text of a review, fields left out are not checked
+func validateReviewText(req payloads.ReviewRequest) error {
+	if req.Rating != nil && (*req.Rating < constants.MinReviewRating || *req.Rating > constants.MaxReviewRating) {
+		return fmt.Errorf(utils.InvalidReviewRating, constants.MinReviewRating, constants.MaxReviewRating)
+	}
+	if (req.Title != nil && len([]rune(strings.TrimSpace(*req.Title))) > constants.MaxReviewTitle) ||
+		(req.Body != nil && len([]rune(strings.TrimSpace(*req.Body))) > constants.MaxReviewBody) {
+		return fmt.Errorf(utils.InvalidReviewText, constants.MaxReviewTitle, constants.MaxReviewBody)
+	}
+	return nil
+}
+
+// parseReviewListQuery reads limit, offset, sort, rating and verified of a review listing
+func parseReviewListQuery(r *http.Request, defaultSort string) (models.ReviewListOptions, error) {
+	params := r.URL.Query()
+	opts := models.ReviewListOptions{Limit: constants.DefaultReviewLimit, Sort: params.Get("sort")}
+	if opts.Sort == "" {
+		opts.Sort = defaultSort
+	}
+	if !models.IsReviewSort(opts.Sort) {
+		return opts, fmt.Errorf(utils.InvalidReviewSort, opts.Sort)
+	}
+
+	ints := map[string]*int{"limit": &opts.Limit, "offset": &opts.Offset, "rating": &opts.Rating}
+	for name, target := range ints {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return opts, fmt.Errorf(utils.InvalidReviewParam, name)
+		}
+		*target = parsed
+	}
+	if opts.Limit < 1 || opts.Limit > constants.MaxReviewLimit {
+		return opts, fmt.Errorf(utils.InvalidReviewParam, "limit")
+	}
+	if opts.Rating != 0 && (opts.Rating < constants.MinReviewRating || opts.Rating > constants.MaxReviewRating) {
+		return opts, fmt.Errorf(utils.InvalidReviewParam, "rating")
+	}
+	if verified := params.Get("verified"); verified != "" {
+		parsed, err := strconv.ParseBool(verified)
+		if err != nil {
+			return opts, fmt.Errorf(utils.InvalidReviewParam, "verified")
+		}
+		opts.VerifiedOnly = parsed
+	}
+	return opts, nil
+}
+
+// ownReview loads the review of the path and checks the caller wrote it, it writes the error response itself
+func (db *Service) ownReview(w http.ResponseWriter, r *http.Request) (*models.Review, bool) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidReviewIDError, http.StatusBadRequest, err)
+		return nil, false
+	}
+	var review models.Review
+	if err := review.GetReviewById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewNotFound, id), http.StatusNotFound, err)
+		return nil, false
+	}
+	if review.UserID != utils.GetUserIdFromContext(r) {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewNotOwned, id), http.StatusForbidden, nil)
+		return nil, false
+	}
+	return &review, true
+}
+
+// GetProductReviews lists the approved reviews of a product with its rating summary (GET /products/{id}/reviews)
+func (db *Service) GetProductReviews(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+	opts, err := parseReviewListQuery(r, models.DefaultReviewSort)
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	var product models.Product
+	if err := product.CheckProductExistsById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+
+	opts.Status = models.ReviewStatusApproved
+	reviews, total, err := models.ListReviews(db.DB, id, opts)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := payloads.ReviewListResponse{
+		Reviews: reviews,
+		Total:   total,
+		Limit:   opts.Limit,
+		Offset:  opts.Offset,
+		Summary: &payloads.RatingSummary{Average: product.Rating, Count: product.RatingCount, Histogram: product.RatingHistogram},
+	}
+	utils.JsonResponse(resp, w, fmt.Sprintf(utils.ReviewsFetched, len(reviews)), http.StatusOK)
+}
+
+// CreateReview reviews a product (POST /product/{id}/reviews), the review waits for moderation. It is marked as
+// a verified purchase when the order service knows an order of the product by the caller
+func (db *Service) CreateReview(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+	userId := utils.GetUserIdFromContext(r)
+
+	var req payloads.ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if req.Rating == nil {
+		err := fmt.Errorf(utils.InvalidReviewRating, constants.MinReviewRating, constants.MaxReviewRating)
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if err := validateReviewText(req); err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	var product models.Product
+	if err := product.CheckProductExistsById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+	exists, err := models.ReviewExists(db.DB, id, userId)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewCreationError, id), http.StatusInternalServerError, err)
+		return
+	}
+	if exists {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewAlreadyExists, id), http.StatusConflict, nil)
+		return
+	}
+
+	review := models.Review{ProductID: id, UserID: userId, Rating: *req.Rating}
+	if req.Title != nil {
+		review.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Body != nil {
+		review.Body = strings.TrimSpace(*req.Body)
+	}
+	//the review is still taken when the order service can't answer, it is then just not verified
+	verified, err := checkVerifiedPurchase(r, userId, id)
+	if err != nil {
+		utils.LogError(fmt.Sprintf(utils.PurchaseCheckFailed, userId, id), map[string]interface{}{"error": err.Error()})
+	}
+	review.VerifiedPurchase = verified
+
+	if err := review.CreateReview(db.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewCreationError, id), http.StatusInternalServerError, err)
+		return
+	}
+	review.Photos = []models.ReviewPhoto{}
+	utils.JsonResponse(review, w, fmt.Sprintf(utils.ReviewCreated, review.ID), http.StatusCreated)
+}
+
+// GetReviewById returns a published review (GET /product/reviews/{id})
+func (db *Service) GetReviewById(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidReviewIDError, http.StatusBadRequest, err)
+		return
+	}
+	var review models.Review
+	if err := review.GetReviewById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewNotFound, id), http.StatusNotFound, err)
+		return
+	}
+	if review.Status != models.ReviewStatusApproved {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewNotFound, id), http.StatusNotFound, nil)
+		return
+	}
+	utils.JsonResponse(review, w, fmt.Sprintf(utils.ReviewFetched, id), http.StatusOK)
+}
+
+// UpdateReview edits the caller's review (PUT /product/reviews/{id}), it goes back to moderation
+func (db *Service) UpdateReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := db.ownReview(w, r)
+	if !ok {
+		return
+	}
+	var req payloads.ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if err := validateReviewText(req); err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	updatedFields := map[string]interface{}{}
+	if req.Rating != nil {
+		updatedFields["rating"] = *req.Rating
+	}
+	if req.Title != nil {
+		updatedFields["title"] = strings.TrimSpace(*req.Title)
+	}
+	if req.Body != nil {
+		updatedFields["body"] = strings.TrimSpace(*req.Body)
+	}
+	if len(updatedFields) == 0 {
+		utils.JsonResponse(review, w, fmt.Sprintf(utils.ReviewFetched, review.ID), http.StatusOK)
+		return
+	}
+
+	wasApproved := review.Status == models.ReviewStatusApproved
+	if err := review.UpdateReview(db.DB, updatedFields); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewUpdateError, review.ID), http.StatusInternalServerError, err)
+		return
+	}
+	if wasApproved {
+		indexProducts(db.DB, review.ProductID)
+	}
+	utils.JsonResponse(review, w, fmt.Sprintf(utils.ReviewUpdated, review.ID), http.StatusOK)
+}
+
+// DeleteReview removes the caller's review with its photos (DELETE /product/reviews/{id})
+func (db *Service) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := db.ownReview(w, r)
+	if !ok {
+		return
+	}
+	if err := review.DeleteReview(db.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewDeletionError, review.ID), http.StatusInternalServerError, err)
+		return
+	}
+	deleteImageFiles(review.PhotoStorageKeys())
+	if review.Status == models.ReviewStatusApproved {
+		indexProducts(db.DB, review.ProductID)
+	}
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.ReviewDeleted, review.ID), http.StatusOK)
+}
+
+// VoteReview records whether the caller found a published review helpful (POST /product/reviews/{id}/vote)
+func (db *Service) VoteReview(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidReviewIDError, http.StatusBadRequest, err)
+		return
+	}
+	var req payloads.ReviewVoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Helpful == nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+
+	var review models.Review
+	if err := review.GetReviewById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewNotFound, id), http.StatusNotFound, err)
+		return
+	}
+	if review.Status != models.ReviewStatusApproved {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewNotPublished, id), http.StatusConflict, nil)
+		return
+	}
+	userId := utils.GetUserIdFromContext(r)
+	if review.UserID == userId {
+		utils.JsonError(w, utils.ReviewOwnVote, http.StatusForbidden, nil)
+		return
+	}
+
+	if err := review.Vote(db.DB, userId, *req.Helpful); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewVoteError, id), http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(review, w, fmt.Sprintf(utils.ReviewVoted, id), http.StatusOK)
+}
+
+// UploadReviewPhotos adds the files of the photo field of a multipart form to the caller's review
+// (POST /product/reviews/{id}/photos), the photos go through the checks of product images
+func (db *Service) UploadReviewPhotos(w http.ResponseWriter, r *http.Request) {
+	review, ok := db.ownReview(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, constants.MaxUploadBytes)
+	if err := r.ParseMultipartForm(constants.MaxImageBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.JsonError(w, fmt.Sprintf(utils.ImageTooLarge, constants.MaxUploadBytes), http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		utils.JsonError(w, utils.InvalidMultipartForm, http.StatusBadRequest, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	files := r.MultipartForm.File["photo"]
+	if len(files) == 0 {
+		utils.JsonError(w, utils.NoImageUploaded, http.StatusBadRequest, nil)
+		return
+	}
+	if len(review.Photos)+len(files) > constants.MaxReviewPhotos {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewPhotoLimitReached, review.ID, constants.MaxReviewPhotos), http.StatusBadRequest, nil)
+		return
+	}
+
+	processed := make([]*media.ProcessedImage, 0, len(files))
+	for _, header := range files {
+		data, err := readFormFile(header)
+		if err != nil {
+			utils.JsonError(w, utils.FileRetrieveFailed, http.StatusBadRequest, err)
+			return
+		}
+		photo, err := media.Process(data, imageLimits, reviewPhotoSizes)
+		if err != nil {
+			if errors.Is(err, media.ErrInvalidImage) {
+				utils.JsonError(w, fmt.Sprintf("%s: %s", header.Filename, err.Error()), http.StatusBadRequest, err)
+				return
+			}
+			utils.JsonError(w, utils.ErrorSavingFile, http.StatusInternalServerError, err)
+			return
+		}
+		processed = append(processed, photo)
+	}
+
+	photos := make([]models.ReviewPhoto, 0, len(processed))
+	var stored []string
+	for _, p := range processed {
+		name := uuid.NewString()
+		thumbnail := p.Thumbnails[reviewPhotoSizes[0].Name]
+		photo := models.ReviewPhoto{
+			StorageKey:          fmt.Sprintf("reviews/%d/%s.%s", review.ID, name, p.Original.Ext),
+			ThumbnailStorageKey: fmt.Sprintf("reviews/%d/%s_%s.%s", review.ID, name, reviewPhotoSizes[0].Name, thumbnail.Ext),
+			Width:               p.Original.Width,
+			Height:              p.Original.Height,
+		}
+		photo.URL = imageStorage.URL(photo.StorageKey)
+		photo.ThumbnailURL = imageStorage.URL(photo.ThumbnailStorageKey)
+		for key, data := range map[string][]byte{photo.StorageKey: p.Original.Data, photo.ThumbnailStorageKey: thumbnail.Data} {
+			if err := imageStorage.Put(key, data); err != nil {
+				deleteImageFiles(append(stored, key))
+				utils.JsonError(w, utils.UnableToSaveFile, http.StatusInternalServerError, err)
+				return
+			}
+			stored = append(stored, key)
+		}
+		photos = append(photos, photo)
+	}
+
+	wasApproved := review.Status == models.ReviewStatusApproved
+	if err := review.AddPhotos(db.DB, photos); err != nil {
+		deleteImageFiles(stored)
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewUpdateError, review.ID), http.StatusInternalServerError, err)
+		return
+	}
+	if wasApproved {
+		indexProducts(db.DB, review.ProductID)
+	}
+	utils.JsonResponse(review, w, fmt.Sprintf(utils.ReviewPhotosAdded, len(photos), review.ID), http.StatusCreated)
+}
+
+// GetModerationQueue lists the reviews of every product with a status, pending ones oldest first by default
+// (GET /product/reviews/moderation), admin only
+func (db *Service) GetModerationQueue(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.ReviewStatusPending
+	}
+	if status != models.ReviewStatusPending && status != models.ReviewStatusApproved && status != models.ReviewStatusRejected {
+		err := fmt.Errorf(utils.InvalidReviewStatus, status)
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	opts, err := parseReviewListQuery(r, "oldest")
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	opts.Status = status
+
+	reviews, total, err := models.ListReviews(db.DB, 0, opts)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	resp := payloads.ReviewListResponse{Reviews: reviews, Total: total, Limit: opts.Limit, Offset: opts.Offset}
+	utils.JsonResponse(resp, w, fmt.Sprintf(utils.ReviewsFetched, len(reviews)), http.StatusOK)
+}
+
+// ModerateReview approves or rejects a review (PUT /product/reviews/{id}/moderation), admin only. The product
+// rating follows the reviews which are approved
+func (db *Service) ModerateReview(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidReviewIDError, http.StatusBadRequest, err)
+		return
+	}
+	var req payloads.ReviewModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	req.Status = strings.ToLower(strings.TrimSpace(req.Status))
+	if req.Status != models.ReviewStatusApproved && req.Status != models.ReviewStatusRejected {
+		utils.JsonError(w, utils.InvalidModerationStatus, http.StatusBadRequest, nil)
+		return
+	}
+
+	var review models.Review
+	if err := review.GetReviewById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewNotFound, id), http.StatusNotFound, err)
+		return
+	}
+	changesRating := (review.Status == models.ReviewStatusApproved) != (req.Status == models.ReviewStatusApproved)
+	if err := review.Moderate(db.DB, req.Status, strings.TrimSpace(req.Note), utils.GetUserIdFromContext(r)); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ReviewUpdateError, id), http.StatusInternalServerError, err)
+		return
+	}
+	if changesRating {
+		indexProducts(db.DB, review.ProductID)
+	}
+	utils.JsonResponse(review, w, fmt.Sprintf(utils.ReviewModerated, id, req.Status), http.StatusOK)
+}
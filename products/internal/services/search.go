@@ -0,0 +1,169 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/internal/search"
+	"e-commerce-backend/products/pkg/constants"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// searchIndex inverted index of the products of this process, built on start and kept up to date by the
+// handlers changing products
+var searchIndex = search.NewIndex(search.DefaultSynonyms)
+
+type SearchService interface {
+	SearchProducts(w http.ResponseWriter, r *http.Request)
+}
+
+func toSearchDocument(product models.Product, tags []string) search.Document {
+	return search.Document{
+		ID:          product.ID,
+		Name:        product.PName,
+		Description: product.PDesc,
+		Category:    product.Category,
+		Tags:        tags,
+		Price:       product.Price,
+		Rating:      product.Rating,
+	}
+}
+
+// BuildSearchIndex indexes every product which is not deleted
+func BuildSearchIndex(db *gorm.DB) error {
+	products, err := models.GetAllProducts(db)
+	if err != nil {
+		return err
+	}
+	ids := make([]int, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+	tags, err := models.GetTagNamesByProductIds(db, ids)
+	if err != nil {
+		return err
+	}
+
+	docs := make([]search.Document, 0, len(products))
+	for _, product := range products {
+		docs = append(docs, toSearchDocument(product, tags[product.ID]))
+	}
+	searchIndex.Rebuild(docs)
+	utils.LogInfo(fmt.Sprintf(utils.SearchIndexBuilt, searchIndex.Len()), nil)
+	return nil
+}
+
+// indexProducts brings the index in step with the products of ids, deleted products leave it. A failure is
+// only logged, the product change itself already went through
+func indexProducts(db *gorm.DB, ids ...int) {
+	products, err := models.GetProductsByIds(db, ids)
+	if err == nil {
+		var tags map[int][]string
+		if tags, err = models.GetTagNamesByProductIds(db, ids); err == nil {
+			indexed := map[int]bool{}
+			for _, product := range products {
+				searchIndex.Upsert(toSearchDocument(product, tags[product.ID]))
+				indexed[product.ID] = true
+			}
+			for _, id := range ids {
+				if !indexed[id] {
+					searchIndex.Remove(id)
+				}
+			}
+			return
+		}
+	}
+	for _, id := range ids {
+		utils.LogError(fmt.Sprintf(utils.SearchIndexError, id), map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// parseSearchQuery reads the search parameters, q is the text and the others narrow the matches
+func parseSearchQuery(r *http.Request) (search.Query, error) {
+	params := r.URL.Query()
+	q := search.Query{
+		Text:     params.Get("q"),
+		Category: params.Get("category"),
+		Limit:    constants.DefaultSearchLimit,
+	}
+	if tags := params.Get("tags"); tags != "" {
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				q.Tags = append(q.Tags, tag)
+			}
+		}
+	}
+
+	floats := map[string]*float64{"min_price": &q.MinPrice, "max_price": &q.MaxPrice, "min_rating": &q.MinRating}
+	for name, field := range floats {
+		if value := params.Get(name); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 0 {
+				return q, fmt.Errorf(utils.InvalidSearchParam, name)
+			}
+			*field = parsed
+		}
+	}
+	ints := map[string]*int{"limit": &q.Limit, "offset": &q.Offset}
+	for name, field := range ints {
+		if value := params.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				return q, fmt.Errorf(utils.InvalidSearchParam, name)
+			}
+			*field = parsed
+		}
+	}
+	if q.Limit == 0 {
+		q.Limit = constants.DefaultSearchLimit
+	}
+	q.Limit = min(q.Limit, constants.MaxSearchLimit)
+	return q, nil
+}
+
+// SearchProducts ranks the products by how well name, tags, category and description match q
+// (GET /products/search?q=...), the facets count every match and not only the returned page
+func (db *Service) SearchProducts(w http.ResponseWriter, r *http.Request) {
+	q, err := parseSearchQuery(r)
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	result := searchIndex.Search(q)
+	ids := make([]int, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		ids = append(ids, hit.ID)
+	}
+	products, err := models.GetProductsByIds(db.DB, ids)
+	if err != nil {
+		utils.JsonError(w, utils.ProductsFetchError, http.StatusInternalServerError, err)
+		return
+	}
+	productResps, err := models.ToProductResponses(db.DB, products)
+	if err != nil {
+		utils.JsonError(w, utils.ProductsFetchError, http.StatusInternalServerError, err)
+		return
+	}
+	byId := make(map[int]payloads.ProductResponse, len(productResps))
+	for _, productResp := range productResps {
+		byId[productResp.ID] = productResp
+	}
+
+	resp := payloads.ProductSearchResponse{Query: q.Text, Total: result.Total, Results: []payloads.ProductSearchResult{}, Facets: result.Facets}
+	for _, hit := range result.Hits {
+		productResp, ok := byId[hit.ID]
+		if !ok {
+			//deleted since it was indexed
+			continue
+		}
+		resp.Results = append(resp.Results, payloads.ProductSearchResult{ProductResponse: productResp, Score: hit.Score})
+	}
+
+	utils.JsonResponse(resp, w, fmt.Sprintf(utils.SearchResultsFound, resp.Total), http.StatusOK)
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/constants"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/middlewares"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SellerService interface {
+	AssignProductSeller(w http.ResponseWriter, r *http.Request)
+	GetSellerProducts(w http.ResponseWriter, r *http.Request)
+	GetSellerSales(w http.ResponseWriter, r *http.Request)
+	GetSellerLowStock(w http.ResponseWriter, r *http.Request)
+}
+
+// checkSeller makes sure the user holds the seller role of the users service before products are tied to it
+func checkSeller(db *gorm.DB, sellerId int) (int, error) {
+	isSeller, err := middlewares.HasRole(db, sellerId, constants.SellerRole)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf(utils.SellerCheckFailed, sellerId)
+	}
+	if !isSeller {
+		return http.StatusBadRequest, fmt.Errorf(utils.UserNotSeller, sellerId)
+	}
+	return http.StatusOK, nil
+}
+
+// resolveProductSeller is the seller a new product is added for, sellers add their own products and admins can
+// add them for any seller
+func (db *Service) resolveProductSeller(r *http.Request, requested int) (int, int, error) {
+	userId := utils.GetUserIdFromContext(r)
+	if requested == 0 || requested == userId {
+		return userId, http.StatusOK, nil
+	}
+	isAdmin, err := middlewares.HasRole(db.DB, userId, constants.AdminRole)
+	if err != nil {
+		return 0, http.StatusInternalServerError, fmt.Errorf(utils.SellerCheckFailed, userId)
+	}
+	if !isAdmin {
+		return 0, http.StatusForbidden, errors.New(utils.ProductSellerForbidden)
+	}
+	if status, err := checkSeller(db.DB, requested); err != nil {
+		return 0, status, err
+	}
+	return requested, http.StatusOK, nil
+}
+
+// authorizeProductOwner writes the error and returns false unless the caller is the seller of the product or an admin
+func (db *Service) authorizeProductOwner(w http.ResponseWriter, r *http.Request, product *models.Product) bool {
+	userId := utils.GetUserIdFromContext(r)
+	if userId != 0 && product.SellerID == userId {
+		return true
+	}
+	isAdmin, err := middlewares.HasRole(db.DB, userId, constants.AdminRole)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.SellerCheckFailed, userId), http.StatusInternalServerError, err)
+		return false
+	}
+	if !isAdmin {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotOwned, product.ID), http.StatusForbidden, nil)
+		return false
+	}
+	return true
+}
+
+// RequireProductOwner lets a request for the product of the {id} path through only for its seller or an admin,
+// it goes after AuthMiddleware
+func (db *Service) RequireProductOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := utils.GetIDFromPath(r)
+		if err != nil {
+			utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+			return
+		}
+		var product models.Product
+		if err := product.CheckProductExistsById(db.DB, id); err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+			return
+		}
+		if !db.authorizeProductOwner(w, r, &product) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireVariantOwner is RequireProductOwner for the variant of the {id} path, the variant belongs to the seller
+// of its product
+func (db *Service) RequireVariantOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := utils.GetIDFromPath(r)
+		if err != nil {
+			utils.JsonError(w, utils.InvalidVariantIDError, http.StatusBadRequest, err)
+			return
+		}
+		var variant models.ProductVariant
+		if err := variant.GetVariantById(db.DB, id); err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.VariantNotFoundError, id), http.StatusNotFound, err)
+			return
+		}
+		var product models.Product
+		if err := product.CheckProductExistsById(db.DB, variant.ProductID); err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, variant.ProductID), http.StatusNotFound, err)
+			return
+		}
+		if !db.authorizeProductOwner(w, r, &product) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AssignProductSeller moves a product to another seller (PUT /product/{id}/seller), products added before they
+// were tied to sellers get theirs this way
+func (db *Service) AssignProductSeller(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+	var req payloads.ProductSellerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if req.SellerID <= 0 {
+		utils.JsonError(w, utils.InvalidSellerRequest, http.StatusBadRequest, nil)
+		return
+	}
+
+	var product models.Product
+	if err := product.CheckProductExistsById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+	if status, err := checkSeller(db.DB, req.SellerID); err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+	if err := product.AssignSeller(db.DB, req.SellerID); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.SellerAssignError, id), http.StatusInternalServerError, err)
+		return
+	}
+
+	resp, err := product.FetchProductResp(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, utils.ProductsFetchError, http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(resp, w, fmt.Sprintf(utils.ProductSellerAssigned, id, req.SellerID), http.StatusOK)
+}
+
+// GetSellerProducts lists the catalog of the calling seller with the paging, sorting and fields of /products
+func (db *Service) GetSellerProducts(w http.ResponseWriter, r *http.Request) {
+	sellerId := utils.GetUserIdFromContext(r)
+	scope := func(query *gorm.DB) *gorm.DB {
+		return query.Where("seller_id = ?", sellerId)
+	}
+	db.listProducts(w, r, scope, fmt.Sprintf(utils.SellerProductsFetched, sellerId))
+}
+
+// parseSalesPeriod reads the from and to dates of the query, to is included. Without them the period is the
+// last 30 days
+func parseSalesPeriod(r *http.Request) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		day, err := time.Parse(constants.SalesPeriodLayout, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+	from := to.Add(-constants.DefaultSalesPeriod)
+	if value := query.Get("from"); value != "" {
+		day, err := time.Parse(constants.SalesPeriodLayout, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		from = day
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, errors.New(utils.InvalidSalesPeriod)
+	}
+	return from, to, nil
+}
+
+// GetSellerSales sums what the calling seller sold per product within a period (GET /product/seller/sales)
+func (db *Service) GetSellerSales(w http.ResponseWriter, r *http.Request) {
+	sellerId := utils.GetUserIdFromContext(r)
+	from, to, err := parseSalesPeriod(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidSalesPeriod, http.StatusBadRequest, err)
+		return
+	}
+
+	sales, err := models.GetSellerSales(db.DB, sellerId, from, to)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.SellerSalesFetchError, sellerId), http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(sales, w, fmt.Sprintf(utils.SellerSalesFetched, sellerId), http.StatusOK)
+}
+
+// GetSellerLowStock lists the products and variants of the calling seller with few units left
+// (GET /product/seller/low-stock), ?threshold sets how few instead of the reorder threshold of each product
+func (db *Service) GetSellerLowStock(w http.ResponseWriter, r *http.Request) {
+	sellerId := utils.GetUserIdFromContext(r)
+	//without a threshold every product is checked against its own reorder threshold
+	threshold, perProduct := constants.DefaultLowStockThreshold, true
+	if value := r.URL.Query().Get("threshold"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			utils.JsonError(w, utils.InvalidStockThreshold, http.StatusBadRequest, err)
+			return
+		}
+		threshold, perProduct = parsed, false
+	}
+
+	items, err := models.GetSellerLowStock(db.DB, sellerId, threshold, perProduct)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.SellerStockFetchError, sellerId), http.StatusInternalServerError, err)
+		return
+	}
+	utils.JsonResponse(items, w, fmt.Sprintf(utils.SellerLowStockFetched, len(items), sellerId), http.StatusOK)
+}
@@ -8,11 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
-	"io"
-	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -51,7 +47,8 @@ func trackUpdatedProductFields(oldData models.Product, newData payloads.ProductR
 		field := v.Type().Field(i)
 		fieldName := field.Name
 		fieldValue := v.Field(i)
-		if fieldName == "Tags" {
+		//the seller only changes through AssignProductSeller
+		if fieldName == "Tags" || fieldName == "SellerID" {
 			continue
 		}
 		if fieldValue.IsZero() || fieldName == "ID" {
@@ -70,13 +67,24 @@ func trackUpdatedProductFields(oldData models.Product, newData payloads.ProductR
 	return updatedFields
 }
 
-func (db *Service) GetProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := models.GetProducts()
+// checkProductSKU rejects a sku another product already uses, products without a sku are fine
+func (db *Service) checkProductSKU(sku string, excludeId int) (int, error) {
+	if sku == "" {
+		return http.StatusOK, nil
+	}
+	exists, err := models.ProductSKUExists(db.DB, sku, excludeId)
 	if err != nil {
-		utils.JsonError(w, utils.ProductNotFoundError, http.StatusNotFound, err[0])
+		return http.StatusInternalServerError, errors.New(utils.DatabaseConnectionError)
 	}
+	if exists {
+		return http.StatusConflict, fmt.Errorf(utils.ProductSKUExists, sku)
+	}
+	return http.StatusOK, nil
+}
 
-	utils.JsonResponse(products, w, utils.ProductsFetchedSuccessfully, http.StatusOK)
+// GetProducts lists the products a page at a time, see parseListQuery for paging, sorting and fields
+func (db *Service) GetProducts(w http.ResponseWriter, r *http.Request) {
+	db.listProducts(w, r, allProducts, utils.ProductsFetchedSuccessfully)
 }
 
 func (db *Service) GetProductById(w http.ResponseWriter, r *http.Request) {
@@ -105,18 +113,16 @@ func (db *Service) GetProductById(w http.ResponseWriter, r *http.Request) {
 		productResp.Tags = tags
 	}
 
-	utils.JsonResponse(productResp, w, fmt.Sprintf(utils.ProductFetchedSuccessfully, id), http.StatusOK)
-}
-
-func (db *Service) FetchCategories(w http.ResponseWriter, r *http.Request) {
-	var p models.Product
-	categories, err := p.FetchProductCategories(db.DB)
-	if err != nil {
-		utils.JsonError(w, utils.CategoryNotFoundError, http.StatusNotFound, err)
+	if err := attachVariants(db.DB, productResp); err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	if err := attachLowestPrice(db.DB, productResp); err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.JsonResponse(categories, w, utils.CategoriesFetchedSuccessfully, http.StatusOK)
+	utils.JsonResponse(productResp, w, fmt.Sprintf(utils.ProductFetchedSuccessfully, id), http.StatusOK)
 }
 
 func (db *Service) AddProduct(w http.ResponseWriter, r *http.Request) {
@@ -135,14 +141,32 @@ func (db *Service) AddProduct(w http.ResponseWriter, r *http.Request) {
 		utils.JsonError(w, utils.InvalidProductDataError, http.StatusBadRequest, nil)
 		return
 	}
+	if err := resolveProductCategory(db.DB, &newProduct); err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	sellerId, status, err := db.resolveProductSeller(r, newProduct.SellerID)
+	if err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+	if status, err := db.checkProductSKU(newProduct.SKU, 0); err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
 
 	var product models.Product
 	if err := models.CopyStructIntoStruct(&newProduct, &product); err != nil {
 		utils.JsonError(w, utils.InvalidProductDataError, http.StatusBadRequest, err)
 		return
 	}
+	product.SellerID = sellerId
+	if err := product.ValidateQuantityRules(); err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
 
-	id, err := product.AddProduct(db.DB)
+	id, err := product.AddProduct(db.DB, utils.GetUserIdFromContext(r))
 	if err != nil {
 		utils.JsonError(w, utils.ProductCreationError, http.StatusInternalServerError, err)
 		return
@@ -158,6 +182,7 @@ func (db *Service) AddProduct(w http.ResponseWriter, r *http.Request) {
 		errStr := utils.ErrorsToString(errs)
 		utils.JsonError(w, utils.FailedAddingTagToProduct, http.StatusNotFound, errors.New(errStr))
 	}
+	indexProducts(db.DB, id)
 
 	createdProduct, err := product.FetchProductResp(db.DB, id)
 	if err != nil {
@@ -191,6 +216,25 @@ func (db *Service) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
 		return
 	}
+	if err := resolveProductCategory(db.DB, &newProduct); err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if status, err := db.checkProductSKU(newProduct.SKU, id); err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+
+	//rules are checked as they will be once the update is applied
+	merged := existingP
+	if err := models.CopyStructIntoStruct(&newProduct, &merged); err != nil {
+		utils.JsonError(w, utils.InvalidProductDataError, http.StatusBadRequest, err)
+		return
+	}
+	if err := merged.ValidateQuantityRules(); err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
 
 	updatedFields := trackUpdatedProductFields(existingP, newProduct)
 	if len(updatedFields) == 0 {
@@ -198,7 +242,11 @@ func (db *Service) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := existingP.UpdateProduct(db.DB, id, updatedFields); err != nil {
+	if err := existingP.UpdateProduct(db.DB, id, updatedFields, utils.GetUserIdFromContext(r)); err != nil {
+		if errors.Is(err, models.ErrInsufficientStock) {
+			utils.JsonError(w, err.Error(), http.StatusConflict, err)
+			return
+		}
 		if strings.Contains(err.Error(), "not found") {
 			utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusInternalServerError, err)
 			return
@@ -218,6 +266,7 @@ func (db *Service) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		utils.JsonError(w, fmt.Sprintf(utils.ProductTagUpdateError, id), http.StatusBadRequest, errors.New(errStr))
 		return
 	}
+	indexProducts(db.DB, id)
 
 	productResp, err := existingP.FetchProductResp(db.DB, id)
 	if err != nil {
@@ -249,77 +298,11 @@ func (db *Service) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 		utils.JsonError(w, fmt.Sprintf(utils.ProductDeletionError, id), http.StatusInternalServerError, err)
 		return
 	}
+	searchIndex.Remove(id)
 
 	utils.JsonResponse(nil, w, fmt.Sprintf(utils.ProductDeletedSuccessfully, id), http.StatusOK)
 }
 
-func (db *Service) UploadProductImageHandler(w http.ResponseWriter, r *http.Request) {
-	productID := getProductID(r.URL.Path)
-	if productID == 0 {
-		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, nil)
-		return
-	}
-	log.Println(productID)
-
-	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
-
-	err := r.ParseMultipartForm(10 << 20) // 10MB max memory
-	if err != nil {
-		utils.JsonError(w, "Unable to parse form", http.StatusBadRequest, err)
-		return
-	}
-
-	file, handler, err := r.FormFile("image")
-	if err != nil {
-		utils.JsonError(w, utils.FileRetrieveFailed, http.StatusBadRequest, err)
-		return
-	}
-	defer file.Close()
-
-	uploadDir := "./uploads"
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		os.Mkdir(uploadDir, 0755)
-	}
-
-	filePath := filepath.Join(uploadDir, fmt.Sprintf("%d-%s", productID, handler.Filename))
-	destFile, err := os.Create(filePath)
-	if err != nil {
-		utils.JsonError(w, utils.UnableToSaveFile, http.StatusInternalServerError, err)
-		return
-	}
-	log.Println(filePath, *destFile)
-	defer destFile.Close()
-
-	_, err = io.Copy(destFile, file)
-	if err != nil {
-		utils.JsonError(w, utils.ErrorSavingFile, http.StatusInternalServerError, err)
-		return
-	}
-
-}
-
-func getProductID(path string) int {
-	segments := splitPath(path)
-	if len(segments) >= 2 && segments[0] == "products" {
-		id, err := strconv.Atoi(segments[1])
-		if err == nil {
-			return id
-		}
-	}
-	return 0
-}
-
-func splitPath(path string) []string {
-	segments := strings.Split(path, "/")
-	var cleanedSegments []string
-	for _, segment := range segments {
-		if segment != "" {
-			cleanedSegments = append(cleanedSegments, segment)
-		}
-	}
-	return cleanedSegments
-}
-
 func (db *Service) UpdateProductQuantityHandler(w http.ResponseWriter, r *http.Request) {
 	productID := mux.Vars(r)["id"]
 	if productID == "" {
@@ -335,74 +318,115 @@ func (db *Service) UpdateProductQuantityHandler(w http.ResponseWriter, r *http.R
 
 	// Parse request body
 	var req struct {
-		Quantity int    `json:"quantity"`
-		Method   string `json:"method"`
+		Quantity    int    `json:"quantity"`
+		Method      string `json:"method"`
+		WarehouseID int    `json:"warehouse_id"` // 0 books the change in the default warehouse
+		Reason      string `json:"reason"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.JsonError(w, "Invalid request body", http.StatusBadRequest, err)
 		return
 	}
+	if req.Quantity <= 0 {
+		utils.JsonError(w, fmt.Sprintf(utils.InvalidMovementQuantity, req.Method), http.StatusBadRequest, nil)
+		return
+	}
+
+	if req.WarehouseID != 0 {
+		if status, err := checkWarehouse(db.DB, req.WarehouseID, req.Method == ProductAddQuanMethod); err != nil {
+			utils.JsonError(w, err.Error(), status, err)
+			return
+		}
+	}
 
-	// Update product quantity in the database
+	// Update product quantity in the database, the change is booked in the stock ledger
+	movement := models.StockMovement{
+		WarehouseID: req.WarehouseID,
+		ProductID:   productIDInt,
+		Reason:      req.Reason,
+		ActorID:     utils.GetUserIdFromContext(r),
+	}
 	var productResp payloads.ProductResponse
 	if req.Method == ProductAddQuanMethod {
-		productResp, err = AddQuantity(db.DB, productIDInt, req.Quantity)
+		productResp, err = AddQuantity(db.DB, movement, req.Quantity)
 	} else if req.Method == ProductSubQuanMethod {
-		productResp, err = SubtractQuantity(db.DB, productIDInt, req.Quantity)
+		productResp, err = SubtractQuantity(db.DB, movement, req.Quantity)
 	} else {
-		utils.JsonError(w, "Invalid method", http.StatusBadRequest, nil)
+		utils.JsonError(w, utils.InvalidQuantityMethod, http.StatusBadRequest, nil)
 		return
 	}
 
 	if err != nil {
-		utils.JsonErrorWithExtra(w, err.Error(), http.StatusInternalServerError, err, "UpdateProductQuantityHandler")
+		status := http.StatusInternalServerError
+		if errors.Is(err, models.ErrInsufficientStock) {
+			status = http.StatusConflict
+		}
+		utils.JsonErrorWithExtra(w, err.Error(), status, err, "UpdateProductQuantityHandler")
 		return
 	}
 	utils.JsonResponseWithExtra(productResp, w, utils.ProductQuantityUpdated, http.StatusOK, "UpdateProductQuantityHandler")
 }
 
-func SubtractQuantity(db *gorm.DB, productID int, quantity int) (payloads.ProductResponse, error) {
+// SubtractQuantity takes quantity units of the product out of stock as a negative adjustment, from the warehouse
+// of the movement or, without one, from the warehouses with free stock like a quantity update does
+func SubtractQuantity(db *gorm.DB, movement models.StockMovement, quantity int) (payloads.ProductResponse, error) {
 	var product models.Product
 	var productResp payloads.ProductResponse
 
-	if err := product.CheckProductExistsById(db, productID); err != nil {
+	if err := product.CheckProductExistsById(db, movement.ProductID); err != nil {
 		return productResp, err
 	}
 
 	if product.Quantity < quantity {
-		return productResp, fmt.Errorf(utils.ProductOutOfStockError, product.ID)
+		return productResp, fmt.Errorf("%w: %s", models.ErrInsufficientStock, fmt.Sprintf(utils.ProductOutOfStockError, product.ID))
 	}
 
-	product.Quantity -= quantity
-	// Save the updated product back to the database
-	if err := product.UpdateProductQuantity(db); err != nil {
-		return productResp, err
+	var err error
+	if movement.WarehouseID == 0 {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return models.SetStockQuantity(tx, product.ID, 0, product.Quantity-quantity, movement.ActorID, movement.Reason)
+		})
+	} else {
+		movement.Type = models.MovementAdjustment
+		movement.Quantity = -quantity
+		err = models.RecordMovement(db, &movement)
 	}
-
-	if err := models.CopyStructIntoStruct(&product, &productResp); err != nil {
+	if err != nil {
 		return productResp, err
 	}
 
-	return productResp, nil
+	return fetchQuantityResp(db, product.ID)
 }
 
-func AddQuantity(db *gorm.DB, productID int, quantity int) (payloads.ProductResponse, error) {
+// AddQuantity receives quantity units of the product into the warehouse of the movement
+func AddQuantity(db *gorm.DB, movement models.StockMovement, quantity int) (payloads.ProductResponse, error) {
 	var product models.Product
 	var productResp payloads.ProductResponse
 
-	if err := product.CheckProductExistsById(db, productID); err != nil {
+	if err := product.CheckProductExistsById(db, movement.ProductID); err != nil {
 		return productResp, err
 	}
-	product.Quantity += quantity
 
-	// Save the updated product back to the database
-	if err := product.UpdateProductQuantity(db); err != nil {
+	movement.Type = models.MovementReceipt
+	movement.Quantity = quantity
+	if err := models.RecordMovement(db, &movement); err != nil {
 		return productResp, err
 	}
 
+	return fetchQuantityResp(db, product.ID)
+}
+
+func fetchQuantityResp(db *gorm.DB, productID int) (payloads.ProductResponse, error) {
+	var product models.Product
+	var productResp payloads.ProductResponse
+
+	if err := product.CheckProductExistsById(db, productID); err != nil {
+		return productResp, err
+	}
 	if err := models.CopyStructIntoStruct(&product, &productResp); err != nil {
 		return productResp, err
 	}
+	product.SetPricing(&productResp)
 
 	return productResp, nil
 }
@@ -421,14 +445,38 @@ func (db *Service) GetProductByIdForCart(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	response := map[string]interface{}{
-		"id":          productResp.ID,
-		"name":        productResp.PName,
-		"description": productResp.PDesc,
-		"price":       productResp.Price,
-		"quantity":    productResp.Quantity,
-		"discount":    productResp.Discount,
+	available, err := product.GetAvailableQuantity(db.DB)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusInternalServerError, err)
+		return
+	}
+
+	hasVariants, err := models.HasVariants(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusInternalServerError, err)
+		return
 	}
 
-	utils.JsonResponse(response, w, fmt.Sprintf(utils.ProductFetchedSuccessfully, id), http.StatusOK)
+	cartProduct := toCartProduct(productResp, available)
+	cartProduct["has_variants"] = hasVariants
+	utils.JsonResponse(cartProduct, w, fmt.Sprintf(utils.ProductFetchedSuccessfully, id), http.StatusOK)
+}
+
+// toCartProduct is the product view used by the cart and order services
+func toCartProduct(productResp *payloads.ProductResponse, available int) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                   productResp.ID,
+		"name":                 productResp.PName,
+		"description":          productResp.PDesc,
+		"price":                productResp.Price,
+		"quantity":             productResp.Quantity,
+		"available_quantity":   available,
+		"discount":             productResp.Discount,
+		"category":             productResp.Category,
+		"min_order_quantity":   productResp.MinOrderQty,
+		"max_order_quantity":   productResp.MaxOrderQty,
+		"quantity_step":        productResp.QuantityStep,
+		"max_per_customer":     productResp.MaxPerCustomer,
+		"purchase_window_days": productResp.PurchaseWindowDays,
+	}
 }
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/constants"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/notifications/emails"
+	"e-commerce-backend/shared/notifications/emails/templates"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type StockAlertService interface {
+	SubscribeBackInStock(w http.ResponseWriter, r *http.Request)
+	UnsubscribeBackInStock(w http.ResponseWriter, r *http.Request)
+	ConfirmBackInStock(w http.ResponseWriter, r *http.Request)
+}
+
+// StartStockAlertWorker periodically emails the stock events written by stock changes, low stock alerts to the
+// seller and the admins and back in stock notifications to the customers waiting for the item
+func StartStockAlertWorker(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			sent, err := processStockEvents(db)
+			if err != nil {
+				utils.LogError(utils.StockAlertCheckError, map[string]interface{}{"error": err.Error()})
+				continue
+			}
+			if sent > 0 {
+				utils.LogInfo(fmt.Sprintf(utils.StockAlertsSent, sent), nil)
+			}
+		}
+	}()
+}
+
+// stockItem is the product, or the variant of it, a stock event is about
+type stockItem struct {
+	product models.Product
+	name    string
+	sku     string
+	inStock bool
+}
+
+func loadStockItem(db *gorm.DB, productId, variantId int) (stockItem, error) {
+	var item stockItem
+	if err := item.product.CheckProductExistsById(db, productId); err != nil {
+		return item, err
+	}
+	item.name, item.sku, item.inStock = item.product.PName, item.product.SKU, item.product.IsInStock()
+	if variantId > 0 {
+		var variant models.ProductVariant
+		if err := variant.GetVariantById(db, variantId); err != nil {
+			return item, err
+		}
+		item.name = fmt.Sprintf("%s (%s)", item.product.PName, variant.Title())
+		item.sku, item.inStock = variant.SKU, variant.InStock
+	}
+	return item, nil
+}
+
+// processStockEvents sends the pending events, an event is claimed before it is sent so it is sent at most once
+func processStockEvents(db *gorm.DB) (int, error) {
+	events, err := models.GetPendingStockEvents(db, constants.StockAlertBatchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	sent := 0
+	for _, event := range events {
+		claimed, err := event.Claim(db)
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue
+		}
+		item, err := loadStockItem(db, event.ProductID, event.VariantID)
+		if err != nil {
+			//deleted products have nobody left to tell
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return sent, err
+		}
+
+		switch event.Type {
+		case models.StockEventLowStock:
+			recipients, err := models.StockAlertRecipients(db, item.product.SellerID, constants.AdminRole)
+			if err != nil {
+				return sent, err
+			}
+			content := emails.LowStockAlert{ProductName: item.name, SKU: item.sku, Quantity: event.Quantity, Threshold: event.Threshold}
+			for _, recipient := range recipients {
+				emails.EmailWorkerWithGoRoutine(recipient, fmt.Sprintf(templates.LowStockAlertSubject, item.name), templates.LOW_STOCK_ALERT_TEMPLATE, content, nil)
+			}
+			sent += len(recipients)
+		case models.StockEventBackInStock:
+			//sold out again before the alert went out, the subscribers keep waiting for the next restock
+			if !item.inStock {
+				continue
+			}
+			subscriptions, err := models.ClaimBackInStockSubscribers(db, event.ProductID, event.VariantID)
+			if err != nil {
+				return sent, err
+			}
+			content := emails.BackInStockAlert{ProductName: item.name}
+			for _, subscription := range subscriptions {
+				emails.EmailWorkerWithGoRoutine(subscription.Email, fmt.Sprintf(templates.BackInStockSubject, item.name), templates.BACK_IN_STOCK_TEMPLATE, content, nil)
+			}
+			sent += len(subscriptions)
+		}
+	}
+	return sent, nil
+}
+
+// SubscribeBackInStock emails the customer once the product, or the variant of variant_id, is back in stock
+// (POST /product/{id}/back-in-stock). Signed in customers are subscribed with the email of their account, guests
+// are emailed a code to confirm the subscription with first
+func (db *Service) SubscribeBackInStock(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+	var req payloads.BackInStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	userId := utils.GetUserIdFromContext(r)
+	email := strings.TrimSpace(req.Email)
+	if userId != 0 {
+		email = utils.GetUserEmailFromContext(r)
+	}
+	if err := utils.CheckEmailSecurity(email); err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if status, err := checkVariantOfProduct(db.DB, req.VariantID, id); err != nil {
+		utils.JsonError(w, err.Error(), status, err)
+		return
+	}
+
+	item, err := loadStockItem(db.DB, id, req.VariantID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+			return
+		}
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	if item.inStock {
+		utils.JsonError(w, fmt.Sprintf(utils.ItemAlreadyInStock, item.name), http.StatusConflict, nil)
+		return
+	}
+
+	subscription := models.BackInStockSubscription{
+		ProductID: id,
+		VariantID: req.VariantID,
+		Email:     email,
+		UserID:    userId,
+	}
+	if userId != 0 {
+		now := time.Now()
+		subscription.ConfirmedAt = &now
+	}
+	if err := subscription.Subscribe(db.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.BackInStockSubscribeError, item.name), http.StatusInternalServerError, err)
+		return
+	}
+	if userId == 0 {
+		content := emails.BackInStockConfirmation{ProductName: item.name, Token: subscription.Token}
+		emails.EmailWorkerWithGoRoutine(email, fmt.Sprintf(templates.BackInStockConfirmSubject, item.name), templates.BACK_IN_STOCK_CONFIRM_TEMPLATE, content, nil)
+		utils.JsonResponse(nil, w, fmt.Sprintf(utils.BackInStockConfirmSent, item.name, email), http.StatusAccepted)
+		return
+	}
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.BackInStockSubscribed, email, item.name), http.StatusCreated)
+}
+
+// ConfirmBackInStock confirms the restock alert of a guest with the code emailed to them
+// (POST /product/back-in-stock/confirm)
+func (db *Service) ConfirmBackInStock(w http.ResponseWriter, r *http.Request) {
+	var req payloads.BackInStockConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	token := strings.TrimSpace(req.Token)
+	if token == "" {
+		utils.JsonError(w, utils.BackInStockTokenRequired, http.StatusBadRequest, nil)
+		return
+	}
+
+	subscription, err := models.ConfirmBackInStock(db.DB, token)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.JsonError(w, utils.BackInStockTokenInvalid, http.StatusNotFound, err)
+			return
+		}
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	name := models.ItemLabel(subscription.ProductID, subscription.VariantID)
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.BackInStockConfirmed, subscription.Email, name), http.StatusOK)
+}
+
+// UnsubscribeBackInStock stops waiting for the restock (DELETE /product/{id}/back-in-stock?variant_id=&token=),
+// signed in customers unsubscribe the email of their account, guests need the code of the subscription
+func (db *Service) UnsubscribeBackInStock(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+	query := r.URL.Query()
+	variantId := 0
+	if value := query.Get("variant_id"); value != "" {
+		if variantId, err = strconv.Atoi(value); err != nil || variantId < 0 {
+			utils.JsonError(w, utils.InvalidVariantIDError, http.StatusBadRequest, err)
+			return
+		}
+	}
+	email := utils.GetUserEmailFromContext(r)
+	if utils.GetUserIdFromContext(r) == 0 {
+		token := strings.TrimSpace(query.Get("token"))
+		if token == "" {
+			utils.JsonError(w, utils.BackInStockTokenRequired, http.StatusBadRequest, nil)
+			return
+		}
+		subscription, err := models.GetBackInStockSubscriptionByToken(db.DB, id, token)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				utils.JsonError(w, utils.BackInStockTokenInvalid, http.StatusNotFound, err)
+				return
+			}
+			utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+			return
+		}
+		email, variantId = subscription.Email, subscription.VariantID
+	}
+	if err := utils.CheckEmailSecurity(email); err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	name := models.ItemLabel(id, variantId)
+	removed, err := models.UnsubscribeBackInStock(db.DB, id, variantId, email)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	if !removed {
+		utils.JsonError(w, fmt.Sprintf(utils.BackInStockNotSubscribed, email, name), http.StatusNotFound, nil)
+		return
+	}
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.BackInStockUnsubscribed, email, name), http.StatusOK)
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type TagService interface {
+	GetTags(w http.ResponseWriter, r *http.Request)
+	RenameTag(w http.ResponseWriter, r *http.Request)
+	MergeTags(w http.ResponseWriter, r *http.Request)
+	DeleteTag(w http.ResponseWriter, r *http.Request)
+}
+
+// reindexTaggedProducts brings the search index in step once the tags of productIds changed
+func reindexTaggedProducts(db *gorm.DB, productIds []int) {
+	if len(productIds) > 0 {
+		indexProducts(db, productIds...)
+	}
+}
+
+// GetTags lists every tag with the number of products using it (GET /product/tags), admin only
+func (db *Service) GetTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := models.GetTagsWithUsage(db.DB)
+	if err != nil {
+		utils.JsonError(w, utils.TagFetchError, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(tags, w, fmt.Sprintf(utils.TagsFetched, len(tags)), http.StatusOK)
+}
+
+// RenameTag changes the name of a tag (PUT /product/tags/{id}), admin only. Two tags can't share a name, the
+// tag has to be merged into the other one instead
+func (db *Service) RenameTag(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidTagIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var req payloads.TagRenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		utils.JsonError(w, utils.InvalidTagName, http.StatusBadRequest, nil)
+		return
+	}
+
+	tag, err := models.FetchTagById(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.TagNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+	var existing models.Tag
+	if err := db.DB.Where("name = ? AND id <> ?", name, id).First(&existing).Error; err == nil {
+		utils.JsonError(w, fmt.Sprintf(utils.TagAlreadyExistsError, name), http.StatusConflict, nil)
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.JsonError(w, fmt.Sprintf(utils.TagUpdateFailed, err), http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tag.Rename(db.DB, name); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.TagUpdateFailed, err), http.StatusInternalServerError, err)
+		return
+	}
+
+	productIds, err := models.GetProductIdsByTagIds(db.DB, []int{id})
+	if err != nil {
+		utils.LogError(fmt.Sprintf(utils.TagUpdateFailed, err), nil)
+	}
+	reindexTaggedProducts(db.DB, productIds)
+
+	utils.JsonResponse(tag, w, fmt.Sprintf(utils.TagRenamed, id), http.StatusOK)
+}
+
+// MergeTags folds the source tags into the target tag (POST /product/tags/merge), admin only
+func (db *Service) MergeTags(w http.ResponseWriter, r *http.Request) {
+	var req payloads.TagMergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if req.TargetID <= 0 || len(req.SourceIDs) == 0 || slices.Contains(req.SourceIDs, req.TargetID) {
+		utils.JsonError(w, utils.InvalidTagMerge, http.StatusBadRequest, nil)
+		return
+	}
+
+	for _, id := range append([]int{req.TargetID}, req.SourceIDs...) {
+		if _, err := models.FetchTagById(db.DB, id); err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.TagNotFoundError, id), http.StatusNotFound, err)
+			return
+		}
+	}
+
+	//products of the source tags are searched under the target name once merged
+	productIds, err := models.GetProductIdsByTagIds(db.DB, req.SourceIDs)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.TagMergeFailed, req.TargetID), http.StatusInternalServerError, err)
+		return
+	}
+	if err := models.MergeTags(db.DB, req.SourceIDs, req.TargetID); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.TagMergeFailed, req.TargetID), http.StatusInternalServerError, err)
+		return
+	}
+	reindexTaggedProducts(db.DB, productIds)
+
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.TagsMerged, len(req.SourceIDs), req.TargetID), http.StatusOK)
+}
+
+// DeleteTag removes a tag from every product and deletes it (DELETE /product/tags/{id}), admin only
+func (db *Service) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidTagIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	tag, err := models.FetchTagById(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.TagNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+	productIds, err := models.GetProductIdsByTagIds(db.DB, []int{id})
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.TagDeletionFailed, id), http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tag.DeleteTag(db.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.TagDeletionFailed, id), http.StatusInternalServerError, err)
+		return
+	}
+	reindexTaggedProducts(db.DB, productIds)
+
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.TagDeleted, id, len(productIds)), http.StatusOK)
+}
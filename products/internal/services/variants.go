@@ -0,0 +1,425 @@
+package services
+
+import (
+	"e-commerce-backend/products/internal/models"
+	"e-commerce-backend/products/pkg/payloads"
+	"e-commerce-backend/shared/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type VariantService interface {
+	SetProductOptions(w http.ResponseWriter, r *http.Request)
+	GetProductVariants(w http.ResponseWriter, r *http.Request)
+	CreateVariant(w http.ResponseWriter, r *http.Request)
+	GetVariantById(w http.ResponseWriter, r *http.Request)
+	UpdateVariant(w http.ResponseWriter, r *http.Request)
+	DeleteVariant(w http.ResponseWriter, r *http.Request)
+	ReserveVariant(w http.ResponseWriter, r *http.Request)
+}
+
+// toCartVariant is the variant view used by the cart and order services, the product view with the price,
+// stock and name of the variant so a variant line is priced like any other line
+func toCartVariant(productResp *payloads.ProductResponse, variant *models.ProductVariant, price float64, available int) map[string]interface{} {
+	view := toCartProduct(productResp, available)
+	view["variant_id"] = variant.ID
+	view["name"] = fmt.Sprintf("%s (%s)", productResp.PName, variant.Title())
+	view["price"] = price
+	view["quantity"] = variant.Quantity
+	view["sku"] = variant.SKU
+	view["barcode"] = variant.Barcode
+	view["options"] = variant.OptionMap()
+	view["images"] = variant.Images
+	return view
+}
+
+func validateOptionsRequest(req payloads.ProductOptionsRequest) error {
+	names := map[string]bool{}
+	for _, option := range req.Options {
+		name := strings.TrimSpace(option.Name)
+		if name == "" || names[name] || len(option.Values) == 0 {
+			return errors.New(utils.InvalidProductOptions)
+		}
+		names[name] = true
+
+		values := map[string]bool{}
+		for _, value := range option.Values {
+			if strings.TrimSpace(value) == "" || values[value] {
+				return errors.New(utils.InvalidProductOptions)
+			}
+			values[value] = true
+		}
+	}
+	return nil
+}
+
+// variantOptionValues orders the option values of the request like the options of the product
+func variantOptionValues(options []models.ProductOption, values map[string]string) []models.VariantOptionValue {
+	optionValues := make([]models.VariantOptionValue, 0, len(options))
+	for _, option := range options {
+		optionValues = append(optionValues, models.VariantOptionValue{Name: option.Name, Value: values[option.Name]})
+	}
+	return optionValues
+}
+
+func variantImages(urls []string) []models.VariantImage {
+	images := make([]models.VariantImage, 0, len(urls))
+	for i, url := range urls {
+		images = append(images, models.VariantImage{URL: url, Position: i})
+	}
+	return images
+}
+
+// checkVariantOptions validates the option values against the product and makes sure no other variant of the
+// product sells the same combination
+func checkVariantOptions(db *gorm.DB, options []models.ProductOption, productId, variantId int, values map[string]string) error {
+	if err := models.ValidateVariantOptions(options, values); err != nil {
+		return err
+	}
+	existingId, err := models.FindVariantByOptions(db, productId, values)
+	if err != nil {
+		return err
+	}
+	if existingId != 0 && existingId != variantId {
+		return errors.New(utils.VariantCombinationExists)
+	}
+	return nil
+}
+
+// SetProductOptions replaces the options of the product (PUT /product/{id}/options), every variant still sold
+// has to fit the new options
+func (db *Service) SetProductOptions(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var req payloads.ProductOptionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if err := validateOptionsRequest(req); err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	var product models.Product
+	if err := product.CheckProductExistsById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+
+	options := make([]models.ProductOption, 0, len(req.Options))
+	for _, option := range req.Options {
+		options = append(options, models.ProductOption{Name: strings.TrimSpace(option.Name), Values: option.Values})
+	}
+
+	variants, err := models.GetVariantsByProductId(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductOptionsUpdateError, id), http.StatusInternalServerError, err)
+		return
+	}
+	for _, variant := range variants {
+		if err := models.ValidateVariantOptions(options, variant.OptionMap()); err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.ProductOptionsInUse, variant.SKU), http.StatusConflict, err)
+			return
+		}
+	}
+
+	if err := models.SetProductOptions(db.DB, id, options); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductOptionsUpdateError, id), http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(options, w, fmt.Sprintf(utils.ProductOptionsUpdated, id), http.StatusOK)
+}
+
+// GetProductVariants lists the options and the variants still sold of the product (GET /product/{id}/variants)
+func (db *Service) GetProductVariants(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var product models.Product
+	if err := product.CheckProductExistsById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+
+	options, err := models.GetProductOptions(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+	variants, err := models.GetVariantsByProductId(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := map[string]interface{}{"options": options, "variants": variants}
+	utils.JsonResponse(resp, w, fmt.Sprintf(utils.VariantsFetched, len(variants), id), http.StatusOK)
+}
+
+// CreateVariant adds a variant to the product (POST /product/{id}/variants), it needs one value for every
+// option of the product and a sku no other variant uses
+func (db *Service) CreateVariant(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidProductIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var req payloads.VariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	req.SKU = strings.TrimSpace(req.SKU)
+	if req.SKU == "" || req.Quantity == nil || *req.Quantity < 0 || (req.Price != nil && *req.Price < 0) {
+		utils.JsonError(w, utils.InvalidVariantDataError, http.StatusBadRequest, nil)
+		return
+	}
+
+	var product models.Product
+	if err := product.CheckProductExistsById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.ProductNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+
+	options, err := models.GetProductOptions(db.DB, id)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.VariantCreationError, id), http.StatusInternalServerError, err)
+		return
+	}
+	if err := checkVariantOptions(db.DB, options, id, 0, req.Options); err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	exists, err := models.SKUExists(db.DB, req.SKU, 0)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.VariantCreationError, id), http.StatusInternalServerError, err)
+		return
+	}
+	if exists {
+		utils.JsonError(w, fmt.Sprintf(utils.VariantSKUExists, req.SKU), http.StatusConflict, nil)
+		return
+	}
+
+	variant := models.ProductVariant{
+		ProductID: id,
+		SKU:       req.SKU,
+		Barcode:   req.Barcode,
+		Quantity:  *req.Quantity,
+		Options:   variantOptionValues(options, req.Options),
+		Images:    variantImages(req.Images),
+	}
+	if req.Price != nil {
+		variant.Price = *req.Price
+	}
+	for i := range variant.Options {
+		variant.Options[i].ProductID = id
+	}
+	if err := variant.CreateVariant(db.DB, utils.GetUserIdFromContext(r)); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.VariantCreationError, id), http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(variant, w, fmt.Sprintf(utils.VariantCreated, variant.ID), http.StatusCreated)
+}
+
+// GetVariantById returns the cart view of the variant (GET /product/variant/{id})
+func (db *Service) GetVariantById(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidVariantIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var variant models.ProductVariant
+	if err := variant.GetVariantById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.VariantNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+
+	//a variant of a deleted product is not sold either
+	var product models.Product
+	productResp, err := product.FetchProductResp(db.DB, variant.ProductID)
+	if err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.VariantNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+
+	available, err := variant.GetAvailableQuantity(db.DB)
+	if err != nil {
+		utils.JsonError(w, utils.DatabaseConnectionError, http.StatusInternalServerError, err)
+		return
+	}
+
+	view := toCartVariant(productResp, &variant, variant.EffectivePrice(&product), available)
+	utils.JsonResponse(view, w, fmt.Sprintf(utils.VariantFetched, id), http.StatusOK)
+}
+
+// UpdateVariant changes the fields sent in the request (PUT /product/variant/{id})
+func (db *Service) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidVariantIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var req payloads.VariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JsonError(w, utils.InvalidRequestBody, http.StatusBadRequest, err)
+		return
+	}
+	if (req.Quantity != nil && *req.Quantity < 0) || (req.Price != nil && *req.Price < 0) {
+		utils.JsonError(w, utils.InvalidVariantDataError, http.StatusBadRequest, nil)
+		return
+	}
+
+	var variant models.ProductVariant
+	if err := variant.GetVariantById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.VariantNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+
+	updatedFields := map[string]interface{}{}
+	if sku := strings.TrimSpace(req.SKU); sku != "" && sku != variant.SKU {
+		exists, err := models.SKUExists(db.DB, sku, id)
+		if err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.VariantUpdateError, id), http.StatusInternalServerError, err)
+			return
+		}
+		if exists {
+			utils.JsonError(w, fmt.Sprintf(utils.VariantSKUExists, sku), http.StatusConflict, nil)
+			return
+		}
+		updatedFields["sku"] = sku
+	}
+	if req.Barcode != "" {
+		updatedFields["barcode"] = req.Barcode
+	}
+	if req.Price != nil {
+		updatedFields["price"] = *req.Price
+	}
+	if req.Quantity != nil {
+		updatedFields["quantity"] = *req.Quantity
+	}
+
+	var optionValues []models.VariantOptionValue
+	if req.Options != nil {
+		options, err := models.GetProductOptions(db.DB, variant.ProductID)
+		if err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.VariantUpdateError, id), http.StatusInternalServerError, err)
+			return
+		}
+		if err := checkVariantOptions(db.DB, options, variant.ProductID, id, req.Options); err != nil {
+			utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+			return
+		}
+		optionValues = variantOptionValues(options, req.Options)
+	}
+	var images []models.VariantImage
+	if req.Images != nil {
+		images = variantImages(req.Images)
+	}
+
+	if err := variant.UpdateVariant(db.DB, updatedFields, optionValues, images, utils.GetUserIdFromContext(r)); err != nil {
+		if errors.Is(err, models.ErrInsufficientStock) {
+			utils.JsonError(w, err.Error(), http.StatusConflict, err)
+			return
+		}
+		utils.JsonError(w, fmt.Sprintf(utils.VariantUpdateError, id), http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(variant, w, fmt.Sprintf(utils.VariantUpdated, id), http.StatusOK)
+}
+
+// DeleteVariant stops selling the variant (DELETE /product/variant/{id})
+func (db *Service) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidVariantIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	var variant models.ProductVariant
+	if err := variant.GetVariantById(db.DB, id); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.VariantNotFoundError, id), http.StatusNotFound, err)
+		return
+	}
+	if err := variant.DeleteVariant(db.DB); err != nil {
+		utils.JsonError(w, fmt.Sprintf(utils.VariantDeletionError, id), http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.JsonResponse(nil, w, fmt.Sprintf(utils.VariantDeleted, id), http.StatusOK)
+}
+
+// ReserveVariant holds stock of the variant for a reference (POST /product/variant/{id}/reserve), quantity 0
+// releases the hold
+func (db *Service) ReserveVariant(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r)
+	if err != nil {
+		utils.JsonError(w, utils.InvalidVariantIDError, http.StatusBadRequest, err)
+		return
+	}
+
+	req, err := decodeReservationRequest(r)
+	if err != nil {
+		utils.JsonError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	var reservation models.StockReservation
+	if req.Quantity == 0 {
+		if err := reservation.ReleaseVariant(db.DB, id, req.Reference); err != nil {
+			utils.JsonError(w, fmt.Sprintf(utils.ReservationReleaseError, req.Reference), http.StatusInternalServerError, err)
+			return
+		}
+		utils.JsonResponse(nil, w, fmt.Sprintf(utils.ReservationsReleased, 1), http.StatusOK)
+		return
+	}
+
+	if err := reservation.ReserveVariant(db.DB, id, req.Reference, req.Quantity, reservationTTL(req.TTLSeconds)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.JsonError(w, fmt.Sprintf(utils.VariantNotFoundError, id), http.StatusNotFound, err)
+			return
+		}
+		utils.JsonError(w, fmt.Sprintf(utils.VariantReservationFailed, id), http.StatusConflict, err)
+		return
+	}
+
+	utils.JsonResponse(reservation, w, fmt.Sprintf(utils.VariantStockReserved, id), http.StatusOK)
+}
+
+// attachVariants adds the options and variants of the product to its response, products without variants
+// are left as they are
+func attachVariants(db *gorm.DB, productResp *payloads.ProductResponse) error {
+	options, err := models.GetProductOptions(db, productResp.ID)
+	if err != nil {
+		return err
+	}
+	variants, err := models.GetVariantsByProductId(db, productResp.ID)
+	if err != nil {
+		return err
+	}
+	if len(options) > 0 {
+		productResp.Options = options
+	}
+	if len(variants) > 0 {
+		productResp.Variants = variants
+	}
+	return nil
+}
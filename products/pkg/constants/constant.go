@@ -1 +1,106 @@
 package constants
+
+import (
+	"e-commerce-backend/shared/utils"
+	"time"
+)
+
+// Stock reservations
+const (
+	DefaultReservationTTL   = 30 * time.Minute
+	MaxReservationTTL       = 24 * time.Hour
+	ReservationSweepEvery   = time.Minute
+	MaxReservationReference = 64
+)
+
+// MaxBatchProductIds caps the ids of one batch lookup so a single request can't scan the whole catalogue
+const MaxBatchProductIds = 100
+
+// Product listings
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+	DealMinDiscount  = 20 // percent of sale discount from which a product is a deal
+)
+
+// Product search
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// Product images
+const (
+	MaxImageBytes     = 10 << 20 // per file
+	MaxUploadBytes    = 50 << 20 // per upload request, several files can be sent at once
+	MinImageDimension = 100
+	MaxImageDimension = 8000
+	MaxProductImages  = 12
+	DefaultMediaRoot  = "./uploads"
+	DefaultMediaURL   = "/media"
+)
+
+// Product reviews, ratings are whole stars
+const (
+	MinReviewRating    = 1
+	MaxReviewRating    = 5
+	MaxReviewTitle     = 150
+	MaxReviewBody      = 5000
+	MaxReviewPhotos    = 5
+	DefaultReviewLimit = 10
+	MaxReviewLimit     = 50
+)
+
+// Warehouses and stock ledger
+const (
+	MaxWarehouseCode     = 32
+	DefaultMovementLimit = 50
+	MaxMovementLimit     = 200
+)
+
+// Catalog import and export
+const (
+	MaxImportBytes      = 20 << 20
+	MaxImportMemory     = 8 << 20 // of the upload kept in memory, the rest goes to a temporary file
+	MaxImportRows       = 10000
+	MaxImportRowErrors  = 1000 // stored per job, Failed keeps counting past it
+	ImportProgressEvery = 100  // rows between two saves of the progress of a job
+	ExportBatchSize     = 500
+	MaxSKULength        = 64
+)
+
+// Product sellers, roles are the ones of the users service
+const (
+	SellerRole               = "seller"
+	AdminRole                = "admin"
+	DefaultLowStockThreshold = 5
+	SalesPeriodLayout        = "2006-01-02"
+	DefaultSalesPeriod       = 30 * 24 * time.Hour
+)
+
+// Stock alerts, low stock and back in stock events are emailed by a worker
+const (
+	StockAlertEvery     = time.Minute
+	StockAlertBatchSize = 100
+)
+
+const (
+	OrderMicroservicePurchase = "/purchased/%d"
+)
+
+func MicroserviceLinks() map[string]string {
+	links := map[string]string{}
+
+	orderPurchaseLink := utils.GetOrderMicroserviceLink(OrderMicroservicePurchase)
+	links["orderMSPurchaseCallLink"] = orderPurchaseLink
+	return links
+}
+
+// Price rules, the scheduler applies rules starting and ending between its runs
+const (
+	PriceRuleSweepEvery     = time.Minute
+	MaxPriceRuleName        = 100
+	MaxFlashDealDuration    = 48 * time.Hour
+	DefaultPriceHistoryDays = 30
+	MaxPriceHistoryDays     = 365
+)
@@ -3,16 +3,184 @@ package payloads
 import "time"
 
 type ProductRequest struct {
-	ID        int       `json:"id"`
-	PName     string    `json:"product_name"`
-	PDesc     string    `json:"product_desc"`
-	Price     float64   `json:"price"`
-	Quantity  int       `json:"quantity"`
-	IsDeleted bool      `json:"is_deleted"`
-	Discount  float64   `json:"discount"`
-	Category  string    `json:"category"`
-	CreatedAt time.Time `json:"created_at" gorm:"type:datetime;default:CURRENT_TIMESTAMP"`
-	UpdatedAt time.Time `json:"updated_at" gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
-	Tags      []string  `json:"tags" gorm:"-"`
-	Rating    float64   `json:"rating"`
+	ID         int       `json:"id"`
+	SellerID   int       `json:"seller_id"` // admins add products for a seller, sellers always add their own
+	SKU        string    `json:"sku"`
+	PName      string    `json:"product_name"`
+	PDesc      string    `json:"product_desc"`
+	Price      float64   `json:"price"`
+	Quantity   int       `json:"quantity"`
+	IsDeleted  bool      `json:"is_deleted"`
+	Discount   float64   `json:"discount"`
+	Category   string    `json:"category"`
+	CategoryID int       `json:"category_id"`
+	CreatedAt  time.Time `json:"created_at" gorm:"type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"type:datetime;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
+	Tags       []string  `json:"tags" gorm:"-"`
+
+	MinOrderQty        int `json:"min_order_quantity"`
+	MaxOrderQty        int `json:"max_order_quantity"`
+	QuantityStep       int `json:"quantity_step"`
+	MaxPerCustomer     int `json:"max_per_customer"`
+	PurchaseWindowDays int `json:"purchase_window_days"`
+
+	ReorderThreshold int `json:"reorder_threshold"`
+}
+
+// CategoryRequest creates or updates a category, on update fields left out keep their value. The slug is made
+// from the name when not sent and a ParentID of 0 moves the category to the top level
+type CategoryRequest struct {
+	Name        string  `json:"name"`
+	Slug        string  `json:"slug"`
+	Description *string `json:"description"`
+	ImageURL    *string `json:"image_url"`
+	ParentID    *int    `json:"parent_id"`
+	SortOrder   *int    `json:"sort_order"`
+}
+
+// ProductCategoryRequest assigns a product to a category by id
+type ProductCategoryRequest struct {
+	CategoryID int `json:"category_id"`
+}
+
+// ReservationRequest sets the quantity held for a reference, quantity 0 releases the hold
+type ReservationRequest struct {
+	Reference  string `json:"reference"`
+	Quantity   int    `json:"quantity"`
+	TTLSeconds int    `json:"ttl_seconds"`
+}
+
+// ReservationBatchRequest used to release, extend or commit the holds of several references at once, canceling
+// the holds committed for an order only needs OrderID
+type ReservationBatchRequest struct {
+	References []string `json:"references"`
+	TTLSeconds int      `json:"ttl_seconds"`
+	OrderID    int      `json:"order_id"`
+}
+
+// BundleRequest products sold together as one cart line at Price
+type BundleRequest struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Price       float64             `json:"price"`
+	Items       []BundleItemRequest `json:"items"`
+}
+
+type BundleItemRequest struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// ProductOptionsRequest replaces the options of a product, e.g. {"name": "size", "values": ["S", "M", "L"]}
+type ProductOptionsRequest struct {
+	Options []ProductOptionRequest `json:"options"`
+}
+
+type ProductOptionRequest struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// VariantRequest creates or updates a variant, on update fields left out keep their value and Options or Images
+// replace the current ones when sent. A price of 0 sells the variant at the product price
+type VariantRequest struct {
+	SKU      string            `json:"sku"`
+	Barcode  string            `json:"barcode"`
+	Price    *float64          `json:"price"`
+	Quantity *int              `json:"quantity"`
+	Options  map[string]string `json:"options"`
+	Images   []string          `json:"images"`
+}
+
+// TagRenameRequest new name of a tag, a name already used by another tag has to be merged instead
+type TagRenameRequest struct {
+	Name string `json:"name"`
+}
+
+// TagMergeRequest moves the products of the source tags onto the target tag and removes the source tags
+type TagMergeRequest struct {
+	SourceIDs []int `json:"source_ids"`
+	TargetID  int   `json:"target_id"`
+}
+
+// ImageOrderRequest new order of the images of a product, every image of the product has to be listed once
+type ImageOrderRequest struct {
+	ImageIDs []int `json:"image_ids"`
+}
+
+// ReviewRequest writes or edits a review, on edit fields left out keep their value
+type ReviewRequest struct {
+	Rating *int    `json:"rating"`
+	Title  *string `json:"title"`
+	Body   *string `json:"body"`
+}
+
+// ReviewModerationRequest decision of a moderator, the note is kept with the review
+type ReviewModerationRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+type ReviewVoteRequest struct {
+	Helpful *bool `json:"helpful"`
+}
+
+// ProductSellerRequest seller a product is moved to by an admin
+type ProductSellerRequest struct {
+	SellerID int `json:"seller_id"`
+}
+
+// WarehouseRequest creates or updates a warehouse, on update fields left out keep their value
+type WarehouseRequest struct {
+	Code     string  `json:"code"`
+	Name     string  `json:"name"`
+	Address  *string `json:"address"`
+	Priority *int    `json:"priority"`
+	IsActive *bool   `json:"is_active"`
+}
+
+// StockMovementRequest stock received, returned or counted in a warehouse. Receipts and returns add the quantity,
+// an adjustment adds or removes it by its sign
+type StockMovementRequest struct {
+	WarehouseID int    `json:"warehouse_id"`
+	VariantID   int    `json:"variant_id"`
+	Type        string `json:"type"`
+	Quantity    int    `json:"quantity"`
+	Reason      string `json:"reason"`
+}
+
+// PriceRuleRequest creates or updates a price rule, on update fields left out keep their value. StartsAt defaults
+// to now on create
+type PriceRuleRequest struct {
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	DiscountType string     `json:"discount_type"`
+	Value        *float64   `json:"value"`
+	Scope        string     `json:"scope"`
+	ScopeID      *int       `json:"scope_id"`
+	Priority     *int       `json:"priority"`
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	IsActive     *bool      `json:"is_active"`
+}
+
+// BackInStockRequest subscribes to the restock of a product or one of its variants, signed in customers are
+// always subscribed with the email of their account, the email is for guests
+type BackInStockRequest struct {
+	VariantID int    `json:"variant_id"`
+	Email     string `json:"email"`
+}
+
+// BackInStockConfirmRequest token emailed to a guest who subscribed to a restock
+type BackInStockConfirmRequest struct {
+	Token string `json:"token"`
+}
+
+// StockTransferRequest stock moved from one warehouse to another
+type StockTransferRequest struct {
+	FromWarehouseID int    `json:"from_warehouse_id"`
+	ToWarehouseID   int    `json:"to_warehouse_id"`
+	VariantID       int    `json:"variant_id"`
+	Quantity        int    `json:"quantity"`
+	Reason          string `json:"reason"`
 }
@@ -1,20 +1,207 @@
 package payloads
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
 	"time"
 )
 
 type ProductResponse struct {
-	ID        int         `json:"id"`
-	PName     string      `json:"product_name"`
-	PDesc     string      `json:"product_desc"`
-	Price     float64     `json:"price"`
-	Quantity  int         `json:"quantity"`
-	IsDeleted bool        `json:"is_deleted"`
-	Discount  float64     `json:"discount"`
-	Rating    float64     `json:"rating"`
-	Category  string      `json:"category"`
-	Tags      interface{} `json:"tags"`
-	CreatedAt time.Time   `json:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at"`
+	ID         int         `json:"id"`
+	SellerID   int         `json:"seller_id"`
+	SKU        string      `json:"sku"`
+	PName      string      `json:"product_name"`
+	PDesc      string      `json:"product_desc"`
+	Price      float64     `json:"price"`
+	Quantity   int         `json:"quantity"`
+	IsDeleted  bool        `json:"is_deleted"`
+	InStock    bool        `json:"in_stock"`
+	Discount   float64     `json:"discount"` // effective discount, the larger of ProductDiscount and the running sale
+	Rating     float64     `json:"rating"`   // average of the approved reviews
+	SoldCount  int         `json:"sold_count"`
+	Category   string      `json:"category"`
+	CategoryID int         `json:"category_id"`
+	Tags       interface{} `json:"tags"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+
+	MinOrderQty        int `json:"min_order_quantity"`
+	MaxOrderQty        int `json:"max_order_quantity"`
+	QuantityStep       int `json:"quantity_step"`
+	MaxPerCustomer     int `json:"max_per_customer"`
+	PurchaseWindowDays int `json:"purchase_window_days"`
+	ReorderThreshold   int `json:"reorder_threshold"`
+
+	ProductDiscount float64    `json:"product_discount"` // discount set on the product itself
+	SaleEndsAt      *time.Time `json:"sale_ends_at,omitempty"`
+	LowestPrice     *float64   `json:"lowest_price_30_days,omitempty"` // lowest effective price of the last 30 days, product page only
+
+	RatingCount     int             `json:"rating_count"`
+	RatingHistogram RatingHistogram `json:"rating_histogram"`
+
+	Breadcrumbs interface{} `json:"breadcrumbs"`
+	Images      interface{} `json:"images"` // ordered, the first one is the main image
+	Options     interface{} `json:"options,omitempty"`
+	Variants    interface{} `json:"variants,omitempty"`
+}
+
+// ProductBatchResponse cart view of the requested products keyed by id, ids which could not be served are
+// reported in Errors instead of failing the whole batch
+type ProductBatchResponse struct {
+	Products map[int]map[string]interface{} `json:"products"`
+	Errors   map[int]string                 `json:"errors"`
+	Deleted  []int                          `json:"deleted"`
+}
+
+// ProductListResponse one page of a product listing, NextCursor is left out on the last page. Items are
+// products or, when fields were asked for, only those fields of them
+type ProductListResponse struct {
+	Items      interface{} `json:"items"`
+	Total      int64       `json:"total"`
+	Limit      int         `json:"limit"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// ProductSearchResult product matching a search with the relevance score it was ranked by
+type ProductSearchResult struct {
+	ProductResponse
+	Score float64 `json:"score"`
+}
+
+// ProductSearchResponse one page of search results, Facets counts every matching product and not only the page
+type ProductSearchResponse struct {
+	Query   string                `json:"query"`
+	Total   int                   `json:"total"`
+	Results []ProductSearchResult `json:"results"`
+	Facets  interface{}           `json:"facets"`
+}
+
+// RatingHistogram number of approved reviews per star rating, index 0 counts the one star reviews. It is sent as
+// an object keyed by the stars and stored as a json array
+type RatingHistogram [5]int
+
+func (h RatingHistogram) MarshalJSON() ([]byte, error) {
+	stars := make(map[string]int, len(h))
+	for i, count := range h {
+		stars[strconv.Itoa(i+1)] = count
+	}
+	return json.Marshal(stars)
+}
+
+func (h *RatingHistogram) UnmarshalJSON(data []byte) error {
+	var stars map[string]int
+	if err := json.Unmarshal(data, &stars); err != nil {
+		return err
+	}
+	*h = RatingHistogram{}
+	for star, count := range stars {
+		i, err := strconv.Atoi(star)
+		if err != nil || i < 1 || i > len(h) {
+			return fmt.Errorf("invalid rating %s in histogram", star)
+		}
+		h[i-1] = count
+	}
+	return nil
+}
+
+func (h RatingHistogram) Value() (driver.Value, error) {
+	data, err := json.Marshal([5]int(h))
+	return string(data), err
+}
+
+func (h *RatingHistogram) Scan(src interface{}) error {
+	*h = RatingHistogram{}
+	switch value := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(value, (*[5]int)(h))
+	case string:
+		return json.Unmarshal([]byte(value), (*[5]int)(h))
+	}
+	return fmt.Errorf("unsupported rating histogram value %T", src)
+}
+
+// RatingSummary aggregate rating of a product as it is kept on the product
+type RatingSummary struct {
+	Average   float64         `json:"average"`
+	Count     int             `json:"count"`
+	Histogram RatingHistogram `json:"histogram"`
+}
+
+// ReviewListResponse one page of reviews, Summary is only sent for the reviews of one product
+type ReviewListResponse struct {
+	Reviews interface{}    `json:"reviews"`
+	Total   int64          `json:"total"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+	Summary *RatingSummary `json:"summary,omitempty"`
+}
+
+// ProductSales units of a product sold through committed orders within a period, SoldCount is its lifetime total
+type ProductSales struct {
+	ProductID int    `json:"product_id"`
+	Name      string `json:"product_name"`
+	UnitsSold int    `json:"units_sold"`
+	Orders    int    `json:"orders"`
+	SoldCount int    `json:"lifetime_units_sold"`
+}
+
+// SellerSalesResponse sales of a seller between From and To, To is excluded
+type SellerSalesResponse struct {
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	Products    []ProductSales `json:"products"`
+	TotalUnits  int            `json:"total_units"`
+	TotalOrders int            `json:"total_orders"`
+}
+
+// LowStockItem product or variant of a seller with few units left to sell, Available leaves out reserved units
+type LowStockItem struct {
+	ProductID int    `json:"product_id"`
+	VariantID int    `json:"variant_id,omitempty"`
+	Name      string `json:"name"`
+	SKU       string `json:"sku,omitempty"`
+	Quantity  int    `json:"quantity"`
+	Reserved  int    `json:"reserved"`
+	Available int    `json:"available"`
+}
+
+// InventoryLevelResponse stock of a product or variant in one warehouse, Available leaves out reserved units
+type InventoryLevelResponse struct {
+	WarehouseID   int    `json:"warehouse_id"`
+	WarehouseCode string `json:"warehouse_code"`
+	WarehouseName string `json:"warehouse_name"`
+	VariantID     int    `json:"variant_id,omitempty"`
+	OnHand        int    `json:"on_hand"`
+	Reserved      int    `json:"reserved"`
+	Available     int    `json:"available"`
+}
+
+// ProductInventoryResponse stock of a product per warehouse with the totals over every warehouse
+type ProductInventoryResponse struct {
+	ProductID int                      `json:"product_id"`
+	Levels    []InventoryLevelResponse `json:"levels"`
+	OnHand    int                      `json:"on_hand"`
+	Reserved  int                      `json:"reserved"`
+	Available int                      `json:"available"`
+}
+
+// StockMovementListResponse page of the stock ledger of a product
+type StockMovementListResponse struct {
+	Movements interface{} `json:"movements"`
+	Total     int64       `json:"total"`
+	Limit     int         `json:"limit"`
+	Offset    int         `json:"offset"`
+}
+
+// PriceHistoryResponse prices of a product over the last Days days, newest first, the oldest one is the price
+// the period started with
+type PriceHistoryResponse struct {
+	ProductID   int         `json:"product_id"`
+	Days        int         `json:"days"`
+	LowestPrice float64     `json:"lowest_price"`
+	History     interface{} `json:"history"`
 }
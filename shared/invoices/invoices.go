@@ -152,6 +152,7 @@ type Invoice struct {
 	TaxAmount       string         `json:"tax_amount"`
 	SubTotal        string         `json:"sub_total"`
 	TotalDiscount   string         `json:"total_discount"`
+	CODFee          string         `json:"cod_fee,omitempty"`
 	TotalAmount     string         `json:"total_amount"`
 }
 
@@ -348,6 +349,28 @@ func (inv Invoice) addFooter(m core.Maroto) {
 		}),
 	)
 
+	if inv.CODFee != "" {
+		m.AddRow(8,
+			text.NewCol(8, ""),
+			text.NewCol(2, "COD Fee ", props.Text{
+				Top:   2,
+				Style: fontstyle.Bold,
+				Size:  10,
+				Align: align.Right,
+			}, rowHeaderProperties()).WithStyle(&props.Cell{
+				BackgroundColor: &props.Color{Red: 240, Green: 240, Blue: 240},
+			}),
+			text.NewCol(2, strToFloatToStr(inv.CODFee), props.Text{
+				Top:   2,
+				Style: fontstyle.Bold,
+				Size:  10,
+				Align: align.Center,
+			}, rowProperties()).WithStyle(&props.Cell{
+				BackgroundColor: &props.Color{Red: 240, Green: 240, Blue: 240},
+			}),
+		)
+	}
+
 	m.AddRow(8,
 		text.NewCol(8, ""),
 		text.NewCol(2, "Sub Total ", props.Text{
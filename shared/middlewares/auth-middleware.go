@@ -43,6 +43,9 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		ctx := context.WithValue(r.Context(), utils.UserIDKey, int(userID))
+		if email, ok := claims["email"].(string); ok {
+			ctx = context.WithValue(ctx, utils.UserEmailKey, email)
+		}
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
@@ -0,0 +1,33 @@
+package middlewares
+
+import (
+	"context"
+	"e-commerce-backend/shared/utils"
+	"net/http"
+)
+
+// GuestOrAuthMiddleware authenticates with the JWT when an authorization header is sent, anonymous shoppers
+// are identified by the signed guest cart token instead
+func GuestOrAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			AuthMiddleware(next).ServeHTTP(w, r)
+			return
+		}
+
+		cartToken := r.Header.Get(utils.CartTokenHeader)
+		if cartToken == "" {
+			utils.JsonError(w, utils.MissingAuthorizationHeader, http.StatusUnauthorized, nil)
+			return
+		}
+
+		guestId, err := utils.VerifyCartToken(cartToken)
+		if err != nil {
+			utils.JsonError(w, utils.InvalidCartToken, http.StatusUnauthorized, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), utils.GuestIDKey, guestId)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -12,28 +12,20 @@ import (
 func RoleMiddleware(db *gorm.DB, allowedRoles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID, ok := r.Context().Value("userID").(uint)
-			if !ok {
+			userID := utils.GetUserIdFromContext(r)
+			if userID == 0 {
 				utils.JsonError(w, "User not authenticated", http.StatusUnauthorized, nil)
 				return
 			}
 
-			var role string
-			if err := db.Table("roles").Where("user_id = ?", userID).Pluck("role", &role).Error; err != nil {
+			roles, err := userRoles(db, userID)
+			if err != nil || len(roles) == 0 {
 				// If there's an error fetching the role (e.g., role not found)
 				utils.JsonError(w, "Role not found", http.StatusUnauthorized, nil)
 				return
 			}
 
-			roleAllowed := false
-			for _, allowedRole := range allowedRoles {
-				if strings.EqualFold(strings.ToLower(role), strings.ToLower(allowedRole)) {
-					roleAllowed = true
-					break
-				}
-			}
-
-			if !roleAllowed {
+			if !anyRoleAllowed(roles, allowedRoles) {
 				utils.JsonError(w, "Unauthorized role", http.StatusForbidden, nil)
 				return
 			}
@@ -42,3 +34,29 @@ func RoleMiddleware(db *gorm.DB, allowedRoles ...string) func(http.Handler) http
 		})
 	}
 }
+
+// HasRole tells whether the user has one of the allowed roles, for handlers deciding on more than the role
+func HasRole(db *gorm.DB, userID int, allowedRoles ...string) (bool, error) {
+	roles, err := userRoles(db, userID)
+	if err != nil {
+		return false, err
+	}
+	return anyRoleAllowed(roles, allowedRoles), nil
+}
+
+func userRoles(db *gorm.DB, userID int) ([]string, error) {
+	var roles []string
+	err := db.Table("roles").Where("user_id = ?", userID).Pluck("role", &roles).Error
+	return roles, err
+}
+
+func anyRoleAllowed(roles, allowedRoles []string) bool {
+	for _, role := range roles {
+		for _, allowedRole := range allowedRoles {
+			if strings.EqualFold(role, allowedRole) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"e-commerce-backend/shared/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServiceMiddleware only lets calls of the other services through, they carry the shared service token
+func ServiceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !utils.VerifyServiceToken(r.Header.Get(utils.ServiceTokenHeader)) {
+			utils.JsonError(w, utils.InvalidServiceToken, http.StatusForbidden, nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func GinServiceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !utils.VerifyServiceToken(c.GetHeader(utils.ServiceTokenHeader)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": utils.InvalidServiceToken})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
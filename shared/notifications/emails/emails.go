@@ -36,6 +36,50 @@ type OrderInvoiceAttachment struct {
 	CustomerName string
 }
 
+type WishlistAlert struct {
+	Items []WishlistAlertItem
+}
+
+type WishlistAlertItem struct {
+	ProductName  string
+	WishlistName string
+	OldPrice     string
+	NewPrice     string
+	PriceDropped bool
+	BackInStock  bool
+}
+
+type AbandonedCartReminder struct {
+	Items         []AbandonedCartItem
+	Total         string
+	CouponCode    string
+	CouponPercent string
+	CouponApplied bool // the coupon was put on the cart, otherwise the user enters it at checkout
+}
+
+type AbandonedCartItem struct {
+	ProductName string
+	Quantity    int
+	Price       string
+}
+
+type LowStockAlert struct {
+	ProductName string
+	SKU         string
+	Quantity    int
+	Threshold   int
+}
+
+type BackInStockAlert struct {
+	ProductName string
+}
+
+// BackInStockConfirmation asks a guest to confirm the restock alert, the token confirms and cancels it
+type BackInStockConfirmation struct {
+	ProductName string
+	Token       string
+}
+
 // GeneralEmailTemplate General Format
 type GeneralEmailTemplate struct {
 	To               string
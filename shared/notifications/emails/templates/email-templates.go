@@ -14,6 +14,11 @@ const (
 	OrderUpdatedSubject              = "Your Order #%s Has Been Updated"
 	OrderAwaitingPaymentSubject      = "Action Required: Your Order is Awaiting Payment"
 	OrderInvoiceAttachedSubject      = "Your Order #%s Invoice File Attached Below"
+	WishlistAlertSubject             = "Good News About Items On Your Wishlist"
+	AbandonedCartSubject             = "You Left Something In Your Cart"
+	LowStockAlertSubject             = "Low Stock: %s"
+	BackInStockSubject               = "%s Is Back In Stock"
+	BackInStockConfirmSubject        = "Confirm Your Restock Alert For %s"
 )
 
 const TEST_EMAIL_TEMPLATE = `
@@ -217,3 +222,59 @@ const ORDER_AWAITING_PAYMENT_TEMPLATE = `
 	Best regards,<br>
 	The Team
 `
+
+// ************wishlist email template*********
+const WISHLIST_ALERT_TEMPLATE = `
+	Hello,<br><br>
+	Some products on your wishlists changed since you saved them.<br><br>
+	{{range .Items}}
+	<b>{{.ProductName}}</b> ({{.WishlistName}}): {{if .BackInStock}}back in stock{{end}}{{if and .BackInStock .PriceDropped}}, {{end}}{{if .PriceDropped}}price dropped from ${{.OldPrice}} to ${{.NewPrice}}{{end}}<br>
+	{{end}}<br>
+	Stocks are limited, add them to your cart before they are gone.<br><br>
+	Best regards,<br>
+	The Team
+`
+
+// ************cart email template*********
+const ABANDONED_CART_TEMPLATE = `
+	Hello,<br><br>
+	You left some items in your cart, they are still waiting for you.<br><br>
+	{{range .Items}}
+	{{.ProductName}} x {{.Quantity}}: ${{.Price}}<br>
+	{{end}}<br>
+	Total: ${{.Total}}<br><br>
+	{{if .CouponCode}}
+	Use the coupon <b>{{.CouponCode}}</b> for {{.CouponPercent}}% off{{if .CouponApplied}}, it is already applied to your cart{{end}}.<br><br>
+	{{end}}
+	Complete your order before the items run out of stock.<br><br>
+	Best regards,<br>
+	The Team
+`
+
+// ************stock email template*********
+const LOW_STOCK_ALERT_TEMPLATE = `
+	Hello,<br><br>
+	<b>{{.ProductName}}</b>{{if .SKU}} (SKU {{.SKU}}){{end}} is running low on stock.<br><br>
+	Units left: {{.Quantity}}<br>
+	Reorder threshold: {{.Threshold}}<br><br>
+	Restock it before it sells out.<br><br>
+	Best regards,<br>
+	The Team
+`
+
+const BACK_IN_STOCK_TEMPLATE = `
+	Hello,<br><br>
+	Good news, <b>{{.ProductName}}</b> is back in stock.<br><br>
+	Stocks are limited, add it to your cart before it is gone.<br><br>
+	Best regards,<br>
+	The Team
+`
+
+const BACK_IN_STOCK_CONFIRM_TEMPLATE = `
+	Hello,<br><br>
+	You asked to be emailed once <b>{{.ProductName}}</b> is back in stock.<br><br>
+	Confirm the alert with the code <b>{{.Token}}</b>, the same code cancels it later on.<br><br>
+	If you did not ask for it, ignore this email and you will not hear from us about it.<br><br>
+	Best regards,<br>
+	The Team
+`
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+)
+
+// CartTokenHeader carries the guest cart token of anonymous shoppers
+const CartTokenHeader = "X-Cart-Token"
+
+const GuestIDKey string = "guestID"
+
+func cartTokenSecret() []byte {
+	if secret := os.Getenv("CART_TOKEN_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return jwtSecretKey
+}
+
+func signGuestId(guestId string) string {
+	mac := hmac.New(sha256.New, cartTokenSecret())
+	mac.Write([]byte(guestId))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateCartToken returns a new guest id and its signed token "<guest id>.<signature>"
+func GenerateCartToken() (string, string) {
+	guestId := GenerateRandomToken()
+	return guestId, guestId + "." + signGuestId(guestId)
+}
+
+// VerifyCartToken checks the signature of a guest cart token and returns the guest id
+func VerifyCartToken(token string) (string, error) {
+	guestId, signature, ok := strings.Cut(token, ".")
+	if !ok || guestId == "" {
+		return "", errors.New(InvalidCartToken)
+	}
+	if !hmac.Equal([]byte(signature), []byte(signGuestId(guestId))) {
+		return "", errors.New(InvalidCartToken)
+	}
+	return guestId, nil
+}
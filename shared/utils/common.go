@@ -5,12 +5,15 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"reflect"
+	"strconv"
 )
 
 const UserIDKey string = "userID"
+const UserEmailKey string = "userEmail"
 
 func MapStructFields(src interface{}, dest interface{}) error {
 	srcValue := reflect.ValueOf(src)
@@ -62,7 +65,7 @@ func GetPaymentMicroserviceLink(extra string) string {
 	if err := godotenv.Load("../../.env"); err != nil {
 		log.Fatal("Error loading .env file")
 	}
-	paymentBaseUrl := "http://localhost:" + os.Getenv("PAYMENT_PORT") + "/order/%s/payment"
+	paymentBaseUrl := "http://localhost:" + os.Getenv("PAYMENT_PORT") + "/order/%d/payment"
 	if extra != "" {
 		paymentBaseUrl = paymentBaseUrl + extra
 	}
@@ -80,6 +83,17 @@ func GetUserMicroserviceLink(extra string) string {
 	return userBaseUrl
 }
 
+func GetOrderMicroserviceLink(extra string) string {
+	if err := godotenv.Load("../../.env"); err != nil {
+		log.Fatal("Error loading .env file")
+	}
+	orderBaseUrl := "http://localhost:" + os.Getenv("ORDER_PORT") + "/user/%d/order"
+	if extra != "" {
+		orderBaseUrl = orderBaseUrl + extra
+	}
+	return orderBaseUrl
+}
+
 func ErrorsToString(errs []error) string {
 	errStr := ""
 	for i, err := range errs {
@@ -100,6 +114,12 @@ func GetUserIdFromContext(r *http.Request) int {
 	return userId
 }
 
+// GetUserEmailFromContext email claim of the JWT, empty for guests and tokens without it
+func GetUserEmailFromContext(r *http.Request) string {
+	email, _ := r.Context().Value(UserEmailKey).(string)
+	return email
+}
+
 func GetUserFromGinCtx(c *gin.Context) (int, error) {
 	ctxUserId, ok := c.Get(UserIDKey)
 	if !ok {
@@ -107,3 +127,43 @@ func GetUserFromGinCtx(c *gin.Context) (int, error) {
 	}
 	return ctxUserId.(int), nil
 }
+
+// ToCents rounds an amount to whole cents so money can be compared without float drift
+func ToCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// Cash on delivery defaults, used when COD_FEE / COD_MAX_ORDER_VALUE are not set in .env
+const (
+	DefaultCODFee           = 40.0
+	DefaultCODMaxOrderValue = 5000.0
+)
+
+func GetEnvFloat(key string, defaultValue float64) float64 {
+	if err := godotenv.Load("../../.env"); err != nil {
+		log.Fatal("Error loading .env file from common.go")
+	}
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func GetCODFee() float64 {
+	return GetEnvFloat("COD_FEE", DefaultCODFee)
+}
+
+func GetCODMaxOrderValue() float64 {
+	return GetEnvFloat("COD_MAX_ORDER_VALUE", DefaultCODMaxOrderValue)
+}
+
+// CartLineReservationReference identifies the stock reservation held by a cart line in the product service
+func CartLineReservationReference(cartLineId int) string {
+	return fmt.Sprintf("cart-line-%d", cartLineId)
+}
+
+// QuoteReservationReference identifies the stock reservation held for an accepted quote in the product service
+func QuoteReservationReference(quoteId int) string {
+	return fmt.Sprintf("quote-%d", quoteId)
+}
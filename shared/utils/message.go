@@ -44,6 +44,7 @@ const (
 	ErrorProductMicroservices     = "error occurred while calling product microservice"
 	ProductQuantityUpdated        = "product quantity updated successfully"
 	CategoryNotFoundError         = "product category not found"
+	ProductSKUExists              = "sku %s is already used by another product"
 )
 
 // Info messages
@@ -68,6 +69,339 @@ const (
 	TagUpdateFailed          = "failed to update tag: %v"
 	FailedAddingTagToProduct = "failed to add tag to product"
 	FailedToFetchTag         = "failed to fetch tag"
+	InvalidTagIDError        = "invalid tag ID"
+	InvalidTagName           = "a tag name is required"
+	TagNotFoundError         = "tag with ID %d not found"
+	InvalidTagMerge          = "tags to merge and a target tag which is not one of them are required"
+	InvalidTagMode           = "invalid tag mode %s, use any or all"
+	TagMergeFailed           = "failed to merge tags into tag with ID %d"
+	TagDeletionFailed        = "failed to delete tag with ID %d"
+)
+
+const (
+	TagsFetched = "%d tags fetched successfully"
+	TagRenamed  = "tag with ID %d renamed successfully"
+	TagsMerged  = "%d tags merged into tag with ID %d"
+	TagDeleted  = "tag with ID %d deleted from %d products"
+)
+
+// ************Product batch lookup*************
+const (
+	ProductBatchIdsRequired  = "product ids are required"
+	ProductBatchSizeExceeded = "at most %d products can be fetched at once"
+	ProductsBatchFetched     = "%d products fetched, %d not found"
+	ProductDeletedError      = "product with ID %d is no longer available"
+)
+
+// ************Stock reservation*************
+const (
+	InsufficientStockToReserve   = "insufficient stock to reserve product with ID %d, available quantity %d"
+	ReservationFailed            = "failed to reserve stock for product with ID %d"
+	ReservationReferenceRequired = "reservation reference is required"
+	ReservationNotFound          = "no active reservation found"
+	ReservationUpdateError       = "failed to update reservations"
+	ReservationCommitError       = "failed to commit reservations for order with ID %d"
+	ReservationReleaseError      = "failed to release stock reservation %s"
+	ReservationNotHeld           = "stock of %s is no longer held, check the cart again"
+	ReservationCancelError       = "failed to return the stock of order with ID %d"
+)
+
+const (
+	StockReserved         = "stock reserved for product with ID %d"
+	ReservationsReleased  = "%d reservations released"
+	ReservationsExtended  = "%d reservations extended"
+	ReservationsCommitted = "reservations committed for order with ID %d"
+	ReservationsExpired   = "%d stale stock reservations expired"
+	ReservationsCanceled  = "%d reservations of order with ID %d canceled, their stock is back"
+)
+
+// ************Quantity rules and bundles*************
+const (
+	InvalidQuantityRules    = "invalid quantity rules, quantities can't be negative and max per order can't be below the min order quantity"
+	InvalidBundleDataError  = "invalid data provided for bundle creation, a name, a price and at least one product are required"
+	InvalidBundleIDError    = "invalid bundle ID"
+	BundleNotFoundError     = "bundle with ID %d not found"
+	BundleInactiveError     = "bundle with ID %d is no longer sold"
+	BundleProductNotFound   = "product with ID %d of the bundle not found"
+	BundleCreationError     = "failed to create bundle"
+	BundleDeletionError     = "failed to delete bundle with ID %d"
+	BundleReservationFailed = "failed to reserve stock for bundle with ID %d"
+)
+
+const (
+	BundleCreated       = "bundle with ID %d created successfully"
+	BundleFetched       = "bundle with ID %d fetched successfully"
+	BundleDeleted       = "bundle with ID %d deleted successfully"
+	BundleStockReserved = "stock reserved for bundle with ID %d"
+)
+
+// ************Product variants*************
+const (
+	InvalidVariantIDError     = "invalid variant ID"
+	InvalidVariantDataError   = "invalid data provided for variant, a sku and a quantity of zero or more are required"
+	InvalidProductOptions     = "invalid product options, every option needs a unique name and at least one value"
+	VariantNotFoundError      = "variant with ID %d not found"
+	VariantOptionsMismatch    = "a variant needs exactly one value for each of the %d options of the product"
+	VariantOptionMissing      = "variant has no value for option %s"
+	VariantOptionValueInvalid = "value %s is not offered for option %s"
+	VariantCombinationExists  = "product already has a variant with these option values"
+	VariantSKUExists          = "sku %s is already used by another variant"
+	VariantCreationError      = "failed to create variant for product with ID %d"
+	VariantUpdateError        = "failed to update variant with ID %d"
+	VariantDeletionError      = "failed to delete variant with ID %d"
+	ProductOptionsInUse       = "options don't fit variant %s which is still sold"
+	ProductOptionsUpdateError = "failed to update options of product with ID %d"
+	ProductRequiresVariant    = "product with ID %d is sold in variants, a variant has to be picked"
+	InsufficientVariantStock  = "insufficient stock to reserve variant with ID %d, available quantity %d"
+	VariantOutOfStockError    = "variant with ID %d is out of stock"
+	VariantReservationFailed  = "failed to reserve stock for variant with ID %d"
+)
+
+const (
+	ProductOptionsUpdated = "options of product with ID %d updated successfully"
+	VariantCreated        = "variant with ID %d created successfully"
+	VariantsFetched       = "%d variants of product with ID %d fetched successfully"
+	VariantFetched        = "variant with ID %d fetched successfully"
+	VariantUpdated        = "variant with ID %d updated successfully"
+	VariantDeleted        = "variant with ID %d deleted successfully"
+	VariantStockReserved  = "stock reserved for variant with ID %d"
+)
+
+// ************Product categories*************
+const (
+	InvalidCategoryIDError     = "invalid category ID"
+	InvalidCategoryDataError   = "invalid data provided for category, a name is required"
+	CategoryByIdNotFound       = "category with ID %d not found"
+	CategoryByNameNotFound     = "category %s not found"
+	CategorySlugExists         = "slug %s is already used by another category"
+	CategoryParentInvalid      = "category with ID %d can't be moved below itself or one of its subcategories"
+	CategoryHasChildren        = "category with ID %d still has subcategories"
+	CategoryHasProducts        = "category with ID %d still has %d products"
+	CategoryCreationError      = "failed to create category"
+	CategoryUpdateError        = "failed to update category with ID %d"
+	CategoryDeletionError      = "failed to delete category with ID %d"
+	ProductCategoryAssignError = "failed to move product with ID %d to another category"
+)
+
+const (
+	CategoryCreated         = "category with ID %d created successfully"
+	CategoryFetched         = "category with ID %d fetched successfully"
+	CategoryUpdated         = "category with ID %d updated successfully"
+	CategoryDeleted         = "category with ID %d deleted successfully"
+	ProductCategoryAssigned = "product with ID %d moved to category with ID %d"
+)
+
+// ************Product listings*************
+const (
+	InvalidListSort   = "invalid sort %s, use price, rating, newest, discount or popularity"
+	InvalidListOrder  = "invalid order %s, use asc or desc"
+	InvalidListCursor = "invalid cursor, it has to come from a page listed with the same sort and order"
+	InvalidListLimit  = "invalid limit, it has to be between 1 and %d"
+	InvalidListField  = "unknown field %s"
+	DealsFetched      = "deals fetched successfully"
+	OffersFetched     = "products with offers fetched successfully"
+)
+
+// ************Product search*************
+const (
+	InvalidSearchParam = "invalid search parameter %s"
+	SearchIndexError   = "failed to update the search index for product with ID %d"
+	SearchIndexBuilt   = "search index built with %d products"
+	SearchResultsFound = "%d products found"
+)
+
+// ************Product reviews*************
+const (
+	InvalidReviewIDError    = "invalid review ID"
+	InvalidReviewRating     = "rating has to be a whole number of stars between %d and %d"
+	InvalidReviewText       = "a review title can have up to %d characters and a body up to %d"
+	InvalidReviewParam      = "invalid review parameter %s"
+	InvalidReviewSort       = "invalid sort %s, use newest, oldest, helpful, highest or lowest"
+	InvalidReviewStatus     = "invalid review status %s, use pending, approved or rejected"
+	InvalidModerationStatus = "a review can only be approved or rejected"
+	ReviewAlreadyExists     = "product with ID %d is already reviewed by you, edit that review instead"
+	ReviewNotFound          = "review with ID %d not found"
+	ReviewNotOwned          = "review with ID %d belongs to another user"
+	ReviewNotPublished      = "review with ID %d is not published"
+	ReviewOwnVote           = "a review can't be voted on by its author"
+	ReviewPhotoLimitReached = "review with ID %d can't have more than %d photos"
+	ReviewCreationError     = "failed to save the review of product with ID %d"
+	ReviewUpdateError       = "failed to update review with ID %d"
+	ReviewDeletionError     = "failed to delete review with ID %d"
+	ReviewVoteError         = "failed to record the vote on review with ID %d"
+	PurchaseCheckFailed     = "failed to check whether user %d bought product with ID %d"
+)
+
+const (
+	ReviewCreated     = "review with ID %d submitted, it is shown once approved"
+	ReviewsFetched    = "%d reviews fetched"
+	ReviewFetched     = "review with ID %d fetched"
+	ReviewUpdated     = "review with ID %d updated, it is shown again once approved"
+	ReviewDeleted     = "review with ID %d deleted"
+	ReviewModerated   = "review with ID %d %s"
+	ReviewVoted       = "vote on review with ID %d recorded"
+	ReviewPhotosAdded = "%d photos added to review with ID %d"
+)
+
+// ************Product images*************
+const (
+	InvalidImageIDError    = "invalid image ID"
+	InvalidMultipartForm   = "unable to parse the multipart form"
+	NoImageUploaded        = "no image uploaded, send the files in the image field"
+	ImageTypeNotAllowed    = "image type %s is not allowed, use jpeg, png, gif or webp"
+	ImageTooLarge          = "image is larger than the %d bytes allowed"
+	ImageDimensionsInvalid = "image is %dx%d pixels, both sides have to be between %d and %d"
+	ImageDecodeError       = "image could not be read"
+	ImageLimitReached      = "product with ID %d can't have more than %d images"
+	ImageNotFound          = "image with ID %d of product %d not found"
+	InvalidImageOrder      = "the order has to list every image of the product exactly once"
+	ImageDeletionError     = "failed to delete image with ID %d"
+	ImageFileDeleteError   = "failed to delete the file %s of a deleted image"
+)
+
+const (
+	ImagesUploaded  = "%d images uploaded for product with ID %d"
+	ImagesFetched   = "%d images of product with ID %d fetched"
+	ImageDeleted    = "image with ID %d deleted from product with ID %d"
+	ImagesReordered = "images of product with ID %d reordered"
+)
+
+// ************Product sellers*************
+const (
+	ProductNotOwned        = "product with ID %d belongs to another seller"
+	ProductSellerForbidden = "only an admin can add or move a product for another seller"
+	UserNotSeller          = "user with ID %d is not a seller"
+	InvalidSellerRequest   = "a seller_id is required"
+	SellerCheckFailed      = "failed to check the roles of user %d"
+	SellerAssignError      = "failed to assign a seller to product with ID %d"
+	InvalidSalesPeriod     = "invalid sales period, from and to are dates like 2006-01-02 and from can't be after to"
+	InvalidStockThreshold  = "invalid threshold, it has to be a number of zero or more"
+	SellerSalesFetchError  = "failed to fetch the sales of seller %d"
+	SellerStockFetchError  = "failed to fetch the low stock items of seller %d"
+)
+
+const (
+	ProductSellerAssigned = "product with ID %d assigned to seller %d"
+	SellerProductsFetched = "products of seller %d fetched successfully"
+	SellerSalesFetched    = "sales of seller %d fetched successfully"
+	SellerLowStockFetched = "%d low stock items of seller %d fetched successfully"
+)
+
+// ************Warehouses and stock ledger*************
+const (
+	InsufficientStock          = "insufficient stock"
+	InvalidAllocationStrategy  = "invalid stock allocation strategy %s, use priority or most_stock"
+	StockAllocationFailed      = "not enough stock in the active warehouses to allocate %d units of %s"
+	WarehouseStockInsufficient = "%s has less stock in warehouse %d than the movement takes out"
+	WarehouseStockUnavailable  = "%s has only %d units free of reservations in warehouse %d"
+	StockHeldByReservations    = "the stock of %s can't go down to %d, the rest is held by reservations"
+	InvalidWarehouseIDError    = "invalid warehouse ID"
+	InvalidWarehouseData       = "a warehouse needs a code of up to %d characters and a name"
+	WarehouseNotFound          = "warehouse with ID %d not found"
+	WarehouseInactive          = "warehouse with ID %d is not active"
+	WarehouseCodeExists        = "warehouse code %s is already used"
+	WarehouseCreationError     = "failed to create the warehouse"
+	WarehouseUpdateError       = "failed to update warehouse with ID %d"
+	InvalidMovementType        = "invalid movement type %s, use receipt, return or adjustment"
+	InvalidMovementQuantity    = "a %s needs a quantity above zero, an adjustment any quantity but zero"
+	InvalidTransfer            = "a transfer needs two different warehouses and a quantity above zero"
+	VariantNotOfProduct        = "variant with ID %d is not a variant of product with ID %d"
+	StockMovementError         = "failed to move the stock of product with ID %d"
+	InventoryFetchError        = "failed to fetch the inventory of product with ID %d"
+	InvalidInventoryParam      = "invalid inventory parameter %s"
+	InvalidQuantityMethod      = "invalid method, use add or subtract"
+)
+
+const (
+	WarehouseCreated      = "warehouse with ID %d created successfully"
+	WarehouseUpdated      = "warehouse with ID %d updated successfully"
+	WarehousesFetched     = "%d warehouses fetched successfully"
+	InventoryFetched      = "inventory of product with ID %d fetched successfully"
+	StockMoved            = "stock of product with ID %d moved successfully"
+	StockTransferred      = "%d units of product with ID %d transferred from warehouse %d to warehouse %d"
+	StockMovementsFetched = "%d stock movements of product with ID %d fetched successfully"
+)
+
+// ************Stock alerts*************
+const (
+	InvalidReorderThreshold   = "invalid reorder threshold, it has to be a number of zero or more"
+	ItemAlreadyInStock        = "%s is in stock, there is nothing to wait for"
+	BackInStockSubscribeError = "failed to subscribe to the restock of %s"
+	BackInStockNotSubscribed  = "%s is not waiting for the restock of %s"
+	BackInStockTokenRequired  = "the code of the restock alert is required"
+	BackInStockTokenInvalid   = "the code of the restock alert is not valid"
+	StockAlertCheckError      = "failed to send the stock alerts"
+)
+
+const (
+	BackInStockSubscribed   = "%s will be emailed once %s is back in stock"
+	BackInStockUnsubscribed = "%s no longer waits for the restock of %s"
+	BackInStockConfirmSent  = "a code to confirm the restock alert of %s was sent to %s"
+	BackInStockConfirmed    = "%s will be emailed once %s is back in stock"
+	StockAlertsSent         = "%d stock alerts sent"
+)
+
+// ************Price rules and price history*************
+const (
+	InvalidPriceRuleIDError = "invalid price rule ID"
+	PriceRuleNotFound       = "price rule with ID %d not found"
+	InvalidPriceRuleName    = "a price rule needs a name of up to %d characters"
+	InvalidPriceRuleType    = "invalid price rule type %s, use sale or flash"
+	InvalidDiscountType     = "invalid discount type %s, use percentage or fixed"
+	InvalidPriceRuleValue   = "the value of a price rule has to be above zero, at most 100 for a percentage"
+	InvalidPriceRuleScope   = "invalid price rule scope %s, use all, product, category or tag"
+	PriceRuleScopeNotFound  = "the %s with ID %d the price rule applies to was not found"
+	InvalidPriceRulePeriod  = "a price rule needs an end after its start"
+	FlashDealTooLong        = "a flash deal can run for at most %s"
+	PriceRuleCreationError  = "failed to create the price rule"
+	PriceRuleUpdateError    = "failed to update price rule with ID %d"
+	PriceRuleDeletionError  = "failed to delete price rule with ID %d"
+	PriceRulesApplyError    = "failed to apply the price rules"
+	InvalidPriceRuleStatus  = "invalid status %s, use active, scheduled or expired"
+	InvalidPriceHistoryDays = "invalid days, it has to be a number from 1 to %d"
+	PriceHistoryFetchError  = "failed to fetch the price history of product with ID %d"
+)
+
+const (
+	PriceRuleCreated    = "price rule with ID %d created successfully"
+	PriceRuleUpdated    = "price rule with ID %d updated successfully"
+	PriceRuleDeleted    = "price rule with ID %d deleted successfully"
+	PriceRuleFetched    = "price rule with ID %d fetched successfully"
+	PriceRulesFetched   = "%d price rules fetched successfully"
+	PriceRulesApplied   = "prices of %d products changed by the price rules"
+	PriceHistoryFetched = "price history of product with ID %d fetched successfully"
+)
+
+// ************Catalog import and export*************
+const (
+	InvalidCatalogFormat   = "invalid format %s, use csv or jsonl"
+	InvalidColumnMapping   = "invalid column mapping, send a JSON object from your column names to ours"
+	UnknownCatalogColumn   = "unknown column %s, map it to one of our columns or leave it out"
+	DuplicateCatalogColumn = "column %s is given more than once"
+	CatalogColumnRequired  = "column %s is required"
+	CatalogTooLarge        = "the catalog is larger than the %d bytes allowed"
+	CatalogFileRequired    = "no file uploaded, send the catalog in the file field"
+	CatalogReadError       = "unable to read the catalog: %v"
+	CatalogRowLimit        = "a catalog import can have up to %d rows"
+	CatalogEmpty           = "the catalog has no rows"
+	InvalidCatalogValue    = "invalid value %q"
+	CatalogFieldRequired   = "required for a new product"
+	CatalogSKURequired     = "a sku is required to match the row with a product"
+	ProductNameTaken       = "a product named %s already exists"
+	DuplicateCatalogSKU    = "sku %s is already on row %d"
+	ProductSKUDeleted      = "sku %s belongs to a deleted product"
+	ImportJobCreationError = "failed to start the import"
+	ImportJobNotFound      = "import job with ID %d not found"
+	ImportJobNotOwned      = "import job with ID %d belongs to another user"
+	InvalidImportJobID     = "invalid import job ID"
+	ImportJobFailed        = "import job with ID %d failed"
+	ImportRowWriteError    = "failed to save the product"
+	CatalogExportError     = "failed to export the catalog"
+)
+
+const (
+	ImportJobStarted = "import job with ID %d started, follow it at /product/import/%d"
+	ImportJobFetched = "import job with ID %d fetched successfully"
 )
 
 // Validation error messages
@@ -152,34 +486,148 @@ const (
 	UserIdNotFoundInToken      = "user ID not found in token"
 	UserIdNotFoundInCtx        = "user ID not found in context"
 	UserIdNotFoundInParam      = "user ID not found in param"
+	InvalidServiceToken        = "only the services can call this endpoint"
 )
 
 // ************* Cart **************
 // Errors
 const (
-	CartIdNotFoundError          = "cart with Id %d not found"
-	UserCartNotFoundError        = "cart not found for user with userId %d"
-	CartItemNotFoundError        = "cart item with cartId %d not found in cart"
-	CartItemAdditionError        = "failed to add item to cart"
-	CartItemUpdateError          = "error occurred while updating item in cart"
-	CartItemDeletionError        = "error occurred while deleting item from cart"
-	CartOutOfStockError          = "item with ID %d is out of stock"
-	InvalidCartRequest           = "invalid cart request"
-	CartInvalidProductError      = "invalid product for item with ID %d"
-	CartUnexpectedFetchError     = "unexpected error fetching cart data"
-	CartUnexpectedUpdateError    = "unexpected error updating cart data"
-	ErrorCallingCartMicroservice = "error occurred while calling cart microservice"
-	CartIdNotProvided            = "cart ID not provided"
+	CartIdNotFoundError           = "cart with Id %d not found"
+	UserCartNotFoundError         = "cart not found for user with userId %d"
+	CartItemNotFoundError         = "cart item with cartId %d not found in cart"
+	CartItemAdditionError         = "failed to add item to cart"
+	CartItemUpdateError           = "error occurred while updating item in cart"
+	CartItemDeletionError         = "error occurred while deleting item from cart"
+	CartOutOfStockError           = "item with ID %d is out of stock"
+	InvalidCartRequest            = "invalid cart request"
+	CartInvalidProductError       = "invalid product for item with ID %d"
+	CartUnexpectedFetchError      = "unexpected error fetching cart data"
+	CartUnexpectedUpdateError     = "unexpected error updating cart data"
+	ErrorCallingCartMicroservice  = "error occurred while calling cart microservice"
+	ErrorCallingOrderMicroservice = "error occurred while calling order microservice"
+	CartIdNotProvided             = "cart ID not provided"
+	CartDetailsUpdateError        = "failed to update cart details for user with ID %d"
+	CartCouponInvalid             = "coupon %s is not valid"
+	InvalidCartToken              = "invalid or tampered cart token"
+	GuestCartNotFoundError        = "guest cart not found"
+	GuestCartCreationError        = "failed to create guest cart"
+	CartMergeError                = "failed to merge guest cart into cart of user with ID %d"
+	CartMergeStrategyInvalid      = "cart merge strategy %s is not supported"
+	CartValidationError           = "failed to validate cart"
+	CartChangesNotAcknowledged    = "cart changed since items were added, acknowledge the changes before checkout"
+	CartBlockedByWarnings         = "cart has items which can't be checked out"
+	CartAcknowledgeError          = "failed to acknowledge cart changes"
+	CartAcknowledgeStale          = "price or discount of cart line %d changed again, review the cart before acknowledging"
+	CartCheckoutError             = "failed to check out cart with ID %d"
+	CartOrderRejected             = "order service rejected checkout of cart with ID %d"
+	CartCheckoutConfirmError      = "order %d placed but cart checkout %d could not be confirmed"
+	AbandonedCartCheckError       = "failed to check abandoned carts"
+	AbandonedCartReminderError    = "failed to send reminder for abandoned cart with ID %d"
+)
+
+// Cart validation warnings
+const (
+	CartPriceIncreased     = "price of product with ID %d went up from %.2f to %.2f"
+	CartPriceDecreased     = "price of product with ID %d went down from %.2f to %.2f"
+	CartDiscountExpired    = "discount of %.2f%% on product with ID %d has expired"
+	CartDiscountChanged    = "discount on product with ID %d changed from %.2f%% to %.2f%%"
+	CartProductDeleted     = "product with ID %d is no longer sold"
+	CartInsufficientStock  = "only %d of product with ID %d left in stock, %d in cart"
+	CartBelowMinQuantity   = "product with ID %d can only be ordered from %d units, %d requested"
+	CartAboveMaxQuantity   = "at most %d units of product with ID %d per order, %d requested"
+	CartInvalidQtyStep     = "product with ID %d is sold in packs of %d, %d requested"
+	CartCustomerLimit      = "at most %d units of product with ID %d per customer, %d already bought and %d requested"
+	CartBundlePriceUp      = "price of bundle with ID %d went up from %.2f to %.2f"
+	CartBundlePriceDown    = "price of bundle with ID %d went down from %.2f to %.2f"
+	CartBundleUnavailable  = "bundle with ID %d is no longer sold"
+	CartBundleNotInStock   = "only %d of bundle with ID %d left in stock, %d requested"
+	CartBundleNoWishlist   = "bundles can't be saved to a wishlist, cart item with ID %d is a bundle"
+	CartQuantityRuleError  = "quantity of cart item with ID %d breaks a rule of its product"
+	CartVariantRequired    = "product with ID %d is sold in variants, a variant_id is required"
+	CartVariantUnavailable = "variant with ID %d is no longer sold"
+	CartVariantNotInStock  = "only %d of variant with ID %d left in stock, %d requested"
+	CartVariantNoWishlist  = "variants can't be saved to a wishlist, cart item with ID %d is a variant"
 )
 
 // Info messages
 const (
-	CartClearedSuccessfully     = "cart cleared successfully for user with ID %d"
+	CartClearedSuccessfully     = "cart with ID %d cleared successfully"
 	CartFetchedSuccessfully     = "cart fetched successfully for user with ID %d"
 	CartItemAddedSuccessfully   = "item with ID %d added to cart successfully"
 	CartItemUpdatedSuccessfully = "item with ID %d updated in cart successfully"
 	CartItemDeletedSuccessfully = "item with ID %d removed from cart successfully"
 	CartCheckedOutSuccessfully  = "cart checked out successfully for user with ID %d"
+	CartDetailsUpdated          = "cart details updated successfully for user with ID %d"
+	GuestCartCreated            = "guest cart created successfully"
+	CartMergedSuccessfully      = "guest cart merged into cart of user with ID %d"
+	CartValidated               = "cart validated with %d warnings"
+	CartChangesAcknowledged     = "cart changes acknowledged"
+	AbandonedCartRemindersSent  = "%d abandoned cart reminders sent"
+)
+
+// ************* Wishlist **************
+// Errors
+const (
+	WishlistNotFoundError     = "wishlist with ID %d not found"
+	WishlistItemNotFoundError = "wishlist item with ID %d not found"
+	SharedWishlistNotFound    = "shared wishlist not found or no longer public"
+	WishlistNameRequired      = "wishlist name is required"
+	WishlistCreationError     = "failed to create wishlist"
+	WishlistUpdateError       = "failed to update wishlist with ID %d"
+	WishlistDeletionError     = "failed to delete wishlist with ID %d"
+	WishlistItemAdditionError = "failed to add product with ID %d to wishlist"
+	WishlistMoveError         = "failed to move item between cart and wishlist"
+	WishlistSavedListReadOnly = "the saved for later list can't be renamed, shared or deleted"
+	WishlistCheckError        = "failed to check wishlisted products"
+)
+
+// Info messages
+const (
+	WishlistsFetched        = "wishlists fetched successfully for user with ID %d"
+	WishlistFetched         = "wishlist with ID %d fetched successfully"
+	WishlistCreated         = "wishlist created successfully"
+	WishlistUpdated         = "wishlist with ID %d updated successfully"
+	WishlistDeleted         = "wishlist with ID %d deleted successfully"
+	WishlistItemAdded       = "product with ID %d added to wishlist"
+	WishlistItemRemoved     = "wishlist item with ID %d removed"
+	CartLineSavedForLater   = "cart item with ID %d saved for later"
+	CartLineMovedToWishlist = "cart item with ID %d moved to wishlist with ID %d"
+	WishlistItemMovedToCart = "wishlist item with ID %d moved to cart"
+	WishlistAlertsSent      = "wishlist alerts sent to %d users"
+)
+
+// ************* Cart sharing and quotes **************
+// Errors
+const (
+	SharedCartNotFound       = "shared cart not found or expired"
+	CartShareError           = "failed to share cart of user with ID %d"
+	CartEmptyError           = "cart is empty"
+	CartImportError          = "failed to import shared cart"
+	QuoteNotFoundError       = "quote with ID %d not found"
+	QuoteCreationError       = "failed to request a quote for cart of user with ID %d"
+	QuoteNoProductLines      = "only products can be quoted, the cart has none"
+	QuoteUpdateError         = "failed to update quote with ID %d"
+	QuoteNotPriced           = "quote with ID %d has not been priced yet"
+	QuoteNotOpen             = "quote with ID %d is %s and can't be changed"
+	QuoteExpired             = "quote with ID %d expired on %s"
+	QuotePriceMissing        = "every line of quote with ID %d needs a negotiated price above zero"
+	QuoteExpiryInPast        = "quote expiry has to be in the future"
+	QuoteStockUnavailable    = "stock for quote with ID %d is no longer available"
+	QuoteOrderRejected       = "order service rejected quote with ID %d"
+	QuoteAcceptConfirmError  = "order %d placed but quote %d could not be marked accepted"
+	InvalidQuoteStatusFilter = "quote status %s is not supported"
+	QuoteIdInvalid           = "quote id %s is invalid"
+)
+
+const (
+	CartShared        = "cart shared successfully"
+	SharedCartFetched = "shared cart fetched successfully"
+	QuoteRequested    = "quote with ID %d requested successfully"
+	QuotesFetched     = "%d quotes fetched successfully"
+	QuoteFetched      = "quote with ID %d fetched successfully"
+	QuotePriced       = "quote with ID %d priced successfully"
+	QuoteAccepted     = "quote with ID %d accepted, order %d placed"
+	QuoteRejected     = "quote with ID %d rejected"
 )
 
 // *************** Templates and Files ********************
@@ -200,10 +648,14 @@ const (
 // *************** Order *****************
 const (
 	OrderCreatedSuccessfully  = "order successfully created"
-	OrderFetchSuccess         = "order with orderId %s fetch successfully"
+	OrderSuccessful           = "order placed successfully"
+	OrderFetchSuccess         = "order with orderId %d fetch successfully"
 	OrderIdInvalid            = "order id %s is invalid"
 	OrderIdRequired           = "order id is required"
 	OrdersFetchedSuccessfully = "orders fetched successfully"
+	ProductPurchaseChecked    = "purchase of product with ID %d checked"
+	InvalidProductIdParam     = "product id %s is invalid"
+	OrderNotFound             = "order with ID %d not found"
 )
 
 const (
@@ -225,8 +677,61 @@ const (
 	PaymentStatusFailed     = "failed"
 	InvalidPaymentRequest   = "invalid payment request"
 	PaymentValidationFailed = "payment validation failed"
+	PaymentStatusRefunded   = "refunded"
+)
+
+// Split tender errors
+const (
+	PaymentMethodNotSupported   = "payment method %s is not supported"
+	PaymentTenderAmountMismatch = "sum of tenders %.2f does not match amount due %.2f"
+	PaymentTenderFailed         = "%s tender failed: %v"
+	PaymentRemainderFailed      = "refunded because the remaining tender failed"
+	PaymentRefundFailed         = "failed to refund payment with ID %d"
+	PaymentStatusUpdateError    = "failed to update status of payment with ID %d"
+	PaymentFetchError           = "failed to fetch payments for order with ID %d"
+	OrderAlreadyPaid            = "order with ID %d is already paid"
+	OrderPaymentIncomplete      = "order with ID %d is not fully paid"
+	CouponReleaseFailed         = "failed to release the coupon of order with ID %d"
+	QuoteReopenFailed           = "failed to reopen the quote of order with ID %d"
+	OrderCancelFailed           = "failed to mark order with ID %d cancelled"
+)
+
+// Cash on delivery
+const (
+	PaymentMethodCOD         = "cod"
+	CODOrderValueExceeded    = "cash on delivery is not available for orders above %.2f"
+	CODPaymentNotFound       = "no pending cash on delivery payment for order with ID %d"
+	CODCollectionError       = "failed to record cash on delivery collection for order with ID %d"
+	CODCollectedSuccessfully = "cash on delivery collected for order with ID %d"
+	InvalidWebhookSecret     = "invalid webhook secret"
+	DeliveryEventIgnored     = "delivery event %s ignored"
+	OrderPlacedWithCOD       = "order placed successfully, pay on delivery"
+	OrderNotCOD              = "order with ID %d is not a pending cash on delivery order"
+	CODOrderNotifyError      = "failed to tell the order service that order with ID %d was collected"
+	CODOrderMarkedPaid       = "cash on delivery order with ID %d marked paid"
+)
+
+// Gift card errors
+const (
+	GiftCardNotFound            = "gift card not found"
+	GiftCardCodeRequired        = "gift card code is required as tender reference"
+	GiftCardInactive            = "gift card %s is not active"
+	GiftCardExpired             = "gift card %s has expired"
+	GiftCardInsufficientBalance = "gift card %s has insufficient balance, available balance %.2f"
+	GiftCardCreationError       = "failed to create gift cards"
+	GiftCardBulkCountError      = "gift card count must be between 1 and %d"
+	GiftCardsAlreadyIssued      = "gift cards already issued for order with ID %d"
+	GiftCardPurchaseFailed      = "failed to issue purchased gift cards for order with ID %d"
+	OrderHasNoGiftCards         = "order with ID %d has no gift cards to issue"
+	OrderGiftCardLineInvalid    = "order with ID %d has an invalid gift card line"
+)
+
+const (
+	GiftCardsCreatedSuccessfully = "%d gift cards created successfully"
+	GiftCardFetchedSuccessfully  = "gift card fetched successfully"
 )
 
 const (
-	PaymentSuccessful = "payment successfully created"
+	PaymentSuccessful          = "payment successfully created"
+	PaymentFetchedSuccessfully = "payments fetched successfully for order with ID %d"
 )
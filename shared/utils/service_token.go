@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"net/http"
+	"os"
+)
+
+// ServiceTokenHeader carries the shared secret the services send when they call each other
+const ServiceTokenHeader = "X-Service-Token"
+
+// serviceToken is SERVICE_TOKEN of .env, endpoints meant for the services only stay closed while it is not set
+func serviceToken() string {
+	return os.Getenv("SERVICE_TOKEN")
+}
+
+// SetServiceToken marks an outgoing request as a call of one of the services
+func SetServiceToken(req *http.Request) {
+	req.Header.Set(ServiceTokenHeader, serviceToken())
+}
+
+// VerifyServiceToken tells whether the token is the shared secret of the services
+func VerifyServiceToken(token string) bool {
+	secret := serviceToken()
+	return secret != "" && hmac.Equal([]byte(secret), []byte(token))
+}
@@ -30,7 +30,7 @@ func main() {
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"X-Requested-With", "Content-Type", "Authorization"},
+		AllowedHeaders: []string{"X-Requested-With", "Content-Type", "Authorization", utils.CartTokenHeader},
 	})
 
 	r.Handle("/admin", middlewares.AuthMiddleware(middlewares.RoleMiddleware(db, "admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
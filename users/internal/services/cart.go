@@ -0,0 +1,31 @@
+package services
+
+import (
+	"e-commerce-backend/shared/utils"
+	"e-commerce-backend/users/pkg/constants"
+	"fmt"
+	"net/http"
+)
+
+// mergeGuestCart asks the cart service to move the guest cart into the cart of the user who just logged in
+func mergeGuestCart(token, cartToken string) error {
+	cartMicroserviceCall := utils.GetCartMicroserviceLink(constants.CartMicroserviceMerge)
+	req, err := http.NewRequest(http.MethodPost, cartMicroserviceCall, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request to microservice: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(utils.CartTokenHeader, cartToken)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to microservice: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("microservice responded with status code %d", resp.StatusCode)
+	}
+	return nil
+}
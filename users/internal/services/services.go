@@ -390,6 +390,13 @@ func (db *Service) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//shopper added items as guest before logging in, login must not fail because of the cart
+	if cartToken := r.Header.Get(utils.CartTokenHeader); cartToken != "" {
+		if err := mergeGuestCart(token, cartToken); err != nil {
+			utils.LogError(fmt.Sprintf(utils.CartMergeError, user.ID), map[string]interface{}{"error": err.Error()})
+		}
+	}
+
 	userResponse := models.CopyUserToUserResponse(user)
 	authResponse := models.UserAuthResponse{
 		Token: token,
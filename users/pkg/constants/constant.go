@@ -4,3 +4,5 @@ const (
 	PasswordReset     = 1
 	EmailVerification = 2
 )
+
+const CartMicroserviceMerge = "/merge"